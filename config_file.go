@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFile is the YAML configuration loaded with --config. Top-level keys
+// are flag names; the env section sets environment variables such as the
+// OTEL_*, PROMETHEUS_* and PYROSCOPE_* observability toggles.
+type configFile struct {
+	Options map[string]interface{} `yaml:",inline"`
+	Env     map[string]string      `yaml:"env"`
+}
+
+// configPathArg finds the --config path before flags are parsed, so the file
+// can be applied underneath them
+func configPathArg(args []string) string {
+	path := getEnv("BODS_CONFIG", "")
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			path = value
+		} else if i+1 < len(args) {
+			path = args[i+1]
+		}
+	}
+	return path
+}
+
+// applyConfigFile sets each flag in flags from the config file unless its
+// BODS_* environment variable is set, and sets each unset env variable. Flags
+// given on the command line are parsed afterwards, so they take precedence.
+func applyConfigFile(flags *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var config configFile
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	for name, value := range config.Env {
+		if os.Getenv(name) == "" {
+			os.Setenv(name, value)
+		}
+	}
+
+	for name, value := range config.Options {
+		if name == "config" || flags.Lookup(name) == nil {
+			return fmt.Errorf("unknown option %q in %s", name, path)
+		}
+		if os.Getenv(flagEnvName(name)) != "" {
+			continue
+		}
+		if err := flags.Set(name, configValue(value)); err != nil {
+			return fmt.Errorf("invalid value for %q in %s: %w", name, path, err)
+		}
+	}
+
+	return nil
+}
+
+// flagEnvName returns the environment variable backing a flag, e.g.
+// BODS_LINE_REFS for line-refs
+func flagEnvName(name string) string {
+	return "BODS_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// configValue formats a YAML value as a flag value: lists are joined with
+// commas and maps become comma-separated name=value pairs
+func configValue(value interface{}) string {
+	switch v := value.(type) {
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = configValue(item)
+		}
+		return strings.Join(items, ",")
+	case map[string]interface{}:
+		pairs := make([]string, 0, len(v))
+		for name, item := range v {
+			pairs = append(pairs, name+"="+configValue(item))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
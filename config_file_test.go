@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testConfigFile = `
+line-refs: [49x, "72@15s"]
+interval: 45s
+dry-run: true
+loki-labels:
+  region: south_west
+  env: prod
+env:
+  OTEL_SERVICE_NAME: bods2loki-config
+`
+
+// testFlags defines a few of main's flags the way main does, with BODS_*
+// environment variables as defaults
+func testFlags() *flag.FlagSet {
+	flags := flag.NewFlagSet("bods2loki", flag.ContinueOnError)
+	flags.String("config", "", "")
+	flags.String("line-refs", getEnv("BODS_LINE_REFS", "49x"), "")
+	flags.String("interval", getEnv("BODS_INTERVAL", "30s"), "")
+	flags.Bool("dry-run", false, "")
+	flags.String("loki-labels", getEnv("BODS_LOKI_LABELS", ""), "")
+	return flags
+}
+
+func TestConfigFilePrecedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		args     []string
+		lineRefs string
+		interval string
+		otelName string
+		dryRun   string
+	}{
+		{
+			name:     "config file only",
+			lineRefs: "49x,72@15s", interval: "45s", otelName: "bods2loki-config", dryRun: "true",
+		},
+		{
+			name:     "flag overrides config file",
+			args:     []string{"--line-refs=1,2", "--config", "bods2loki.yaml"},
+			lineRefs: "1,2", interval: "45s", otelName: "bods2loki-config", dryRun: "true",
+		},
+		{
+			name:     "env var overrides config file",
+			env:      map[string]string{"BODS_INTERVAL": "10s", "OTEL_SERVICE_NAME": "bods2loki-env"},
+			lineRefs: "49x,72@15s", interval: "10s", otelName: "bods2loki-env", dryRun: "true",
+		},
+		{
+			name:     "flag overrides env var",
+			env:      map[string]string{"BODS_INTERVAL": "10s"},
+			args:     []string{"--interval=5m", "--dry-run=false"},
+			lineRefs: "49x,72@15s", interval: "5m", otelName: "bods2loki-config", dryRun: "false",
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "bods2loki.yaml")
+	if err := os.WriteFile(path, []byte(testConfigFile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"BODS_LINE_REFS", "BODS_INTERVAL", "OTEL_SERVICE_NAME"} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			flags := testFlags()
+			if err := applyConfigFile(flags, path); err != nil {
+				t.Fatalf("applyConfigFile: %v", err)
+			}
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			for name, want := range map[string]string{"line-refs": tt.lineRefs, "interval": tt.interval, "dry-run": tt.dryRun} {
+				if got := flags.Lookup(name).Value.String(); got != want {
+					t.Errorf("--%s = %q, want %q", name, got, want)
+				}
+			}
+			if got := flags.Lookup("loki-labels").Value.String(); got != "env=prod,region=south_west" {
+				t.Errorf("--loki-labels = %q, want the map as sorted name=value pairs", got)
+			}
+			if got := os.Getenv("OTEL_SERVICE_NAME"); got != tt.otelName {
+				t.Errorf("OTEL_SERVICE_NAME = %q, want %q", got, tt.otelName)
+			}
+		})
+	}
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"unknown option", "line-ref: 49x\n"},
+		{"config option", "config: other.yaml\n"},
+		{"invalid value", "dry-run: sometimes\n"},
+		{"invalid YAML", "line-refs: [49x\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bods2loki.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyConfigFile(testFlags(), path); err == nil {
+				t.Errorf("applyConfigFile accepted %q", tt.content)
+			}
+		})
+	}
+
+	if err := applyConfigFile(testFlags(), filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("applyConfigFile accepted a missing file")
+	}
+}
+
+func TestConfigPathArg(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		args []string
+		want string
+	}{
+		{"none", "", []string{"--dry-run"}, ""},
+		{"separate value", "", []string{"--config", "a.yaml"}, "a.yaml"},
+		{"equals", "", []string{"-config=a.yaml", "--dry-run"}, "a.yaml"},
+		{"env var", "b.yaml", []string{"--dry-run"}, "b.yaml"},
+		{"flag over env var", "b.yaml", []string{"--config=a.yaml"}, "a.yaml"},
+		{"after terminator", "", []string{"--", "--config=a.yaml"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BODS_CONFIG", tt.env)
+			if got := configPathArg(tt.args); got != tt.want {
+				t.Errorf("configPathArg(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
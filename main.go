@@ -7,26 +7,104 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"bods2loki/pkg/bods"
+	"bods2loki/pkg/logging"
+	"bods2loki/pkg/metrics"
+	"bods2loki/pkg/parser"
 	"bods2loki/pkg/pipeline"
 	"bods2loki/pkg/profiling"
 	"bods2loki/pkg/tracing"
 )
 
+// diagnosticsFlushTimeout bounds how long an on-demand telemetry flush may take
+const diagnosticsFlushTimeout = 10 * time.Second
+
 func main() {
 	// Command line flags
 	var (
-		dryRun       = flag.Bool("dry-run", false, "Print data to stdout instead of sending to Loki")
-		apiKey       = flag.String("api-key", getEnv("BODS_API_KEY", ""), "BODS API key (required)")
-		datasetID    = flag.String("dataset-id", getEnv("BODS_DATASET_ID", "699"), "BODS dataset ID")
-		lineRefs     = flag.String("line-refs", getEnv("BODS_LINE_REFS", "49x"), "Bus line references, comma-separated")
-		lokiURL      = flag.String("loki-url", getEnv("BODS_LOKI_URL", "http://localhost:3100"), "Grafana Loki URL")
-		lokiUser     = flag.String("loki-user", getEnv("BODS_LOKI_USER", ""), "Loki username (for Grafana Cloud authentication)")
-		lokiPassword = flag.String("loki-password", getEnv("BODS_LOKI_PASSWORD", ""), "Loki password/token (for Grafana Cloud authentication)")
-		interval     = flag.String("interval", getEnv("BODS_INTERVAL", "30s"), "Polling interval")
+		dryRun         = flag.Bool("dry-run", false, "Print data to stdout instead of sending to Loki")
+		apiKey         = flag.String("api-key", getEnv("BODS_API_KEY", ""), "BODS API key (required)")
+		datasetID      = flag.String("dataset-id", getEnv("BODS_DATASET_ID", "699"), "BODS dataset ID")
+		lineRefs       = flag.String("line-refs", getEnv("BODS_LINE_REFS", "49x"), "Bus line references, comma-separated; append @interval to poll a line on its own schedule, e.g. 49x@15s")
+		lokiURL        = flag.String("loki-url", getEnv("BODS_LOKI_URL", "http://localhost:3100"), "Grafana Loki URL")
+		lokiUser       = flag.String("loki-user", getEnv("BODS_LOKI_USER", ""), "Loki username (for Grafana Cloud authentication)")
+		lokiPassword   = flag.String("loki-password", getEnv("BODS_LOKI_PASSWORD", ""), "Loki password/token (for Grafana Cloud authentication)")
+		interval       = flag.String("interval", getEnv("BODS_INTERVAL", "30s"), "Polling interval")
+		emitZero       = flag.Bool("emit-zero-values", isTrue(getEnv("BODS_EMIT_ZERO_VALUES", "false")), "Emit bearing/velocity as explicit zeros when the feed provides them")
+		splitOOO       = flag.Bool("split-out-of-order", isTrue(getEnv("BODS_SPLIT_OUT_OF_ORDER", "false")), "Send entries older than a stream's last push to a separate out_of_order stream")
+		dedupEntries   = flag.Bool("dedup-entries", isTrue(getEnv("BODS_DEDUP_ENTRIES", "false")), "Skip Loki entries identical to those sent in the previous push for the same stream")
+		osgbFields     = flag.String("osgb-fields", getEnv("BODS_OSGB_FIELDS", ""), "Feed fields holding OSGB36 easting,northing to convert to WGS84 (e.g. Easting,Northing)")
+		explain        = flag.String("explain-vehicle", getEnv("BODS_EXPLAIN_VEHICLE", ""), "Log every pipeline stage for this vehicle ref (e.g. FBRI-37330)")
+		dumpSample     = flag.String("dump-sample", getEnv("BODS_DUMP_SAMPLE", ""), "Directory to save each line's raw fetched XML to (for building test fixtures)")
+		proxyURL       = flag.String("proxy-url", getEnv("BODS_PROXY_URL", ""), "HTTP(S) proxy for BODS and Loki requests (default: use HTTP_PROXY/HTTPS_PROXY)")
+		earlyThreshold = flag.String("early-threshold", getEnv("BODS_EARLY_THRESHOLD", "1m"), "How far ahead of schedule a bus must be for delay_bucket=early")
+		lateThreshold  = flag.String("late-threshold", getEnv("BODS_LATE_THRESHOLD", "1m"), "Delay beyond which a bus is_late (delay_bucket=minor)")
+		majorThreshold = flag.String("major-delay-threshold", getEnv("BODS_MAJOR_DELAY_THRESHOLD", "5m"), "Delay beyond which delay_bucket=major")
+		redactFields   = flag.String("redact-fields", getEnv("BODS_REDACT_FIELDS", ""), "Identifier fields to hash or redact before logging and sending, comma-separated (vehicle_ref, block_ref)")
+		redactKey      = flag.String("redact-key", getEnv("BODS_REDACT_KEY", ""), "Key for hashing redacted fields; a random per-process key is used when unset")
+		queueOverlap   = flag.Bool("queue-overlapping-cycle", isTrue(getEnv("BODS_QUEUE_OVERLAPPING_CYCLE", "false")), "Queue at most one cycle when a tick fires while the previous cycle is still running, instead of skipping it")
+		monitoredOnly  = flag.Bool("monitored-only", isTrue(getEnv("BODS_MONITORED_ONLY", "false")), "Drop vehicles whose position the feed reports as not real-time (Monitored=false)")
+		sessionTag     = flag.String("session-tag", getEnv("BODS_SESSION_TAG", ""), "Tag entries with a per-process session_id: field, or label to also add it as a stream label")
+		minInterval    = flag.String("min-interval", getEnv("BODS_MIN_INTERVAL", "10s"), "Shortest polling interval accepted without --allow-fast-polling")
+		allowFast      = flag.Bool("allow-fast-polling", isTrue(getEnv("BODS_ALLOW_FAST_POLLING", "false")), "Allow a polling interval below --min-interval (risks the API key being banned)")
+		imageTheme     = flag.String("image-theme", getEnv("BODS_IMAGE_THEME", "light"), "Bus image color theme: light or dark")
+		includeRaw     = flag.Bool("include-raw", isTrue(getEnv("BODS_INCLUDE_RAW", "false")), "Keep the full decoded BODS response in memory alongside parsed vehicles (for debugging)")
+		normalizeTimes = flag.Bool("normalize-call-times", isTrue(getEnv("BODS_NORMALIZE_CALL_TIMES", "false")), "Rewrite MonitoredCall times as RFC3339 UTC, keeping originals in *_raw fields")
+		noMonitored    = flag.Bool("disable-monitored-call", isTrue(getEnv("BODS_DISABLE_MONITORED_CALL", "false")), "Skip parsing and emitting MonitoredCall (and is_late/delay_bucket)")
+		noOnward       = flag.Bool("disable-onward-calls", isTrue(getEnv("BODS_DISABLE_ONWARD_CALLS", "false")), "Skip parsing and emitting OnwardCalls")
+		qualityWts     = flag.String("quality-weights", getEnv("BODS_QUALITY_WEIGHTS", ""), "Weights for data_quality signals, e.g. monitored=2,coordinates=1,lag=1,freshness=1 (default: equal)")
+		maxFeedAge     = flag.String("max-feed-age", getEnv("BODS_MAX_FEED_AGE", ""), "Treat responses whose SIRI ResponseTimestamp is older than this as failed (e.g. 2m; default: no limit)")
+		cycleSummary   = flag.Bool("cycle-summary", isTrue(getEnv("BODS_CYCLE_SUMMARY", "false")), "Push a per-cycle summary entry to a service=summary Loki stream")
+		historyTTL     = flag.String("position-history-ttl", getEnv("BODS_POSITION_HISTORY_TTL", ""), "Keep recent positions per vehicle, forgetting vehicles unseen for this long (e.g. 15m; default: disabled)")
+		historySize    = flag.Int("position-history-size", getEnvInt("BODS_POSITION_HISTORY_SIZE", pipeline.DefaultPositionHistorySize), "Maximum number of vehicles kept in the position history")
+		recoverPanics  = flag.Bool("recover-panics", isTrue(getEnv("BODS_RECOVER_PANICS", "false")), "Mark a line as failed when processing it panics, instead of crashing the process")
+		lineRefLabel   = flag.Bool("line-ref-as-label", isTrue(getEnv("BODS_LINE_REF_AS_LABEL", "true")), "Use line_ref as a Loki stream label; when false all lines share one stream")
+		selfCheck      = flag.Bool("selfcheck", isTrue(getEnv("BODS_SELFCHECK", "false")), "Parse an embedded SIRI sample at startup and exit if the parser or image generator is broken")
+		intervalJitter = flag.String("interval-jitter", getEnv("BODS_INTERVAL_JITTER", ""), "Randomly vary each polling period by up to this much either way, e.g. 10% (default: none)")
+		compactSVG     = flag.Bool("compact-svg", isTrue(getEnv("BODS_COMPACT_SVG", "false")), "Minify bus image SVG markup (strip comments and whitespace) before base64 encoding")
+		stripFields    = flag.String("strip-fields", getEnv("BODS_STRIP_FIELDS", ""), "Entry fields to remove from every log line, comma-separated (e.g. bus_image,line_ref)")
+		strictScheme   = flag.Bool("strict-endpoint-scheme", isTrue(getEnv("BODS_STRICT_ENDPOINT_SCHEME", "false")), "Fail on OTLP endpoints without an http:// or https:// scheme, or whose insecure setting contradicts it, instead of warning")
+		timestampKey   = flag.String("timestamp-field", getEnv("BODS_TIMESTAMP_FIELD", "timestamp"), "JSON key for the timestamp in each log line (e.g. @timestamp, time)")
+		checkDataset   = flag.Bool("check-dataset", isTrue(getEnv("BODS_CHECK_DATASET", "false")), "Fetch the dataset metadata at startup, logging its coverage and exiting if the dataset ID is invalid")
+		maxLineBytes   = flag.Int("max-line-bytes", getEnvInt("BODS_MAX_LINE_BYTES", 0), "Trim or drop Loki log lines larger than this many bytes, e.g. Loki max_line_size (0 disables)")
+		maxPushBytes   = flag.Int("max-push-bytes", getEnvInt("BODS_MAX_PUSH_BYTES", 0), "Split Loki pushes larger than this many bytes into several requests (0 disables)")
+		fetchAttempts  = flag.Int("fetch-attempts", getEnvInt("BODS_FETCH_ATTEMPTS", 1), "Total attempts per BODS fetch, retrying 429/5xx and network errors with exponential backoff (1 disables retries)")
+		fetchDelay     = flag.String("fetch-retry-delay", getEnv("BODS_FETCH_RETRY_DELAY", "500ms"), "Initial backoff before retrying a failed BODS fetch, doubled for each further attempt")
+		lokiAttempts   = flag.Int("loki-attempts", getEnvInt("BODS_LOKI_ATTEMPTS", 1), "Total attempts per Loki push, retrying 429 (honouring Retry-After), 5xx and network errors (1 disables retries)")
+		gzipPushes     = flag.Bool("loki-gzip", isTrue(getEnv("BODS_LOKI_GZIP", "false")), "Gzip-compress Loki push bodies")
+		recordedTime   = flag.Bool("recorded-at-timestamps", isTrue(getEnv("BODS_RECORDED_AT_TIMESTAMPS", "false")), "Use each vehicle RecordedAtTime as its Loki timestamp instead of the ingestion time")
+		boundingBox    = flag.String("bounding-box", getEnv("BODS_BOUNDING_BOX", ""), "Only fetch vehicles within minLng,minLat,maxLng,maxLat")
+		lokiTenant     = flag.String("loki-tenant", getEnv("BODS_LOKI_TENANT", ""), "Loki tenant ID sent as X-Scope-OrgID for multi-tenant Loki")
+		lokiToken      = flag.String("loki-token", getEnv("BODS_LOKI_TOKEN", ""), "Loki bearer token; takes precedence over --loki-user/--loki-password")
+		maxConcurrency = flag.Int("max-concurrency", getEnvInt("BODS_MAX_CONCURRENCY", pipeline.DefaultMaxConcurrency), "Maximum number of lines fetched from BODS at once")
+		dedupWindow    = flag.String("dedup-window", getEnv("BODS_DEDUP_WINDOW", ""), "Skip vehicles whose report is unchanged since last sent within this window (e.g. 5m; default: disabled)")
+		situations     = flag.Bool("enable-situations", isTrue(getEnv("BODS_ENABLE_SITUATIONS", "false")), "Also poll the SIRI-SX disruptions feed and push new or updated situations to a stream=\"disruptions\" Loki stream")
+		lokiLabels     = flag.String("loki-labels", getEnv("BODS_LOKI_LABELS", ""), "Comma-separated name=value labels added to every Loki stream, e.g. region=north,env=prod")
+		reservedLabels = flag.Bool("allow-reserved-labels", isTrue(getEnv("BODS_ALLOW_RESERVED_LABELS", "false")), "Let --loki-labels replace the job, service and stream labels")
+		drainTimeout   = flag.String("drain-timeout", getEnv("BODS_DRAIN_TIMEOUT", "5s"), "On shutdown, how long the running cycle may keep sending data it already fetched")
+		locationBounds = flag.String("location-bounds", getEnv("BODS_LOCATION_BOUNDS", ""), "Treat positions outside this area as invalid: uk, or minLng,minLat,maxLng,maxLat")
+		dropBadCoords  = flag.Bool("drop-invalid-locations", isTrue(getEnv("BODS_DROP_INVALID_LOCATIONS", "false")), "Drop vehicles with invalid positions instead of flagging them with location_valid=false")
+		configPath     = flag.String("config", getEnv("BODS_CONFIG", ""), "YAML file of options, overridden by env vars and flags")
+		bodsTimeout    = flag.String("bods-timeout", getEnv("BODS_BODS_TIMEOUT", "30s"), "Timeout for each BODS API request")
+		lokiTimeout    = flag.String("loki-timeout", getEnv("BODS_LOKI_TIMEOUT", "30s"), "Timeout for each Loki push request")
+		dryRunFormat   = flag.String("dry-run-format", getEnv("BODS_DRY_RUN_FORMAT", "pretty"), "Dry run output: pretty, jsonl (one log line per line) or json (an array per cycle)")
+		lokiFormat     = flag.String("loki-format", getEnv("BODS_LOKI_FORMAT", "json"), "Loki push format: json or protobuf (snappy-compressed)")
+		busImageMode   = flag.String("bus-image-mode", getEnv("BODS_BUS_IMAGE_MODE", "compact"), "Bus image per vehicle: compact, badge or none (skip generation)")
+		once           = flag.Bool("once", isTrue(getEnv("BODS_ONCE", "false")), "Run a single fetch, parse and send cycle, then exit (non-zero if every line failed)")
+		operatorRef    = flag.String("operator-ref", getEnv("BODS_OPERATOR_REF", ""), "Only fetch vehicles run by this operator (e.g. FBRI)")
+		geojsonOut     = flag.String("geojson-out", getEnv("BODS_GEOJSON_OUT", ""), "Write each cycle's vehicles to this file as a GeoJSON FeatureCollection")
+		bodsHeaders    = flag.String("bods-headers", getEnv("BODS_BODS_HEADERS", ""), "Comma-separated name=value headers sent with every BODS request, e.g. X-Proxy-Auth=secret")
+		adaptiveIdle   = flag.String("adaptive-idle", getEnv("BODS_ADAPTIVE_IDLE", ""), "Slow polling, up to this interval, while no vehicles are returned (e.g. 10m; empty disables)")
+		cycleTimeout   = flag.String("cycle-timeout", getEnv("BODS_CYCLE_TIMEOUT", ""), "Maximum time for a whole fetch, parse and send cycle (default: twice the polling interval of the cycle's lines)")
+		maxRespBytes   = flag.Int("max-response-bytes", getEnvInt("BODS_MAX_RESPONSE_BYTES", bods.DefaultMaxResponseBytes), "Fail fetches whose response body is larger than this many bytes")
+		kafkaBrokers   = flag.String("kafka-brokers", getEnv("BODS_KAFKA_BROKERS", ""), "Comma-separated Kafka brokers to also publish each vehicle entry to")
+		kafkaTopic     = flag.String("kafka-topic", getEnv("BODS_KAFKA_TOPIC", ""), "Kafka topic for vehicle entries, required with --kafka-brokers")
+		otelLogs       = flag.Bool("otel-logs", isTrue(getEnv("BODS_OTEL_LOGS", "false")), "Also emit each vehicle as an OpenTelemetry log record through the OTLP logs exporter")
 	)
 
 	flag.Usage = func() {
@@ -45,6 +123,76 @@ func main() {
 		fmt.Fprintf(os.Stderr, "  BODS_LOKI_USER    - Loki username (for Grafana Cloud)\n")
 		fmt.Fprintf(os.Stderr, "  BODS_LOKI_PASSWORD - Loki password/token (for Grafana Cloud)\n")
 		fmt.Fprintf(os.Stderr, "  BODS_INTERVAL     - Polling interval (default: 30s)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_EMIT_ZERO_VALUES - Emit provided zero bearing/velocity (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_SPLIT_OUT_OF_ORDER - Split out-of-order entries into their own stream (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_DEDUP_ENTRIES - Skip entries identical to the previous push (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_OSGB_FIELDS  - OSGB36 easting,northing source fields to convert to WGS84\n")
+		fmt.Fprintf(os.Stderr, "  BODS_EXPLAIN_VEHICLE - Vehicle ref to trace through the pipeline\n")
+		fmt.Fprintf(os.Stderr, "  BODS_DUMP_SAMPLE  - Directory to save raw fetched XML to\n")
+		fmt.Fprintf(os.Stderr, "  BODS_PROXY_URL    - Proxy URL for BODS and Loki requests\n")
+		fmt.Fprintf(os.Stderr, "  BODS_EARLY_THRESHOLD - Ahead-of-schedule threshold for delay_bucket=early (default: 1m)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_LATE_THRESHOLD - Delay beyond which a bus is late (default: 1m)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_MAJOR_DELAY_THRESHOLD - Delay beyond which delay_bucket=major (default: 5m)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_REDACT_FIELDS - Fields to hash or redact (vehicle_ref, block_ref)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_REDACT_KEY   - Key used to hash redacted fields\n")
+		fmt.Fprintf(os.Stderr, "  BODS_QUEUE_OVERLAPPING_CYCLE - Queue one cycle instead of skipping overlapping ticks (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_MONITORED_ONLY - Drop vehicles reported as Monitored=false (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_SESSION_TAG  - Tag entries with a per-process session_id (field or label)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_MIN_INTERVAL - Shortest accepted polling interval (default: 10s)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_ALLOW_FAST_POLLING - Allow intervals below the minimum (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_IMAGE_THEME  - Bus image color theme, light or dark (default: light)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_INCLUDE_RAW  - Keep the full decoded response with parsed data (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_NORMALIZE_CALL_TIMES - Rewrite stop call times as RFC3339 UTC (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_DISABLE_MONITORED_CALL - Skip MonitoredCall parsing (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_DISABLE_ONWARD_CALLS - Skip OnwardCalls parsing (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_QUALITY_WEIGHTS - Weights for data_quality signals (default: equal)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_MAX_FEED_AGE - Reject responses with an older ResponseTimestamp (default: no limit)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_CYCLE_SUMMARY - Push a per-cycle summary entry to Loki (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_POSITION_HISTORY_TTL - How long to keep unseen vehicles in the position history (default: disabled)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_POSITION_HISTORY_SIZE - Maximum vehicles in the position history (default: 10000)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_RECOVER_PANICS - Recover from panics processing a line (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_LINE_REF_AS_LABEL - Use line_ref as a stream label (default: true)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_SELFCHECK    - Verify the parser on an embedded sample at startup (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_INTERVAL_JITTER - Random variation applied to each polling period, e.g. 10%%\n")
+		fmt.Fprintf(os.Stderr, "  BODS_COMPACT_SVG  - Minify bus image SVGs (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_STRIP_FIELDS - Entry fields to remove from log lines (e.g. bus_image,line_ref)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_STRICT_ENDPOINT_SCHEME - Fail on ambiguous Loki/OTLP endpoint schemes (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_TIMESTAMP_FIELD - JSON key for the entry timestamp (default: timestamp)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_CHECK_DATASET - Validate the dataset ID and log its coverage at startup (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_MAX_LINE_BYTES - Maximum Loki log line size in bytes (default: 0, unlimited)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_MAX_PUSH_BYTES - Maximum Loki push body size in bytes before splitting (default: 0, unlimited)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_FETCH_ATTEMPTS - Total attempts per BODS fetch (default: 1, no retries)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_FETCH_RETRY_DELAY - Initial backoff between BODS fetch attempts (default: 500ms)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_LOKI_ATTEMPTS - Total attempts per Loki push (default: 1, no retries)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_LOKI_GZIP    - Gzip-compress Loki push bodies (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_RECORDED_AT_TIMESTAMPS - Timestamp entries with RecordedAtTime (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_BOUNDING_BOX - Area to fetch vehicles from (minLng,minLat,maxLng,maxLat)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_LOKI_TENANT  - Loki tenant ID (X-Scope-OrgID)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_LOKI_TOKEN   - Loki bearer token (overrides user/password)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_MAX_CONCURRENCY - Maximum lines fetched at once (default: 8)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_DEDUP_WINDOW - Skip unchanged vehicles within this window (default: disabled)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_ENABLE_SITUATIONS - Also push SIRI-SX disruptions (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_LOKI_LABELS  - Extra Loki stream labels (name=value,...)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_ALLOW_RESERVED_LABELS - Let loki-labels replace job/service/stream (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_DRAIN_TIMEOUT - Time allowed to send in-flight data on shutdown (default: 5s)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_LOCATION_BOUNDS - Area valid positions must lie within (uk or a box)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_DROP_INVALID_LOCATIONS - Drop vehicles with invalid positions (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_CONFIG       - YAML configuration file\n")
+		fmt.Fprintf(os.Stderr, "  BODS_BODS_TIMEOUT - Timeout for each BODS API request (default: 30s)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_LOKI_TIMEOUT - Timeout for each Loki push request (default: 30s)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_DRY_RUN_FORMAT - Dry run output format: pretty, jsonl or json (default: pretty)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_LOKI_FORMAT - Loki push format: json or protobuf (default: json)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_BUS_IMAGE_MODE - Bus image per vehicle: compact, badge or none (default: compact)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_ONCE - Run a single cycle and exit (default: false)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_OPERATOR_REF - Only fetch vehicles run by this operator\n")
+		fmt.Fprintf(os.Stderr, "  BODS_GEOJSON_OUT - GeoJSON file to write each cycle's vehicles to\n")
+		fmt.Fprintf(os.Stderr, "  BODS_BODS_HEADERS - Extra headers for BODS requests (name=value,...)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_ADAPTIVE_IDLE - Maximum polling interval while no vehicles are returned\n")
+		fmt.Fprintf(os.Stderr, "  BODS_CYCLE_TIMEOUT - Maximum time for a whole cycle (default: twice the lines' polling interval)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_MAX_RESPONSE_BYTES - Maximum BODS response size in bytes (default: 52428800)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_KAFKA_BROKERS - Kafka brokers to publish vehicle entries to (comma-separated)\n")
+		fmt.Fprintf(os.Stderr, "  BODS_KAFKA_TOPIC - Kafka topic for vehicle entries\n")
+		fmt.Fprintf(os.Stderr, "  BODS_OTEL_LOGS - Also emit vehicles as OpenTelemetry log records (true/false)\n")
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "  # Dry run mode (safe for testing)\n")
 		fmt.Fprintf(os.Stderr, "  %s --dry-run --api-key=YOUR_API_KEY --line-refs=49x\n\n", os.Args[0])
@@ -56,8 +204,22 @@ func main() {
 		fmt.Fprintf(os.Stderr, "    --loki-user=123456 --loki-password=your_token\n\n")
 	}
 
+	// Apply the config file underneath env vars and command line flags
+	if path := configPathArg(os.Args[1:]); path != "" {
+		if err := applyConfigFile(flag.CommandLine, path); err != nil {
+			log.Fatalf("Invalid config file: %v", err)
+		}
+	}
+
 	flag.Parse()
 
+	if err := logging.InitLogging(); err != nil {
+		log.Fatalf("Failed to initialize logging: %v", err)
+	}
+	if *configPath != "" {
+		log.Printf("Loaded configuration from %s", *configPath)
+	}
+
 	// Validate required parameters
 	if *apiKey == "" {
 		fmt.Fprintf(os.Stderr, "Error: API key is required. Use --api-key or set BODS_API_KEY environment variable.\n\n")
@@ -71,19 +233,155 @@ func main() {
 		log.Fatalf("Invalid interval format: %v", err)
 	}
 
+	var cycleTimeoutDuration time.Duration
+	if *cycleTimeout != "" {
+		cycleTimeoutDuration, err = time.ParseDuration(*cycleTimeout)
+		if err != nil || cycleTimeoutDuration <= 0 {
+			log.Fatalf("Invalid cycle-timeout: %q", *cycleTimeout)
+		}
+	}
+
+	var adaptiveIdleMax time.Duration
+	if *adaptiveIdle != "" {
+		adaptiveIdleMax, err = time.ParseDuration(*adaptiveIdle)
+		if err != nil || adaptiveIdleMax < 0 {
+			log.Fatalf("Invalid adaptive-idle: %q", *adaptiveIdle)
+		}
+	}
+
+	jitterFraction, err := parseFraction(*intervalJitter)
+	if err != nil {
+		log.Fatalf("Invalid interval-jitter: %v", err)
+	}
+
+	fetchDelayDuration, err := time.ParseDuration(*fetchDelay)
+	if err != nil || fetchDelayDuration < 0 {
+		log.Fatalf("Invalid fetch-retry-delay: %q", *fetchDelay)
+	}
+
+	minIntervalDuration, err := time.ParseDuration(*minInterval)
+	if err != nil || minIntervalDuration <= 0 {
+		log.Fatalf("Invalid min-interval: %q", *minInterval)
+	}
+
+	// Parse delay thresholds
+	var delayThresholds parser.DelayThresholds
+	for _, threshold := range []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"early-threshold", *earlyThreshold, &delayThresholds.Early},
+		{"late-threshold", *lateThreshold, &delayThresholds.Late},
+		{"major-delay-threshold", *majorThreshold, &delayThresholds.Major},
+	} {
+		d, err := time.ParseDuration(threshold.value)
+		if err != nil || d < 0 {
+			log.Fatalf("Invalid %s: %q", threshold.name, threshold.value)
+		}
+		*threshold.dest = d
+	}
+
+	var maxFeedAgeDuration time.Duration
+	if *maxFeedAge != "" {
+		maxFeedAgeDuration, err = time.ParseDuration(*maxFeedAge)
+		if err != nil || maxFeedAgeDuration < 0 {
+			log.Fatalf("Invalid max-feed-age: %q", *maxFeedAge)
+		}
+	}
+
+	var historyTTLDuration time.Duration
+	if *historyTTL != "" {
+		historyTTLDuration, err = time.ParseDuration(*historyTTL)
+		if err != nil || historyTTLDuration < 0 {
+			log.Fatalf("Invalid position-history-ttl: %q", *historyTTL)
+		}
+	}
+
+	drainDuration, err := time.ParseDuration(*drainTimeout)
+	if err != nil || drainDuration <= 0 {
+		log.Fatalf("Invalid drain-timeout: %q", *drainTimeout)
+	}
+
+	bodsTimeoutDuration, err := time.ParseDuration(*bodsTimeout)
+	if err != nil || bodsTimeoutDuration <= 0 {
+		log.Fatalf("Invalid bods-timeout: %q", *bodsTimeout)
+	}
+	lokiTimeoutDuration, err := time.ParseDuration(*lokiTimeout)
+	if err != nil || lokiTimeoutDuration <= 0 {
+		log.Fatalf("Invalid loki-timeout: %q", *lokiTimeout)
+	}
+
+	var dedupDuration time.Duration
+	if *dedupWindow != "" {
+		dedupDuration, err = time.ParseDuration(*dedupWindow)
+		if err != nil || dedupDuration < 0 {
+			log.Fatalf("Invalid dedup-window: %q", *dedupWindow)
+		}
+	}
+
+	qualityWeights, err := parser.ParseQualityWeights(*qualityWts)
+	if err != nil {
+		log.Fatalf("Invalid quality-weights: %v", err)
+	}
+
 	// Parse line references
-	lineRefsList := strings.Split(*lineRefs, ",")
-	for i, ref := range lineRefsList {
-		lineRefsList[i] = strings.TrimSpace(ref)
+	lineRefsList, lineIntervals, err := parseLineRefs(parseList(*lineRefs))
+	if err != nil {
+		log.Fatalf("Invalid line-refs: %v", err)
+	}
+
+	// Parse OSGB source fields
+	var eastingField, northingField string
+	if *osgbFields != "" {
+		fields := strings.Split(*osgbFields, ",")
+		if len(fields) != 2 || strings.TrimSpace(fields[0]) == "" || strings.TrimSpace(fields[1]) == "" {
+			log.Fatalf("Invalid osgb-fields format: expected easting,northing field names, got %q", *osgbFields)
+		}
+		eastingField = strings.TrimSpace(fields[0])
+		northingField = strings.TrimSpace(fields[1])
+	}
+
+	// Parse redacted fields
+	redactFieldsList := parseList(*redactFields)
+
+	// Parse stripped entry fields
+	stripFieldsList := parseList(*stripFields)
+
+	// Parse extra Loki stream labels
+	extraLabels, err := parseLabels(parseList(*lokiLabels))
+	if err != nil {
+		log.Fatalf("Invalid loki-labels: %v", err)
+	}
+
+	// Parse extra BODS request headers
+	extraHeaders, err := parseLabels(parseList(*bodsHeaders))
+	if err != nil {
+		log.Fatalf("Invalid bods-headers: %v", err)
+	}
+
+	// Check the Loki URL scheme rather than let requests fail later
+	lokiEndpoint, err := normalizeLokiURL(*lokiURL)
+	if err != nil {
+		log.Fatalf("Invalid loki-url: %v", err)
 	}
 
 	// Initialize tracing
+	tracing.StrictEndpointScheme = *strictScheme
+	metrics.StrictEndpointScheme = *strictScheme
 	shutdownTracing, err := tracing.InitTracing()
 	if err != nil {
 		log.Fatalf("Failed to initialize tracing: %v", err)
 	}
 	defer shutdownTracing()
 
+	// Initialize metrics
+	shutdownMetrics, err := metrics.InitMetrics()
+	if err != nil {
+		log.Fatalf("Failed to initialize metrics: %v", err)
+	}
+	defer shutdownMetrics()
+
 	// Initialize profiling
 	shutdownProfiling, err := profiling.InitProfiling()
 	if err != nil {
@@ -93,14 +391,79 @@ func main() {
 
 	// Create pipeline configuration
 	config := pipeline.Config{
-		DryRun:       *dryRun,
-		APIKey:       *apiKey,
-		DatasetID:    *datasetID,
-		LineRefs:     lineRefsList,
-		LokiURL:      *lokiURL,
-		LokiUser:     *lokiUser,
-		LokiPassword: *lokiPassword,
-		Interval:     intervalDuration,
+		DryRun:                *dryRun,
+		APIKey:                *apiKey,
+		DatasetID:             *datasetID,
+		LineRefs:              lineRefsList,
+		LokiURL:               lokiEndpoint,
+		LokiUser:              *lokiUser,
+		LokiPassword:          *lokiPassword,
+		Interval:              intervalDuration,
+		DumpSampleDir:         *dumpSample,
+		EmitZeroValues:        *emitZero,
+		SplitOutOfOrder:       *splitOOO,
+		OSGBEastingField:      eastingField,
+		OSGBNorthingField:     northingField,
+		ExplainVehicle:        *explain,
+		DedupEntries:          *dedupEntries,
+		ProxyURL:              *proxyURL,
+		DelayThresholds:       delayThresholds,
+		RedactFields:          redactFieldsList,
+		RedactKey:             *redactKey,
+		QueueOverlappingCycle: *queueOverlap,
+		MonitoredOnly:         *monitoredOnly,
+		SessionTag:            *sessionTag,
+		MinInterval:           minIntervalDuration,
+		AllowFastPolling:      *allowFast,
+		ImageTheme:            *imageTheme,
+		IncludeRaw:            *includeRaw,
+		NormalizeCallTimes:    *normalizeTimes,
+		DisableMonitoredCall:  *noMonitored,
+		DisableOnwardCalls:    *noOnward,
+		QualityWeights:        qualityWeights,
+		MaxFeedAge:            maxFeedAgeDuration,
+		CycleSummary:          *cycleSummary,
+		PositionHistoryTTL:    historyTTLDuration,
+		PositionHistorySize:   *historySize,
+		RecoverPanics:         *recoverPanics,
+		DisableLineRefLabel:   !*lineRefLabel,
+		IntervalJitter:        jitterFraction,
+		CompactSVG:            *compactSVG,
+		StripFields:           stripFieldsList,
+		TimestampField:        *timestampKey,
+		MaxLineBytes:          *maxLineBytes,
+		MaxPushBytes:          *maxPushBytes,
+		FetchAttempts:         *fetchAttempts,
+		FetchRetryDelay:       fetchDelayDuration,
+		LokiAttempts:          *lokiAttempts,
+		CompressPushes:        *gzipPushes,
+		RecordedAtTimestamps:  *recordedTime,
+		BoundingBox:           *boundingBox,
+		LokiTenant:            *lokiTenant,
+		LokiToken:             *lokiToken,
+		LineIntervals:         lineIntervals,
+		MaxConcurrency:        *maxConcurrency,
+		DedupWindow:           dedupDuration,
+		EnableSituations:      *situations,
+		LokiLabels:            extraLabels,
+		AllowReservedLabels:   *reservedLabels,
+		DrainTimeout:          drainDuration,
+		LocationBounds:        *locationBounds,
+		DropInvalidLocations:  *dropBadCoords,
+		BODSTimeout:           bodsTimeoutDuration,
+		LokiTimeout:           lokiTimeoutDuration,
+		DryRunFormat:          *dryRunFormat,
+		LokiFormat:            *lokiFormat,
+		BusImageMode:          *busImageMode,
+		OperatorRef:           *operatorRef,
+		GeoJSONOut:            *geojsonOut,
+		BODSHeaders:           extraHeaders,
+		AdaptiveIdleMax:       adaptiveIdleMax,
+		CycleTimeout:          cycleTimeoutDuration,
+		MaxResponseBytes:      int64(*maxRespBytes),
+		KafkaBrokers:          parseList(*kafkaBrokers),
+		KafkaTopic:            *kafkaTopic,
+		OTelLogs:              *otelLogs,
 	}
 
 	// Create pipeline
@@ -109,16 +472,38 @@ func main() {
 		log.Fatalf("Failed to create pipeline: %v", err)
 	}
 
+	if *selfCheck {
+		if err := pipelineInstance.SelfCheck(context.Background()); err != nil {
+			log.Fatalf("Self-check failed: %v", err)
+		}
+		log.Printf("Self-check passed")
+	}
+
+	if *checkDataset {
+		if err := pipelineInstance.CheckDataset(context.Background()); err != nil {
+			log.Fatalf("Dataset check failed: %v", err)
+		}
+	}
+
 	// Print startup information
 	if *dryRun {
 		log.Printf("Starting BODS to Loki pipeline in DRY RUN mode")
 		log.Printf("Data will be printed to stdout, not sent to Loki")
 	} else {
 		log.Printf("Starting BODS to Loki pipeline in PRODUCTION mode")
-		log.Printf("Data will be sent to Loki at: %s", *lokiURL)
+		log.Printf("Data will be sent to Loki at: %s", lokiEndpoint)
 	}
 	log.Printf("Monitoring lines: %v", lineRefsList)
 	log.Printf("Polling interval: %v", intervalDuration)
+	if *explain != "" {
+		log.Printf("Explaining pipeline stages for vehicle: %s", *explain)
+	}
+	if id := pipelineInstance.SessionID(); id != "" {
+		log.Printf("Session ID: %s", id)
+	}
+	if *dumpSample != "" {
+		log.Printf("Raw XML samples will be saved to: %s", *dumpSample)
+	}
 
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
@@ -128,6 +513,37 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// Run a single cycle and exit, e.g. from a Kubernetes CronJob
+	if *once {
+		go func() {
+			sig := <-sigChan
+			log.Printf("Received signal %v, finishing the cycle...", sig)
+			cancel()
+		}()
+
+		err := pipelineInstance.RunCycle(ctx)
+		closePipeline(pipelineInstance)
+		if err != nil {
+			log.Printf("Failed to run cycle: %v", err)
+			// os.Exit skips deferred calls, so flush telemetry first
+			shutdownProfiling()
+			shutdownMetrics()
+			shutdownTracing()
+			os.Exit(1)
+		}
+		log.Println("Cycle complete, exiting")
+		return
+	}
+
+	// Run an extra cycle and flush telemetry on SIGUSR1 (where supported)
+	diagChan := make(chan os.Signal, 1)
+	notifyDiagnostics(diagChan)
+	go func() {
+		for range diagChan {
+			handleDiagnosticsSignal(ctx, pipelineInstance)
+		}
+	}()
+
 	// Start pipeline in goroutine
 	errChan := make(chan error, 1)
 	go func() {
@@ -139,14 +555,16 @@ func main() {
 	case sig := <-sigChan:
 		log.Printf("Received signal %v, shutting down gracefully...", sig)
 		cancel()
-		// Wait a bit for graceful shutdown
+		// Let the running cycle drain, with a little longer to wind down
 		select {
-		case <-time.After(5 * time.Second):
+		case <-time.After(drainDuration + 5*time.Second):
 			log.Println("Shutdown timeout, forcing exit")
 		case <-errChan:
 			log.Println("Pipeline stopped")
+			closePipeline(pipelineInstance)
 		}
 	case err := <-errChan:
+		closePipeline(pipelineInstance)
 		if err != nil && err != context.Canceled {
 			log.Fatalf("Pipeline error: %v", err)
 		}
@@ -156,6 +574,35 @@ func main() {
 	log.Println("BODS to Loki pipeline shutdown complete")
 }
 
+// closePipeline flushes and closes the pipeline's sinks once it has stopped,
+// so buffered output such as Kafka messages isn't lost on exit
+func closePipeline(p *pipeline.Pipeline) {
+	if err := p.Close(); err != nil {
+		log.Printf("Failed to close sinks: %v", err)
+	}
+}
+
+// handleDiagnosticsSignal runs one out-of-band cycle and force-flushes telemetry
+func handleDiagnosticsSignal(ctx context.Context, p *pipeline.Pipeline) {
+	log.Println("Received diagnostics signal, running an immediate cycle")
+
+	if err := p.TriggerCycle(ctx); err != nil {
+		log.Printf("On-demand cycle: %v", err)
+	}
+
+	flushCtx, cancel := context.WithTimeout(ctx, diagnosticsFlushTimeout)
+	defer cancel()
+
+	if err := tracing.ForceFlush(flushCtx); err != nil {
+		log.Printf("Error flushing traces: %v", err)
+	}
+	if err := metrics.ForceFlush(flushCtx); err != nil {
+		log.Printf("Error flushing metrics: %v", err)
+	}
+
+	log.Println("Diagnostics flush complete")
+}
+
 // getEnv returns the value of an environment variable or a default value if not set
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -163,3 +610,105 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// parseFraction parses a fraction given either as a percentage ("10%") or a
+// decimal ("0.1"); an empty string is zero
+func parseFraction(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	if pct, ok := strings.CutSuffix(s, "%"); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(pct), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid percentage %q", s)
+		}
+		return f / 100, nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid fraction %q", s)
+	}
+	return f, nil
+}
+
+// parseList splits a comma-separated option, trimming each item and dropping
+// empty ones so inputs like ",,49x," yield just [49x]
+func parseList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseLabels parses "name=value" items into a map, e.g. of labels or headers
+func parseLabels(items []string) (map[string]string, error) {
+	labels := make(map[string]string, len(items))
+	for _, item := range items {
+		name, value, ok := strings.Cut(item, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" || value == "" {
+			return nil, fmt.Errorf("expected name=value, got %q", item)
+		}
+		labels[name] = value
+	}
+	return labels, nil
+}
+
+// parseLineRefs splits optional per-line intervals off line refs given as
+// "ref@interval", e.g. "49x@15s", and errors if there are no refs at all
+func parseLineRefs(items []string) ([]string, map[string]time.Duration, error) {
+	if len(items) == 0 {
+		return nil, nil, fmt.Errorf("no line references given")
+	}
+	refs := make([]string, 0, len(items))
+	intervals := make(map[string]time.Duration)
+	for _, item := range items {
+		ref, intervalStr, hasInterval := strings.Cut(item, "@")
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			return nil, nil, fmt.Errorf("missing line reference in %q", item)
+		}
+		refs = append(refs, ref)
+
+		if hasInterval {
+			interval, err := time.ParseDuration(strings.TrimSpace(intervalStr))
+			if err != nil || interval <= 0 {
+				return nil, nil, fmt.Errorf("invalid interval for line %s: %q", ref, intervalStr)
+			}
+			intervals[ref] = interval
+		}
+	}
+	return refs, intervals, nil
+}
+
+// normalizeLokiURL rejects a Loki URL without an http:// or https:// scheme
+// rather than guess which one the server speaks
+func normalizeLokiURL(raw string) (string, error) {
+	if strings.HasPrefix(raw, "http://") || strings.HasPrefix(raw, "https://") {
+		return raw, nil
+	}
+	return "", fmt.Errorf("%q has no http:// or https:// scheme", raw)
+}
+
+// getEnvInt returns the integer value of an environment variable or a default
+// value if not set or not a valid integer
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+// isTrue checks if a string represents a true value
+func isTrue(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return s == "true" || s == "1" || s == "yes" || s == "on"
+}
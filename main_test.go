@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"bods2loki/pkg/bods"
+	"bods2loki/pkg/pipeline"
+)
+
+func TestParseLineRefs(t *testing.T) {
+	tests := []struct {
+		name      string
+		items     []string
+		refs      []string
+		intervals map[string]time.Duration
+		wantErr   bool
+	}{
+		{
+			name:      "plain refs",
+			items:     []string{"49x", "72"},
+			refs:      []string{"49x", "72"},
+			intervals: map[string]time.Duration{},
+		},
+		{
+			name:      "per-line interval",
+			items:     []string{"49x@30s", "72", " 1 @ 2m "},
+			refs:      []string{"49x", "72", "1"},
+			intervals: map[string]time.Duration{"49x": 30 * time.Second, "1": 2 * time.Minute},
+		},
+		{name: "missing ref", items: []string{"@30s"}, wantErr: true},
+		{name: "no refs", items: nil, wantErr: true},
+		{name: "invalid interval", items: []string{"49x@soon"}, wantErr: true},
+		{name: "zero interval", items: []string{"49x@0s"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refs, intervals, err := parseLineRefs(tt.items)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseLineRefs(%q) succeeded, want an error", tt.items)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseLineRefs(%q): %v", tt.items, err)
+			}
+			if !reflect.DeepEqual(refs, tt.refs) {
+				t.Errorf("refs = %q, want %q", refs, tt.refs)
+			}
+			if !reflect.DeepEqual(intervals, tt.intervals) {
+				t.Errorf("intervals = %v, want %v", intervals, tt.intervals)
+			}
+		})
+	}
+}
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"single", "49x", []string{"49x"}},
+		{"trimmed", " 49x , 72 ", []string{"49x", "72"}},
+		{"leading and trailing empties", ",,49x,", []string{"49x"}},
+		{"embedded empties", "49x,, ,72", []string{"49x", "72"}},
+		{"empty", "", nil},
+		{"only separators", " , ,, ", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseList(tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseList(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+
+	// An all-empty --line-refs is rejected rather than polling nothing
+	if _, _, err := parseLineRefs(parseList(",, ,")); err == nil {
+		t.Error("parseLineRefs accepted a line-refs list with no refs")
+	}
+}
+
+// countingFetcher serves one vehicle per line, counting fetches
+type countingFetcher struct {
+	fetches atomic.Int32
+}
+
+func (f *countingFetcher) FetchBusData(ctx context.Context, lineRef string) (*bods.BusData, error) {
+	f.fetches.Add(1)
+	return &bods.BusData{
+		XMLData: `<?xml version="1.0" encoding="UTF-8"?>
+<Siri xmlns="http://www.siri.org.uk/siri" version="2.0"><ServiceDelivery><VehicleMonitoringDelivery><VehicleActivity>
+<RecordedAtTime>2025-10-09T15:37:34+00:00</RecordedAtTime><MonitoredVehicleJourney>
+<LineRef>49x</LineRef><DirectionRef>inbound</DirectionRef><VehicleRef>bus-1</VehicleRef>
+<VehicleLocation><Longitude>-2.480741</Longitude><Latitude>51.495853</Latitude></VehicleLocation>
+</MonitoredVehicleJourney></VehicleActivity></VehicleMonitoringDelivery></ServiceDelivery></Siri>`,
+		ContentType: "application/xml",
+		Timestamp:   time.Now(),
+		LineRef:     lineRef,
+	}, nil
+}
+
+func TestHandleDiagnosticsSignalRunsCycle(t *testing.T) {
+	fetcher := &countingFetcher{}
+	sink := pipeline.NewMemorySink()
+	p, err := pipeline.New(pipeline.Config{LineRefs: []string{"49x"}, Interval: time.Hour},
+		pipeline.WithFetcher(fetcher), pipeline.WithSink("memory", sink))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	handleDiagnosticsSignal(context.Background(), p)
+
+	if got := fetcher.fetches.Load(); got != 1 {
+		t.Errorf("got %d fetches, want one extra cycle", got)
+	}
+	if got := len(sink.Records()); got != 1 {
+		t.Errorf("sink received %d lines, want 1", got)
+	}
+}
+
+func TestNormalizeLokiURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{"http", "http://loki:3100", "http://loki:3100", false},
+		{"https", "https://logs.example.com", "https://logs.example.com", false},
+		{"scheme-less", "loki:3100", "", true},
+		{"scheme-less host", "logs.example.com", "", true},
+		{"other scheme", "ftp://loki:3100", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeLokiURL(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeLokiURL error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeLokiURL(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"labels", "region=south_west, env = prod", map[string]string{"region": "south_west", "env": "prod"}, false},
+		{"empty", "", map[string]string{}, false},
+		{"value with equals", "query=a=b", map[string]string{"query": "a=b"}, false},
+		{"missing value", "region=", nil, true},
+		{"missing name", "=prod", nil, true},
+		{"no separator", "region", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLabels(parseList(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLabels(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseLabels(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTrue(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"true", true},
+		{" TRUE ", true},
+		{"1", true},
+		{"yes", true},
+		{"on", true},
+		{"false", false},
+		{"0", false},
+		{"", false},
+		{"enabled", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := isTrue(tt.input); got != tt.want {
+				t.Errorf("isTrue(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
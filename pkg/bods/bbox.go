@@ -0,0 +1,61 @@
+package bods
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BoundingBox limits a datafeed query to vehicles within an area
+type BoundingBox struct {
+	MinLongitude float64
+	MinLatitude  float64
+	MaxLongitude float64
+	MaxLatitude  float64
+}
+
+// ParseBoundingBox parses "minLng,minLat,maxLng,maxLat"
+func ParseBoundingBox(s string) (BoundingBox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return BoundingBox{}, fmt.Errorf("invalid bounding box %q: expected minLng,minLat,maxLng,maxLat", s)
+	}
+
+	var values [4]float64
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return BoundingBox{}, fmt.Errorf("invalid bounding box %q: %q is not a number", s, part)
+		}
+		values[i] = f
+	}
+
+	box := BoundingBox{values[0], values[1], values[2], values[3]}
+	if box.MinLongitude >= box.MaxLongitude || box.MinLatitude >= box.MaxLatitude {
+		return BoundingBox{}, fmt.Errorf("invalid bounding box %q: minimums must be below maximums", s)
+	}
+	return box, nil
+}
+
+// String formats the box as the datafeed API's boundingBox parameter
+func (b BoundingBox) String() string {
+	return strings.Join([]string{
+		strconv.FormatFloat(b.MinLongitude, 'f', -1, 64),
+		strconv.FormatFloat(b.MinLatitude, 'f', -1, 64),
+		strconv.FormatFloat(b.MaxLongitude, 'f', -1, 64),
+		strconv.FormatFloat(b.MaxLatitude, 'f', -1, 64),
+	}, ",")
+}
+
+// WithBoundingBox only fetches vehicles within box
+func WithBoundingBox(box BoundingBox) Option {
+	return func(c *Client) {
+		c.boundingBox = &box
+	}
+}
+
+// Contains reports whether a position lies within the box
+func (b BoundingBox) Contains(latitude, longitude float64) bool {
+	return longitude >= b.MinLongitude && longitude <= b.MaxLongitude &&
+		latitude >= b.MinLatitude && latitude <= b.MaxLatitude
+}
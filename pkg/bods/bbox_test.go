@@ -0,0 +1,93 @@
+package bods
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseBoundingBox(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    BoundingBox
+		wantErr bool
+	}{
+		{"bristol", "-2.7,51.4,-2.5,51.5", BoundingBox{-2.7, 51.4, -2.5, 51.5}, false},
+		{"spaces", " -2.7, 51.4 ,-2.5,51.5 ", BoundingBox{-2.7, 51.4, -2.5, 51.5}, false},
+		{"too few values", "-2.7,51.4,-2.5", BoundingBox{}, true},
+		{"not a number", "-2.7,north,-2.5,51.5", BoundingBox{}, true},
+		{"minimum above maximum", "-2.5,51.4,-2.7,51.5", BoundingBox{}, true},
+		{"empty area", "-2.7,51.4,-2.7,51.5", BoundingBox{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBoundingBox(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBoundingBox(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseBoundingBox(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBoundingBoxContains(t *testing.T) {
+	box := BoundingBox{-2.7, 51.4, -2.5, 51.5}
+
+	tests := []struct {
+		name                string
+		latitude, longitude float64
+		want                bool
+	}{
+		{"inside", 51.45, -2.6, true},
+		{"on the edge", 51.4, -2.7, true},
+		{"too far north", 51.6, -2.6, false},
+		{"too far east", 51.45, -2.4, false},
+		{"coordinates swapped", -2.6, 51.45, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := box.Contains(tt.latitude, tt.longitude); got != tt.want {
+				t.Errorf("Contains(%v, %v) = %v, want %v", tt.latitude, tt.longitude, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchBoundingBoxQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{"no bounding box", nil, ""},
+		{"bounding box", []Option{WithBoundingBox(BoundingBox{-2.7, 51.4, -2.5, 51.5})}, "-2.7,51.4,-2.5,51.5"},
+		{"precise bounding box", []Option{WithBoundingBox(BoundingBox{-2.480741, 51.495853, -2.4, 51.6})}, "-2.480741,51.495853,-2.4,51.6"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, server := newFakeBODS(t)
+			client := NewClient("test-key", "", tt.opts...)
+			client.baseURL = server.URL + "/api/v1/datafeed/"
+
+			if _, err := client.FetchBusData(context.Background(), "49x"); err != nil {
+				t.Fatalf("FetchBusData: %v", err)
+			}
+
+			query := fake.received()[0].URL.Query()
+			if got := query.Get("boundingBox"); got != tt.want {
+				t.Errorf("boundingBox = %q, want %q", got, tt.want)
+			}
+			if _, ok := query["boundingBox"]; ok != (tt.want != "") {
+				t.Errorf("boundingBox present = %v, want %v", ok, tt.want != "")
+			}
+			if got := query.Get("lineRef"); got != "49x" {
+				t.Errorf("lineRef = %q, want 49x alongside the bounding box", got)
+			}
+		})
+	}
+}
@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 
+	"bods2loki/pkg/metrics"
+	"bods2loki/pkg/retry"
+
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -22,29 +26,161 @@ type Client struct {
 	apiKey     string
 	baseURL    string
 	tracer     trace.Tracer
+
+	proxyURL    *url.URL
+	retryPolicy retry.Policy
+	timeout     time.Duration
+
+	datasetInfoURL string
+	situationsURL  string
+	boundingBox    *BoundingBox
+	operatorRef    string
+	headers        map[string]string
+
+	maxResponseBytes int64
+}
+
+// StatusError is returned when the API responds with a non-200 status
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// DefaultMaxResponseBytes bounds response bodies when no limit is configured
+const DefaultMaxResponseBytes = 50 << 20
+
+// maxErrorBodyBytes bounds the response body kept in a StatusError
+const maxErrorBodyBytes = 1024
+
+// newStatusError builds a StatusError, truncating body so an enormous error
+// page doesn't end up in logs and spans
+func newStatusError(statusCode int, body []byte) *StatusError {
+	snippet := string(body)
+	if len(body) > maxErrorBodyBytes {
+		snippet = string(body[:maxErrorBodyBytes]) + "...(truncated)"
+	}
+	return &StatusError{StatusCode: statusCode, Body: snippet}
+}
+
+// ResponseTooLargeError is returned when a response body exceeds the
+// client's size limit
+type ResponseTooLargeError struct {
+	Limit int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("response body exceeds the %d byte limit", e.Limit)
+}
+
+// WithMaxResponseBytes rejects response bodies larger than maxBytes, so a
+// malformed or enormous response can't exhaust memory
+func WithMaxResponseBytes(maxBytes int64) Option {
+	return func(c *Client) {
+		c.maxResponseBytes = maxBytes
+	}
+}
+
+// Option configures optional Client behaviour
+type Option func(*Client)
+
+// WithProxy routes requests through the given proxy. When unset, the
+// HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables are honoured.
+func WithProxy(proxyURL *url.URL) Option {
+	return func(c *Client) {
+		c.proxyURL = proxyURL
+	}
 }
 
 type BusData struct {
-	XMLData   string
-	Timestamp time.Time
-	LineRef   string
+	// XMLData holds the raw response body, which is JSON when ContentType says so
+	XMLData     string
+	ContentType string
+	Timestamp   time.Time
+	LineRef     string
 }
 
-func NewClient(apiKey, datasetID string) *Client {
-	// Create HTTP client with OpenTelemetry instrumentation
-	client := &http.Client{
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
-		Timeout:   30 * time.Second,
+// DefaultTimeout bounds each request when no timeout is configured
+const DefaultTimeout = 30 * time.Second
+
+// WithTimeout sets the overall timeout for each of the client's requests to the BODS API
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithOperatorRef only fetches vehicles run by the given operator, for
+// datasets covering several operators
+func WithOperatorRef(operatorRef string) Option {
+	return func(c *Client) {
+		c.operatorRef = operatorRef
+	}
+}
+
+// WithHeaders sends extra headers with every request, e.g. to authenticate
+// with a proxy. They are set after the client's own, so a User-Agent or
+// Accept given here replaces the default.
+func WithHeaders(headers map[string]string) Option {
+	return func(c *Client) {
+		c.headers = headers
 	}
+}
+
+// setHeaders applies the configured extra headers to req
+func (c *Client) setHeaders(req *http.Request) {
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
+}
 
+// WithRetryPolicy retries failed fetches according to policy
+func WithRetryPolicy(policy retry.Policy) Option {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+func NewClient(apiKey, datasetID string, opts ...Option) *Client {
 	baseURL := fmt.Sprintf(BaseURLTemplate, datasetID)
 
-	return &Client{
-		httpClient: client,
-		apiKey:     apiKey,
-		baseURL:    baseURL,
-		tracer:     otel.Tracer("bods-client"),
+	c := &Client{
+		apiKey:      apiKey,
+		baseURL:     baseURL,
+		tracer:      otel.Tracer("bods-client"),
+		retryPolicy: retry.NoRetry,
+		timeout:     DefaultTimeout,
+
+		maxResponseBytes: DefaultMaxResponseBytes,
+
+		datasetInfoURL: fmt.Sprintf(DatasetInfoURLTemplate, datasetID),
+		situationsURL:  SituationsURL,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	// Create HTTP client with OpenTelemetry instrumentation
+	c.httpClient = &http.Client{
+		Transport: otelhttp.NewTransport(newTransport(c.proxyURL)),
+		Timeout:   c.timeout,
+	}
+
+	return c
+}
+
+// newTransport clones the default transport, keeping its environment-based
+// proxy handling unless an explicit proxy is configured
+func newTransport(proxyURL *url.URL) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
 	}
+	return transport
 }
 
 func (c *Client) FetchBusData(ctx context.Context, lineRef string) (*BusData, error) {
@@ -56,28 +192,78 @@ func (c *Client) FetchBusData(ctx context.Context, lineRef string) (*BusData, er
 	)
 	defer span.End()
 
+	if c.operatorRef != "" {
+		span.SetAttributes(attribute.String("operator_ref", c.operatorRef))
+	}
+
 	// Build URL with parameters
-	url := fmt.Sprintf("%s?api_key=%s&lineRef=%s", c.baseURL, c.apiKey, lineRef)
+	var boundingBox string
+	if c.boundingBox != nil {
+		boundingBox = "&boundingBox=" + url.QueryEscape(c.boundingBox.String())
+	}
+	var operatorRef string
+	if c.operatorRef != "" {
+		operatorRef = "&operatorRef=" + url.QueryEscape(c.operatorRef)
+	}
+	url := fmt.Sprintf("%s?api_key=%s&lineRef=%s%s%s", c.baseURL, c.apiKey, lineRef, boundingBox, operatorRef)
 
 	span.SetAttributes(
 		attribute.String("http.url", url),
 		attribute.String("http.method", "GET"),
 	)
 
+	return c.fetch(ctx, span, url, lineRef)
+}
+
+// fetch requests url according to the client's retry policy
+func (c *Client) fetch(ctx context.Context, span trace.Span, url, lineRef string) (*BusData, error) {
+	// Record each retry on this fetch's span
+	policy := c.retryPolicy
+	onRetry := policy.OnRetry
+	policy.OnRetry = func(attempt int, err error, delay time.Duration) {
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Int("retry.attempt", attempt),
+			attribute.String("retry.delay", delay.String()),
+			attribute.String("retry.error", err.Error()),
+		))
+		if onRetry != nil {
+			onRetry(attempt, err, delay)
+		}
+	}
+
+	var busData *BusData
+	attempt := 0
+	err := retry.Do(ctx, policy, func(ctx context.Context) error {
+		var err error
+		attempt++
+		busData, err = c.fetchOnce(ctx, span, url, lineRef, attempt > 1)
+		return err
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return busData, nil
+}
+
+// fetchOnce makes a single request to the datafeed API
+func (c *Client) fetchOnce(ctx context.Context, span trace.Span, url, lineRef string, isRetry bool) (*BusData, error) {
 	// Create request
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		span.RecordError(err)
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("User-Agent", "bods2loki/1.0.0")
-	req.Header.Set("Accept", "*/*")
+	// Prefer XML, but accept JSON from feeds/mirrors that serve it directly
+	req.Header.Set("Accept", "application/xml, application/json;q=0.9, */*;q=0.8")
+	c.setHeaders(req)
 
 	// Make request
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		span.RecordError(err)
+		metrics.RecordBODSRequestFailed(ctx, lineRef, err, isRetry)
 		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
@@ -86,29 +272,39 @@ func (c *Client) FetchBusData(ctx context.Context, lineRef string) (*BusData, er
 		attribute.Int("http.status_code", resp.StatusCode),
 		attribute.String("http.response.content_type", resp.Header.Get("Content-Type")),
 	)
+	metrics.RecordBODSResponse(ctx, lineRef, resp.StatusCode, resp.Header.Get("Content-Type"), isRetry)
 
 	if resp.StatusCode != http.StatusOK {
-		// Read the error response body for debugging
-		body, _ := io.ReadAll(resp.Body)
-		err := fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
-		span.RecordError(err)
-		return nil, err
+		// Read the error response body for debugging, bounded like a success
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, c.maxResponseBytes+1))
+		statusErr := newStatusError(resp.StatusCode, body)
+		if after, ok := retry.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return nil, &retry.RetryAfterError{Err: statusErr, After: after}
+		}
+		return nil, statusErr
 	}
 
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
+	// Read response body, one byte past the limit to detect oversize bodies
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.maxResponseBytes+1))
 	if err != nil {
-		span.RecordError(err)
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
+	if int64(len(body)) > c.maxResponseBytes {
+		span.AddEvent("response_too_large", trace.WithAttributes(
+			attribute.Int64("response.limit_bytes", c.maxResponseBytes),
+		))
+		metrics.RecordBODSResponseTooLarge(ctx, lineRef)
+		return nil, &ResponseTooLargeError{Limit: c.maxResponseBytes}
+	}
 
 	span.SetAttributes(
 		attribute.Int("response.size_bytes", len(body)),
 	)
 
 	return &BusData{
-		XMLData:   string(body),
-		Timestamp: time.Now(),
-		LineRef:   lineRef,
+		XMLData:     string(body),
+		ContentType: resp.Header.Get("Content-Type"),
+		Timestamp:   time.Now(),
+		LineRef:     lineRef,
 	}, nil
 }
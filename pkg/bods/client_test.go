@@ -0,0 +1,320 @@
+package bods
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sampleXML is a minimal SIRI-VM response
+const sampleXML = `<?xml version="1.0" encoding="UTF-8"?>
+<Siri xmlns="http://www.siri.org.uk/siri" version="2.0"><ServiceDelivery><VehicleMonitoringDelivery/></ServiceDelivery></Siri>`
+
+// fakeResponse is a queued response from a fakeBODS
+type fakeResponse struct {
+	status int
+	header http.Header
+	body   string
+}
+
+// fakeBODS records every request it receives, answering with the queued
+// responses and then sampleXML
+type fakeBODS struct {
+	mu        sync.Mutex
+	requests  []*http.Request
+	responses []fakeResponse
+}
+
+func newFakeBODS(t *testing.T, responses ...fakeResponse) (*fakeBODS, *httptest.Server) {
+	t.Helper()
+
+	f := &fakeBODS{responses: responses}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+func (f *fakeBODS) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, req.Clone(context.Background()))
+	response := fakeResponse{status: http.StatusOK, body: sampleXML}
+	if len(f.responses) > 0 {
+		response, f.responses = f.responses[0], f.responses[1:]
+	}
+	f.mu.Unlock()
+
+	for name, values := range response.header {
+		w.Header()[name] = values
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/xml")
+	}
+	w.WriteHeader(response.status)
+	w.Write([]byte(response.body))
+}
+
+// received returns the requests received so far
+func (f *fakeBODS) received() []*http.Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*http.Request(nil), f.requests...)
+}
+
+func TestFetchThroughProxy(t *testing.T) {
+	proxy, proxyServer := newFakeBODS(t)
+	proxyURL, _ := url.Parse(proxyServer.URL)
+
+	client := NewClient("test-key", "", WithProxy(proxyURL))
+	client.baseURL = "http://bods.invalid/api/v1/datafeed/"
+
+	data, err := client.FetchBusData(context.Background(), "49x")
+	if err != nil {
+		t.Fatalf("FetchBusData: %v", err)
+	}
+	if data.XMLData != sampleXML {
+		t.Errorf("body = %q, want the proxied response", data.XMLData)
+	}
+
+	requests := proxy.received()
+	if len(requests) != 1 {
+		t.Fatalf("proxy received %d requests, want 1", len(requests))
+	}
+	// Proxied requests carry the absolute target URL
+	if got := requests[0].URL; got.Host != "bods.invalid" || got.Query().Get("lineRef") != "49x" {
+		t.Errorf("proxy request URL = %s, want the BODS datafeed", got)
+	}
+}
+
+func TestFetchPassesContentType(t *testing.T) {
+	maintenance := `<html><body>Down for maintenance</body></html>`
+	_, server := newFakeBODS(t, fakeResponse{
+		status: http.StatusOK,
+		header: http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+		body:   maintenance,
+	})
+
+	client := NewClient("test-key", "")
+	client.baseURL = server.URL + "/api/v1/datafeed/"
+
+	data, err := client.FetchBusData(context.Background(), "49x")
+	if err != nil {
+		t.Fatalf("FetchBusData: %v", err)
+	}
+	// The parser classifies the page as a feed error from its content type
+	if data.ContentType != "text/html; charset=utf-8" || data.XMLData != maintenance {
+		t.Errorf("BusData = %q (%s), want the HTML page and its content type", data.XMLData, data.ContentType)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want time.Duration
+	}{
+		{"default", nil, DefaultTimeout},
+		{"custom", []Option{WithTimeout(2 * time.Minute)}, 2 * time.Minute},
+		{"short", []Option{WithTimeout(50 * time.Millisecond)}, 50 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewClient("test-key", "", tt.opts...).httpClient.Timeout; got != tt.want {
+				t.Errorf("http.Client.Timeout = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// A response slower than the timeout fails the fetch
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	t.Cleanup(slow.Close)
+	client := NewClient("test-key", "", WithTimeout(50*time.Millisecond))
+	client.baseURL = slow.URL + "/api/v1/datafeed/"
+	if _, err := client.FetchBusData(context.Background(), "49x"); err == nil {
+		t.Error("FetchBusData succeeded against a server slower than the timeout")
+	}
+}
+
+func TestFetchOperatorRefQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{"no operator", nil, ""},
+		{"operator", []Option{WithOperatorRef("FBRI")}, "FBRI"},
+		{"escaped operator", []Option{WithOperatorRef("A&B Coaches")}, "A&B Coaches"},
+		{"with bounding box", []Option{WithOperatorRef("FBRI"), WithBoundingBox(BoundingBox{-2.7, 51.4, -2.5, 51.5})}, "FBRI"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, server := newFakeBODS(t)
+			client := NewClient("test-key", "", tt.opts...)
+			client.baseURL = server.URL + "/api/v1/datafeed/"
+
+			if _, err := client.FetchBusData(context.Background(), "49x"); err != nil {
+				t.Fatalf("FetchBusData: %v", err)
+			}
+
+			query := fake.received()[0].URL.Query()
+			if got := query.Get("operatorRef"); got != tt.want {
+				t.Errorf("operatorRef = %q, want %q", got, tt.want)
+			}
+			if _, ok := query["operatorRef"]; ok != (tt.want != "") {
+				t.Errorf("operatorRef present = %v, want %v", ok, tt.want != "")
+			}
+			if got := query.Get("lineRef"); got != "49x" {
+				t.Errorf("lineRef = %q, want 49x alongside the operator", got)
+			}
+		})
+	}
+}
+
+func TestExtraHeaders(t *testing.T) {
+	headers := map[string]string{"X-Proxy-Auth": "secret", "User-Agent": "fleet-monitor/2.0"}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		fetch   func(c *Client) error
+	}{
+		{"bus data", headers, func(c *Client) error { _, err := c.FetchBusData(context.Background(), "49x"); return err }},
+		{"situations", headers, func(c *Client) error { _, err := c.FetchSituations(context.Background()); return err }},
+		{"dataset info", headers, func(c *Client) error { _, err := c.FetchDatasetInfo(context.Background()); return err }},
+		{"no extra headers", nil, func(c *Client) error { _, err := c.FetchBusData(context.Background(), "49x"); return err }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, server := newFakeBODS(t, fakeResponse{status: http.StatusOK, header: http.Header{"Content-Type": {"application/json"}}, body: `{"id": 699}`})
+			client := NewClient("test-key", "699",
+				WithHeaders(tt.headers),
+				WithSituationsURL(server.URL+"/api/v1/siri-sx"),
+				WithDatasetInfoURL(server.URL+"/api/v1/dataset/699/"),
+			)
+			client.baseURL = server.URL + "/api/v1/datafeed/"
+
+			// The canned response needn't parse; only the request matters
+			tt.fetch(client)
+
+			requests := fake.received()
+			if len(requests) == 0 {
+				t.Fatal("no request reached the server")
+			}
+			header := requests[0].Header
+			for name, want := range tt.headers {
+				if got := header.Values(name); len(got) != 1 || got[0] != want {
+					t.Errorf("%s = %q, want only %q", name, got, want)
+				}
+			}
+			if tt.headers == nil && header.Get("User-Agent") != "bods2loki/1.0.0" {
+				t.Errorf("User-Agent = %q, want the default", header.Get("User-Agent"))
+			}
+		})
+	}
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int64
+		wantErr bool
+	}{
+		{"well under the limit", DefaultMaxResponseBytes, false},
+		{"exactly the limit", int64(len(sampleXML)), false},
+		{"one byte over", int64(len(sampleXML)) - 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, server := newFakeBODS(t, fakeResponse{status: http.StatusOK, body: sampleXML}, fakeResponse{status: http.StatusOK, body: sampleXML})
+			client := NewClient("test-key", "", WithMaxResponseBytes(tt.limit), WithRetry(3, time.Millisecond))
+			client.baseURL = server.URL + "/api/v1/datafeed/"
+
+			data, err := client.FetchBusData(context.Background(), "49x")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FetchBusData error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				if data.XMLData != sampleXML {
+					t.Errorf("XMLData is %d bytes, want the whole %d byte response", len(data.XMLData), len(sampleXML))
+				}
+				return
+			}
+
+			var tooLarge *ResponseTooLargeError
+			if !errors.As(err, &tooLarge) || tooLarge.Limit != tt.limit {
+				t.Errorf("error = %v, want a ResponseTooLargeError with limit %d", err, tt.limit)
+			}
+			// Retrying would only fetch the same oversize body again
+			if got := len(fake.received()); got != 1 {
+				t.Errorf("got %d attempts, want 1", got)
+			}
+		})
+	}
+
+	if got := NewClient("test-key", "").maxResponseBytes; got != DefaultMaxResponseBytes {
+		t.Errorf("default maxResponseBytes = %d, want %d", got, DefaultMaxResponseBytes)
+	}
+}
+
+func TestMaxResponseBytesErrorBodies(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		fetch  func(c *Client) error
+	}{
+		{"bus data 5xx", http.StatusInternalServerError, func(c *Client) error { _, err := c.FetchBusData(context.Background(), "49x"); return err }},
+		{"dataset info 5xx", http.StatusBadGateway, func(c *Client) error { _, err := c.FetchDatasetInfo(context.Background()); return err }},
+		{"dataset info 200", http.StatusOK, func(c *Client) error { _, err := c.FetchDatasetInfo(context.Background()); return err }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// An endless body: the fetch only returns if the client stops reading
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				chunk := []byte(strings.Repeat("x", 4096))
+				for r.Context().Err() == nil {
+					if _, err := w.Write(chunk); err != nil {
+						return
+					}
+				}
+			}))
+			defer server.Close()
+
+			const limit = 64 << 10
+			client := NewClient("test-key", "699", WithMaxResponseBytes(limit), WithDatasetInfoURL(server.URL+"/api/v1/dataset/699/"))
+			client.baseURL = server.URL + "/api/v1/datafeed/"
+
+			err := tt.fetch(client)
+			if tt.status == http.StatusOK {
+				var tooLarge *ResponseTooLargeError
+				if !errors.As(err, &tooLarge) || tooLarge.Limit != limit {
+					t.Errorf("error = %v, want a ResponseTooLargeError with limit %d", err, limit)
+				}
+				return
+			}
+
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.status {
+				t.Fatalf("error = %v, want a StatusError with status %d", err, tt.status)
+			}
+			if len(statusErr.Body) > maxErrorBodyBytes+len("...(truncated)") || !strings.HasSuffix(statusErr.Body, "...(truncated)") {
+				t.Errorf("StatusError body is %d bytes, want it truncated to %d", len(statusErr.Body), maxErrorBodyBytes)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package bods
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DatasetInfoURLTemplate = "https://data.bus-data.dft.gov.uk/api/v1/dataset/%s/"
+)
+
+// DatasetInfo is the metadata BODS publishes for a dataset
+type DatasetInfo struct {
+	ID           int      `json:"id"`
+	Name         string   `json:"name"`
+	OperatorName string   `json:"operatorName"`
+	Status       string   `json:"status"`
+	LastModified string   `json:"modified"`
+	Lines        []string `json:"lines"`
+	// BoundingBox is [min longitude, min latitude, max longitude, max latitude]
+	// when the dataset reports one
+	BoundingBox []float64 `json:"boundingBox,omitempty"`
+}
+
+// WithDatasetInfoURL fetches dataset metadata from url instead of the BODS
+// dataset endpoint for the client's dataset ID
+func WithDatasetInfoURL(url string) Option {
+	return func(c *Client) {
+		c.datasetInfoURL = url
+	}
+}
+
+// FetchDatasetInfo retrieves the dataset's metadata, e.g. to confirm the
+// dataset ID is valid and see which lines it covers before polling
+func (c *Client) FetchDatasetInfo(ctx context.Context) (*DatasetInfo, error) {
+	ctx, span := c.tracer.Start(ctx, "bods.fetch_dataset_info",
+		trace.WithAttributes(attribute.String("api.endpoint", c.datasetInfoURL)),
+	)
+	defer span.End()
+
+	url := fmt.Sprintf("%s?api_key=%s", c.datasetInfoURL, c.apiKey)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "bods2loki/1.0.0")
+	req.Header.Set("Accept", "application/json")
+	c.setHeaders(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+
+	// Read one byte past the limit to detect oversize bodies
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.maxResponseBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := newStatusError(resp.StatusCode, body)
+		span.RecordError(err)
+		return nil, err
+	}
+	if int64(len(body)) > c.maxResponseBytes {
+		err := &ResponseTooLargeError{Limit: c.maxResponseBytes}
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var info DatasetInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to decode dataset metadata: %w", err)
+	}
+
+	span.SetAttributes(attribute.Int("dataset.lines", len(info.Lines)))
+	return &info, nil
+}
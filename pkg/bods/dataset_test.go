@@ -0,0 +1,96 @@
+package bods
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const sampleDatasetInfo = `{
+	"id": 699,
+	"name": "First Bus_AVL_Bristol",
+	"operatorName": "First West of England",
+	"status": "published",
+	"modified": "2025-10-09T06:00:12.345678+00:00",
+	"lines": ["49x", "72", "1"],
+	"boundingBox": [-2.8, 51.3, -2.3, 51.6]
+}`
+
+func TestFetchDatasetInfo(t *testing.T) {
+	jsonHeader := http.Header{"Content-Type": {"application/json"}}
+
+	tests := []struct {
+		name       string
+		response   fakeResponse
+		want       *DatasetInfo
+		wantStatus int
+		wantErr    bool
+	}{
+		{
+			name:     "published dataset",
+			response: fakeResponse{status: http.StatusOK, header: jsonHeader, body: sampleDatasetInfo},
+			want: &DatasetInfo{
+				ID:           699,
+				Name:         "First Bus_AVL_Bristol",
+				OperatorName: "First West of England",
+				Status:       "published",
+				LastModified: "2025-10-09T06:00:12.345678+00:00",
+				Lines:        []string{"49x", "72", "1"},
+				BoundingBox:  []float64{-2.8, 51.3, -2.3, 51.6},
+			},
+		},
+		{
+			name:     "no bounding box",
+			response: fakeResponse{status: http.StatusOK, header: jsonHeader, body: `{"id": 700, "status": "inactive", "lines": []}`},
+			want:     &DatasetInfo{ID: 700, Status: "inactive", Lines: []string{}},
+		},
+		{
+			name:       "unknown dataset",
+			response:   fakeResponse{status: http.StatusNotFound, header: jsonHeader, body: `{"detail": "Not found."}`},
+			wantStatus: http.StatusNotFound,
+			wantErr:    true,
+		},
+		{
+			name:     "not JSON",
+			response: fakeResponse{status: http.StatusOK, body: sampleXML},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, server := newFakeBODS(t, tt.response)
+			client := NewClient("test-key", "699", WithDatasetInfoURL(server.URL+"/api/v1/dataset/699/"))
+
+			info, err := client.FetchDatasetInfo(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FetchDatasetInfo error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(info, tt.want) {
+				t.Errorf("FetchDatasetInfo() = %+v, want %+v", info, tt.want)
+			}
+			var statusErr *StatusError
+			if tt.wantStatus != 0 && (!errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus) {
+				t.Errorf("error = %v, want a StatusError with status %d", err, tt.wantStatus)
+			}
+
+			requests := fake.received()
+			if len(requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(requests))
+			}
+			req := requests[0]
+			if req.URL.Path != "/api/v1/dataset/699/" || req.URL.Query().Get("api_key") != "test-key" {
+				t.Errorf("requested %s, want the dataset path with the API key", req.URL)
+			}
+			if got := req.Header.Get("Accept"); got != "application/json" {
+				t.Errorf("Accept = %q, want application/json", got)
+			}
+		})
+	}
+
+	if got := NewClient("test-key", "699").datasetInfoURL; got != "https://data.bus-data.dft.gov.uk/api/v1/dataset/699/" {
+		t.Errorf("default dataset info URL = %q", got)
+	}
+}
@@ -0,0 +1,47 @@
+package bods
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"bods2loki/pkg/retry"
+)
+
+// maxRetryDelay caps the backoff between fetch attempts
+const maxRetryDelay = 30 * time.Second
+
+// WithRetry retries fetches failing with a 429, a 5xx gateway/server error or
+// a network error, up to maxAttempts in total, with exponential backoff from
+// baseDelay plus jitter
+func WithRetry(maxAttempts int, baseDelay time.Duration) Option {
+	return WithRetryPolicy(retry.Policy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   baseDelay,
+		MaxDelay:    maxRetryDelay,
+		Jitter:      0.2,
+		Retryable:   IsRetryable,
+	})
+}
+
+// IsRetryable reports whether a fetch error is likely transient
+func IsRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
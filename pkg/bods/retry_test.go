@@ -0,0 +1,88 @@
+package bods
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFetchBusDataRetries(t *testing.T) {
+	unavailable := fakeResponse{status: http.StatusServiceUnavailable, body: "unavailable"}
+
+	tests := []struct {
+		name      string
+		responses []fakeResponse
+		attempts  int
+		wantErr   bool
+	}{
+		{"success", nil, 1, false},
+		{"503 twice then success", []fakeResponse{unavailable, unavailable}, 3, false},
+		{"429 then success", []fakeResponse{{status: http.StatusTooManyRequests}}, 2, false},
+		{"attempts exhausted", []fakeResponse{unavailable, {status: http.StatusBadGateway}, {status: http.StatusGatewayTimeout}}, 3, true},
+		{"4xx not retried", []fakeResponse{{status: http.StatusForbidden, body: "invalid api key"}}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, server := newFakeBODS(t, tt.responses...)
+			client := NewClient("test-key", "", WithRetry(3, time.Millisecond))
+			client.baseURL = server.URL + "/api/v1/datafeed/"
+
+			data, err := client.FetchBusData(context.Background(), "49x")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FetchBusData error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && data.XMLData != sampleXML {
+				t.Errorf("XMLData = %q, want the response that finally succeeded", data.XMLData)
+			}
+			if got := len(fake.received()); got != tt.attempts {
+				t.Errorf("got %d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestFetchBusDataNoRetryByDefault(t *testing.T) {
+	fake, server := newFakeBODS(t, fakeResponse{status: http.StatusServiceUnavailable})
+	client := NewClient("test-key", "")
+	client.baseURL = server.URL + "/api/v1/datafeed/"
+
+	if _, err := client.FetchBusData(context.Background(), "49x"); err == nil {
+		t.Fatal("FetchBusData succeeded, want the 503 returned")
+	}
+	if got := len(fake.received()); got != 1 {
+		t.Errorf("got %d attempts, want 1 without WithRetry", got)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limited", &StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"internal server error", &StatusError{StatusCode: http.StatusInternalServerError}, true},
+		{"bad gateway", &StatusError{StatusCode: http.StatusBadGateway}, true},
+		{"service unavailable", &StatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"gateway timeout", &StatusError{StatusCode: http.StatusGatewayTimeout}, true},
+		{"not implemented", &StatusError{StatusCode: http.StatusNotImplemented}, false},
+		{"not found", &StatusError{StatusCode: http.StatusNotFound}, false},
+		{"network error", fmt.Errorf("failed to make request: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}), true},
+		{"cancelled", fmt.Errorf("failed to make request: %w", context.Canceled), false},
+		{"deadline", fmt.Errorf("failed to make request: %w", context.DeadlineExceeded), false},
+		{"other error", errors.New("failed to read response body"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
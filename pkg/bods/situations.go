@@ -0,0 +1,36 @@
+package bods
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	SituationsURL = "https://data.bus-data.dft.gov.uk/api/v1/siri-sx/"
+)
+
+// WithSituationsURL fetches SIRI-SX situations from url instead of the BODS
+// disruptions endpoint
+func WithSituationsURL(url string) Option {
+	return func(c *Client) {
+		c.situationsURL = url
+	}
+}
+
+// FetchSituations retrieves the SIRI-SX situations feed of service
+// disruptions. The response is returned as BusData with an empty LineRef,
+// since the feed covers every operator rather than one line.
+func (c *Client) FetchSituations(ctx context.Context) (*BusData, error) {
+	ctx, span := c.tracer.Start(ctx, "bods.fetch_situations",
+		trace.WithAttributes(attribute.String("api.endpoint", c.situationsURL)),
+	)
+	defer span.End()
+
+	url := fmt.Sprintf("%s?api_key=%s", c.situationsURL, c.apiKey)
+	span.SetAttributes(attribute.String("http.method", "GET"))
+
+	return c.fetch(ctx, span, url, "")
+}
@@ -0,0 +1,90 @@
+// Package geojson converts parsed vehicles to GeoJSON, e.g. for viewing a
+// cycle's positions in geojson.io.
+package geojson
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"bods2loki/pkg/types"
+)
+
+// FeatureCollection is a GeoJSON FeatureCollection
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// Feature is a GeoJSON Feature with a Point geometry
+type Feature struct {
+	Type       string                 `json:"type"`
+	Geometry   Point                  `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Point is a GeoJSON Point; Coordinates are [longitude, latitude]
+type Point struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// FromBusData builds a FeatureCollection with a Point for each vehicle in
+// batch. Vehicles with invalid locations are left out, since they would
+// otherwise be drawn at 0,0 or far from the line.
+func FromBusData(batch []*types.ParsedBusData) FeatureCollection {
+	collection := FeatureCollection{Type: "FeatureCollection", Features: []Feature{}}
+	for _, data := range batch {
+		for _, vehicle := range data.VehicleData {
+			if !vehicle.LocationValid {
+				continue
+			}
+			collection.Features = append(collection.Features, vehicleFeature(vehicle))
+		}
+	}
+	return collection
+}
+
+func vehicleFeature(vehicle types.VehicleActivity) Feature {
+	properties := map[string]interface{}{
+		"vehicle_ref":      vehicle.VehicleRef,
+		"line_ref":         vehicle.LineRef,
+		"direction_ref":    vehicle.DirectionRef,
+		"operator_ref":     vehicle.OperatorRef,
+		"origin_name":      vehicle.OriginName,
+		"destination_name": vehicle.DestinationName,
+		"recorded_at_time": vehicle.RecordedAtTime,
+		"data_quality":     vehicle.DataQuality,
+	}
+	if vehicle.HasBearing {
+		properties["bearing"] = vehicle.Bearing
+	}
+	if vehicle.HasVelocity {
+		properties["velocity"] = vehicle.Velocity
+	}
+	if vehicle.DelayBucket != "" {
+		properties["delay_bucket"] = vehicle.DelayBucket
+		properties["delay_seconds"] = vehicle.DelaySeconds
+	}
+
+	return Feature{
+		Type: "Feature",
+		Geometry: Point{
+			Type:        "Point",
+			Coordinates: [2]float64{vehicle.Longitude, vehicle.Latitude},
+		},
+		Properties: properties,
+	}
+}
+
+// WriteFile writes collection to path, replacing any previous contents
+func WriteFile(path string, collection FeatureCollection) error {
+	encoded, err := json.MarshalIndent(collection, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal GeoJSON: %w", err)
+	}
+	if err := os.WriteFile(path, encoded, 0o644); err != nil {
+		return fmt.Errorf("failed to write GeoJSON file: %w", err)
+	}
+	return nil
+}
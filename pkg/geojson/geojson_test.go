@@ -0,0 +1,122 @@
+package geojson
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bods2loki/pkg/types"
+)
+
+func TestFromBusData(t *testing.T) {
+	tests := []struct {
+		name     string
+		vehicles []types.VehicleActivity
+		want     [][2]float64
+	}{
+		{"no vehicles", nil, nil},
+		{"longitude first", []types.VehicleActivity{{VehicleRef: "bus-1", Latitude: 51.495853, Longitude: -2.480741, LocationValid: true}}, [][2]float64{{-2.480741, 51.495853}}},
+		{"invalid locations skipped", []types.VehicleActivity{
+			{VehicleRef: "bus-1", Latitude: 51.45, Longitude: -2.6, LocationValid: true},
+			{VehicleRef: "bus-2"},
+			{VehicleRef: "bus-3", Latitude: 51.5, Longitude: -2.5, LocationValid: true},
+		}, [][2]float64{{-2.6, 51.45}, {-2.5, 51.5}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collection := FromBusData([]*types.ParsedBusData{{LineRef: "49x", VehicleData: tt.vehicles}})
+			if collection.Type != "FeatureCollection" || collection.Features == nil {
+				t.Fatalf("collection = %+v, want a FeatureCollection with a non-nil feature list", collection)
+			}
+			if len(collection.Features) != len(tt.want) {
+				t.Fatalf("got %d features, want %d", len(collection.Features), len(tt.want))
+			}
+			for i, feature := range collection.Features {
+				if feature.Type != "Feature" || feature.Geometry.Type != "Point" {
+					t.Errorf("feature %d is a %s with a %s, want a Feature with a Point", i, feature.Type, feature.Geometry.Type)
+				}
+				if feature.Geometry.Coordinates != tt.want[i] {
+					t.Errorf("feature %d coordinates = %v, want [lng, lat] %v", i, feature.Geometry.Coordinates, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFeatureProperties(t *testing.T) {
+	tests := []struct {
+		name    string
+		vehicle types.VehicleActivity
+		present []string
+		absent  []string
+	}{
+		{"bare vehicle", types.VehicleActivity{}, []string{"vehicle_ref", "line_ref", "data_quality"}, []string{"bearing", "velocity", "delay_bucket", "delay_seconds"}},
+		{"provided zero bearing and velocity", types.VehicleActivity{HasBearing: true, HasVelocity: true}, []string{"bearing", "velocity"}, []string{"delay_bucket"}},
+		{"delay", types.VehicleActivity{DelayBucket: "late", DelaySeconds: 300}, []string{"delay_bucket", "delay_seconds"}, []string{"bearing"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.vehicle.LocationValid = true
+			properties := vehicleFeature(tt.vehicle).Properties
+			for _, key := range tt.present {
+				if _, ok := properties[key]; !ok {
+					t.Errorf("properties lack %s: %v", key, properties)
+				}
+			}
+			for _, key := range tt.absent {
+				if _, ok := properties[key]; ok {
+					t.Errorf("properties hold %s: %v", key, properties)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vehicles.geojson")
+	batch := []*types.ParsedBusData{{LineRef: "49x", VehicleData: []types.VehicleActivity{
+		{VehicleRef: "bus-1", LineRef: "49x", Latitude: 51.495853, Longitude: -2.480741, LocationValid: true},
+	}}}
+
+	// A second write replaces the first
+	if err := WriteFile(path, FromBusData(append(batch, batch...))); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := WriteFile(path, FromBusData(batch)); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry struct {
+				Coordinates []float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("file is not valid JSON: %v", err)
+	}
+	if decoded.Type != "FeatureCollection" || len(decoded.Features) != 1 {
+		t.Fatalf("file holds a %q with %d features, want a FeatureCollection with 1", decoded.Type, len(decoded.Features))
+	}
+	feature := decoded.Features[0]
+	if len(feature.Geometry.Coordinates) != 2 || feature.Geometry.Coordinates[0] != -2.480741 || feature.Geometry.Coordinates[1] != 51.495853 {
+		t.Errorf("coordinates = %v, want [-2.480741 51.495853]", feature.Geometry.Coordinates)
+	}
+	if feature.Properties["vehicle_ref"] != "bus-1" {
+		t.Errorf("vehicle_ref = %v, want bus-1", feature.Properties["vehicle_ref"])
+	}
+
+	if err := WriteFile(filepath.Join(t.TempDir(), "missing", "vehicles.geojson"), FromBusData(batch)); err == nil {
+		t.Error("WriteFile succeeded into a missing directory")
+	}
+}
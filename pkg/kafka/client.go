@@ -0,0 +1,123 @@
+// Package kafka publishes parsed bus data to a Kafka topic, one message per
+// vehicle, using the same JSON entries that are pushed to Loki.
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"bods2loki/pkg/loki"
+	"bods2loki/pkg/types"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MessageWriter writes messages to Kafka; *kafkago.Writer implements it
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafkago.Message) error
+	Close() error
+}
+
+type Client struct {
+	writer       MessageWriter
+	topic        string
+	tracer       trace.Tracer
+	entryOptions loki.EntryOptions
+}
+
+// Option configures optional Client behaviour
+type Option func(*Client)
+
+// WithEntryOptions controls how vehicle entries are built, as for Loki
+func WithEntryOptions(opts loki.EntryOptions) Option {
+	return func(c *Client) {
+		c.entryOptions = opts
+	}
+}
+
+// WithWriter replaces the Kafka writer, e.g. to configure TLS or SASL
+func WithWriter(writer MessageWriter) Option {
+	return func(c *Client) {
+		c.writer = writer
+	}
+}
+
+// NewClient creates a client producing to topic on the given brokers.
+// Messages are keyed by vehicle ref, so each vehicle's updates stay in order
+// on one partition.
+func NewClient(brokers []string, topic string, opts ...Option) *Client {
+	c := &Client{
+		topic:  topic,
+		tracer: otel.Tracer("kafka-client"),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.writer == nil {
+		c.writer = &kafkago.Writer{
+			Addr:         kafkago.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafkago.Hash{},
+			RequiredAcks: kafkago.RequireAll,
+			BatchTimeout: 10 * time.Millisecond,
+		}
+	}
+
+	return c
+}
+
+// Send publishes one message per vehicle on a line
+func (c *Client) Send(ctx context.Context, data *types.ParsedBusData) error {
+	return c.SendBatch(ctx, []*types.ParsedBusData{data})
+}
+
+// SendBatch publishes one message per vehicle across every line in a
+// single write
+func (c *Client) SendBatch(ctx context.Context, batch []*types.ParsedBusData) error {
+	ctx, span := c.tracer.Start(ctx, "kafka.send_batch",
+		trace.WithAttributes(
+			attribute.String("messaging.destination.name", c.topic),
+			attribute.Int("lines_count", len(batch)),
+		),
+	)
+	defer span.End()
+
+	var messages []kafkago.Message
+	for _, data := range batch {
+		for _, vehicle := range data.VehicleData {
+			value, err := json.Marshal(loki.BuildVehicleEntry(data, vehicle, c.entryOptions))
+			if err != nil {
+				span.RecordError(err)
+				return fmt.Errorf("failed to marshal vehicle JSON: %w", err)
+			}
+			messages = append(messages, kafkago.Message{
+				Key:   []byte(vehicle.VehicleRef),
+				Value: value,
+			})
+		}
+	}
+	span.SetAttributes(attribute.Int("messages_count", len(messages)))
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	if err := c.writer.WriteMessages(ctx, messages...); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to write to Kafka topic %s: %w", c.topic, err)
+	}
+
+	return nil
+}
+
+// Close flushes and closes the underlying writer
+func (c *Client) Close() error {
+	return c.writer.Close()
+}
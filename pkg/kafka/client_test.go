@@ -0,0 +1,166 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"bods2loki/pkg/loki"
+	"bods2loki/pkg/types"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// fakeWriter records the messages written to it
+type fakeWriter struct {
+	messages []kafkago.Message
+	writes   int
+	err      error
+	closed   bool
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	w.writes++
+	if w.err != nil {
+		return w.err
+	}
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func busData(line string, vehicleRefs ...string) *types.ParsedBusData {
+	data := &types.ParsedBusData{LineRef: line, Timestamp: "2025-10-09T15:37:40Z"}
+	for _, ref := range vehicleRefs {
+		data.VehicleData = append(data.VehicleData, types.VehicleActivity{
+			LineRef:       line,
+			VehicleRef:    ref,
+			Latitude:      51.495853,
+			Longitude:     -2.480741,
+			LocationValid: true,
+		})
+	}
+	return data
+}
+
+func TestSendBatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		batch  []*types.ParsedBusData
+		keys   []string
+		writes int
+	}{
+		{
+			name:   "one message per vehicle across lines",
+			batch:  []*types.ParsedBusData{busData("49x", "bus-1", "bus-2"), busData("72", "bus-3")},
+			keys:   []string{"bus-1", "bus-2", "bus-3"},
+			writes: 1,
+		},
+		{
+			name:   "no vehicles writes nothing",
+			batch:  []*types.ParsedBusData{busData("49x")},
+			writes: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := &fakeWriter{}
+			opts := loki.EntryOptions{TimestampField: "@timestamp"}
+			client := NewClient([]string{"localhost:9092"}, "buses", WithWriter(writer), WithEntryOptions(opts))
+
+			if err := client.SendBatch(context.Background(), tt.batch); err != nil {
+				t.Fatalf("SendBatch: %v", err)
+			}
+			if writer.writes != tt.writes {
+				t.Errorf("got %d writes, want %d", writer.writes, tt.writes)
+			}
+
+			var keys []string
+			for _, msg := range writer.messages {
+				keys = append(keys, string(msg.Key))
+
+				var entry map[string]interface{}
+				if err := json.Unmarshal(msg.Value, &entry); err != nil {
+					t.Fatalf("message value is not JSON: %v", err)
+				}
+				if entry["vehicle_ref"] != string(msg.Key) {
+					t.Errorf("message keyed %s carries vehicle %v", msg.Key, entry["vehicle_ref"])
+				}
+				if _, ok := entry["@timestamp"]; !ok {
+					t.Errorf("entry options were not applied to %v", entry)
+				}
+			}
+			if !reflect.DeepEqual(keys, tt.keys) {
+				t.Errorf("message keys = %q, want %q", keys, tt.keys)
+			}
+		})
+	}
+}
+
+func TestSendMatchesLokiEntry(t *testing.T) {
+	writer := &fakeWriter{}
+	client := NewClient(nil, "buses", WithWriter(writer))
+	data := busData("49x", "bus-1")
+
+	if err := client.Send(context.Background(), data); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	want, err := json.Marshal(loki.BuildVehicleEntry(data, data.VehicleData[0], loki.EntryOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(writer.messages))
+	}
+	if got := writer.messages[0].Value; string(got) != string(want) {
+		t.Errorf("message = %s, want the Loki entry %s", got, want)
+	}
+}
+
+func TestSendWriteError(t *testing.T) {
+	writer := &fakeWriter{err: errors.New("broker unavailable")}
+	client := NewClient(nil, "buses", WithWriter(writer))
+
+	err := client.Send(context.Background(), busData("49x", "bus-1"))
+	if !errors.Is(err, writer.err) {
+		t.Errorf("Send error = %v, want it to wrap %v", err, writer.err)
+	}
+}
+
+func TestNewClientWriter(t *testing.T) {
+	client := NewClient([]string{"kafka-1:9092", "kafka-2:9092"}, "buses")
+
+	writer, ok := client.writer.(*kafkago.Writer)
+	if !ok {
+		t.Fatalf("writer is %T, want *kafka.Writer", client.writer)
+	}
+	if writer.Topic != "buses" {
+		t.Errorf("topic = %q, want %q", writer.Topic, "buses")
+	}
+	if addr := writer.Addr.String(); addr != "kafka-1:9092,kafka-2:9092" {
+		t.Errorf("brokers = %q, want both brokers", addr)
+	}
+	if _, ok := writer.Balancer.(*kafkago.Hash); !ok {
+		t.Errorf("balancer is %T, want key hashing", writer.Balancer)
+	}
+}
+
+func TestClose(t *testing.T) {
+	writer := &fakeWriter{}
+	client := NewClient(nil, "buses", WithWriter(writer))
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if !writer.closed {
+		t.Errorf("writer was not closed")
+	}
+}
@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// InitLogging installs a slog handler configured by LOG_LEVEL (debug, info,
+// warn, error; default info) and LOG_FORMAT (text or json; default text).
+// Messages from the standard log package are always written, unfiltered by
+// LOG_LEVEL: unchanged in text mode, or as info records in JSON mode.
+func InitLogging() error {
+	return initLogging(os.Stderr)
+}
+
+func initLogging(w io.Writer) error {
+	level, err := parseLevel(getEnv("LOG_LEVEL", "info"))
+	if err != nil {
+		return err
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	format := strings.ToLower(strings.TrimSpace(getEnv("LOG_FORMAT", "text")))
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid LOG_FORMAT %q: expected text or json", format)
+	}
+
+	// SetDefault also sends the standard log package through handler, so
+	// undo that: its messages have no level and mustn't be hidden by LOG_LEVEL
+	slog.SetDefault(slog.New(handler))
+	if format == "json" {
+		log.SetFlags(0)
+		log.SetOutput(slog.NewLogLogger(slog.NewJSONHandler(w, nil), slog.LevelInfo).Writer())
+	} else {
+		log.SetFlags(log.LstdFlags)
+		log.SetOutput(w)
+	}
+
+	return nil
+}
+
+// parseLevel maps a LOG_LEVEL value to a slog level
+func parseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("invalid LOG_LEVEL %q: expected debug, info, warn or error", s)
+	}
+}
+
+// getEnv returns the value of an environment variable or a default value if not set
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
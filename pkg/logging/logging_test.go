@@ -0,0 +1,148 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// initTestLogging initializes logging into a buffer, restoring the default
+// loggers when the test ends
+func initTestLogging(t *testing.T, level, format string) (*bytes.Buffer, error) {
+	t.Helper()
+
+	t.Setenv("LOG_LEVEL", level)
+	t.Setenv("LOG_FORMAT", format)
+	defaultLogger, flags := slog.Default(), log.Flags()
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+		log.SetFlags(flags)
+		log.SetOutput(os.Stderr)
+	})
+
+	var buf bytes.Buffer
+	return &buf, initLogging(&buf)
+}
+
+func TestJSONLogging(t *testing.T) {
+	tests := []struct {
+		name   string
+		level  string
+		format string
+		want   []string
+	}{
+		{"info", "info", "json", []string{"WARN", "ERROR", "INFO", "INFO"}},
+		{"warn", "warn", "JSON", []string{"WARN", "ERROR", "INFO"}},
+		{"debug", "debug", " json ", []string{"WARN", "ERROR", "INFO", "DEBUG", "INFO"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := initTestLogging(t, tt.level, tt.format)
+			if err != nil {
+				t.Fatalf("initLogging: %v", err)
+			}
+
+			slog.Warn("Loki URL has no scheme", "url", "loki:3100")
+			slog.Error("sending failed", "lines", 2)
+			slog.Info("cycle complete")
+			slog.Debug("fetched line", "line_ref", "49x")
+			// Standard log messages are never hidden by LOG_LEVEL
+			log.Printf("Pipeline started - polling every %v", "30s")
+
+			var levels []string
+			var last map[string]interface{}
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				var record map[string]interface{}
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					t.Fatalf("log line %q is not JSON: %v", line, err)
+				}
+				if record["msg"] == "" || record["time"] == nil {
+					t.Errorf("record %v lacks a message or time", record)
+				}
+				levels = append(levels, record["level"].(string))
+				last = record
+			}
+			if strings.Join(levels, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("logged levels %v, want %v", levels, tt.want)
+			}
+			if last["msg"] != "Pipeline started - polling every 30s" {
+				t.Errorf("standard log record msg = %q, want the message as written", last["msg"])
+			}
+		})
+	}
+}
+
+func TestLogFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		json    bool
+		wantErr bool
+	}{
+		{"default text", "", false, false},
+		{"explicit text", "text", false, false},
+		{"json", "json", true, false},
+		{"unknown", "logfmt", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := initTestLogging(t, "info", tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("initLogging error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			log.Println("Pipeline stopped")
+			if isJSON := json.Valid(bytes.TrimSpace(buf.Bytes())); isJSON != tt.json {
+				t.Errorf("output %q is JSON = %v, want %v", buf, isJSON, tt.json)
+			}
+		})
+	}
+
+	if _, err := initTestLogging(t, "verbose", "json"); err == nil {
+		t.Error("initLogging accepted LOG_LEVEL=verbose")
+	}
+}
+
+func TestTextModeKeepsStandardLog(t *testing.T) {
+	tests := []struct {
+		level string
+	}{
+		{"info"},
+		{"warn"},
+		{"error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			buf, err := initTestLogging(t, tt.level, "text")
+			if err != nil {
+				t.Fatalf("initLogging: %v", err)
+			}
+
+			log.Println("Pipeline started - polling every 30s")
+			slog.Info("cycle complete")
+
+			// Plain log lines keep their timestamped format, whatever the level
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if !regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} Pipeline started - polling every 30s$`).MatchString(lines[0]) {
+				t.Errorf("standard log line = %q, want the unchanged log format", lines[0])
+			}
+			if strings.Contains(lines[0], "level=") {
+				t.Errorf("standard log line %q was given a level", lines[0])
+			}
+			if got, want := len(lines) == 2, tt.level == "info"; got != want {
+				t.Errorf("slog info record written = %v at LOG_LEVEL=%s, want %v", got, tt.level, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package loki
+
+// encodedPush is a push request encoded for sending
+type encodedPush struct {
+	req PushRequest
+	// body is sent as is, after any compression
+	body []byte
+	// rawSize is the size of the body before compression
+	rawSize int
+}
+
+// splitPush encodes streams as push requests whose bodies, as actually sent
+// in the client's format and compression, stay within the client's maximum
+// push size where possible. An oversize request is halved, splitting a
+// stream's values across requests if needed, until each part fits; a single
+// value larger than the maximum is still sent on its own.
+func (c *Client) splitPush(streams []Stream) ([]encodedPush, error) {
+	push, err := c.encodeBody(PushRequest{Streams: streams})
+	if err != nil {
+		return nil, err
+	}
+	if c.maxPushBytes <= 0 || len(push.body) <= c.maxPushBytes || countValues(streams) <= 1 {
+		return []encodedPush{push}, nil
+	}
+
+	first, second := halveStreams(streams)
+	pushes, err := c.splitPush(first)
+	if err != nil {
+		return nil, err
+	}
+	rest, err := c.splitPush(second)
+	if err != nil {
+		return nil, err
+	}
+	return append(pushes, rest...), nil
+}
+
+func countValues(streams []Stream) int {
+	n := 0
+	for _, stream := range streams {
+		n += len(stream.Values)
+	}
+	return n
+}
+
+// halveStreams splits streams into two parts with half the values each,
+// keeping their order. A stream straddling the middle appears in both parts.
+func halveStreams(streams []Stream) (first, second []Stream) {
+	remaining := countValues(streams) / 2
+	for i, stream := range streams {
+		if remaining == 0 {
+			return first, append(second, streams[i:]...)
+		}
+		if len(stream.Values) <= remaining {
+			first = append(first, stream)
+			remaining -= len(stream.Values)
+			continue
+		}
+
+		first = append(first, Stream{Stream: stream.Stream, Values: stream.Values[:remaining]})
+		second = append(second, Stream{Stream: stream.Stream, Values: stream.Values[remaining:]})
+		return first, append(second, streams[i+1:]...)
+	}
+	return first, second
+}
@@ -0,0 +1,102 @@
+package loki
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"bods2loki/pkg/types"
+)
+
+func TestHalveStreams(t *testing.T) {
+	values := func(n int) [][]string {
+		var v [][]string
+		for i := range n {
+			v = append(v, []string{fmt.Sprint(i), "line"})
+		}
+		return v
+	}
+	a := Stream{Stream: map[string]string{"line_ref": "a"}, Values: values(3)}
+	b := Stream{Stream: map[string]string{"line_ref": "b"}, Values: values(3)}
+
+	tests := []struct {
+		name          string
+		streams       []Stream
+		first, second int
+	}{
+		{"stream boundary", []Stream{a, {Stream: b.Stream, Values: values(1)}, b}, 3, 4},
+		{"within a stream", []Stream{a, b}, 3, 3},
+		{"single stream", []Stream{{Stream: a.Stream, Values: values(5)}}, 2, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, second := halveStreams(tt.streams)
+			if countValues(first) != tt.first || countValues(second) != tt.second {
+				t.Errorf("halves have %d and %d values, want %d and %d", countValues(first), countValues(second), tt.first, tt.second)
+			}
+		})
+	}
+}
+
+func TestSplitPushBySentSize(t *testing.T) {
+	const maxBytes = 2048
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"json", nil},
+		{"gzip json", []Option{WithCompression(true)}},
+		{"snappy protobuf", []Option{WithFormat(FormatProtobuf)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, server := newPushRecorder(t)
+			client := NewClient(server.URL, "", "", append(tt.opts, WithMaxPushBytes(maxBytes))...)
+
+			var refs []string
+			for i := range 60 {
+				// Hashed refs keep the entries from compressing away
+				refs = append(refs, fmt.Sprintf("bus-%x", sha256.Sum256([]byte{byte(i)})))
+			}
+			if err := client.SendBatch(context.Background(), []*types.ParsedBusData{
+				testBusData("49x", refs[:40]...),
+				testBusData("72", refs[40:]...),
+			}); err != nil {
+				t.Fatalf("SendBatch: %v", err)
+			}
+
+			pushes := recorder.received()
+			if len(pushes) < 2 {
+				t.Fatalf("got %d pushes, want the batch split", len(pushes))
+			}
+			for i, push := range pushes {
+				if len(push.body) > maxBytes {
+					t.Errorf("push %d body is %d bytes as sent, over the %d limit", i, len(push.body), maxBytes)
+				}
+			}
+
+			seen := make(map[string]bool)
+			for _, entry := range recorder.entries(t) {
+				seen[entry["vehicle_ref"].(string)] = true
+			}
+			if len(seen) != len(refs) {
+				t.Errorf("%d of %d vehicles arrived", len(seen), len(refs))
+			}
+		})
+	}
+}
+
+func TestSplitPushOversizeValue(t *testing.T) {
+	recorder, server := newPushRecorder(t)
+	client := NewClient(server.URL, "", "", WithMaxPushBytes(16))
+
+	if err := client.SendBusData(context.Background(), testBusData("49x", "bus-1", "bus-2")); err != nil {
+		t.Fatalf("SendBusData: %v", err)
+	}
+	if got := len(recorder.received()); got != 2 {
+		t.Errorf("got %d pushes, want each oversize entry sent on its own", got)
+	}
+}
@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
+	"bods2loki/pkg/metrics"
+	"bods2loki/pkg/retry"
 	"bods2loki/pkg/types"
 
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
@@ -23,6 +27,158 @@ type Client struct {
 	username   string
 	password   string
 	tracer     trace.Tracer
+
+	entryOptions    EntryOptions
+	splitOutOfOrder bool
+	tracker         *streamTracker
+	dedupEntries    bool
+	deduper         *entryDeduper
+	proxyURL        *url.URL
+	retryPolicy     retry.Policy
+	timeout         time.Duration
+	extraLabels     map[string]string
+	noLineRefLabel  bool
+	maxLineBytes    int
+	maxPushBytes    int
+	compress        bool
+	format          string
+	recordedAtTime  bool
+	tenantID        string
+	bearerToken     string
+	// overrideReserved lets extraLabels replace the client's own labels
+	overrideReserved bool
+}
+
+// StatusError is returned when Loki responds with a non-2xx status
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Loki returned status %d", e.StatusCode)
+}
+
+// Option configures optional Client behaviour
+type Option func(*Client)
+
+// WithEntryOptions sets how individual vehicle log entries are built
+func WithEntryOptions(opts EntryOptions) Option {
+	return func(c *Client) {
+		c.entryOptions = opts
+	}
+}
+
+// WithOutOfOrderSplit moves entries older than the newest already pushed to a
+// stream into a separate out_of_order="true" stream, for Loki versions that
+// reject out-of-order writes
+func WithOutOfOrderSplit(enabled bool) Option {
+	return func(c *Client) {
+		c.splitOutOfOrder = enabled
+	}
+}
+
+// WithEntryDedup skips entries whose content is identical to one sent in the
+// previous push to the same stream
+func WithEntryDedup(enabled bool) Option {
+	return func(c *Client) {
+		c.dedupEntries = enabled
+	}
+}
+
+// WithProxy routes pushes through the given proxy. When unset, the
+// HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables are honoured.
+func WithProxy(proxyURL *url.URL) Option {
+	return func(c *Client) {
+		c.proxyURL = proxyURL
+	}
+}
+
+// DefaultTimeout bounds each request when no timeout is configured
+const DefaultTimeout = 30 * time.Second
+
+// WithTimeout sets the overall timeout for each of the client's pushes to Loki
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithRetryPolicy retries failed pushes according to policy
+func WithRetryPolicy(policy retry.Policy) Option {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+// WithLineRefLabel controls whether line_ref is a stream label. When disabled,
+// all lines share a single stream and line_ref is only in the log line body,
+// for users hitting Loki stream limits.
+func WithLineRefLabel(enabled bool) Option {
+	return func(c *Client) {
+		c.noLineRefLabel = !enabled
+	}
+}
+
+// WithMaxLineBytes keeps each log line within maxBytes, which should be at
+// most Loki's max_line_size. Oversize entries have their onward calls trimmed
+// first, then the bus image and monitored call; entries that still don't fit
+// are dropped.
+func WithMaxLineBytes(maxBytes int) Option {
+	return func(c *Client) {
+		c.maxLineBytes = maxBytes
+	}
+}
+
+// WithMaxPushBytes splits pushes whose body as sent, in the client's format
+// and after any compression, would exceed maxBytes into several requests,
+// sent one after another, so a large batch isn't rejected whole by Loki's
+// ingest limits
+func WithMaxPushBytes(maxBytes int) Option {
+	return func(c *Client) {
+		c.maxPushBytes = maxBytes
+	}
+}
+
+// WithCompression gzips push bodies, sending them with Content-Encoding: gzip.
+// It does not apply to FormatProtobuf, whose bodies are always snappy-compressed.
+func WithCompression(enabled bool) Option {
+	return func(c *Client) {
+		c.compress = enabled
+	}
+}
+
+// WithRecordedAtTimestamps stamps each entry with the vehicle's RecordedAtTime,
+// falling back to the fetch time and then the current time, instead of
+// always using the time of the push
+func WithRecordedAtTimestamps(enabled bool) Option {
+	return func(c *Client) {
+		c.recordedAtTime = enabled
+	}
+}
+
+// WithTenant sends pushes to a multi-tenant Loki tenant via the X-Scope-OrgID header
+func WithTenant(tenantID string) Option {
+	return func(c *Client) {
+		c.tenantID = tenantID
+	}
+}
+
+// WithBearerToken authenticates with an Authorization: Bearer header, taking
+// precedence over basic auth credentials
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.bearerToken = token
+	}
+}
+
+// WithLabel adds a static label to every stream pushed by the client
+func WithLabel(name, value string) Option {
+	return func(c *Client) {
+		if c.extraLabels == nil {
+			c.extraLabels = make(map[string]string)
+		}
+		c.extraLabels[name] = value
+	}
 }
 
 type PushRequest struct {
@@ -34,20 +190,40 @@ type Stream struct {
 	Values [][]string        `json:"values"`
 }
 
-func NewClient(baseURL, username, password string) *Client {
+func NewClient(baseURL, username, password string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:  baseURL,
+		username: username,
+		password: password,
+		tracer:   otel.Tracer("loki-client"),
+		tracker:  newStreamTracker(),
+		deduper:  newEntryDeduper(),
+
+		retryPolicy: retry.NoRetry,
+		timeout:     DefaultTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
 	// Create HTTP client with OpenTelemetry instrumentation
-	client := &http.Client{
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
-		Timeout:   30 * time.Second,
+	c.httpClient = &http.Client{
+		Transport: otelhttp.NewTransport(newTransport(c.proxyURL)),
+		Timeout:   c.timeout,
 	}
 
-	return &Client{
-		httpClient: client,
-		baseURL:    baseURL,
-		username:   username,
-		password:   password,
-		tracer:     otel.Tracer("loki-client"),
+	return c
+}
+
+// newTransport clones the default transport, keeping its environment-based
+// proxy handling unless an explicit proxy is configured
+func newTransport(proxyURL *url.URL) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
 	}
+	return transport
 }
 
 func (c *Client) SendBusData(ctx context.Context, data *types.ParsedBusData) error {
@@ -59,78 +235,278 @@ func (c *Client) SendBusData(ctx context.Context, data *types.ParsedBusData) err
 	)
 	defer span.End()
 
-	// Create individual log entries for each vehicle
-	var logValues [][]string
+	return c.send(ctx, span, []*types.ParsedBusData{data})
+}
+
+// SendBatch pushes the data for several lines in as few requests as possible,
+// normally one, with each line keeping its own stream
+func (c *Client) SendBatch(ctx context.Context, batch []*types.ParsedBusData) error {
+	vehicles := 0
+	for _, data := range batch {
+		vehicles += len(data.VehicleData)
+	}
+
+	ctx, span := c.tracer.Start(ctx, "loki.send_batch",
+		trace.WithAttributes(
+			attribute.Int("lines_count", len(batch)),
+			attribute.Int("vehicles_count", vehicles),
+		),
+	)
+	defer span.End()
+
+	return c.send(ctx, span, batch)
+}
+
+// lineEntries holds the log entries built for one line
+type lineEntries struct {
+	labels  map[string]string
+	key     string
+	entries []logEntry
+	hashes  []uint64
+}
+
+// send builds the streams for every line in batch and pushes them
+func (c *Client) send(ctx context.Context, span trace.Span, batch []*types.ParsedBusData) error {
+	var lines []lineEntries
+	skipped := 0
+	oversize := 0
+	for _, data := range batch {
+		line, lineSkipped, lineOversize, err := c.buildEntries(ctx, data)
+		if err != nil {
+			span.RecordError(err)
+			return err
+		}
+		lines = append(lines, line)
+		skipped += lineSkipped
+		oversize += lineOversize
+	}
+
+	span.SetAttributes(
+		attribute.Int("duplicate_entries_skipped", skipped),
+		attribute.Int("oversize_entries", oversize),
+	)
+
+	// Lines sharing a stream (without the line_ref label) are merged into it
+	var order []string
+	grouped := make(map[string]*lineEntries)
+	for _, line := range lines {
+		key := streamKey(line.labels)
+		group, ok := grouped[key]
+		if !ok {
+			group = &lineEntries{labels: line.labels}
+			grouped[key] = group
+			order = append(order, key)
+		}
+		group.entries = append(group.entries, line.entries...)
+	}
+
+	var streams []Stream
+	entriesCount := 0
+	for _, key := range order {
+		group := grouped[key]
+		entriesCount += len(group.entries)
+
+		// Keep entries sharing a second-precision timestamp distinct
+		spreadCoarseTimestamps(group.entries)
+
+		// Create Loki streams with individual log lines, ordered by timestamp
+		streams = append(streams, c.tracker.buildStreams(group.labels, group.entries, c.splitOutOfOrder)...)
+	}
+
+	// Split into several requests if the body would exceed the push size limit
+	requests, err := c.splitPush(streams)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to encode Loki request: %w", err)
+	}
+
+	span.SetAttributes(
+		attribute.Int("log_lines_count", entriesCount),
+		attribute.Int("streams_count", len(streams)),
+		attribute.Int("push_requests_count", len(requests)),
+	)
+
+	for i, request := range requests {
+		lokiReq := request.req
+
+		// Send to Loki
+		if err := retry.Do(ctx, c.pushPolicy(ctx), func(ctx context.Context) error {
+			return c.push(ctx, span, request)
+		}); err != nil {
+			span.RecordError(err)
+			if len(requests) > 1 {
+				return fmt.Errorf("push %d of %d: %w", i+1, len(requests), err)
+			}
+			return err
+		}
+		metrics.RecordBatchStreams(ctx, len(lokiReq.Streams))
+
+		// Record what was sent so far, so a later failed chunk can't cause
+		// these entries to be treated as out of order on the next push
+		c.tracker.markSent(lokiReq.Streams)
+	}
+	if c.dedupEntries {
+		for _, line := range lines {
+			c.deduper.remember(line.key, line.hashes)
+		}
+	}
+
+	return nil
+}
+
+// buildEntries creates the log entries for each vehicle on a line, skipping
+// duplicates and shrinking or dropping oversize entries
+func (c *Client) buildEntries(ctx context.Context, data *types.ParsedBusData) (line lineEntries, skipped, oversize int, err error) {
+	labels := map[string]string{
+		"job":     "bods2loki",
+		"service": "bus-tracking",
+	}
+	c.applyLabels(labels)
+	// line_ref is never overridden, so streams can't merge across lines
+	if !c.noLineRefLabel {
+		labels["line_ref"] = data.LineRef
+	}
+
+	// Dedup state is per line even when all lines share one stream
+	line = lineEntries{labels: labels, key: data.LineRef + "|" + streamKey(labels)}
 
 	for _, vehicle := range data.VehicleData {
 		// Create individual vehicle log entry
-		vehicleLog := map[string]interface{}{
-			"timestamp":                      data.Timestamp,
-			"line_ref":                       data.LineRef,
-			"vehicle_ref":                    vehicle.VehicleRef,
-			"direction_ref":                  vehicle.DirectionRef,
-			"operator_ref":                   vehicle.OperatorRef,
-			"origin_ref":                     vehicle.OriginRef,
-			"origin_name":                    vehicle.OriginName,
-			"destination_ref":                vehicle.DestinationRef,
-			"destination_name":               vehicle.DestinationName,
-			"origin_aimed_departure_time":    vehicle.OriginAimedDepartureTime,
-			"destination_aimed_arrival_time": vehicle.DestinationAimedArrivalTime,
-			"longitude":                      vehicle.Longitude,
-			"latitude":                       vehicle.Latitude,
-			"recorded_at_time":               vehicle.RecordedAtTime,
-			"valid_until_time":               vehicle.ValidUntilTime,
-			"bus_image":                      vehicle.BusImage,
+		vehicleLog := BuildVehicleEntry(data, vehicle, c.entryOptions)
+
+		// Skip entries identical to one already sent in the last push to this stream
+		if c.dedupEntries {
+			hash, err := entryHash(vehicleLog, c.entryOptions.timestampKey())
+			if err != nil {
+				return line, skipped, oversize, fmt.Errorf("failed to hash vehicle entry: %w", err)
+			}
+			line.hashes = append(line.hashes, hash)
+			if c.deduper.seen(line.key, hash) {
+				skipped++
+				continue
+			}
 		}
 
-		// Convert vehicle to JSON
-		vehicleJSON, err := json.Marshal(vehicleLog)
+		// Convert vehicle to JSON, shrinking it to fit the line size limit
+		vehicleJSON, truncated, fits, err := marshalWithinLimit(vehicleLog, c.maxLineBytes)
 		if err != nil {
-			span.RecordError(err)
-			return fmt.Errorf("failed to marshal vehicle JSON: %w", err)
+			return line, skipped, oversize, fmt.Errorf("failed to marshal vehicle JSON: %w", err)
+		}
+		if !fits {
+			metrics.RecordEntryAction(ctx, "oversize", "dropped")
+			oversize++
+			continue
+		}
+		if truncated {
+			metrics.RecordEntryAction(ctx, "oversize", "truncated")
+			oversize++
 		}
 
-		// Add to log values with current timestamp
-		logValues = append(logValues, []string{
-			strconv.FormatInt(time.Now().UnixNano(), 10),
-			string(vehicleJSON),
+		// Add to log entries with the observation time or the current time
+		timestamp := time.Now().UnixNano()
+		if c.recordedAtTime {
+			timestamp = entryTimestamp(data, vehicle)
+		}
+		line.entries = append(line.entries, logEntry{
+			timestamp: timestamp,
+			line:      string(vehicleJSON),
 		})
 	}
 
-	// Create Loki push request with individual log lines
+	return line, skipped, oversize, nil
+}
+
+// SendSummary pushes a single JSON entry describing a processing cycle to the
+// service="summary" stream, so operational health can be queried from Loki
+func (c *Client) SendSummary(ctx context.Context, summary interface{}) error {
+	ctx, span := c.tracer.Start(ctx, "loki.send_summary")
+	defer span.End()
+
+	labels := map[string]string{
+		"job":     "bods2loki",
+		"service": "summary",
+	}
+	c.applyLabels(labels)
+
+	summaryJSON, err := json.Marshal(summary)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to marshal summary JSON: %w", err)
+	}
+
 	lokiReq := PushRequest{
-		Streams: []Stream{
-			{
-				Stream: map[string]string{
-					"job":      "bods2loki",
-					"service":  "bus-tracking",
-					"line_ref": data.LineRef,
-				},
-				Values: logValues,
-			},
-		},
-	}
-
-	// Marshal Loki request
-	reqBody, err := json.Marshal(lokiReq)
+		Streams: []Stream{{
+			Stream: labels,
+			Values: [][]string{{strconv.FormatInt(time.Now().UnixNano(), 10), string(summaryJSON)}},
+		}},
+	}
+
+	request, err := c.encodeBody(lokiReq)
 	if err != nil {
 		span.RecordError(err)
-		return fmt.Errorf("failed to marshal Loki request: %w", err)
+		return fmt.Errorf("failed to encode Loki request: %w", err)
+	}
+
+	if err := retry.Do(ctx, c.pushPolicy(ctx), func(ctx context.Context) error {
+		return c.push(ctx, span, request)
+	}); err != nil {
+		span.RecordError(err)
+		return err
 	}
 
-	// Send to Loki
+	return nil
+}
+
+// pushPolicy returns the client's retry policy, counting each retry
+func (c *Client) pushPolicy(ctx context.Context) retry.Policy {
+	policy := c.retryPolicy
+	onRetry := policy.OnRetry
+	policy.OnRetry = func(attempt int, err error, delay time.Duration) {
+		reason := "error"
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) {
+			reason = strconv.Itoa(statusErr.StatusCode)
+		}
+		metrics.RecordLokiSendRetry(ctx, reason)
+		if onRetry != nil {
+			onRetry(attempt, err, delay)
+		}
+	}
+	return policy
+}
+
+// push makes a single POST of an encoded push request to Loki
+func (c *Client) push(ctx context.Context, span trace.Span, request encodedPush) error {
 	url := fmt.Sprintf("%s/loki/api/v1/push", c.baseURL)
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
+	body := request.body
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
 	if err != nil {
-		span.RecordError(err)
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	if c.format == FormatProtobuf {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+		if c.compress {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+	}
 	req.Header.Set("User-Agent", "bods2loki/1.0.0")
 
-	// Add basic authentication if credentials are provided
-	if c.username != "" && c.password != "" {
+	if c.tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", c.tenantID)
+	}
+
+	// Add bearer or basic authentication if credentials are provided
+	if c.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+		span.SetAttributes(
+			attribute.Bool("auth.enabled", true),
+			attribute.String("auth.type", "bearer"),
+		)
+	} else if c.username != "" && c.password != "" {
 		req.SetBasicAuth(c.username, c.password)
 		span.SetAttributes(
 			attribute.Bool("auth.enabled", true),
@@ -145,25 +521,32 @@ func (c *Client) SendBusData(ctx context.Context, data *types.ParsedBusData) err
 	span.SetAttributes(
 		attribute.String("http.url", url),
 		attribute.String("http.method", "POST"),
-		attribute.Int("request.size_bytes", len(reqBody)),
-		attribute.Int("log_lines_count", len(logValues)),
+		attribute.Int("request.size_bytes", len(body)),
+		attribute.Int("request.uncompressed_size_bytes", request.rawSize),
 	)
+	metrics.RecordHTTPRequestBodySize(ctx, "loki", len(body))
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		span.RecordError(err)
+		metrics.RecordLokiRequestFailed(ctx, err)
 		return fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
+	metrics.RecordLokiResponse(ctx, resp.StatusCode)
 
 	span.SetAttributes(
 		attribute.Int("http.status_code", resp.StatusCode),
 	)
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		err := fmt.Errorf("Loki returned status %d", resp.StatusCode)
-		span.RecordError(err)
-		return err
+		statusErr := &StatusError{StatusCode: resp.StatusCode}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			if after, ok := retry.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				span.SetAttributes(attribute.String("http.retry_after", after.String()))
+				return &retry.RetryAfterError{Err: statusErr, After: after}
+			}
+		}
+		return statusErr
 	}
 
 	return nil
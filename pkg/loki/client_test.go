@@ -0,0 +1,409 @@
+package loki
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"bods2loki/pkg/types"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// recordedPush is one request received by a pushRecorder
+type recordedPush struct {
+	header http.Header
+	body   []byte
+	req    PushRequest
+}
+
+// pushRecorder is a fake Loki that decodes and keeps every push it receives,
+// answering with the queued statuses and then 204
+type pushRecorder struct {
+	mu       sync.Mutex
+	pushes   []recordedPush
+	statuses []int
+	header   http.Header
+}
+
+func newPushRecorder(t *testing.T, statuses ...int) (*pushRecorder, *httptest.Server) {
+	t.Helper()
+
+	r := &pushRecorder{statuses: statuses}
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return r, server
+}
+
+func (r *pushRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	push, err := decodePush(req.Header, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.mu.Lock()
+	r.pushes = append(r.pushes, recordedPush{header: req.Header.Clone(), body: body, req: push})
+	status := http.StatusNoContent
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	for name, values := range r.header {
+		w.Header()[name] = values
+	}
+	r.mu.Unlock()
+
+	w.WriteHeader(status)
+}
+
+// received returns the pushes received so far
+func (r *pushRecorder) received() []recordedPush {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]recordedPush(nil), r.pushes...)
+}
+
+// entries returns every log line received, decoded, across all pushes
+func (r *pushRecorder) entries(t *testing.T) []map[string]interface{} {
+	t.Helper()
+
+	var entries []map[string]interface{}
+	for _, push := range r.received() {
+		for _, stream := range push.req.Streams {
+			for _, value := range stream.Values {
+				var entry map[string]interface{}
+				if err := json.Unmarshal([]byte(value[1]), &entry); err != nil {
+					t.Fatalf("log line is not JSON: %v", err)
+				}
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries
+}
+
+// decodePush decodes a push body in any of the formats the client sends
+func decodePush(header http.Header, body []byte) (PushRequest, error) {
+	var req PushRequest
+	switch {
+	case header.Get("Content-Type") == "application/x-protobuf":
+		decoded, err := snappy.Decode(nil, body)
+		if err != nil {
+			return req, fmt.Errorf("invalid snappy body: %w", err)
+		}
+		return unmarshalProtobuf(decoded)
+	case header.Get("Content-Encoding") == "gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return req, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		if body, err = io.ReadAll(gz); err != nil {
+			return req, fmt.Errorf("invalid gzip body: %w", err)
+		}
+	}
+	err := json.Unmarshal(body, &req)
+	return req, err
+}
+
+// unmarshalProtobuf decodes a logproto.PushRequest into the JSON push shape,
+// with labels kept as their selector string under the "labels" key
+func unmarshalProtobuf(body []byte) (PushRequest, error) {
+	var req PushRequest
+	err := eachField(body, func(num protowire.Number, streamMsg []byte) error {
+		stream := Stream{Stream: map[string]string{}}
+		err := eachField(streamMsg, func(num protowire.Number, field []byte) error {
+			if num == 1 {
+				stream.Stream["labels"] = string(field)
+				return nil
+			}
+
+			var nanos int64
+			var line string
+			err := eachField(field, func(num protowire.Number, entryField []byte) error {
+				if num == 2 {
+					line = string(entryField)
+					return nil
+				}
+				ts, err := unmarshalTimestamp(entryField)
+				nanos = ts
+				return err
+			})
+			stream.Values = append(stream.Values, []string{strconv.FormatInt(nanos, 10), line})
+			return err
+		})
+		req.Streams = append(req.Streams, stream)
+		return err
+	})
+	return req, err
+}
+
+// unmarshalTimestamp decodes a google.protobuf.Timestamp as Unix nanoseconds
+func unmarshalTimestamp(msg []byte) (int64, error) {
+	var nanos int64
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		if n < 0 || typ != protowire.VarintType {
+			return 0, fmt.Errorf("unexpected timestamp field %d of type %d", num, typ)
+		}
+		msg = msg[n:]
+		value, n := protowire.ConsumeVarint(msg)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		msg = msg[n:]
+		if num == 1 {
+			nanos += int64(value) * 1e9
+		} else {
+			nanos += int64(value)
+		}
+	}
+	return nanos, nil
+}
+
+// eachField calls fn with every length-delimited field of a message
+func eachField(msg []byte, fn func(protowire.Number, []byte) error) error {
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		if n < 0 || typ != protowire.BytesType {
+			return fmt.Errorf("unexpected protobuf field %d of type %d", num, typ)
+		}
+		msg = msg[n:]
+		value, n := protowire.ConsumeBytes(msg)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		msg = msg[n:]
+		if err := fn(num, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// testBusData returns parsed data for line with one vehicle per ref
+func testBusData(line string, vehicleRefs ...string) *types.ParsedBusData {
+	data := &types.ParsedBusData{
+		LineRef:   line,
+		Timestamp: "2025-10-09T15:37:40Z",
+	}
+	for _, ref := range vehicleRefs {
+		data.VehicleData = append(data.VehicleData, types.VehicleActivity{
+			LineRef:        line,
+			VehicleRef:     ref,
+			DirectionRef:   "inbound",
+			Latitude:       51.495853,
+			Longitude:      -2.480741,
+			LocationValid:  true,
+			RecordedAtTime: "2025-10-09T15:37:34+00:00",
+		})
+	}
+	return data
+}
+
+func TestPushThroughProxy(t *testing.T) {
+	var mu sync.Mutex
+	var targets []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		targets = append(targets, req.Method+" "+req.URL.String())
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(proxy.Close)
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	client := NewClient("http://loki.invalid:3100", "", "", WithProxy(proxyURL))
+	if err := client.SendBusData(context.Background(), testBusData("49x", "bus-1")); err != nil {
+		t.Fatalf("SendBusData: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(targets) != 1 || targets[0] != "POST http://loki.invalid:3100/loki/api/v1/push" {
+		t.Errorf("proxy received %q, want one push to loki.invalid", targets)
+	}
+}
+
+func TestLineRefLabel(t *testing.T) {
+	tests := []struct {
+		name    string
+		label   bool
+		streams int
+	}{
+		{"stream per line", true, 2},
+		{"single stream", false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, server := newPushRecorder(t)
+			client := NewClient(server.URL, "", "", WithLineRefLabel(tt.label))
+
+			batch := []*types.ParsedBusData{testBusData("49x", "bus-1", "bus-2"), testBusData("72", "bus-3")}
+			if err := client.SendBatch(context.Background(), batch); err != nil {
+				t.Fatalf("SendBatch: %v", err)
+			}
+
+			pushes := recorder.received()
+			if len(pushes) != 1 {
+				t.Fatalf("got %d pushes, want 1", len(pushes))
+			}
+			streams := pushes[0].req.Streams
+			if len(streams) != tt.streams {
+				t.Fatalf("got %d streams, want %d", len(streams), tt.streams)
+			}
+			for _, stream := range streams {
+				if _, ok := stream.Stream["line_ref"]; ok != tt.label {
+					t.Errorf("stream %v has line_ref label %v, want %v", stream.Stream, ok, tt.label)
+				}
+			}
+
+			lines := make(map[string]int)
+			for _, entry := range recorder.entries(t) {
+				ref, _ := entry["line_ref"].(string)
+				lines[ref]++
+			}
+			if lines["49x"] != 2 || lines["72"] != 1 {
+				t.Errorf("entries by line_ref = %v, want 2 for 49x and 1 for 72", lines)
+			}
+		})
+	}
+}
+
+func TestCompression(t *testing.T) {
+	tests := []struct {
+		name     string
+		compress bool
+		encoding string
+	}{
+		{"plain", false, ""},
+		{"gzip", true, "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, server := newPushRecorder(t)
+			client := NewClient(server.URL, "", "", WithCompression(tt.compress))
+
+			if err := client.SendBusData(context.Background(), testBusData("49x", "bus-1", "bus-2")); err != nil {
+				t.Fatalf("SendBusData: %v", err)
+			}
+
+			pushes := recorder.received()
+			if len(pushes) != 1 {
+				t.Fatalf("got %d pushes, want 1", len(pushes))
+			}
+			push := pushes[0]
+			if got := push.header.Get("Content-Encoding"); got != tt.encoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.encoding)
+			}
+			if got := push.header.Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+			if isGzip := bytes.HasPrefix(push.body, []byte{0x1f, 0x8b}); isGzip != tt.compress {
+				t.Errorf("body is gzip = %v, want %v", isGzip, tt.compress)
+			}
+
+			// The recorder only decodes valid bodies, so both vehicles arriving
+			// shows the gzip stream was complete
+			if got := len(recorder.entries(t)); got != 2 {
+				t.Errorf("decoded %d entries, want 2", got)
+			}
+		})
+	}
+}
+
+func TestTenantHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		tenant string
+	}{
+		{"single tenant", ""},
+		{"tenant", "bus-tracking"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, server := newPushRecorder(t)
+			client := NewClient(server.URL, "", "", WithTenant(tt.tenant))
+
+			if err := client.SendBusData(context.Background(), testBusData("49x", "bus-1")); err != nil {
+				t.Fatalf("SendBusData: %v", err)
+			}
+
+			header := recorder.received()[0].header
+			got := header.Values("X-Scope-OrgID")
+			if want := tt.tenant; (want == "" && len(got) != 0) || (want != "" && (len(got) != 1 || got[0] != want)) {
+				t.Errorf("X-Scope-OrgID = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	tests := []struct {
+		name               string
+		username, password string
+		token              string
+		want               string
+	}{
+		{"none", "", "", "", ""},
+		{"basic", "123456", "glc_secret", "", "Basic MTIzNDU2OmdsY19zZWNyZXQ="},
+		{"basic without password", "123456", "", "", ""},
+		{"bearer", "", "", "glc_token", "Bearer glc_token"},
+		{"bearer takes precedence", "123456", "glc_secret", "glc_token", "Bearer glc_token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, server := newPushRecorder(t)
+			client := NewClient(server.URL, tt.username, tt.password, WithBearerToken(tt.token))
+
+			if err := client.SendBusData(context.Background(), testBusData("49x", "bus-1")); err != nil {
+				t.Fatalf("SendBusData: %v", err)
+			}
+
+			got := recorder.received()[0].header.Values("Authorization")
+			if (tt.want == "" && len(got) != 0) || (tt.want != "" && (len(got) != 1 || got[0] != tt.want)) {
+				t.Errorf("Authorization = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want time.Duration
+	}{
+		{"default", nil, DefaultTimeout},
+		{"custom", []Option{WithTimeout(2 * time.Minute)}, 2 * time.Minute},
+		{"with proxy", []Option{WithTimeout(5 * time.Second), WithProxy(&url.URL{Scheme: "http", Host: "proxy:3128"})}, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewClient("http://loki:3100", "", "", tt.opts...).httpClient.Timeout; got != tt.want {
+				t.Errorf("http.Client.Timeout = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
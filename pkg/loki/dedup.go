@@ -0,0 +1,62 @@
+package loki
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+)
+
+// entryDeduper remembers the content hashes of the entries in the last push to
+// each stream so identical entries are not re-sent on the next cycle
+type entryDeduper struct {
+	mu   sync.Mutex
+	last map[string]map[uint64]struct{}
+}
+
+func newEntryDeduper() *entryDeduper {
+	return &entryDeduper{last: make(map[string]map[uint64]struct{})}
+}
+
+// entryHash hashes an entry's content. The per-cycle fetch timestamp, held
+// under timestampField, is excluded, otherwise no two entries would ever be
+// identical.
+func entryHash(entry map[string]interface{}, timestampField string) (uint64, error) {
+	content := make(map[string]interface{}, len(entry))
+	for k, v := range entry {
+		if k != timestampField {
+			content[k] = v
+		}
+	}
+
+	// Map keys are marshalled in sorted order, so the encoding is stable
+	encoded, err := json.Marshal(content)
+	if err != nil {
+		return 0, err
+	}
+
+	h := fnv.New64a()
+	h.Write(encoded)
+	return h.Sum64(), nil
+}
+
+// seen reports whether the hash was part of the last push to the stream
+func (d *entryDeduper) seen(key string, hash uint64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, ok := d.last[key][hash]
+	return ok
+}
+
+// remember replaces the stream's hash set with the hashes from the latest push,
+// including skipped entries so unchanged vehicles stay suppressed
+func (d *entryDeduper) remember(key string, hashes []uint64) {
+	set := make(map[uint64]struct{}, len(hashes))
+	for _, hash := range hashes {
+		set[hash] = struct{}{}
+	}
+
+	d.mu.Lock()
+	d.last[key] = set
+	d.mu.Unlock()
+}
@@ -0,0 +1,117 @@
+package loki
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestEntryHashIgnoresTimestampField(t *testing.T) {
+	tests := []struct {
+		name           string
+		timestampField string
+	}{
+		{"default field", ""},
+		{"renamed field", "@timestamp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := EntryOptions{TimestampField: tt.timestampField}
+			first := testBusData("49x", "bus-1")
+			second := testBusData("49x", "bus-1")
+			second.Timestamp = "2025-10-09T15:38:10Z"
+
+			a, err := entryHash(BuildVehicleEntry(first, first.VehicleData[0], opts), opts.timestampKey())
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := entryHash(BuildVehicleEntry(second, second.VehicleData[0], opts), opts.timestampKey())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a != b {
+				t.Errorf("entries differing only in fetch time hash differently")
+			}
+
+			second.VehicleData[0].Latitude += 0.01
+			c, err := entryHash(BuildVehicleEntry(second, second.VehicleData[0], opts), opts.timestampKey())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a == c {
+				t.Errorf("entries with different positions hash the same")
+			}
+		})
+	}
+}
+
+func TestEntryDedupSkipsIdenticalEntries(t *testing.T) {
+	for _, timestampField := range []string{"", "@timestamp"} {
+		t.Run("timestamp field "+timestampField, func(t *testing.T) {
+			recorder, server := newPushRecorder(t)
+			client := NewClient(server.URL, "", "",
+				WithEntryDedup(true),
+				WithEntryOptions(EntryOptions{TimestampField: timestampField}),
+			)
+			ctx := context.Background()
+
+			if err := client.SendBusData(ctx, testBusData("49x", "bus-1", "bus-2")); err != nil {
+				t.Fatal(err)
+			}
+
+			// The next cycle is fetched later, with bus-2 having moved
+			next := testBusData("49x", "bus-1", "bus-2")
+			next.Timestamp = "2025-10-09T15:38:10Z"
+			next.VehicleData[1].Latitude += 0.01
+			if err := client.SendBusData(ctx, next); err != nil {
+				t.Fatal(err)
+			}
+
+			entries := recorder.entries(t)
+			if len(entries) != 3 {
+				t.Fatalf("got %d entries, want 3 with the unchanged bus-1 skipped the second time", len(entries))
+			}
+			if ref := entries[2]["vehicle_ref"]; ref != "bus-2" {
+				t.Errorf("second push sent %v, want only the changed bus-2", ref)
+			}
+			key := timestampField
+			if key == "" {
+				key = "timestamp"
+			}
+			if _, ok := entries[2][key]; !ok {
+				t.Errorf("entry is missing its %q field", key)
+			}
+		})
+	}
+}
+
+func TestEntryDedupResends(t *testing.T) {
+	tests := []struct {
+		name     string
+		dedup    bool
+		statuses []int
+		want     int
+	}{
+		{"dedup disabled", false, nil, 4},
+		{"identical entries skipped", true, nil, 2},
+		{"failed push not remembered", true, []int{http.StatusBadRequest}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, server := newPushRecorder(t, tt.statuses...)
+			client := NewClient(server.URL, "", "", WithEntryDedup(tt.dedup))
+
+			// The first push may fail; the second cycle carries identical vehicles
+			client.SendBusData(context.Background(), testBusData("49x", "bus-1", "bus-2"))
+			if err := client.SendBusData(context.Background(), testBusData("49x", "bus-1", "bus-2")); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := len(recorder.entries(t)); got != tt.want {
+				t.Errorf("received %d entries, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package loki
+
+import (
+	"bods2loki/pkg/types"
+)
+
+// EntryOptions controls how individual vehicle log entries are built
+type EntryOptions struct {
+	// EmitZeroValues includes bearing/velocity when the feed provided them,
+	// even if the value is 0 (e.g. a stationary bus heading due north)
+	EmitZeroValues bool
+	// SessionID, when set, is added to every entry as session_id
+	SessionID string
+	// TimestampField is the key holding the entry timestamp, e.g. @timestamp
+	// or time for downstream parsers; empty means "timestamp"
+	TimestampField string
+	// StripFields names entry fields to leave out, e.g. bus_image, or
+	// line_ref when it is already a stream label
+	StripFields []string
+}
+
+// timestampKey returns the entry key holding the timestamp
+func (o EntryOptions) timestampKey() string {
+	if o.TimestampField == "" {
+		return "timestamp"
+	}
+	return o.TimestampField
+}
+
+// BuildVehicleEntry creates the log entry for a single vehicle. It is shared by
+// the Loki client and the dry-run output so both always print the same format.
+func BuildVehicleEntry(data *types.ParsedBusData, vehicle types.VehicleActivity, opts EntryOptions) map[string]interface{} {
+	entry := map[string]interface{}{
+		"timestamp":                      data.Timestamp,
+		"line_ref":                       data.LineRef,
+		"vehicle_ref":                    vehicle.VehicleRef,
+		"direction_ref":                  vehicle.DirectionRef,
+		"operator_ref":                   vehicle.OperatorRef,
+		"origin_ref":                     vehicle.OriginRef,
+		"origin_name":                    vehicle.OriginName,
+		"destination_ref":                vehicle.DestinationRef,
+		"destination_name":               vehicle.DestinationName,
+		"origin_aimed_departure_time":    vehicle.OriginAimedDepartureTime,
+		"destination_aimed_arrival_time": vehicle.DestinationAimedArrivalTime,
+		"longitude":                      vehicle.Longitude,
+		"latitude":                       vehicle.Latitude,
+		"recorded_at_time":               vehicle.RecordedAtTime,
+		"valid_until_time":               vehicle.ValidUntilTime,
+		"data_quality":                   vehicle.DataQuality,
+	}
+
+	// Empty when image generation is disabled
+	if vehicle.BusImage != "" {
+		entry["bus_image"] = vehicle.BusImage
+	}
+
+	// Zero bearing/velocity are omitted unless the feed provided them and zero values were requested
+	if vehicle.Bearing != 0 || (opts.EmitZeroValues && vehicle.HasBearing) {
+		entry["bearing"] = vehicle.Bearing
+	}
+	if vehicle.Velocity != 0 || (opts.EmitZeroValues && vehicle.HasVelocity) {
+		entry["velocity"] = vehicle.Velocity
+	}
+	if vehicle.SpeedMPH != 0 {
+		entry["speed_mph"] = vehicle.SpeedMPH
+		entry["speed_kph"] = vehicle.SpeedKPH
+	}
+	// Only invalid positions are flagged, keeping valid entries small
+	if !vehicle.LocationValid {
+		entry["location_valid"] = false
+	}
+	if vehicle.DestinationDisplay != "" {
+		entry["destination_display"] = vehicle.DestinationDisplay
+	}
+	if len(vehicle.Via) > 0 {
+		entry["via"] = vehicle.Via
+	}
+	if vehicle.CompassDirection != "" {
+		entry["compass_direction"] = vehicle.CompassDirection
+	}
+
+	if data.SnapshotID != "" {
+		entry["snapshot_id"] = data.SnapshotID
+	}
+	if opts.SessionID != "" {
+		entry["session_id"] = opts.SessionID
+	}
+	if vehicle.BlockRef != "" {
+		entry["block_ref"] = vehicle.BlockRef
+	}
+	if vehicle.DatedVehicleJourneyRef != "" {
+		entry["dated_vehicle_journey_ref"] = vehicle.DatedVehicleJourneyRef
+	}
+	if vehicle.DataFrameRef != "" {
+		entry["data_frame_ref"] = vehicle.DataFrameRef
+	}
+	if vehicle.MonitoredCall != nil {
+		entry["monitored_call"] = vehicle.MonitoredCall
+	}
+	if len(vehicle.OnwardCalls) > 0 {
+		entry["onward_calls"] = vehicle.OnwardCalls
+	}
+	if vehicle.Monitored != nil {
+		entry["monitored"] = *vehicle.Monitored
+	}
+	if vehicle.InCongestion != nil {
+		entry["in_congestion"] = *vehicle.InCongestion
+	}
+	if vehicle.InPanic != nil {
+		entry["in_panic"] = *vehicle.InPanic
+	}
+	if vehicle.VehicleStatus != "" {
+		entry["vehicle_status"] = vehicle.VehicleStatus
+	}
+	if vehicle.IsLate != nil {
+		entry["is_late"] = *vehicle.IsLate
+		entry["delay_bucket"] = vehicle.DelayBucket
+	}
+	if vehicle.DelaySeconds != 0 {
+		entry["delay_seconds"] = vehicle.DelaySeconds
+	}
+
+	if key := opts.timestampKey(); key != "timestamp" {
+		entry[key] = entry["timestamp"]
+		delete(entry, "timestamp")
+	}
+
+	for _, field := range opts.StripFields {
+		delete(entry, field)
+	}
+
+	return entry
+}
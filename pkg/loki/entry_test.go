@@ -0,0 +1,175 @@
+package loki
+
+import (
+	"testing"
+
+	"bods2loki/pkg/types"
+)
+
+func TestBuildVehicleEntryZeroValues(t *testing.T) {
+	tests := []struct {
+		name         string
+		vehicle      types.VehicleActivity
+		emitZero     bool
+		wantVelocity bool
+		wantBearing  bool
+	}{
+		{"provided zeros omitted by default", types.VehicleActivity{HasVelocity: true, HasBearing: true}, false, false, false},
+		{"provided zeros emitted", types.VehicleActivity{HasVelocity: true, HasBearing: true}, true, true, true},
+		{"absent values omitted", types.VehicleActivity{}, true, false, false},
+		{"non-zero values always emitted", types.VehicleActivity{Velocity: 4.2, HasVelocity: true, Bearing: 90, HasBearing: true}, false, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := testBusData("49x")
+			entry := BuildVehicleEntry(data, tt.vehicle, EntryOptions{EmitZeroValues: tt.emitZero})
+
+			velocity, hasVelocity := entry["velocity"]
+			if hasVelocity != tt.wantVelocity || (hasVelocity && velocity != tt.vehicle.Velocity) {
+				t.Errorf("velocity = %v (present %v), want present %v", velocity, hasVelocity, tt.wantVelocity)
+			}
+			bearing, hasBearing := entry["bearing"]
+			if hasBearing != tt.wantBearing || (hasBearing && bearing != tt.vehicle.Bearing) {
+				t.Errorf("bearing = %v (present %v), want present %v", bearing, hasBearing, tt.wantBearing)
+			}
+		})
+	}
+}
+
+func TestBuildVehicleEntryLateness(t *testing.T) {
+	late := true
+	tests := []struct {
+		name    string
+		vehicle types.VehicleActivity
+		want    map[string]interface{}
+	}{
+		{"unknown delay omitted", types.VehicleActivity{}, map[string]interface{}{}},
+		{"late", types.VehicleActivity{IsLate: &late, DelayBucket: "major", DelaySeconds: 420}, map[string]interface{}{
+			"is_late": true, "delay_bucket": "major", "delay_seconds": 420,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := BuildVehicleEntry(testBusData("49x"), tt.vehicle, EntryOptions{})
+			for _, key := range []string{"is_late", "delay_bucket", "delay_seconds"} {
+				got, ok := entry[key]
+				want, wantOK := tt.want[key]
+				if ok != wantOK || got != want {
+					t.Errorf("%s = %v (present %v), want %v (present %v)", key, got, ok, want, wantOK)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildVehicleEntryStripFields(t *testing.T) {
+	vehicle := testBusData("49x", "bus-1").VehicleData[0]
+	vehicle.BusImage = "data:image/svg+xml;base64,PHN2Zy8+"
+
+	tests := []struct {
+		name    string
+		display string
+		strip   []string
+		absent  []string
+		present []string
+	}{
+		{"nothing stripped", "", nil, []string{"destination_display"}, []string{"line_ref", "bus_image", "vehicle_ref", "latitude"}},
+		{"destination display", "Bristol Parkway", nil, nil, []string{"destination_display"}},
+		{"image", "", []string{"bus_image"}, []string{"bus_image"}, []string{"line_ref", "vehicle_ref", "latitude"}},
+		{"duplicated line_ref", "", []string{"line_ref", "bus_image"}, []string{"line_ref", "bus_image"}, []string{"vehicle_ref", "direction_ref", "latitude", "timestamp"}},
+		{"unknown field", "", []string{"no_such_field"}, nil, []string{"line_ref", "bus_image", "vehicle_ref"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Optional fields are left out when empty, like stripped ones
+			vehicle := vehicle
+			vehicle.DestinationDisplay = tt.display
+			entry := BuildVehicleEntry(testBusData("49x"), vehicle, EntryOptions{StripFields: tt.strip})
+			for _, key := range tt.absent {
+				if got, ok := entry[key]; ok {
+					t.Errorf("%s = %v, want it absent", key, got)
+				}
+			}
+			for _, key := range tt.present {
+				if _, ok := entry[key]; !ok {
+					t.Errorf("%s missing, want it kept", key)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildVehicleEntrySnapshotID(t *testing.T) {
+	tests := []struct {
+		name     string
+		snapshot string
+	}{
+		{"snapshot", "5b7c2c1e-6b2f-4d3a-9a51-0c6d4f3e2a10"},
+		{"no snapshot", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := testBusData("49x", "bus-1", "bus-2", "bus-3")
+			data.SnapshotID = tt.snapshot
+
+			// Every vehicle from one response carries the same snapshot_id
+			for _, vehicle := range data.VehicleData {
+				entry := BuildVehicleEntry(data, vehicle, EntryOptions{})
+				got, ok := entry["snapshot_id"]
+				if ok != (tt.snapshot != "") || (ok && got != tt.snapshot) {
+					t.Errorf("%s snapshot_id = %v (present %v), want %q", vehicle.VehicleRef, got, ok, tt.snapshot)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildVehicleEntryBusImage(t *testing.T) {
+	tests := []struct {
+		name  string
+		image string
+	}{
+		{"image", "PHN2Zz48L3N2Zz4="},
+		{"images disabled", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := BuildVehicleEntry(testBusData("49x"), types.VehicleActivity{BusImage: tt.image}, EntryOptions{})
+			got, ok := entry["bus_image"]
+			if ok != (tt.image != "") || (ok && got != tt.image) {
+				t.Errorf("bus_image = %v (present %v), want %q", got, ok, tt.image)
+			}
+		})
+	}
+}
+
+func TestBuildVehicleEntryJourneyRefs(t *testing.T) {
+	tests := []struct {
+		name      string
+		dated     string
+		dataFrame string
+	}{
+		{"both refs", "1523", "2025-10-09"},
+		{"dated ref only", "1523", ""},
+		{"no refs", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vehicle := types.VehicleActivity{DatedVehicleJourneyRef: tt.dated, DataFrameRef: tt.dataFrame}
+			entry := BuildVehicleEntry(testBusData("49x"), vehicle, EntryOptions{})
+
+			for field, want := range map[string]string{"dated_vehicle_journey_ref": tt.dated, "data_frame_ref": tt.dataFrame} {
+				got, ok := entry[field]
+				if ok != (want != "") || (ok && got != want) {
+					t.Errorf("%s = %v (present %v), want %q", field, got, ok, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package loki
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// ReservedLabels are set by the client itself. Configured labels may only
+// replace them with WithReservedLabelOverride, and line_ref never.
+var ReservedLabels = []string{"job", "service", "stream", "line_ref"}
+
+// labelName matches a valid Loki label name
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// WithLabels adds static labels to every stream pushed by the client
+func WithLabels(labels map[string]string) Option {
+	return func(c *Client) {
+		for name, value := range labels {
+			WithLabel(name, value)(c)
+		}
+	}
+}
+
+// WithReservedLabelOverride lets configured labels replace job, service and
+// stream, e.g. to run several pipelines under different job names
+func WithReservedLabelOverride(enabled bool) Option {
+	return func(c *Client) {
+		c.overrideReserved = enabled
+	}
+}
+
+// ValidateLabels checks configured labels have valid names and, unless
+// allowReserved is set, don't replace a reserved label
+func ValidateLabels(labels map[string]string, allowReserved bool) error {
+	for name := range labels {
+		if !labelName.MatchString(name) {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+		if name == "line_ref" || (!allowReserved && slices.Contains(ReservedLabels, name)) {
+			return fmt.Errorf("label %q is reserved", name)
+		}
+	}
+	return nil
+}
+
+// applyLabels adds the configured labels to a stream's labels, leaving
+// reserved ones alone unless overriding them is allowed
+func (c *Client) applyLabels(labels map[string]string) {
+	for name, value := range c.extraLabels {
+		if _, set := labels[name]; set && !c.overrideReserved {
+			continue
+		}
+		labels[name] = value
+	}
+}
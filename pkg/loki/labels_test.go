@@ -0,0 +1,77 @@
+package loki
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestValidateLabels(t *testing.T) {
+	tests := []struct {
+		name          string
+		labels        map[string]string
+		allowReserved bool
+		wantErr       bool
+	}{
+		{"custom labels", map[string]string{"region": "south_west", "env": "prod"}, false, false},
+		{"none", nil, false, false},
+		{"invalid name", map[string]string{"bus-region": "south_west"}, false, true},
+		{"leading digit", map[string]string{"1region": "south_west"}, false, true},
+		{"reserved", map[string]string{"job": "bods2loki_staging"}, false, true},
+		{"reserved allowed", map[string]string{"job": "bods2loki_staging"}, true, false},
+		{"line_ref always reserved", map[string]string{"line_ref": "49x"}, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateLabels(tt.labels, tt.allowReserved); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateLabels(%v, %v) error = %v, wantErr %v", tt.labels, tt.allowReserved, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCustomLabels(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		override bool
+		want     map[string]string
+	}{
+		{
+			name:   "custom labels added",
+			labels: map[string]string{"region": "south_west", "env": "prod"},
+			want:   map[string]string{"job": "bods2loki", "service": "bus-tracking", "line_ref": "49x", "region": "south_west", "env": "prod"},
+		},
+		{
+			name:   "reserved labels kept",
+			labels: map[string]string{"job": "other", "service": "other", "line_ref": "other"},
+			want:   map[string]string{"job": "bods2loki", "service": "bus-tracking", "line_ref": "49x"},
+		},
+		{
+			name:     "reserved labels overridden",
+			labels:   map[string]string{"job": "bods2loki_staging", "line_ref": "other"},
+			override: true,
+			want:     map[string]string{"job": "bods2loki_staging", "service": "bus-tracking", "line_ref": "49x"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, server := newPushRecorder(t)
+			client := NewClient(server.URL, "", "", WithLabels(tt.labels), WithReservedLabelOverride(tt.override))
+
+			if err := client.SendBusData(context.Background(), testBusData("49x", "bus-1")); err != nil {
+				t.Fatalf("SendBusData: %v", err)
+			}
+
+			streams := recorder.received()[0].req.Streams
+			if len(streams) != 1 {
+				t.Fatalf("got %d streams, want 1", len(streams))
+			}
+			if got := streams[0].Stream; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("labels = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package loki
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// outOfOrderLabel marks the companion stream holding entries that are older than
+// what has already been pushed to their original stream
+const outOfOrderLabel = "out_of_order"
+
+// logEntry is a single Loki log line with its timestamp in nanoseconds
+type logEntry struct {
+	timestamp int64
+	line      string
+}
+
+// streamTracker remembers the newest timestamp pushed to each stream so that
+// entries older Loki versions would reject as out of order can be split off
+type streamTracker struct {
+	mu     sync.Mutex
+	newest map[string]int64
+}
+
+func newStreamTracker() *streamTracker {
+	return &streamTracker{newest: make(map[string]int64)}
+}
+
+// buildStreams sorts entries by timestamp and, when splitLate is set, moves any
+// entry older than the newest already sent for the stream into a companion
+// stream labelled out_of_order="true"
+func (t *streamTracker) buildStreams(labels map[string]string, entries []logEntry, splitLate bool) []Stream {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].timestamp < entries[j].timestamp
+	})
+
+	var newest int64
+	if splitLate {
+		t.mu.Lock()
+		newest = t.newest[streamKey(labels)]
+		t.mu.Unlock()
+	}
+
+	var inOrder, late [][]string
+	for _, entry := range entries {
+		value := []string{strconv.FormatInt(entry.timestamp, 10), entry.line}
+		if splitLate && entry.timestamp < newest {
+			late = append(late, value)
+		} else {
+			inOrder = append(inOrder, value)
+		}
+	}
+
+	var streams []Stream
+	if len(inOrder) > 0 {
+		streams = append(streams, Stream{Stream: labels, Values: inOrder})
+	}
+	if len(late) > 0 {
+		lateLabels := make(map[string]string, len(labels)+1)
+		for k, v := range labels {
+			lateLabels[k] = v
+		}
+		lateLabels[outOfOrderLabel] = "true"
+		streams = append(streams, Stream{Stream: lateLabels, Values: late})
+	}
+
+	return streams
+}
+
+// markSent records the newest timestamp of each successfully pushed stream
+func (t *streamTracker) markSent(streams []Stream) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, stream := range streams {
+		key := streamKey(stream.Stream)
+		for _, value := range stream.Values {
+			ts, err := strconv.ParseInt(value[0], 10, 64)
+			if err == nil && ts > t.newest[key] {
+				t.newest[key] = ts
+			}
+		}
+	}
+}
+
+// streamKey builds a stable identifier for a label set
+func streamKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(labels[k])
+		b.WriteByte(',')
+	}
+	return b.String()
+}
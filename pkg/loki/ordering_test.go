@@ -0,0 +1,79 @@
+package loki
+
+import (
+	"reflect"
+	"testing"
+)
+
+// timestamps returns the timestamps of a stream's values
+func timestamps(stream Stream) []string {
+	var ts []string
+	for _, value := range stream.Values {
+		ts = append(ts, value[0])
+	}
+	return ts
+}
+
+func TestBuildStreams(t *testing.T) {
+	labels := map[string]string{"service": "bods2loki", "line_ref": "49x"}
+	entries := func() []logEntry {
+		return []logEntry{{300, "c"}, {100, "a"}, {200, "b"}}
+	}
+
+	tests := []struct {
+		name      string
+		sent      int64
+		splitLate bool
+		inOrder   []string
+		late      []string
+	}{
+		{"sorted", 0, false, []string{"100", "200", "300"}, nil},
+		{"nothing sent yet", 0, true, []string{"100", "200", "300"}, nil},
+		{"older than last push", 250, true, []string{"300"}, []string{"100", "200"}},
+		{"split disabled", 250, false, []string{"100", "200", "300"}, nil},
+		{"all late", 400, true, nil, []string{"100", "200", "300"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newStreamTracker()
+			if tt.sent > 0 {
+				tracker.newest[streamKey(labels)] = tt.sent
+			}
+
+			var inOrder, late []string
+			for _, stream := range tracker.buildStreams(labels, entries(), tt.splitLate) {
+				if stream.Stream[outOfOrderLabel] == "true" {
+					late = timestamps(stream)
+					if stream.Stream["line_ref"] != "49x" {
+						t.Errorf("late stream lost its labels: %v", stream.Stream)
+					}
+				} else {
+					inOrder = timestamps(stream)
+				}
+			}
+
+			if !reflect.DeepEqual(inOrder, tt.inOrder) || !reflect.DeepEqual(late, tt.late) {
+				t.Errorf("in order %v, late %v; want %v, %v", inOrder, late, tt.inOrder, tt.late)
+			}
+		})
+	}
+}
+
+func TestMarkSentTracksNewestPerStream(t *testing.T) {
+	tracker := newStreamTracker()
+	a := map[string]string{"line_ref": "49x"}
+	b := map[string]string{"line_ref": "72"}
+
+	tracker.markSent([]Stream{
+		{Stream: a, Values: [][]string{{"300", "x"}, {"100", "y"}}},
+		{Stream: b, Values: [][]string{{"50", "z"}}},
+	})
+
+	if got := tracker.newest[streamKey(a)]; got != 300 {
+		t.Errorf("newest for 49x = %d, want 300", got)
+	}
+	if got := tracker.newest[streamKey(b)]; got != 50 {
+		t.Errorf("newest for 72 = %d, want 50", got)
+	}
+}
@@ -0,0 +1,57 @@
+package loki
+
+import (
+	"hash/fnv"
+	"time"
+
+	"bods2loki/pkg/types"
+)
+
+// spreadCoarseTimestamps gives entries with whole-second timestamps (as
+// produced from second-precision source times such as RecordedAtTime) a
+// deterministic sub-second offset derived from the entry content, so vehicles
+// sharing a second don't collide on identical timestamps in a stream. Offsets
+// are bumped by a nanosecond until unique within the push. Entries that
+// already carry sub-second precision are left unchanged.
+func spreadCoarseTimestamps(entries []logEntry) {
+	const second = int64(time.Second)
+
+	used := make(map[int64]bool, len(entries))
+	for _, entry := range entries {
+		if entry.timestamp%second != 0 {
+			used[entry.timestamp] = true
+		}
+	}
+
+	for i := range entries {
+		base := entries[i].timestamp
+		if base%second != 0 {
+			continue
+		}
+
+		h := fnv.New32a()
+		h.Write([]byte(entries[i].line))
+		offset := int64(h.Sum32()) % second
+
+		// Stay within the original second so ordering between seconds is preserved
+		for used[base+offset] {
+			offset = (offset + 1) % second
+		}
+		entries[i].timestamp = base + offset
+		used[entries[i].timestamp] = true
+	}
+}
+
+// entryTimestamp returns the Loki timestamp for a vehicle entry: its
+// RecordedAtTime when valid, else the fetch time, else now
+func entryTimestamp(data *types.ParsedBusData, vehicle types.VehicleActivity) int64 {
+	for _, ts := range []string{vehicle.RecordedAtTime, data.Timestamp} {
+		if ts == "" {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, ts); err == nil {
+			return t.UnixNano()
+		}
+	}
+	return time.Now().UnixNano()
+}
@@ -0,0 +1,163 @@
+package loki
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"bods2loki/pkg/types"
+)
+
+func TestSpreadCoarseTimestamps(t *testing.T) {
+	second := time.Date(2025, 10, 9, 15, 37, 34, 0, time.UTC).UnixNano()
+	precise := second + 123456789
+
+	tests := []struct {
+		name    string
+		entries []logEntry
+	}{
+		{"distinct lines in one second", []logEntry{{second, `{"v":1}`}, {second, `{"v":2}`}, {second, `{"v":3}`}}},
+		{"identical lines in one second", []logEntry{{second, `{"v":1}`}, {second, `{"v":1}`}, {second, `{"v":1}`}}},
+		{"mixed precision", []logEntry{{precise, `{"v":1}`}, {second, `{"v":2}`}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := append([]logEntry(nil), tt.entries...)
+			spreadCoarseTimestamps(entries)
+
+			seen := make(map[int64]bool)
+			for i, entry := range entries {
+				if seen[entry.timestamp] {
+					t.Errorf("entry %d reuses timestamp %d", i, entry.timestamp)
+				}
+				seen[entry.timestamp] = true
+
+				original := tt.entries[i].timestamp
+				if original%int64(time.Second) != 0 && entry.timestamp != original {
+					t.Errorf("entry %d sub-second timestamp changed from %d to %d", i, original, entry.timestamp)
+				}
+				if entry.timestamp-original >= int64(time.Second) || entry.timestamp < original {
+					t.Errorf("entry %d moved out of its second: %d -> %d", i, original, entry.timestamp)
+				}
+			}
+		})
+	}
+
+	// The spread is deterministic, so a resent push keeps its timestamps
+	a := []logEntry{{second, `{"v":1}`}, {second, `{"v":2}`}}
+	b := []logEntry{{second, `{"v":1}`}, {second, `{"v":2}`}}
+	spreadCoarseTimestamps(a)
+	spreadCoarseTimestamps(b)
+	if a[0] != b[0] || a[1] != b[1] {
+		t.Errorf("spreading the same entries gave %v and %v", a, b)
+	}
+}
+
+func TestEntryTimestamp(t *testing.T) {
+	recordedAt := time.Date(2025, 10, 9, 15, 37, 34, 0, time.UTC)
+	fetchedAt := time.Date(2025, 10, 9, 15, 37, 40, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		recordedAt string
+		fetchedAt  string
+		want       time.Time
+	}{
+		{"valid RecordedAtTime", "2025-10-09T16:37:34+01:00", "2025-10-09T15:37:40Z", recordedAt},
+		{"fractional RecordedAtTime", "2025-10-09T15:37:34.25Z", "2025-10-09T15:37:40Z", recordedAt.Add(250 * time.Millisecond)},
+		{"missing RecordedAtTime", "", "2025-10-09T15:37:40Z", fetchedAt},
+		{"malformed RecordedAtTime", "09/10/2025 15:37", "2025-10-09T15:37:40Z", fetchedAt},
+		{"nothing valid", "soon", "", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &types.ParsedBusData{LineRef: "49x", Timestamp: tt.fetchedAt}
+			before := time.Now()
+			got := entryTimestamp(data, types.VehicleActivity{RecordedAtTime: tt.recordedAt})
+
+			if tt.want.IsZero() {
+				// Falls back to the current time
+				if got < before.UnixNano() || got > time.Now().UnixNano() {
+					t.Errorf("entryTimestamp = %v, want now", time.Unix(0, got))
+				}
+				return
+			}
+			if got != tt.want.UnixNano() {
+				t.Errorf("entryTimestamp = %v, want %v", time.Unix(0, got).UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordedAtTimestampsOption(t *testing.T) {
+	tests := []struct {
+		name       string
+		recordedAt bool
+	}{
+		{"ingestion time by default", false},
+		{"recorded at time", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, server := newPushRecorder(t)
+			client := NewClient(server.URL, "", "", WithRecordedAtTimestamps(tt.recordedAt))
+
+			before := time.Now()
+			if err := client.SendBusData(context.Background(), testBusData("49x", "bus-1")); err != nil {
+				t.Fatalf("SendBusData: %v", err)
+			}
+
+			value := recorder.received()[0].req.Streams[0].Values[0]
+			ns, err := strconv.ParseInt(value[0], 10, 64)
+			if err != nil {
+				t.Fatalf("timestamp %q: %v", value[0], err)
+			}
+			// testBusData vehicles were recorded at 15:37:34 on 2025-10-09
+			recorded := time.Date(2025, 10, 9, 15, 37, 34, 0, time.UTC)
+			if isRecorded := time.Unix(0, ns).Truncate(time.Second).Equal(recorded); isRecorded != tt.recordedAt {
+				t.Errorf("timestamp %v is RecordedAtTime = %v, want %v", time.Unix(0, ns).UTC(), isRecorded, tt.recordedAt)
+			}
+			if !tt.recordedAt && ns < before.UnixNano() {
+				t.Errorf("timestamp %v is before the push started at %v", time.Unix(0, ns), before)
+			}
+		})
+	}
+}
+
+func TestRecordedAtTimestampsAreUnique(t *testing.T) {
+	recorder, server := newPushRecorder(t)
+	client := NewClient(server.URL, "", "", WithRecordedAtTimestamps(true))
+
+	// Every vehicle shares the RecordedAtTime second 15:37:34
+	if err := client.SendBusData(context.Background(), testBusData("49x", "bus-1", "bus-2", "bus-3", "bus-4")); err != nil {
+		t.Fatalf("SendBusData: %v", err)
+	}
+
+	recordedAt := time.Date(2025, 10, 9, 15, 37, 34, 0, time.UTC)
+	seen := make(map[string]bool)
+	for _, push := range recorder.received() {
+		for _, stream := range push.req.Streams {
+			for _, value := range stream.Values {
+				if seen[value[0]] {
+					t.Errorf("timestamp %s pushed twice", value[0])
+				}
+				seen[value[0]] = true
+
+				ns, err := strconv.ParseInt(value[0], 10, 64)
+				if err != nil {
+					t.Fatalf("timestamp %q: %v", value[0], err)
+				}
+				if got := time.Unix(0, ns).UTC().Truncate(time.Second); !got.Equal(recordedAt) {
+					t.Errorf("timestamp %s is in %v, want the RecordedAtTime second %v", value[0], got, recordedAt)
+				}
+			}
+		}
+	}
+	if len(seen) != 4 {
+		t.Errorf("pushed %d distinct timestamps, want 4", len(seen))
+	}
+}
@@ -0,0 +1,118 @@
+package loki
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Push body formats
+const (
+	// FormatJSON pushes JSON bodies, optionally gzipped
+	FormatJSON = "json"
+	// FormatProtobuf pushes snappy-compressed logproto.PushRequest bodies,
+	// Loki's native format, which is smaller and cheaper for Loki to decode
+	FormatProtobuf = "protobuf"
+)
+
+// WithFormat selects the push body format, FormatJSON (the default) or FormatProtobuf
+func WithFormat(format string) Option {
+	return func(c *Client) {
+		c.format = format
+	}
+}
+
+// encodeBody encodes a push request in the client's format and compresses it:
+// protobuf is always snappy-compressed, JSON is gzipped when enabled
+func (c *Client) encodeBody(req PushRequest) (encodedPush, error) {
+	if c.format == FormatProtobuf {
+		raw, err := marshalProtobuf(req)
+		if err != nil {
+			return encodedPush{}, err
+		}
+		return encodedPush{req: req, body: snappy.Encode(nil, raw), rawSize: len(raw)}, nil
+	}
+
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return encodedPush{}, err
+	}
+	if !c.compress {
+		return encodedPush{req: req, body: raw, rawSize: len(raw)}, nil
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(raw); err != nil {
+		return encodedPush{}, fmt.Errorf("failed to compress request: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return encodedPush{}, fmt.Errorf("failed to compress request: %w", err)
+	}
+	return encodedPush{req: req, body: buf.Bytes(), rawSize: len(raw)}, nil
+}
+
+// marshalProtobuf encodes req as a logproto.PushRequest:
+//
+//	PushRequest   { repeated StreamAdapter streams = 1; }
+//	StreamAdapter { string labels = 1; repeated EntryAdapter entries = 2; }
+//	EntryAdapter  { google.protobuf.Timestamp timestamp = 1; string line = 2; }
+func marshalProtobuf(req PushRequest) ([]byte, error) {
+	var body []byte
+	for _, stream := range req.Streams {
+		var streamMsg []byte
+		streamMsg = protowire.AppendTag(streamMsg, 1, protowire.BytesType)
+		streamMsg = protowire.AppendString(streamMsg, labelString(stream.Stream))
+
+		for _, value := range stream.Values {
+			if len(value) < 2 {
+				return nil, fmt.Errorf("stream value has %d fields, expected a timestamp and line", len(value))
+			}
+			nanos, err := strconv.ParseInt(value[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid entry timestamp %q: %w", value[0], err)
+			}
+
+			var timestamp []byte
+			timestamp = protowire.AppendTag(timestamp, 1, protowire.VarintType)
+			timestamp = protowire.AppendVarint(timestamp, uint64(nanos/1e9))
+			timestamp = protowire.AppendTag(timestamp, 2, protowire.VarintType)
+			timestamp = protowire.AppendVarint(timestamp, uint64(nanos%1e9))
+
+			var entry []byte
+			entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+			entry = protowire.AppendBytes(entry, timestamp)
+			entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+			entry = protowire.AppendString(entry, value[1])
+
+			streamMsg = protowire.AppendTag(streamMsg, 2, protowire.BytesType)
+			streamMsg = protowire.AppendBytes(streamMsg, entry)
+		}
+
+		body = protowire.AppendTag(body, 1, protowire.BytesType)
+		body = protowire.AppendBytes(body, streamMsg)
+	}
+	return body, nil
+}
+
+// labelString formats labels as a LogQL stream selector, e.g. {job="bods2loki"}
+func labelString(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.Quote(labels[name])
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
@@ -0,0 +1,42 @@
+package loki
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"bods2loki/pkg/retry"
+)
+
+// maxRetryDelay caps the backoff between push attempts
+const maxRetryDelay = 30 * time.Second
+
+// WithRetry retries pushes rejected with a 429 or 5xx, or failing with a
+// network error, up to maxAttempts in total. A Retry-After header on a 429 is
+// honoured; otherwise the wait backs off exponentially from baseDelay.
+func WithRetry(maxAttempts int, baseDelay time.Duration) Option {
+	return WithRetryPolicy(retry.Policy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   baseDelay,
+		MaxDelay:    maxRetryDelay,
+		Jitter:      0.2,
+		Retryable:   IsRetryable,
+	})
+}
+
+// IsRetryable reports whether a push error is likely transient
+func IsRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
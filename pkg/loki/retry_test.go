@@ -0,0 +1,113 @@
+package loki
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendBusDataRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int
+		wantErr  bool
+	}{
+		{"503 twice then success", []int{503, 503}, 3, false},
+		{"429 then success", []int{429}, 2, false},
+		{"attempts exhausted", []int{503, 502, 500}, 3, true},
+		{"4xx not retried", []int{400}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, server := newPushRecorder(t, tt.statuses...)
+			client := NewClient(server.URL, "", "", WithRetry(3, time.Millisecond))
+
+			err := client.SendBusData(context.Background(), testBusData("49x", "bus-1"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SendBusData error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := len(recorder.received()); got != tt.attempts {
+				t.Errorf("got %d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"server error", &StatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"rate limited", &StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"bad request", &StatusError{StatusCode: http.StatusBadRequest}, false},
+		{"network error", fmt.Errorf("push: %w", &net.DNSError{Err: "no such host", IsTemporary: true}), true},
+		{"cancelled", fmt.Errorf("push: %w", context.Canceled), false},
+		{"other error", errors.New("encode failed"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendBusDataHonoursRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		timeout    time.Duration
+		attempts   int
+		wantErr    string
+	}{
+		// The 1m backoff can't finish within the timeout, so only waiting for
+		// Retry-After lets the push land
+		{"seconds", "1", 10 * time.Second, 3, ""},
+		{"wait beyond deadline", "120", time.Second, 1, "exceeds context deadline"},
+		{"http-date beyond deadline", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), time.Second, 1, "exceeds context deadline"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, server := newPushRecorder(t, http.StatusTooManyRequests, http.StatusTooManyRequests)
+			recorder.header = http.Header{"Retry-After": {tt.retryAfter}}
+			client := NewClient(server.URL, "", "", WithRetry(3, time.Minute))
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			start := time.Now()
+			err := client.SendBusData(ctx, testBusData("49x", "bus-1"))
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("SendBusData: %v", err)
+				}
+				pushes := recorder.received()
+				if last := pushes[len(pushes)-1].req.Streams; len(last) != 1 || len(last[0].Values) != 1 {
+					t.Errorf("accepted push holds %v, want the vehicle", last)
+				}
+			} else {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("SendBusData error = %v, want one containing %q", err, tt.wantErr)
+				}
+				if elapsed := time.Since(start); elapsed > tt.timeout/2 {
+					t.Errorf("gave up after %v, want an early return", elapsed)
+				}
+			}
+			if got := len(recorder.received()); got != tt.attempts {
+				t.Errorf("got %d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
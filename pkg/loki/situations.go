@@ -0,0 +1,61 @@
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"bods2loki/pkg/retry"
+	"bods2loki/pkg/types"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SendSituations pushes one JSON entry per SIRI-SX situation to the
+// stream="disruptions" stream, separate from the vehicle streams
+func (c *Client) SendSituations(ctx context.Context, situations []types.Situation) error {
+	ctx, span := c.tracer.Start(ctx, "loki.send_situations",
+		trace.WithAttributes(attribute.Int("situations_count", len(situations))),
+	)
+	defer span.End()
+
+	if len(situations) == 0 {
+		return nil
+	}
+
+	labels := map[string]string{
+		"job":    "bods2loki",
+		"stream": "disruptions",
+	}
+	c.applyLabels(labels)
+
+	// Offset each entry by a nanosecond so they keep their order in the stream
+	now := time.Now().UnixNano()
+	values := make([][]string, 0, len(situations))
+	for i, situation := range situations {
+		line, err := json.Marshal(situation)
+		if err != nil {
+			span.RecordError(err)
+			return fmt.Errorf("failed to marshal situation JSON: %w", err)
+		}
+		values = append(values, []string{strconv.FormatInt(now+int64(i), 10), string(line)})
+	}
+
+	request, err := c.encodeBody(PushRequest{Streams: []Stream{{Stream: labels, Values: values}}})
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to encode Loki request: %w", err)
+	}
+
+	if err := retry.Do(ctx, c.pushPolicy(ctx), func(ctx context.Context) error {
+		return c.push(ctx, span, request)
+	}); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
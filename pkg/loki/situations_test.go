@@ -0,0 +1,59 @@
+package loki
+
+import (
+	"context"
+	"testing"
+
+	"bods2loki/pkg/types"
+)
+
+func TestSendSituations(t *testing.T) {
+	tests := []struct {
+		name       string
+		situations []types.Situation
+		pushes     int
+	}{
+		{"situations", []types.Situation{
+			{SituationNumber: "sx-1001", Summary: "Temple Way closed", AffectedLines: []string{"49x", "72"}},
+			{SituationNumber: "sx-1002", Summary: "Broken down bus on the A4"},
+		}, 1},
+		{"nothing to send", nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, server := newPushRecorder(t)
+			client := NewClient(server.URL, "", "")
+
+			if err := client.SendSituations(context.Background(), tt.situations); err != nil {
+				t.Fatalf("SendSituations: %v", err)
+			}
+
+			pushes := recorder.received()
+			if len(pushes) != tt.pushes {
+				t.Fatalf("got %d pushes, want %d", len(pushes), tt.pushes)
+			}
+			if tt.pushes == 0 {
+				return
+			}
+
+			streams := pushes[0].req.Streams
+			if len(streams) != 1 || streams[0].Stream["stream"] != "disruptions" || streams[0].Stream["job"] != "bods2loki" {
+				t.Fatalf("streams = %v, want one stream labelled stream=disruptions", streams)
+			}
+			if _, ok := streams[0].Stream["line_ref"]; ok {
+				t.Errorf("disruptions stream has a line_ref label: %v", streams[0].Stream)
+			}
+
+			entries := recorder.entries(t)
+			if len(entries) != len(tt.situations) {
+				t.Fatalf("got %d entries, want one per situation", len(entries))
+			}
+			for i, entry := range entries {
+				if entry["situation_number"] != tt.situations[i].SituationNumber {
+					t.Errorf("entry %d situation_number = %v, want %s in order", i, entry["situation_number"], tt.situations[i].SituationNumber)
+				}
+			}
+		})
+	}
+}
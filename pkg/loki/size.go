@@ -0,0 +1,48 @@
+package loki
+
+import (
+	"encoding/json"
+
+	"bods2loki/pkg/types"
+)
+
+// trimmableFields are removed in order when an entry is still too large once
+// its onward calls are gone
+var trimmableFields = []string{"bus_image", "monitored_call"}
+
+// marshalWithinLimit encodes entry, shrinking it to fit within maxBytes when
+// needed: onward calls are truncated first, then dropped, then the fields in
+// trimmableFields. truncated reports whether the entry was shrunk; ok is false
+// when it still doesn't fit and must be dropped. maxBytes <= 0 disables the limit.
+func marshalWithinLimit(entry map[string]interface{}, maxBytes int) (line []byte, truncated, ok bool, err error) {
+	line, err = json.Marshal(entry)
+	if err != nil || maxBytes <= 0 || len(line) <= maxBytes {
+		return line, false, true, err
+	}
+
+	// Halve the onward calls until the entry fits
+	if calls, has := entry["onward_calls"].([]types.StopCall); has {
+		for n := len(calls) / 2; n > 0; n /= 2 {
+			entry["onward_calls"] = calls[:n]
+			if line, err = json.Marshal(entry); err != nil || len(line) <= maxBytes {
+				return line, true, true, err
+			}
+		}
+		delete(entry, "onward_calls")
+		if line, err = json.Marshal(entry); err != nil || len(line) <= maxBytes {
+			return line, true, true, err
+		}
+	}
+
+	for _, field := range trimmableFields {
+		if _, has := entry[field]; !has {
+			continue
+		}
+		delete(entry, field)
+		if line, err = json.Marshal(entry); err != nil || len(line) <= maxBytes {
+			return line, true, true, err
+		}
+	}
+
+	return nil, true, false, nil
+}
@@ -0,0 +1,120 @@
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"bods2loki/pkg/types"
+)
+
+// stopCalls returns n onward calls of roughly 100 bytes each
+func stopCalls(n int) []types.StopCall {
+	calls := make([]types.StopCall, n)
+	for i := range calls {
+		calls[i] = types.StopCall{
+			StopPointRef:        fmt.Sprintf("0100BRP%05d", i),
+			StopPointName:       "Bristol Bus Station",
+			VisitNumber:         i + 1,
+			ExpectedArrivalTime: "2025-10-09T15:45:00+00:00",
+		}
+	}
+	return calls
+}
+
+func TestMarshalWithinLimit(t *testing.T) {
+	vehicle := testBusData("49x", "bus-1").VehicleData[0]
+	vehicle.OnwardCalls = stopCalls(40)
+	vehicle.BusImage = "data:image/svg+xml;base64," + strings.Repeat("A", 2000)
+	full, _ := json.Marshal(BuildVehicleEntry(testBusData("49x"), vehicle, EntryOptions{}))
+	withoutCalls := vehicle
+	withoutCalls.OnwardCalls = nil
+	noCalls, _ := json.Marshal(BuildVehicleEntry(testBusData("49x"), withoutCalls, EntryOptions{}))
+
+	tests := []struct {
+		name          string
+		maxBytes      int
+		wantTruncated bool
+		wantOK        bool
+		wantCalls     bool
+		wantImage     bool
+	}{
+		{"limit disabled", 0, false, true, true, true},
+		{"fits", len(full), false, true, true, true},
+		{"onward calls truncated first", len(full) - 1000, true, true, true, true},
+		{"onward calls dropped", len(noCalls) + 10, true, true, false, true},
+		{"image dropped", 1000, true, true, false, false},
+		{"too small to fit", 50, true, false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := BuildVehicleEntry(testBusData("49x"), vehicle, EntryOptions{})
+			line, truncated, ok, err := marshalWithinLimit(entry, tt.maxBytes)
+			if err != nil {
+				t.Fatalf("marshalWithinLimit: %v", err)
+			}
+			if truncated != tt.wantTruncated || ok != tt.wantOK {
+				t.Fatalf("truncated, ok = %v, %v; want %v, %v", truncated, ok, tt.wantTruncated, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if tt.maxBytes > 0 && len(line) > tt.maxBytes {
+				t.Errorf("line is %d bytes, want at most %d", len(line), tt.maxBytes)
+			}
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(line, &got); err != nil {
+				t.Fatalf("line is not JSON: %v", err)
+			}
+			calls, hasCalls := got["onward_calls"].([]interface{})
+			if hasCalls != tt.wantCalls {
+				t.Errorf("onward_calls present = %v, want %v", hasCalls, tt.wantCalls)
+			}
+			if tt.wantTruncated && hasCalls && len(calls) >= len(vehicle.OnwardCalls) {
+				t.Errorf("kept %d of %d onward calls, want fewer", len(calls), len(vehicle.OnwardCalls))
+			}
+			if _, hasImage := got["bus_image"]; hasImage != tt.wantImage {
+				t.Errorf("bus_image present = %v, want %v", hasImage, tt.wantImage)
+			}
+			if got["vehicle_ref"] != "bus-1" {
+				t.Errorf("vehicle_ref = %v, want bus-1 kept", got["vehicle_ref"])
+			}
+		})
+	}
+}
+
+func TestMaxLineBytes(t *testing.T) {
+	data := testBusData("49x", "small", "large")
+	data.VehicleData[1].OnwardCalls = stopCalls(40)
+
+	recorder, server := newPushRecorder(t)
+	client := NewClient(server.URL, "", "", WithMaxLineBytes(1000))
+
+	_, _, oversize, err := client.buildEntries(context.Background(), data)
+	if err != nil {
+		t.Fatalf("buildEntries: %v", err)
+	}
+	if oversize != 1 {
+		t.Errorf("counted %d oversize entries, want 1", oversize)
+	}
+
+	if err := client.SendBusData(context.Background(), data); err != nil {
+		t.Fatalf("SendBusData: %v", err)
+	}
+	for _, push := range recorder.received() {
+		for _, stream := range push.req.Streams {
+			for _, value := range stream.Values {
+				if len(value[1]) > 1000 {
+					t.Errorf("pushed a %d byte line, want at most 1000", len(value[1]))
+				}
+			}
+		}
+	}
+	if got := len(recorder.entries(t)); got != 2 {
+		t.Errorf("pushed %d entries, want both with the large one trimmed", got)
+	}
+}
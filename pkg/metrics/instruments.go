@@ -0,0 +1,513 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	// enabled is set once InitMetrics has installed a meter provider and
+	// created every instrument
+	enabled bool
+
+	// PipelineVehiclesPerLine records how many vehicles each line reported per cycle
+	PipelineVehiclesPerLine metric.Int64Histogram
+
+	// PipelineFeedErrors counts SIRI deliveries that reported a failed operator feed
+	PipelineFeedErrors metric.Int64Counter
+
+	// BODSResponses counts BODS API responses by status code and content type
+	BODSResponses metric.Int64Counter
+
+	// PipelineCyclesSkipped counts scheduled cycles skipped because the previous one was still running
+	PipelineCyclesSkipped metric.Int64Counter
+
+	// PipelinePanics counts panics recovered while processing a line
+	PipelinePanics metric.Int64Counter
+
+	// PipelineSinkSends counts deliveries to each output sink by outcome
+	PipelineSinkSends metric.Int64Counter
+
+	// PipelineVehiclesDeduplicated counts vehicles not sent because they were unchanged
+	PipelineVehiclesDeduplicated metric.Int64Counter
+
+	// PipelineLinesInFlight tracks lines currently being fetched or sent, by stage
+	PipelineLinesInFlight metric.Int64UpDownCounter
+
+	// LokiEntryActions counts entries altered or dropped before sending, by reason and action
+	LokiEntryActions metric.Int64Counter
+
+	// LokiSendRetries counts retried Loki pushes, by the status code that caused them
+	LokiSendRetries metric.Int64Counter
+
+	// BODSOversizeResponses counts BODS responses rejected for exceeding the size limit
+	BODSOversizeResponses metric.Int64Counter
+
+	// LokiPushResponses counts Loki push attempts by status code, or error type when no response arrived
+	LokiPushResponses metric.Int64Counter
+
+	// HTTPClientRequestBodySize records the size of request bodies sent, after any compression
+	HTTPClientRequestBodySize metric.Int64Histogram
+
+	// LokiBatchStreams records how many streams each Loki push request carries
+	LokiBatchStreams metric.Int64Histogram
+
+	// ParserVehiclesFailed counts vehicles that failed validation, by error type
+	ParserVehiclesFailed metric.Int64Counter
+
+	// ParserImageGenerationDuration records how long generating a bus image takes
+	ParserImageGenerationDuration metric.Float64Histogram
+
+	// ParserImageSize records the size of generated bus image data URIs
+	ParserImageSize metric.Int64Histogram
+
+	// ParserVehicleDataAge records how far each vehicle's RecordedAtTime lags the fetch
+	ParserVehicleDataAge metric.Float64Histogram
+)
+
+// initInstruments creates all instruments from the given meter
+func initInstruments(meter metric.Meter) error {
+	var err error
+
+	PipelineVehiclesPerLine, err = meter.Int64Histogram(
+		"pipeline.vehicles.per_line",
+		metric.WithDescription("Number of vehicles reported per line per polling cycle"),
+		metric.WithUnit("{vehicle}"),
+		metric.WithExplicitBucketBoundaries(0, 1, 2, 5, 10, 20, 50, 100, 200, 500),
+	)
+	if err != nil {
+		return err
+	}
+
+	PipelineFeedErrors, err = meter.Int64Counter(
+		"pipeline.feed.errors",
+		metric.WithDescription("Number of BODS responses whose delivery reported an error condition"),
+		metric.WithUnit("{error}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	BODSResponses, err = meter.Int64Counter(
+		"bods.api.responses",
+		metric.WithDescription("Number of BODS API responses, by status code and content type"),
+		metric.WithUnit("{response}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	PipelineCyclesSkipped, err = meter.Int64Counter(
+		"pipeline.cycles.skipped",
+		metric.WithDescription("Number of scheduled polling cycles skipped because the previous cycle was still running"),
+		metric.WithUnit("{cycle}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	PipelinePanics, err = meter.Int64Counter(
+		"pipeline.panics.total",
+		metric.WithDescription("Number of panics recovered while processing a line"),
+		metric.WithUnit("{panic}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	PipelineSinkSends, err = meter.Int64Counter(
+		"pipeline.sink.sends",
+		metric.WithDescription("Number of per-line deliveries to each output sink, by outcome"),
+		metric.WithUnit("{send}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	PipelineLinesInFlight, err = meter.Int64UpDownCounter(
+		"pipeline.lines.in_flight",
+		metric.WithDescription("Number of lines currently queued for, being fetched from BODS or sent to the sinks, by stage"),
+		metric.WithUnit("{line}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	PipelineVehiclesDeduplicated, err = meter.Int64Counter(
+		"pipeline.vehicles.deduplicated",
+		metric.WithDescription("Number of vehicles not sent because their observation was unchanged since last sent"),
+		metric.WithUnit("{vehicle}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	LokiEntryActions, err = meter.Int64Counter(
+		"loki.entry.actions",
+		metric.WithDescription("Number of log entries truncated or dropped before sending to Loki, by reason"),
+		metric.WithUnit("{entry}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	LokiSendRetries, err = meter.Int64Counter(
+		"loki.send.retries",
+		metric.WithDescription("Number of Loki pushes retried after a rate limit, server or network error"),
+		metric.WithUnit("{retry}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	BODSOversizeResponses, err = meter.Int64Counter(
+		"bods.api.oversize_responses",
+		metric.WithDescription("Number of BODS responses rejected for exceeding the maximum response size"),
+		metric.WithUnit("{response}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	LokiPushResponses, err = meter.Int64Counter(
+		"loki.push.responses",
+		metric.WithDescription("Number of Loki push attempts, by status code or error type"),
+		metric.WithUnit("{response}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	HTTPClientRequestBodySize, err = meter.Int64Histogram(
+		"http.client.request.body.size",
+		metric.WithDescription("Size of HTTP request bodies sent, after any compression"),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(1024, 4096, 16384, 65536, 262144, 1048576, 4194304),
+	)
+	if err != nil {
+		return err
+	}
+
+	LokiBatchStreams, err = meter.Int64Histogram(
+		"loki.batch.streams",
+		metric.WithDescription("Number of streams in each Loki push request"),
+		metric.WithUnit("{stream}"),
+		metric.WithExplicitBucketBoundaries(1, 2, 5, 10, 20, 50, 100),
+	)
+	if err != nil {
+		return err
+	}
+
+	ParserVehiclesFailed, err = meter.Int64Counter(
+		"parser.vehicles.failed",
+		metric.WithDescription("Number of parsed vehicles that failed validation"),
+		metric.WithUnit("{vehicle}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	ParserImageGenerationDuration, err = meter.Float64Histogram(
+		"parser.image.generation.duration",
+		metric.WithDescription("Time taken to generate a base64 SVG bus image"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.000005, 0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.005),
+	)
+	if err != nil {
+		return err
+	}
+
+	ParserImageSize, err = meter.Int64Histogram(
+		"parser.image.size",
+		metric.WithDescription("Size of generated bus image data URIs"),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(256, 512, 1024, 1536, 2048, 3072, 4096, 8192),
+	)
+	if err != nil {
+		return err
+	}
+
+	ParserVehicleDataAge, err = meter.Float64Histogram(
+		"parser.vehicle.data.age",
+		metric.WithDescription("Age of each vehicle's RecordedAtTime when fetched"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(5, 15, 30, 60, 120, 300, 600, 1800, 3600),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// IsEnabled reports whether metrics are being collected, which requires all
+// instruments to have been created successfully
+func IsEnabled() bool {
+	return enabled
+}
+
+// RecordVehiclesPerLine records the vehicle count observed for a line in one cycle
+func RecordVehiclesPerLine(ctx context.Context, lineRef string, count int) {
+	if !IsEnabled() || PipelineVehiclesPerLine == nil {
+		return
+	}
+
+	PipelineVehiclesPerLine.Record(ctx, int64(count),
+		metric.WithAttributes(attribute.String("line_ref", lineRef)),
+	)
+}
+
+// RecordFeedError counts a delivery that reported an error for a line
+func RecordFeedError(ctx context.Context, lineRef, reason string) {
+	if !IsEnabled() || PipelineFeedErrors == nil {
+		return
+	}
+
+	PipelineFeedErrors.Add(ctx, 1,
+		metric.WithAttributes(
+			attribute.String("line_ref", lineRef),
+			attribute.String("error.type", reason),
+		),
+	)
+}
+
+// RecordBODSResponse counts a BODS API response, marking responses to retried
+// requests. Only the media type of contentType is recorded, to keep the
+// attribute low-cardinality.
+func RecordBODSResponse(ctx context.Context, lineRef string, statusCode int, contentType string, retry bool) {
+	if !IsEnabled() || BODSResponses == nil {
+		return
+	}
+
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if mediaType == "" {
+		mediaType = "none"
+	}
+
+	BODSResponses.Add(ctx, 1,
+		metric.WithAttributes(
+			attribute.String("line_ref", lineRef),
+			attribute.Int(statusCodeKey, statusCode),
+			attribute.String("content_type", mediaType),
+			attribute.Bool("retry", retry),
+		),
+	)
+}
+
+// RecordBODSRequestFailed counts a BODS API request that got no response,
+// with a status code of 0 and an error.type such as "timeout"
+func RecordBODSRequestFailed(ctx context.Context, lineRef string, err error, retry bool) {
+	if !IsEnabled() || BODSResponses == nil {
+		return
+	}
+
+	BODSResponses.Add(ctx, 1,
+		metric.WithAttributes(
+			attribute.String("line_ref", lineRef),
+			attribute.Int(statusCodeKey, 0),
+			attribute.String("error.type", requestErrorType(err)),
+			attribute.String("content_type", "none"),
+			attribute.Bool("retry", retry),
+		),
+	)
+}
+
+// RecordBODSResponseTooLarge counts a BODS response rejected for its size
+func RecordBODSResponseTooLarge(ctx context.Context, lineRef string) {
+	if !IsEnabled() || BODSOversizeResponses == nil {
+		return
+	}
+
+	BODSOversizeResponses.Add(ctx, 1,
+		metric.WithAttributes(attribute.String("line_ref", lineRef)),
+	)
+}
+
+// RecordLokiResponse counts a Loki push attempt that got a response
+func RecordLokiResponse(ctx context.Context, statusCode int) {
+	if !IsEnabled() || LokiPushResponses == nil {
+		return
+	}
+
+	LokiPushResponses.Add(ctx, 1,
+		metric.WithAttributes(attribute.Int(statusCodeKey, statusCode)),
+	)
+}
+
+// RecordLokiRequestFailed counts a Loki push attempt that got no response,
+// with a status code of 0 and an error.type such as "timeout"
+func RecordLokiRequestFailed(ctx context.Context, err error) {
+	if !IsEnabled() || LokiPushResponses == nil {
+		return
+	}
+
+	LokiPushResponses.Add(ctx, 1,
+		metric.WithAttributes(
+			attribute.Int(statusCodeKey, 0),
+			attribute.String("error.type", requestErrorType(err)),
+		),
+	)
+}
+
+// statusCodeKey is the semantic convention attribute for an HTTP response
+// status code, which is 0 when no response arrived
+const statusCodeKey = "http.response.status_code"
+
+// requestErrorType classifies a failed HTTP request: "timeout", "canceled"
+// or "connection"
+func requestErrorType(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	default:
+		return "connection"
+	}
+}
+
+// RecordCycleSkipped counts a scheduled cycle skipped due to overlap
+func RecordCycleSkipped(ctx context.Context) {
+	if !IsEnabled() || PipelineCyclesSkipped == nil {
+		return
+	}
+
+	PipelineCyclesSkipped.Add(ctx, 1)
+}
+
+// RecordPanic counts a recovered panic for a line
+func RecordPanic(ctx context.Context, lineRef string) {
+	if !IsEnabled() || PipelinePanics == nil {
+		return
+	}
+
+	PipelinePanics.Add(ctx, 1,
+		metric.WithAttributes(attribute.String("line_ref", lineRef)),
+	)
+}
+
+// RecordSinkSend counts one delivery to a sink as a success or failure
+func RecordSinkSend(ctx context.Context, sink string, success bool) {
+	if !IsEnabled() || PipelineSinkSends == nil {
+		return
+	}
+
+	outcome := "success"
+	if !success {
+		outcome = "failure"
+	}
+
+	PipelineSinkSends.Add(ctx, 1,
+		metric.WithAttributes(
+			attribute.String("sink", sink),
+			attribute.String("outcome", outcome),
+		),
+	)
+}
+
+// TrackLineStage marks lines as in flight in the given stage ("queued",
+// "fetch" or "send"); the returned function must be called when the stage ends
+func TrackLineStage(ctx context.Context, stage string, lines int) func() {
+	if !IsEnabled() || PipelineLinesInFlight == nil {
+		return func() {}
+	}
+
+	attrs := metric.WithAttributes(attribute.String("stage", stage))
+	PipelineLinesInFlight.Add(ctx, int64(lines), attrs)
+	return func() {
+		PipelineLinesInFlight.Add(ctx, -int64(lines), attrs)
+	}
+}
+
+// RecordVehiclesDeduplicated counts vehicles skipped as unchanged for a line
+func RecordVehiclesDeduplicated(ctx context.Context, lineRef string, vehicles int) {
+	if !IsEnabled() || PipelineVehiclesDeduplicated == nil {
+		return
+	}
+
+	PipelineVehiclesDeduplicated.Add(ctx, int64(vehicles),
+		metric.WithAttributes(attribute.String("line_ref", lineRef)),
+	)
+}
+
+// RecordEntryAction counts an entry altered before sending, e.g. reason
+// "oversize" with action "truncated" or "dropped"
+func RecordEntryAction(ctx context.Context, reason, action string) {
+	if !IsEnabled() || LokiEntryActions == nil {
+		return
+	}
+
+	LokiEntryActions.Add(ctx, 1,
+		metric.WithAttributes(
+			attribute.String("reason", reason),
+			attribute.String("action", action),
+		),
+	)
+}
+
+// RecordLokiSendRetry counts a retried Loki push; reason is the HTTP status
+// code that caused it, or "error" for network errors
+func RecordLokiSendRetry(ctx context.Context, reason string) {
+	if !IsEnabled() || LokiSendRetries == nil {
+		return
+	}
+
+	LokiSendRetries.Add(ctx, 1,
+		metric.WithAttributes(attribute.String("reason", reason)),
+	)
+}
+
+// RecordHTTPRequestBodySize records the size of a request body sent to a destination such as "loki"
+func RecordHTTPRequestBodySize(ctx context.Context, destination string, sizeBytes int) {
+	if !IsEnabled() || HTTPClientRequestBodySize == nil {
+		return
+	}
+
+	HTTPClientRequestBodySize.Record(ctx, int64(sizeBytes),
+		metric.WithAttributes(attribute.String("destination", destination)),
+	)
+}
+
+// RecordBatchStreams records the number of streams in a Loki push request
+func RecordBatchStreams(ctx context.Context, streams int) {
+	if !IsEnabled() || LokiBatchStreams == nil {
+		return
+	}
+
+	LokiBatchStreams.Record(ctx, int64(streams))
+}
+
+// RecordVehicleFailed counts a vehicle that failed validation, e.g. "invalid_location"
+func RecordVehicleFailed(ctx context.Context, errorType string) {
+	if !IsEnabled() || ParserVehiclesFailed == nil {
+		return
+	}
+
+	ParserVehiclesFailed.Add(ctx, 1, metric.WithAttributes(attribute.String("error.type", errorType)))
+}
+
+// RecordImageGeneration records the duration and output size of one bus image generation
+func RecordImageGeneration(ctx context.Context, duration time.Duration, sizeBytes int) {
+	if !IsEnabled() || ParserImageGenerationDuration == nil || ParserImageSize == nil {
+		return
+	}
+
+	ParserImageGenerationDuration.Record(ctx, duration.Seconds())
+	ParserImageSize.Record(ctx, int64(sizeBytes))
+}
+
+// RecordVehicleDataAge records the age of one vehicle's data at fetch time
+func RecordVehicleDataAge(ctx context.Context, lineRef string, age time.Duration) {
+	if !IsEnabled() || ParserVehicleDataAge == nil {
+		return
+	}
+
+	ParserVehicleDataAge.Record(ctx, age.Seconds(), metric.WithAttributes(attribute.String("line_ref", lineRef)))
+}
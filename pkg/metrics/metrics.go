@@ -0,0 +1,223 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// meterProvider is kept so metrics can be flushed on demand
+var meterProvider *metric.MeterProvider
+
+// StrictEndpointScheme makes InitMetrics fail on a scheme-less OTLP endpoint,
+// or an insecure setting contradicting its scheme, instead of warning
+var StrictEndpointScheme bool
+
+func InitMetrics() (func(), error) {
+	// Check if metrics are enabled, and whether they are pushed or scraped
+	otlpEnabled := isTrue(getEnv("OTEL_METRICS_ENABLED", "false"))
+	prometheusEnabled := isTrue(getEnv("PROMETHEUS_METRICS_ENABLED", "false"))
+	if otlpEnabled && prometheusEnabled {
+		return nil, fmt.Errorf("OTEL_METRICS_ENABLED and PROMETHEUS_METRICS_ENABLED are mutually exclusive")
+	}
+	if prometheusEnabled {
+		return initPrometheus()
+	}
+	if !otlpEnabled {
+		log.Println("OpenTelemetry metrics are disabled")
+		return func() {}, nil
+	}
+
+	// Get parsed OTLP endpoint configuration
+	endpointConfig, err := parseOTLPEndpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse headers if provided
+	headers := parseHeaders(getEnv("OTEL_EXPORTER_OTLP_METRICS_HEADERS", ""))
+
+	opts := []otlpmetrichttp.Option{
+		otlpmetrichttp.WithEndpoint(endpointConfig.Host),
+	}
+
+	if endpointConfig.Path != "" {
+		opts = append(opts, otlpmetrichttp.WithURLPath(endpointConfig.Path))
+	}
+
+	// Determine insecure mode: explicit env var takes precedence, else use parsed scheme
+	insecureEnv := getEnv("OTEL_EXPORTER_OTLP_METRICS_INSECURE", "")
+	if insecureEnv != "" {
+		if isTrue(insecureEnv) != endpointConfig.Insecure {
+			if StrictEndpointScheme {
+				return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_METRICS_INSECURE=%s conflicts with the OTLP endpoint scheme", insecureEnv)
+			}
+			log.Printf("Warning: OTEL_EXPORTER_OTLP_METRICS_INSECURE=%s overrides the OTLP endpoint scheme", insecureEnv)
+		}
+		if isTrue(insecureEnv) {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+	} else if endpointConfig.Insecure {
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	}
+
+	if len(headers) > 0 {
+		opts = append(opts, otlpmetrichttp.WithHeaders(headers))
+	}
+
+	// Create OTLP exporter
+	exporter, err := otlpmetrichttp.New(context.Background(), opts...)
+	if err != nil {
+		log.Printf("Failed to create OTLP metric exporter, using noop: %v", err)
+		return func() {}, nil
+	}
+
+	res, err := newResource()
+	if err != nil {
+		return nil, err
+	}
+
+	// Create meter provider; the export interval honours OTEL_METRIC_EXPORT_INTERVAL
+	mp := metric.NewMeterProvider(
+		metric.WithReader(metric.NewPeriodicReader(exporter)),
+		metric.WithResource(res),
+	)
+
+	// Set global meter provider
+	otel.SetMeterProvider(mp)
+	meterProvider = mp
+
+	// Only start recording once every instrument exists, so the recording
+	// helpers never touch a nil instrument
+	if err := initInstruments(mp.Meter("bods2loki")); err != nil {
+		log.Printf("Failed to create metric instruments, metrics will not be recorded: %v", err)
+	} else {
+		enabled = true
+		log.Printf("OpenTelemetry metrics enabled - exporting to %s%s", endpointConfig.Host, endpointConfig.Path)
+	}
+
+	return func() {
+		if err := mp.Shutdown(context.Background()); err != nil {
+			log.Printf("Error shutting down meter provider: %v", err)
+		}
+	}, nil
+}
+
+// newResource describes the process with Go-specific attributes
+func newResource() (*resource.Resource, error) {
+	return resource.New(context.Background(),
+		resource.WithAttributes(
+			semconv.ServiceName("bods2loki"),
+			semconv.ServiceVersion("1.0.0"),
+			semconv.ProcessRuntimeName("go"),
+			semconv.ProcessRuntimeVersion(runtime.Version()),
+			semconv.ProcessPID(os.Getpid()),
+		),
+	)
+}
+
+// ForceFlush exports all pending metrics immediately. It is a no-op when metrics are disabled.
+func ForceFlush(ctx context.Context) error {
+	if meterProvider == nil {
+		return nil
+	}
+	return meterProvider.ForceFlush(ctx)
+}
+
+// getEnv returns the value of an environment variable or a default value if not set
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// isTrue checks if a string represents a true value
+func isTrue(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return s == "true" || s == "1" || s == "yes" || s == "on"
+}
+
+// otlpEndpointConfig holds parsed OTLP endpoint configuration
+type otlpEndpointConfig struct {
+	Host     string // host:port for WithEndpoint()
+	Path     string // URL path for WithURLPath()
+	Insecure bool   // true for http://, false for https://
+}
+
+// parseOTLPEndpoint parses the OTLP metrics endpoint from environment variables,
+// mirroring the trace endpoint handling but appending /v1/metrics instead.
+func parseOTLPEndpoint() (otlpEndpointConfig, error) {
+	endpoint := getEnv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", "")
+	appendMetricsPath := false
+
+	if endpoint == "" {
+		endpoint = getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+		appendMetricsPath = true
+	}
+
+	if endpoint == "" {
+		return otlpEndpointConfig{
+			Host:     "localhost:4318",
+			Path:     "",
+			Insecure: true,
+		}, nil
+	}
+
+	// Add default scheme if missing (default to https for security)
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		if StrictEndpointScheme {
+			return otlpEndpointConfig{}, fmt.Errorf("OTLP endpoint %q has no http:// or https:// scheme", endpoint)
+		}
+		log.Printf("Warning: OTLP endpoint %q has no scheme, assuming https://", endpoint)
+		endpoint = "https://" + endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		log.Printf("Failed to parse OTLP metrics endpoint URL, using as-is: %v", err)
+		return otlpEndpointConfig{Host: endpoint, Insecure: true}, nil
+	}
+
+	path := u.Path
+	if appendMetricsPath && !strings.HasSuffix(path, "/v1/metrics") {
+		if path == "" || path == "/" {
+			path = "/v1/metrics"
+		} else {
+			path = strings.TrimSuffix(path, "/") + "/v1/metrics"
+		}
+	}
+
+	return otlpEndpointConfig{
+		Host:     u.Host,
+		Path:     path,
+		Insecure: u.Scheme == "http",
+	}, nil
+}
+
+// parseHeaders parses header string in format "key1=value1,key2=value2"
+func parseHeaders(headerStr string) map[string]string {
+	headers := make(map[string]string)
+	if headerStr == "" {
+		return headers
+	}
+
+	pairs := strings.Split(headerStr, ",")
+	for _, pair := range pairs {
+		if kv := strings.SplitN(strings.TrimSpace(pair), "=", 2); len(kv) == 2 {
+			headers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+
+	return headers
+}
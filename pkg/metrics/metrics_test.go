@@ -0,0 +1,474 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// newTestReader enables metrics with every instrument recording to an
+// in-memory reader, disabling them again when the test ends
+func newTestReader(t *testing.T) *sdkmetric.ManualReader {
+	t.Helper()
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	if err := initInstruments(mp.Meter("test")); err != nil {
+		t.Fatalf("initInstruments: %v", err)
+	}
+	enabled = true
+	t.Cleanup(func() {
+		enabled = false
+		mp.Shutdown(context.Background())
+	})
+	return reader
+}
+
+// collect returns the named metric's data, failing the test if it is missing
+func collect(t *testing.T, reader *sdkmetric.ManualReader, name string) metricdata.Aggregation {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+	t.Fatalf("metric %s was not recorded", name)
+	return nil
+}
+
+// sumPoints returns the data points of an int64 counter
+func sumPoints(t *testing.T, reader *sdkmetric.ManualReader, name string) []metricdata.DataPoint[int64] {
+	t.Helper()
+
+	sum, ok := collect(t, reader, name).(metricdata.Sum[int64])
+	if !ok {
+		t.Fatalf("metric %s is not an int64 sum", name)
+	}
+	return sum.DataPoints
+}
+
+// histogramPoints returns the data points of a histogram
+func histogramPoints[N int64 | float64](t *testing.T, reader *sdkmetric.ManualReader, name string) []metricdata.HistogramDataPoint[N] {
+	t.Helper()
+
+	histogram, ok := collect(t, reader, name).(metricdata.Histogram[N])
+	if !ok {
+		t.Fatalf("metric %s is not a histogram of %T", name, *new(N))
+	}
+	return histogram.DataPoints
+}
+
+// pointWith returns the value of the data point having all of attrs
+func pointWith(points []metricdata.DataPoint[int64], attrs ...attribute.KeyValue) (int64, bool) {
+	for _, point := range points {
+		matches := true
+		for _, attr := range attrs {
+			if value, ok := point.Attributes.Value(attr.Key); !ok || value != attr.Value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return point.Value, true
+		}
+	}
+	return 0, false
+}
+
+func TestResponseStatusCodes(t *testing.T) {
+	reader := newTestReader(t)
+	ctx := context.Background()
+
+	RecordBODSResponse(ctx, "49x", 200, "application/xml; charset=utf-8", false)
+	RecordBODSResponse(ctx, "49x", 200, "application/xml", false)
+	RecordBODSResponse(ctx, "49x", 503, "text/html", true)
+	RecordBODSRequestFailed(ctx, "49x", context.DeadlineExceeded, false)
+	RecordLokiResponse(ctx, 204)
+	RecordLokiResponse(ctx, 429)
+	RecordLokiRequestFailed(ctx, context.Canceled)
+
+	tests := []struct {
+		metric string
+		attrs  []attribute.KeyValue
+		want   int64
+	}{
+		{"bods.api.responses", []attribute.KeyValue{
+			attribute.Int("http.response.status_code", 200),
+			attribute.String("content_type", "application/xml"),
+			attribute.Bool("retry", false),
+		}, 2},
+		{"bods.api.responses", []attribute.KeyValue{
+			attribute.Int("http.response.status_code", 503),
+			attribute.String("content_type", "text/html"),
+			attribute.Bool("retry", true),
+		}, 1},
+		{"bods.api.responses", []attribute.KeyValue{
+			attribute.Int("http.response.status_code", 0),
+			attribute.String("error.type", "timeout"),
+		}, 1},
+		{"loki.push.responses", []attribute.KeyValue{attribute.Int("http.response.status_code", 204)}, 1},
+		{"loki.push.responses", []attribute.KeyValue{attribute.Int("http.response.status_code", 429)}, 1},
+		{"loki.push.responses", []attribute.KeyValue{
+			attribute.Int("http.response.status_code", 0),
+			attribute.String("error.type", "canceled"),
+		}, 1},
+	}
+
+	for _, tt := range tests {
+		points := sumPoints(t, reader, tt.metric)
+		got, ok := pointWith(points, tt.attrs...)
+		if !ok || got != tt.want {
+			t.Errorf("%s with %v = %d (found %v), want %d", tt.metric, tt.attrs, got, ok, tt.want)
+		}
+	}
+
+	for _, point := range sumPoints(t, reader, "loki.push.responses") {
+		if _, ok := point.Attributes.Value("http.status_code"); ok {
+			t.Errorf("data point still uses the deprecated http.status_code attribute")
+		}
+	}
+}
+
+func TestVehiclesPerLine(t *testing.T) {
+	reader := newTestReader(t)
+	ctx := context.Background()
+
+	RecordVehiclesPerLine(ctx, "49x", 3)
+	RecordVehiclesPerLine(ctx, "49x", 5)
+	RecordVehiclesPerLine(ctx, "72", 0)
+
+	want := map[string]struct {
+		count uint64
+		sum   int64
+	}{
+		"49x": {2, 8},
+		"72":  {1, 0},
+	}
+
+	points := histogramPoints[int64](t, reader, "pipeline.vehicles.per_line")
+	if len(points) != len(want) {
+		t.Fatalf("got %d data points, want %d", len(points), len(want))
+	}
+	for _, point := range points {
+		line, _ := point.Attributes.Value("line_ref")
+		w := want[line.AsString()]
+		if point.Count != w.count || point.Sum != w.sum {
+			t.Errorf("line %s: count %d, sum %d; want %d, %d", line.AsString(), point.Count, point.Sum, w.count, w.sum)
+		}
+	}
+}
+
+func TestImageGeneration(t *testing.T) {
+	reader := newTestReader(t)
+	ctx := context.Background()
+
+	sizes := []int{1200, 1800, 950}
+	for _, size := range sizes {
+		RecordImageGeneration(ctx, 2*time.Millisecond, size)
+	}
+
+	durations := histogramPoints[float64](t, reader, "parser.image.generation.duration")
+	if len(durations) != 1 || durations[0].Count != uint64(len(sizes)) {
+		t.Errorf("generation duration points = %v, want one point with %d observations", durations, len(sizes))
+	} else if want := 0.006; durations[0].Sum < want-1e-9 || durations[0].Sum > want+1e-9 {
+		t.Errorf("generation duration sum = %v, want %v", durations[0].Sum, want)
+	}
+
+	imageSizes := histogramPoints[int64](t, reader, "parser.image.size")
+	if len(imageSizes) != 1 || imageSizes[0].Count != uint64(len(sizes)) || imageSizes[0].Sum != 3950 {
+		t.Errorf("image size points = %v, want %d observations summing to 3950", imageSizes, len(sizes))
+	}
+}
+
+func TestCycleSkipped(t *testing.T) {
+	reader := newTestReader(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		RecordCycleSkipped(ctx)
+	}
+
+	points := sumPoints(t, reader, "pipeline.cycles.skipped")
+	if len(points) != 1 || points[0].Value != 3 {
+		t.Errorf("pipeline.cycles.skipped points = %v, want a single count of 3", points)
+	}
+}
+
+func TestSinkSends(t *testing.T) {
+	reader := newTestReader(t)
+	ctx := context.Background()
+
+	RecordSinkSend(ctx, "loki", true)
+	RecordSinkSend(ctx, "loki", true)
+	RecordSinkSend(ctx, "webhook", false)
+
+	tests := []struct {
+		sink    string
+		outcome string
+		want    int64
+	}{
+		{"loki", "success", 2},
+		{"webhook", "failure", 1},
+	}
+
+	points := sumPoints(t, reader, "pipeline.sink.sends")
+	if len(points) != len(tests) {
+		t.Errorf("got %d data points, want %d", len(points), len(tests))
+	}
+	for _, tt := range tests {
+		got, ok := pointWith(points, attribute.String("sink", tt.sink), attribute.String("outcome", tt.outcome))
+		if !ok || got != tt.want {
+			t.Errorf("%s %s = %d (found %v), want %d", tt.sink, tt.outcome, got, ok, tt.want)
+		}
+	}
+}
+
+// recorders calls every recording helper once
+var recorders = []struct {
+	name   string
+	record func(ctx context.Context)
+}{
+	{"VehiclesPerLine", func(ctx context.Context) { RecordVehiclesPerLine(ctx, "49x", 3) }},
+	{"FeedError", func(ctx context.Context) { RecordFeedError(ctx, "49x", "ServiceNotAvailableError") }},
+	{"BODSResponse", func(ctx context.Context) { RecordBODSResponse(ctx, "49x", 200, "application/xml", false) }},
+	{"BODSRequestFailed", func(ctx context.Context) { RecordBODSRequestFailed(ctx, "49x", context.DeadlineExceeded, true) }},
+	{"BODSResponseTooLarge", func(ctx context.Context) { RecordBODSResponseTooLarge(ctx, "49x") }},
+	{"LokiResponse", func(ctx context.Context) { RecordLokiResponse(ctx, 204) }},
+	{"LokiRequestFailed", func(ctx context.Context) { RecordLokiRequestFailed(ctx, context.Canceled) }},
+	{"CycleSkipped", func(ctx context.Context) { RecordCycleSkipped(ctx) }},
+	{"Panic", func(ctx context.Context) { RecordPanic(ctx, "49x") }},
+	{"SinkSend", func(ctx context.Context) { RecordSinkSend(ctx, "loki", true) }},
+	{"LineStage", func(ctx context.Context) { TrackLineStage(ctx, "fetch", 2)() }},
+	{"VehiclesDeduplicated", func(ctx context.Context) { RecordVehiclesDeduplicated(ctx, "49x", 1) }},
+	{"EntryAction", func(ctx context.Context) { RecordEntryAction(ctx, "oversize", "truncated") }},
+	{"LokiSendRetry", func(ctx context.Context) { RecordLokiSendRetry(ctx, "status_503") }},
+	{"HTTPRequestBodySize", func(ctx context.Context) { RecordHTTPRequestBodySize(ctx, "loki", 1024) }},
+	{"BatchStreams", func(ctx context.Context) { RecordBatchStreams(ctx, 4) }},
+	{"VehicleFailed", func(ctx context.Context) { RecordVehicleFailed(ctx, "invalid_location") }},
+	{"ImageGeneration", func(ctx context.Context) { RecordImageGeneration(ctx, time.Millisecond, 1200) }},
+	{"VehicleDataAge", func(ctx context.Context) { RecordVehicleDataAge(ctx, "49x", 6*time.Second) }},
+}
+
+// clearInstruments enables metrics with every instrument nil, as after a
+// failed initInstruments, restoring them when the test ends
+func clearInstruments(t *testing.T) {
+	t.Helper()
+
+	saved := []any{
+		PipelineVehiclesPerLine, PipelineFeedErrors, BODSResponses, PipelineCyclesSkipped,
+		PipelinePanics, PipelineSinkSends, PipelineVehiclesDeduplicated, PipelineLinesInFlight,
+		LokiEntryActions, LokiSendRetries, BODSOversizeResponses, LokiPushResponses,
+		HTTPClientRequestBodySize, LokiBatchStreams, ParserVehiclesFailed,
+		ParserImageGenerationDuration, ParserImageSize, ParserVehicleDataAge,
+	}
+	restore := func(values []any) {
+		PipelineVehiclesPerLine, _ = values[0].(metric.Int64Histogram)
+		PipelineFeedErrors, _ = values[1].(metric.Int64Counter)
+		BODSResponses, _ = values[2].(metric.Int64Counter)
+		PipelineCyclesSkipped, _ = values[3].(metric.Int64Counter)
+		PipelinePanics, _ = values[4].(metric.Int64Counter)
+		PipelineSinkSends, _ = values[5].(metric.Int64Counter)
+		PipelineVehiclesDeduplicated, _ = values[6].(metric.Int64Counter)
+		PipelineLinesInFlight, _ = values[7].(metric.Int64UpDownCounter)
+		LokiEntryActions, _ = values[8].(metric.Int64Counter)
+		LokiSendRetries, _ = values[9].(metric.Int64Counter)
+		BODSOversizeResponses, _ = values[10].(metric.Int64Counter)
+		LokiPushResponses, _ = values[11].(metric.Int64Counter)
+		HTTPClientRequestBodySize, _ = values[12].(metric.Int64Histogram)
+		LokiBatchStreams, _ = values[13].(metric.Int64Histogram)
+		ParserVehiclesFailed, _ = values[14].(metric.Int64Counter)
+		ParserImageGenerationDuration, _ = values[15].(metric.Float64Histogram)
+		ParserImageSize, _ = values[16].(metric.Int64Histogram)
+		ParserVehicleDataAge, _ = values[17].(metric.Float64Histogram)
+	}
+
+	restore(make([]any, len(saved)))
+	enabled = true
+	t.Cleanup(func() {
+		enabled = false
+		restore(saved)
+	})
+}
+
+func TestRecordersWithoutInstruments(t *testing.T) {
+	clearInstruments(t)
+
+	for _, tt := range recorders {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("panicked with nil instruments: %v", r)
+				}
+			}()
+			tt.record(context.Background())
+		})
+	}
+}
+
+func TestRecordersWhileDisabled(t *testing.T) {
+	reader := newTestReader(t)
+	enabled = false
+
+	for _, tt := range recorders {
+		tt.record(context.Background())
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			t.Errorf("metric %s was recorded while metrics were disabled", m.Name)
+		}
+	}
+}
+
+func TestPanics(t *testing.T) {
+	reader := newTestReader(t)
+	ctx := context.Background()
+
+	RecordPanic(ctx, "72")
+	RecordPanic(ctx, "72")
+
+	points := sumPoints(t, reader, "pipeline.panics.total")
+	if got, ok := pointWith(points, attribute.String("line_ref", "72")); !ok || got != 2 {
+		t.Errorf("pipeline.panics.total for line 72 = %d (found %v), want 2", got, ok)
+	}
+}
+
+func TestTrackLineStage(t *testing.T) {
+	reader := newTestReader(t)
+	ctx := context.Background()
+
+	// expect checks every stage gauge holds only the lines currently in it
+	expect := func(step string, want map[string]int64) {
+		t.Helper()
+		points := sumPoints(t, reader, "pipeline.lines.in_flight")
+		for _, stage := range []string{"queued", "fetch", "send"} {
+			if got, _ := pointWith(points, attribute.String("stage", stage)); got != want[stage] {
+				t.Errorf("%s: %s gauge = %d, want %d", step, stage, got, want[stage])
+			}
+		}
+	}
+
+	queuedDone := TrackLineStage(ctx, "queued", 2)
+	expect("queued", map[string]int64{"queued": 2})
+
+	queuedDone()
+	fetchDone := TrackLineStage(ctx, "fetch", 1)
+	otherFetchDone := TrackLineStage(ctx, "fetch", 1)
+	expect("fetching", map[string]int64{"fetch": 2})
+
+	fetchDone()
+	otherFetchDone()
+	sendDone := TrackLineStage(ctx, "send", 2)
+	expect("sending", map[string]int64{"send": 2})
+
+	sendDone()
+	expect("done", nil)
+}
+
+func TestParseOTLPEndpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		metrics  string
+		strict   bool
+		want     otlpEndpointConfig
+		wantWarn bool
+		wantErr  bool
+	}{
+		{name: "default", want: otlpEndpointConfig{Host: "localhost:4318", Insecure: true}},
+		{name: "http endpoint", endpoint: "http://collector:4318", want: otlpEndpointConfig{Host: "collector:4318", Path: "/v1/metrics", Insecure: true}},
+		{name: "https endpoint with path", endpoint: "https://otlp.example.com/otlp/", want: otlpEndpointConfig{Host: "otlp.example.com", Path: "/otlp/v1/metrics"}},
+		{name: "metrics endpoint used as-is", metrics: "http://collector:4318/custom", want: otlpEndpointConfig{Host: "collector:4318", Path: "/custom", Insecure: true}},
+		{name: "scheme-less endpoint warns", endpoint: "collector:4318", want: otlpEndpointConfig{Host: "collector:4318", Path: "/v1/metrics"}, wantWarn: true},
+		{name: "strict scheme-less endpoint", endpoint: "collector:4318", strict: true, wantErr: true},
+		{name: "strict scheme-less metrics endpoint", metrics: "collector:4318/v1/metrics", strict: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", tt.endpoint)
+			t.Setenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", tt.metrics)
+			StrictEndpointScheme = tt.strict
+			t.Cleanup(func() { StrictEndpointScheme = false })
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+			got, err := parseOTLPEndpoint()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseOTLPEndpoint error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseOTLPEndpoint() = %+v, want %+v", got, tt.want)
+			}
+			if warned := strings.Contains(logs.String(), "has no scheme"); warned != tt.wantWarn {
+				t.Errorf("scheme warning logged = %v, want %v; log: %q", warned, tt.wantWarn, logs.String())
+			}
+		})
+	}
+}
+
+func TestVehicleDataAge(t *testing.T) {
+	reader := newTestReader(t)
+	ctx := context.Background()
+
+	RecordVehicleDataAge(ctx, "49x", 20*time.Second)
+	RecordVehicleDataAge(ctx, "49x", 40*time.Second)
+	RecordVehicleDataAge(ctx, "72", 90*time.Second)
+
+	want := map[string]struct {
+		count uint64
+		sum   float64
+	}{
+		"49x": {2, 60},
+		"72":  {1, 90},
+	}
+
+	points := histogramPoints[float64](t, reader, "parser.vehicle.data.age")
+	if len(points) != len(want) {
+		t.Fatalf("got %d data points, want %d", len(points), len(want))
+	}
+	for _, point := range points {
+		line, _ := point.Attributes.Value("line_ref")
+		w := want[line.AsString()]
+		if point.Count != w.count || point.Sum != w.sum {
+			t.Errorf("line %s: count %d, sum %v; want %d, %v", line.AsString(), point.Count, point.Sum, w.count, w.sum)
+		}
+	}
+}
+
+func TestBODSResponseTooLarge(t *testing.T) {
+	reader := newTestReader(t)
+	ctx := context.Background()
+
+	RecordBODSResponseTooLarge(ctx, "49x")
+	RecordBODSResponseTooLarge(ctx, "49x")
+	RecordBODSResponseTooLarge(ctx, "72")
+
+	points := sumPoints(t, reader, "bods.api.oversize_responses")
+	for line, want := range map[string]int64{"49x": 2, "72": 1} {
+		if got, ok := pointWith(points, attribute.String("line_ref", line)); !ok || got != want {
+			t.Errorf("line %s oversize responses = %d, want %d", line, got, want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/sdk/metric"
+)
+
+// initPrometheus exposes every instrument on a /metrics endpoint for
+// Prometheus to scrape, instead of pushing them over OTLP. The listen address
+// is PROMETHEUS_METRICS_ADDR (default :9464).
+func initPrometheus() (func(), error) {
+	registry := promclient.NewRegistry()
+	exporter, err := prometheus.New(prometheus.WithRegisterer(registry))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := newResource()
+	if err != nil {
+		return nil, err
+	}
+
+	mp := metric.NewMeterProvider(
+		metric.WithReader(exporter),
+		metric.WithResource(res),
+	)
+
+	otel.SetMeterProvider(mp)
+	meterProvider = mp
+
+	addr := getEnv("PROMETHEUS_METRICS_ADDR", ":9464")
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Prometheus metrics server failed: %v", err)
+		}
+	}()
+
+	if err := initInstruments(mp.Meter("bods2loki")); err != nil {
+		log.Printf("Failed to create metric instruments, metrics will not be recorded: %v", err)
+	} else {
+		enabled = true
+		log.Printf("Prometheus metrics enabled - serving /metrics on %s", addr)
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down Prometheus metrics server: %v", err)
+		}
+		if err := mp.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down meter provider: %v", err)
+		}
+	}, nil
+}
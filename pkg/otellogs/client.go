@@ -0,0 +1,153 @@
+// Package otellogs emits parsed bus data as OpenTelemetry log records, one per
+// vehicle, through the OTLP logs exporter. The records carry the same JSON
+// entries that are pushed to Loki, so an OpenTelemetry collector can route
+// them to Loki (or elsewhere) instead of bods2loki pushing directly.
+package otellogs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"bods2loki/pkg/loki"
+	"bods2loki/pkg/types"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// scopeName is the instrumentation scope of the emitted records
+const scopeName = "bods2loki/otellogs"
+
+type Client struct {
+	exporter     sdklog.Exporter
+	provider     *sdklog.LoggerProvider
+	logger       log.Logger
+	tracer       trace.Tracer
+	entryOptions loki.EntryOptions
+}
+
+// Option configures optional Client behaviour
+type Option func(*Client)
+
+// WithEntryOptions controls how vehicle entries are built, as for Loki
+func WithEntryOptions(opts loki.EntryOptions) Option {
+	return func(c *Client) {
+		c.entryOptions = opts
+	}
+}
+
+// WithExporter replaces the OTLP HTTP logs exporter, e.g. with an in-memory
+// one in tests
+func WithExporter(exporter sdklog.Exporter) Option {
+	return func(c *Client) {
+		c.exporter = exporter
+	}
+}
+
+// NewClient creates a client emitting through the OTLP HTTP logs exporter,
+// which is configured by the standard OTEL_EXPORTER_OTLP_LOGS_* (or
+// OTEL_EXPORTER_OTLP_*) environment variables
+func NewClient(opts ...Option) (*Client, error) {
+	c := &Client{
+		tracer: otel.Tracer("otellogs-client"),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.exporter == nil {
+		exporter, err := otlploghttp.New(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP logs exporter: %w", err)
+		}
+		c.exporter = exporter
+	}
+
+	res, err := newResource()
+	if err != nil {
+		return nil, err
+	}
+
+	c.provider = sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(c.exporter)),
+		sdklog.WithResource(res),
+	)
+	c.logger = c.provider.Logger(scopeName)
+
+	return c, nil
+}
+
+// newResource describes the process with Go-specific attributes
+func newResource() (*resource.Resource, error) {
+	return resource.New(context.Background(),
+		resource.WithAttributes(
+			semconv.ServiceName("bods2loki"),
+			semconv.ServiceVersion("1.0.0"),
+			semconv.ProcessRuntimeName("go"),
+			semconv.ProcessRuntimeVersion(runtime.Version()),
+			semconv.ProcessPID(os.Getpid()),
+		),
+	)
+}
+
+// Send emits one log record per vehicle on a line
+func (c *Client) Send(ctx context.Context, data *types.ParsedBusData) error {
+	return c.SendBatch(ctx, []*types.ParsedBusData{data})
+}
+
+// SendBatch emits one log record per vehicle across every line. Records are
+// exported in the background; each carries the trace and span of the cycle
+// that emitted it.
+func (c *Client) SendBatch(ctx context.Context, batch []*types.ParsedBusData) error {
+	ctx, span := c.tracer.Start(ctx, "otellogs.send_batch",
+		trace.WithAttributes(attribute.Int("lines_count", len(batch))),
+	)
+	defer span.End()
+
+	observed := time.Now()
+	records := 0
+	for _, data := range batch {
+		for _, vehicle := range data.VehicleData {
+			body, err := json.Marshal(loki.BuildVehicleEntry(data, vehicle, c.entryOptions))
+			if err != nil {
+				span.RecordError(err)
+				return fmt.Errorf("failed to marshal vehicle JSON: %w", err)
+			}
+
+			var record log.Record
+			if timestamp, err := time.Parse(time.RFC3339, data.Timestamp); err == nil {
+				record.SetTimestamp(timestamp)
+			}
+			record.SetObservedTimestamp(observed)
+			record.SetSeverity(log.SeverityInfo)
+			record.SetBody(log.StringValue(string(body)))
+			record.AddAttributes(
+				log.String("line_ref", data.LineRef),
+				log.String("vehicle_ref", vehicle.VehicleRef),
+				log.String("operator_ref", vehicle.OperatorRef),
+				log.String("direction_ref", vehicle.DirectionRef),
+			)
+			c.logger.Emit(ctx, record)
+			records++
+		}
+	}
+	span.SetAttributes(attribute.Int("records_count", records))
+
+	return nil
+}
+
+// Close exports any buffered records and shuts the exporter down
+func (c *Client) Close() error {
+	return c.provider.Shutdown(context.Background())
+}
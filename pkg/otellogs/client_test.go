@@ -0,0 +1,175 @@
+package otellogs
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"bods2loki/pkg/loki"
+	"bods2loki/pkg/types"
+
+	"go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// memoryExporter keeps exported records in memory
+type memoryExporter struct {
+	mu       sync.Mutex
+	records  []sdklog.Record
+	shutdown bool
+}
+
+func (e *memoryExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, record := range records {
+		e.records = append(e.records, record.Clone())
+	}
+	return nil
+}
+
+func (e *memoryExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.shutdown = true
+	return nil
+}
+
+func (e *memoryExporter) ForceFlush(ctx context.Context) error {
+	return nil
+}
+
+func busData(line string, vehicleRefs ...string) *types.ParsedBusData {
+	data := &types.ParsedBusData{LineRef: line, Timestamp: "2025-10-09T15:37:40Z"}
+	for _, ref := range vehicleRefs {
+		data.VehicleData = append(data.VehicleData, types.VehicleActivity{
+			LineRef:       line,
+			VehicleRef:    ref,
+			OperatorRef:   "FBRI",
+			DirectionRef:  "inbound",
+			Latitude:      51.495853,
+			Longitude:     -2.480741,
+			LocationValid: true,
+		})
+	}
+	return data
+}
+
+// attributes collects a record's attributes as strings
+func attributes(record sdklog.Record) map[string]string {
+	attrs := make(map[string]string)
+	record.WalkAttributes(func(kv log.KeyValue) bool {
+		attrs[kv.Key] = kv.Value.AsString()
+		return true
+	})
+	return attrs
+}
+
+func TestSendBatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		batch    []*types.ParsedBusData
+		vehicles []string
+		lines    []string
+	}{
+		{
+			name:     "one record per vehicle across lines",
+			batch:    []*types.ParsedBusData{busData("49x", "bus-1", "bus-2"), busData("72", "bus-3")},
+			vehicles: []string{"bus-1", "bus-2", "bus-3"},
+			lines:    []string{"49x", "49x", "72"},
+		},
+		{
+			name:  "no vehicles emits nothing",
+			batch: []*types.ParsedBusData{busData("49x")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := &memoryExporter{}
+			client, err := NewClient(WithExporter(exporter), WithEntryOptions(loki.EntryOptions{TimestampField: "@timestamp"}))
+			if err != nil {
+				t.Fatalf("NewClient: %v", err)
+			}
+
+			if err := client.SendBatch(context.Background(), tt.batch); err != nil {
+				t.Fatalf("SendBatch: %v", err)
+			}
+			if err := client.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			if len(exporter.records) != len(tt.vehicles) {
+				t.Fatalf("exported %d records, want %d", len(exporter.records), len(tt.vehicles))
+			}
+			for i, record := range exporter.records {
+				want := map[string]string{
+					"line_ref":      tt.lines[i],
+					"vehicle_ref":   tt.vehicles[i],
+					"operator_ref":  "FBRI",
+					"direction_ref": "inbound",
+				}
+				attrs := attributes(record)
+				for key, value := range want {
+					if attrs[key] != value {
+						t.Errorf("record %d: %s = %q, want %q", i, key, attrs[key], value)
+					}
+				}
+
+				var entry map[string]interface{}
+				if err := json.Unmarshal([]byte(record.Body().AsString()), &entry); err != nil {
+					t.Fatalf("record %d body: %v", i, err)
+				}
+				if entry["vehicle_ref"] != tt.vehicles[i] || entry["@timestamp"] != "2025-10-09T15:37:40Z" {
+					t.Errorf("record %d body = %v, want the Loki entry for %s", i, entry, tt.vehicles[i])
+				}
+
+				if want := time.Date(2025, 10, 9, 15, 37, 40, 0, time.UTC); !record.Timestamp().Equal(want) {
+					t.Errorf("record %d timestamp = %v, want %v", i, record.Timestamp(), want)
+				}
+				if record.Severity() != log.SeverityInfo {
+					t.Errorf("record %d severity = %v, want %v", i, record.Severity(), log.SeverityInfo)
+				}
+				res := record.Resource()
+				if name, ok := res.Set().Value("service.name"); !ok || name.AsString() != "bods2loki" {
+					t.Errorf("record %d service.name = %v, want bods2loki", i, name)
+				}
+			}
+			if !exporter.shutdown {
+				t.Error("Close didn't shut the exporter down")
+			}
+		})
+	}
+}
+
+func TestSendBatchTraceCorrelation(t *testing.T) {
+	exporter := &memoryExporter{}
+	client, err := NewClient(WithExporter(exporter))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		SpanID:     trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), spanContext)
+
+	if err := client.Send(ctx, busData("49x", "bus-1")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if len(exporter.records) != 1 {
+		t.Fatalf("exported %d records, want 1", len(exporter.records))
+	}
+	if got := exporter.records[0].TraceID(); got != spanContext.TraceID() {
+		t.Errorf("TraceID = %v, want %v", got, spanContext.TraceID())
+	}
+}
@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"time"
+
+	"bods2loki/pkg/types"
+)
+
+// Delay bucket values emitted as delay_bucket
+const (
+	DelayBucketEarly  = "early"
+	DelayBucketOnTime = "on_time"
+	DelayBucketMinor  = "minor"
+	DelayBucketMajor  = "major"
+)
+
+// DelayThresholds configures how a MonitoredCall delay maps to is_late and delay_bucket
+type DelayThresholds struct {
+	// Early is how far ahead of schedule a bus must be to count as early
+	Early time.Duration
+	// Late is the delay beyond which a bus is late (and at least a minor delay)
+	Late time.Duration
+	// Major is the delay beyond which a late bus counts as a major delay
+	Major time.Duration
+}
+
+// DefaultDelayThresholds returns the thresholds used when none are configured
+func DefaultDelayThresholds() DelayThresholds {
+	return DelayThresholds{
+		Early: time.Minute,
+		Late:  time.Minute,
+		Major: 5 * time.Minute,
+	}
+}
+
+// callDelay returns the expected minus aimed time of a stop call, preferring
+// arrival times and falling back to departure times. ok is false when the
+// delay cannot be determined.
+func callDelay(call *types.StopCall) (delay time.Duration, ok bool) {
+	if call == nil {
+		return 0, false
+	}
+
+	if d, ok := timeDifference(call.AimedArrivalTime, call.ExpectedArrivalTime); ok {
+		return d, true
+	}
+	return timeDifference(call.AimedDepartureTime, call.ExpectedDepartureTime)
+}
+
+// timeDifference parses two RFC3339 timestamps and returns expected - aimed
+func timeDifference(aimed, expected string) (time.Duration, bool) {
+	if aimed == "" || expected == "" {
+		return 0, false
+	}
+
+	aimedTime, err := time.Parse(time.RFC3339, aimed)
+	if err != nil {
+		return 0, false
+	}
+	expectedTime, err := time.Parse(time.RFC3339, expected)
+	if err != nil {
+		return 0, false
+	}
+
+	return expectedTime.Sub(aimedTime), true
+}
+
+// classifyDelay maps a delay to the is_late flag and a delay bucket
+func classifyDelay(delay time.Duration, thresholds DelayThresholds) (isLate bool, bucket string) {
+	switch {
+	case delay < -thresholds.Early:
+		bucket = DelayBucketEarly
+	case delay <= thresholds.Late:
+		bucket = DelayBucketOnTime
+	case delay <= thresholds.Major:
+		bucket = DelayBucketMinor
+	default:
+		bucket = DelayBucketMajor
+	}
+
+	return delay > thresholds.Late, bucket
+}
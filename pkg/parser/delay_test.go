@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"bods2loki/pkg/types"
+)
+
+func TestCallDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		call   *types.StopCall
+		want   time.Duration
+		wantOK bool
+	}{
+		{"no call", nil, 0, false},
+		{"arrival", &types.StopCall{
+			AimedArrivalTime:    "2025-10-09T15:40:00Z",
+			ExpectedArrivalTime: "2025-10-09T15:42:30Z",
+		}, 150 * time.Second, true},
+		{"arrival preferred over departure", &types.StopCall{
+			AimedArrivalTime:      "2025-10-09T15:40:00Z",
+			ExpectedArrivalTime:   "2025-10-09T15:39:00Z",
+			AimedDepartureTime:    "2025-10-09T15:40:00Z",
+			ExpectedDepartureTime: "2025-10-09T15:50:00Z",
+		}, -time.Minute, true},
+		{"departure fallback", &types.StopCall{
+			AimedDepartureTime:    "2025-10-09T15:40:00+01:00",
+			ExpectedDepartureTime: "2025-10-09T14:47:00Z",
+		}, 7 * time.Minute, true},
+		{"malformed times", &types.StopCall{
+			AimedArrivalTime:    "soon",
+			ExpectedArrivalTime: "2025-10-09T15:42:30Z",
+		}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := callDelay(tt.call)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("callDelay = %v, %v; want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestClassifyDelay(t *testing.T) {
+	thresholds := DefaultDelayThresholds()
+	tests := []struct {
+		delay  time.Duration
+		isLate bool
+		bucket string
+	}{
+		{-5 * time.Minute, false, DelayBucketEarly},
+		{-time.Minute, false, DelayBucketOnTime},
+		{0, false, DelayBucketOnTime},
+		{time.Minute, false, DelayBucketOnTime},
+		{90 * time.Second, true, DelayBucketMinor},
+		{5 * time.Minute, true, DelayBucketMinor},
+		{10 * time.Minute, true, DelayBucketMajor},
+	}
+
+	for _, tt := range tests {
+		isLate, bucket := classifyDelay(tt.delay, thresholds)
+		if isLate != tt.isLate || bucket != tt.bucket {
+			t.Errorf("classifyDelay(%v) = %v, %q; want %v, %q", tt.delay, isLate, bucket, tt.isLate, tt.bucket)
+		}
+	}
+}
+
+func TestVehicleDelayFields(t *testing.T) {
+	tests := []struct {
+		name         string
+		call         string
+		delaySeconds int
+		isLate       *bool
+		bucket       string
+	}{
+		{
+			name:         "late arrival",
+			call:         `<AimedArrivalTime>2025-10-09T15:40:00Z</AimedArrivalTime><ExpectedArrivalTime>2025-10-09T15:47:00Z</ExpectedArrivalTime>`,
+			delaySeconds: 420,
+			isLate:       ptr(true),
+			bucket:       DelayBucketMajor,
+		},
+		{
+			name:         "late departure only",
+			call:         `<AimedDepartureTime>2025-10-09T15:40:00Z</AimedDepartureTime><ExpectedDepartureTime>2025-10-09T15:43:00Z</ExpectedDepartureTime>`,
+			delaySeconds: 180,
+			isLate:       ptr(true),
+			bucket:       DelayBucketMinor,
+		},
+		{
+			name: "no times",
+			call: `<StopPointRef>0100BRP90310</StopPointRef>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vehicle := parseJourney(t, NewXMLParser(), sampleJourney+sampleLocation+`<MonitoredCall>`+tt.call+`</MonitoredCall>`)
+
+			if vehicle.DelaySeconds != tt.delaySeconds {
+				t.Errorf("DelaySeconds = %d, want %d", vehicle.DelaySeconds, tt.delaySeconds)
+			}
+			if (vehicle.IsLate == nil) != (tt.isLate == nil) || (tt.isLate != nil && *vehicle.IsLate != *tt.isLate) {
+				t.Errorf("IsLate = %v, want %v", vehicle.IsLate, tt.isLate)
+			}
+			if vehicle.DelayBucket != tt.bucket {
+				t.Errorf("DelayBucket = %q, want %q", vehicle.DelayBucket, tt.bucket)
+			}
+		})
+	}
+}
+
+func TestWithDelayThresholds(t *testing.T) {
+	p := NewXMLParser(WithDelayThresholds(DelayThresholds{Early: 2 * time.Minute, Late: 3 * time.Minute, Major: 10 * time.Minute}))
+
+	tests := []struct {
+		expected string
+		isLate   bool
+		bucket   string
+	}{
+		{"2025-10-09T15:37:30Z", false, DelayBucketEarly},
+		{"2025-10-09T15:38:30Z", false, DelayBucketOnTime},
+		{"2025-10-09T15:42:00Z", false, DelayBucketOnTime},
+		{"2025-10-09T15:47:00Z", true, DelayBucketMinor},
+		{"2025-10-09T15:52:00Z", true, DelayBucketMajor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			vehicle := parseJourney(t, p, sampleJourney+sampleLocation+`<MonitoredCall><AimedArrivalTime>2025-10-09T15:40:00Z</AimedArrivalTime><ExpectedArrivalTime>`+tt.expected+`</ExpectedArrivalTime></MonitoredCall>`)
+			if vehicle.IsLate == nil || *vehicle.IsLate != tt.isLate || vehicle.DelayBucket != tt.bucket {
+				t.Errorf("IsLate, DelayBucket = %v, %q; want %v, %q", vehicle.IsLate, vehicle.DelayBucket, tt.isLate, tt.bucket)
+			}
+		})
+	}
+}
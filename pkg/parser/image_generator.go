@@ -3,14 +3,83 @@ package parser
 import (
 	"encoding/base64"
 	"fmt"
+	"regexp"
 	"strings"
+	"sync"
 )
 
+// Bus image modes, selecting which image each vehicle gets
+const (
+	// ImageModeCompact generates the compact bus icon (the default)
+	ImageModeCompact = "compact"
+	// ImageModeBadge generates the smaller line and direction status badge
+	ImageModeBadge = "badge"
+	// ImageModeNone skips image generation, leaving BusImage empty
+	ImageModeNone = "none"
+)
+
+// ImageModeByName validates a bus image mode name; empty means compact
+func ImageModeByName(name string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(name)); mode {
+	case "":
+		return ImageModeCompact, nil
+	case ImageModeCompact, ImageModeBadge, ImageModeNone:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown bus image mode %q (expected compact, badge or none)", name)
+	}
+}
+
 // BusImageGenerator creates base64-encoded SVG images for bus visualization
-type BusImageGenerator struct{}
+type BusImageGenerator struct {
+	theme ImageTheme
+	// minify strips comments and whitespace from the SVG before encoding
+	minify bool
+	// compactCache holds compact images by compactImageKey. The image only
+	// depends on the line, direction and whole-degree heading, so the cache
+	// stays bounded, and sync.Map suits its write-once, read-often use.
+	compactCache sync.Map
+}
+
+// compactImageKey identifies a compact image; heading is the rounded bearing,
+// or empty when there is no bearing
+type compactImageKey struct {
+	lineRef   string
+	direction string
+	heading   string
+}
 
 func NewBusImageGenerator() *BusImageGenerator {
-	return &BusImageGenerator{}
+	return NewThemedBusImageGenerator(LightTheme)
+}
+
+// NewThemedBusImageGenerator creates a generator drawing with the given theme's colors
+func NewThemedBusImageGenerator(theme ImageTheme) *BusImageGenerator {
+	return &BusImageGenerator{theme: theme}
+}
+
+// NewCompactSVGBusImageGenerator creates a themed generator that minifies the
+// SVG markup before encoding, cutting the size of every image
+func NewCompactSVGBusImageGenerator(theme ImageTheme) *BusImageGenerator {
+	return &BusImageGenerator{theme: theme, minify: true}
+}
+
+var (
+	svgComment    = regexp.MustCompile(`<!--.*?-->`)
+	svgInterTag   = regexp.MustCompile(`>\s+<`)
+	svgWhitespace = regexp.MustCompile(`\s+`)
+)
+
+// encodeSVG returns the SVG as a base64 data URI, minified if configured
+func (g *BusImageGenerator) encodeSVG(svg string) string {
+	if g.minify {
+		svg = svgComment.ReplaceAllString(svg, "")
+		svg = svgInterTag.ReplaceAllString(svg, "><")
+		svg = strings.TrimSpace(svgWhitespace.ReplaceAllString(svg, " "))
+	}
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(svg))
+	return fmt.Sprintf("data:image/svg+xml;base64,%s", encoded)
 }
 
 // GenerateBusImage creates a base64-encoded SVG image of a bus with line number and direction arrow
@@ -32,7 +101,7 @@ func (g *BusImageGenerator) GenerateBusImage(lineRef, direction string) string {
 	// Create SVG with bus icon, line number, and directional arrow
 	svg := fmt.Sprintf(`<svg width="120" height="60" xmlns="http://www.w3.org/2000/svg">
   <!-- Background -->
-  <rect width="120" height="60" fill="#f8f9fa" stroke="#dee2e6" stroke-width="1" rx="8"/>
+  <rect width="120" height="60" fill="%s" stroke="%s" stroke-width="1" rx="8"/>
   
   <!-- Bus Body -->
   <rect x="15" y="20" width="50" height="25" fill="%s" rx="4"/>
@@ -50,15 +119,14 @@ func (g *BusImageGenerator) GenerateBusImage(lineRef, direction string) string {
   <circle cx="55" cy="48" r="2" fill="#696969"/>
   
   <!-- Line Number -->
-  <text x="75" y="25" font-family="Arial, sans-serif" font-size="14" font-weight="bold" fill="#333">%s</text>
+  <text x="75" y="25" font-family="Arial, sans-serif" font-size="14" font-weight="bold" fill="%s">%s</text>
   
   <!-- Direction Arrow -->
   <text x="75" y="45" font-family="Arial, sans-serif" font-size="20" font-weight="bold" fill="%s">%s</text>
-</svg>`, color, lineRef, color, arrow)
+</svg>`, g.theme.Background, g.theme.Border, color, g.theme.Text, lineRef, color, arrow)
 
 	// Encode SVG to base64
-	encoded := base64.StdEncoding.EncodeToString([]byte(svg))
-	return fmt.Sprintf("data:image/svg+xml;base64,%s", encoded)
+	return g.encodeSVG(svg)
 }
 
 // getLineColor returns a unique color for each bus line
@@ -93,8 +161,23 @@ func (g *BusImageGenerator) getLineColor(lineRef string) string {
 	return fmt.Sprintf("hsl(%d, 70%%, 50%%)", hue)
 }
 
-// GenerateCompactBusImage creates a smaller, more compact bus image for dense displays
-func (g *BusImageGenerator) GenerateCompactBusImage(lineRef, direction string) string {
+// GenerateCompactBusImage creates a smaller, more compact bus image for dense displays.
+// A non-zero bearing (degrees clockwise from north) draws an arrow pointing
+// that way; otherwise the inbound/outbound indicator is used.
+func (g *BusImageGenerator) GenerateCompactBusImage(lineRef, direction string, bearing float64) string {
+	key := compactImageKey{lineRef: lineRef, direction: direction}
+	if bearing != 0 {
+		key.heading = fmt.Sprintf("%.0f", bearing)
+	}
+	if image, ok := g.compactCache.Load(key); ok {
+		return image.(string)
+	}
+
+	image, _ := g.compactCache.LoadOrStore(key, g.generateCompactBusImage(lineRef, direction, bearing))
+	return image.(string)
+}
+
+func (g *BusImageGenerator) generateCompactBusImage(lineRef, direction string, bearing float64) string {
 	// Get line-specific color
 	busColor := g.getLineColor(lineRef)
 
@@ -112,10 +195,15 @@ func (g *BusImageGenerator) GenerateCompactBusImage(lineRef, direction string) s
 		directionColor = "#6c757d"
 	}
 
+	// Point an arrow along the actual heading when it is known
+	if bearing != 0 {
+		directionShape = fmt.Sprintf(`<polygon points="50,20 53,29 50,27 47,29" fill="%s" transform="rotate(%.0f 50 25)"/>`, directionColor, bearing)
+	}
+
 	// Create enhanced compact SVG (90x45)
 	svg := fmt.Sprintf(`<svg width="90" height="45" xmlns="http://www.w3.org/2000/svg">
   <!-- Background -->
-  <rect width="90" height="45" fill="white" stroke="#dee2e6" stroke-width="1" rx="6"/>
+  <rect width="90" height="45" fill="%s" stroke="%s" stroke-width="1" rx="6"/>
   
   <!-- Bus Body (more detailed) -->
   <rect x="8" y="15" width="32" height="18" fill="%s" rx="3"/>
@@ -149,28 +237,34 @@ func (g *BusImageGenerator) GenerateCompactBusImage(lineRef, direction string) s
   
   <!-- Direction Label -->
   <text x="62.5" y="35" font-family="Arial, sans-serif" font-size="7" font-weight="bold" fill="%s" text-anchor="middle">%s</text>
-</svg>`, busColor, busColor, busColor, lineRef, directionShape, directionColor, strings.ToUpper(direction[:2]))
+</svg>`, g.theme.CompactBackground, g.theme.Border, busColor, busColor, busColor, lineRef, directionShape, directionColor, directionLabel(direction))
 
 	// Encode SVG to base64
-	encoded := base64.StdEncoding.EncodeToString([]byte(svg))
-	return fmt.Sprintf("data:image/svg+xml;base64,%s", encoded)
+	return g.encodeSVG(svg)
+}
+
+// directionLabel abbreviates a direction to its first two letters, e.g. "IN".
+// Feeds may omit DirectionRef or send a single character.
+func directionLabel(direction string) string {
+	if len(direction) > 2 {
+		direction = direction[:2]
+	}
+	return strings.ToUpper(direction)
 }
 
 // GenerateStatusBadge creates a simple status badge image
 func (g *BusImageGenerator) GenerateStatusBadge(lineRef, direction, status string) string {
 	// Determine colors based on direction and status
-	var bgColor, textColor string
+	var bgColor string
+	textColor := g.theme.BadgeText
 
 	switch strings.ToLower(direction) {
 	case "inbound":
 		bgColor = "#198754" // Green
-		textColor = "white"
 	case "outbound":
 		bgColor = "#dc3545" // Red
-		textColor = "white"
 	default:
 		bgColor = "#6c757d" // Gray
-		textColor = "white"
 	}
 
 	// Direction symbol
@@ -187,9 +281,8 @@ func (g *BusImageGenerator) GenerateStatusBadge(lineRef, direction, status strin
   <!-- Text Content -->
   <text x="50" y="16" font-family="Arial, sans-serif" font-size="11" font-weight="bold" 
         fill="%s" text-anchor="middle">%s %s %s</text>
-</svg>`, bgColor, textColor, lineRef, arrow, strings.ToUpper(direction[:2]))
+</svg>`, bgColor, textColor, lineRef, arrow, directionLabel(direction))
 
 	// Encode SVG to base64
-	encoded := base64.StdEncoding.EncodeToString([]byte(svg))
-	return fmt.Sprintf("data:image/svg+xml;base64,%s", encoded)
+	return g.encodeSVG(svg)
 }
@@ -0,0 +1,307 @@
+package parser
+
+import (
+	"encoding/base64"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// decodeSVG returns the SVG markup of a base64 data URI
+func decodeSVG(t *testing.T, image string) string {
+	t.Helper()
+
+	encoded, ok := strings.CutPrefix(image, "data:image/svg+xml;base64,")
+	if !ok {
+		t.Fatalf("image %q is not an SVG data URI", image)
+	}
+	svg, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("invalid base64 image: %v", err)
+	}
+	return string(svg)
+}
+
+func TestImageTheme(t *testing.T) {
+	tests := []struct {
+		name     string
+		generate func(g *BusImageGenerator) string
+		// fill is the theme color expected as the first (background) fill
+		fill func(theme ImageTheme) string
+		// keeps is a line or direction color that doesn't depend on the theme
+		keeps string
+	}{
+		{
+			name:     "full size",
+			generate: func(g *BusImageGenerator) string { return g.GenerateBusImage("49x", "inbound") },
+			fill:     func(theme ImageTheme) string { return theme.Background },
+			keeps:    "#2E8B57",
+		},
+		{
+			name:     "compact",
+			generate: func(g *BusImageGenerator) string { return g.GenerateCompactBusImage("49x", "inbound", 0) },
+			fill:     func(theme ImageTheme) string { return theme.CompactBackground },
+			keeps:    "#28a745",
+		},
+		{
+			name:     "badge",
+			generate: func(g *BusImageGenerator) string { return g.GenerateStatusBadge("49x", "inbound", "") },
+			fill:     func(theme ImageTheme) string { return theme.BadgeText },
+			keeps:    "#198754",
+		},
+	}
+
+	for _, tt := range tests {
+		for _, theme := range []ImageTheme{LightTheme, DarkTheme} {
+			t.Run(tt.name+"/"+theme.Name, func(t *testing.T) {
+				svg := decodeSVG(t, tt.generate(NewThemedBusImageGenerator(theme)))
+
+				if want := `fill="` + tt.fill(theme) + `"`; !strings.Contains(svg, want) {
+					t.Errorf("SVG has no %s:\n%s", want, svg)
+				}
+				if !strings.Contains(svg, tt.keeps) {
+					t.Errorf("SVG lost the line or direction color %s", tt.keeps)
+				}
+			})
+		}
+	}
+}
+
+func TestDarkThemeBackground(t *testing.T) {
+	svg := decodeSVG(t, NewThemedBusImageGenerator(DarkTheme).GenerateCompactBusImage("49x", "outbound", 0))
+
+	if !strings.Contains(svg, `<rect width="90" height="45" fill="#181b1f" stroke="#34373d"`) {
+		t.Errorf("compact background isn't the dark theme's:\n%s", svg)
+	}
+	if strings.Contains(svg, `fill="white" stroke=`) {
+		t.Error("dark compact image still has the light theme's white background")
+	}
+}
+
+func TestImageThemeByName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"", "light", false},
+		{"light", "light", false},
+		{" Dark ", "dark", false},
+		{"sepia", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			theme, err := ImageThemeByName(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ImageThemeByName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if theme.Name != tt.want {
+				t.Errorf("ImageThemeByName(%q) = %q, want %q", tt.name, theme.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageModeByName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"", ImageModeCompact, false},
+		{"compact", ImageModeCompact, false},
+		{" Badge ", ImageModeBadge, false},
+		{"NONE", ImageModeNone, false},
+		{"full", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode, err := ImageModeByName(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ImageModeByName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if mode != tt.want {
+				t.Errorf("ImageModeByName(%q) = %q, want %q", tt.name, mode, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		contains string
+	}{
+		{"compact by default", nil, `<svg width="90" height="45"`},
+		{"compact", []Option{WithImageMode(ImageModeCompact)}, `<svg width="90" height="45"`},
+		{"badge", []Option{WithImageMode(ImageModeBadge)}, `<svg width="100" height="24"`},
+		{"none", []Option{WithImageMode(ImageModeNone)}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vehicle := parseJourney(t, NewXMLParser(tt.opts...), sampleJourney+sampleLocation)
+			if tt.contains == "" {
+				if vehicle.BusImage != "" {
+					t.Errorf("BusImage = %q, want none", vehicle.BusImage)
+				}
+				return
+			}
+			if svg := decodeSVG(t, vehicle.BusImage); !strings.Contains(svg, tt.contains) {
+				t.Errorf("image lacks %q:\n%s", tt.contains, svg)
+			}
+		})
+	}
+}
+
+func TestCompactSVG(t *testing.T) {
+	tests := []struct {
+		name     string
+		generate func(g *BusImageGenerator) string
+		contains []string
+	}{
+		{"full size", func(g *BusImageGenerator) string { return g.GenerateBusImage("49x", "inbound") }, []string{"<svg", "#2E8B57", ">49x<"}},
+		{"compact", func(g *BusImageGenerator) string { return g.GenerateCompactBusImage("49x", "outbound", 90) }, []string{"<svg", "#dc3545", ">49x<", "rotate(90 50 25)", ">OU<"}},
+		{"badge", func(g *BusImageGenerator) string { return g.GenerateStatusBadge("49x", "inbound", "") }, []string{"<svg", "#198754", "49x ← IN"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			full := tt.generate(NewThemedBusImageGenerator(LightTheme))
+			minified := tt.generate(NewCompactSVGBusImageGenerator(LightTheme))
+
+			if len(minified) >= len(full) {
+				t.Errorf("minified image is %d bytes, want fewer than the full %d", len(minified), len(full))
+			}
+
+			svg := decodeSVG(t, minified)
+			for _, want := range tt.contains {
+				if !strings.Contains(svg, want) {
+					t.Errorf("minified SVG lost %q:\n%s", want, svg)
+				}
+			}
+			if strings.Contains(svg, "<!--") || strings.Contains(svg, "\n") || strings.Contains(svg, ">  <") {
+				t.Errorf("SVG still has comments or whitespace between tags:\n%s", svg)
+			}
+		})
+	}
+}
+
+func TestDirectionLabel(t *testing.T) {
+	tests := []struct {
+		direction string
+		want      string
+	}{
+		{"inbound", "IN"},
+		{"outbound", "OU"},
+		{"1", "1"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.direction, func(t *testing.T) {
+			if got := directionLabel(tt.direction); got != tt.want {
+				t.Errorf("directionLabel(%q) = %q, want %q", tt.direction, got, tt.want)
+			}
+
+			// Feeds without a usable DirectionRef still get images
+			g := NewBusImageGenerator()
+			decodeSVG(t, g.GenerateCompactBusImage("49x", tt.direction, 0))
+			decodeSVG(t, g.GenerateStatusBadge("49x", tt.direction, ""))
+		})
+	}
+}
+
+func TestCompactImageHeading(t *testing.T) {
+	tests := []struct {
+		name      string
+		direction string
+		bearing   float64
+		contains  string
+		absent    string
+	}{
+		{"east", "outbound", 90, `transform="rotate(90 50 25)"`, `points="50,22 55,25 50,28"`},
+		{"south west", "inbound", 225.4, `fill="#28a745" transform="rotate(225 50 25)"`, `points="45,22 50,25 45,28"`},
+		{"unknown direction", "", 10, `fill="#6c757d" transform="rotate(10 50 25)"`, `<circle cx="50" cy="25"`},
+		{"no bearing inbound", "inbound", 0, `points="45,22 50,25 45,28"`, "rotate("},
+		{"no bearing outbound", "outbound", 0, `points="50,22 55,25 50,28"`, "rotate("},
+		{"no bearing or direction", "", 0, `<circle cx="50" cy="25" r="2"`, "rotate("},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svg := decodeSVG(t, NewBusImageGenerator().GenerateCompactBusImage("49x", tt.direction, tt.bearing))
+			if !strings.Contains(svg, tt.contains) {
+				t.Errorf("SVG lacks %q:\n%s", tt.contains, svg)
+			}
+			if strings.Contains(svg, tt.absent) {
+				t.Errorf("SVG has %q:\n%s", tt.absent, svg)
+			}
+		})
+	}
+}
+
+func TestCompactImageCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		direction string
+		bearing   float64
+	}{
+		{"no bearing", "inbound", 0},
+		{"bearing", "outbound", 90},
+		{"fractional bearing", "outbound", 89.6},
+	}
+
+	g := NewBusImageGenerator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := g.generateCompactBusImage("49x", tt.direction, tt.bearing)
+			for i := 0; i < 2; i++ {
+				if got := g.GenerateCompactBusImage("49x", tt.direction, tt.bearing); got != want {
+					t.Errorf("call %d returned a different image to an uncached one", i)
+				}
+			}
+		})
+	}
+
+	// Keys that differ in any part get their own image
+	images := map[string]bool{
+		g.GenerateCompactBusImage("49x", "inbound", 0):   true,
+		g.GenerateCompactBusImage("72", "inbound", 0):    true,
+		g.GenerateCompactBusImage("49x", "outbound", 0):  true,
+		g.GenerateCompactBusImage("49x", "inbound", 180): true,
+	}
+	if len(images) != 4 {
+		t.Errorf("got %d distinct images for 4 keys", len(images))
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for bearing := 0; bearing < 360; bearing += 15 {
+				g.GenerateCompactBusImage("49x", "inbound", float64(bearing))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkGenerateCompactBusImage(b *testing.B) {
+	b.Run("cached", func(b *testing.B) {
+		g := NewBusImageGenerator()
+		for i := 0; i < b.N; i++ {
+			g.GenerateCompactBusImage("49x", "inbound", float64(i%4*90))
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		g := NewBusImageGenerator()
+		for i := 0; i < b.N; i++ {
+			g.generateCompactBusImage("49x", "inbound", float64(i%4*90))
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package parser
+
+import (
+	"bods2loki/pkg/bods"
+	"bods2loki/pkg/types"
+)
+
+// UKBoundingBox covers Great Britain, Northern Ireland and the surrounding
+// islands, for rejecting positions that cannot belong to a BODS vehicle
+var UKBoundingBox = bods.BoundingBox{
+	MinLongitude: -8.7,
+	MinLatitude:  49.8,
+	MaxLongitude: 1.8,
+	MaxLatitude:  60.9,
+}
+
+// WithLocationBounds treats positions outside box as invalid, in addition to
+// the 0,0 placeholder and out-of-range coordinates
+func WithLocationBounds(box bods.BoundingBox) Option {
+	return func(p *XMLParser) {
+		p.locationBounds = &box
+	}
+}
+
+// WithDropInvalidLocations drops vehicles with an invalid position instead
+// of flagging them with LocationValid=false
+func WithDropInvalidLocations(enabled bool) Option {
+	return func(p *XMLParser) {
+		p.dropInvalidLocations = enabled
+	}
+}
+
+// validCoordinates reports whether a position is in range and isn't the 0,0 placeholder
+func validCoordinates(latitude, longitude float64) bool {
+	if latitude == 0 && longitude == 0 {
+		return false
+	}
+	return latitude >= -90 && latitude <= 90 && longitude >= -180 && longitude <= 180
+}
+
+// validLocation reports whether a vehicle's position is valid and within the
+// configured bounds, if any
+func (p *XMLParser) validLocation(vehicle *types.VehicleActivity) bool {
+	if !validCoordinates(vehicle.Latitude, vehicle.Longitude) {
+		return false
+	}
+	return p.locationBounds == nil || p.locationBounds.Contains(vehicle.Latitude, vehicle.Longitude)
+}
@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLocationValidation(t *testing.T) {
+	tests := []struct {
+		name                string
+		latitude, longitude float64
+		opts                []Option
+		valid               bool
+		kept                bool
+	}{
+		{"valid", 51.495853, -2.480741, nil, true, true},
+		{"null island flagged", 0, 0, nil, false, true},
+		{"null island dropped", 0, 0, []Option{WithDropInvalidLocations(true)}, false, false},
+		{"longitude out of range", 51.495853, 182.5, nil, false, true},
+		{"latitude out of range", -91, -2.480741, []Option{WithDropInvalidLocations(true)}, false, false},
+		{"zero longitude is valid", 51.477, 0, nil, true, true},
+		{"valid kept when dropping", 51.495853, -2.480741, []Option{WithDropInvalidLocations(true)}, true, true},
+		{"inside UK bounds", 51.495853, -2.480741, []Option{WithLocationBounds(UKBoundingBox)}, true, true},
+		{"outside UK bounds", 48.8566, 2.3522, []Option{WithLocationBounds(UKBoundingBox)}, false, true},
+		{"outside UK bounds dropped", 48.8566, 2.3522, []Option{WithLocationBounds(UKBoundingBox), WithDropInvalidLocations(true)}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			location := fmt.Sprintf(`<VehicleLocation><Longitude>%v</Longitude><Latitude>%v</Latitude></VehicleLocation>`, tt.longitude, tt.latitude)
+			parsed := parse(t, NewXMLParser(tt.opts...), siri(activity(sampleJourney+location)))
+
+			if kept := len(parsed.VehicleData) == 1; kept != tt.kept {
+				t.Fatalf("vehicle kept = %v, want %v", kept, tt.kept)
+			}
+			if !tt.kept {
+				return
+			}
+			if got := parsed.VehicleData[0].LocationValid; got != tt.valid {
+				t.Errorf("LocationValid = %v, want %v", got, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package parser
+
+import (
+	"math"
+)
+
+// Ellipsoid and projection constants for the Ordnance Survey National Grid
+// (Airy 1830 ellipsoid, transverse Mercator) and the WGS84 ellipsoid
+const (
+	airyA = 6377563.396
+	airyB = 6356256.909
+
+	wgs84A = 6378137.0
+	wgs84B = 6356752.3142
+
+	nationalGridF0      = 0.9996012717
+	nationalGridE0      = 400000.0
+	nationalGridN0      = -100000.0
+	nationalGridPhi0    = 49.0 * math.Pi / 180
+	nationalGridLambda0 = -2.0 * math.Pi / 180
+)
+
+// Helmert parameters for OSGB36 -> WGS84 (the inverse of the published
+// WGS84 -> OSGB36 transform). Accurate to around 5 metres, which is well within
+// GPS noise for bus positions.
+const (
+	helmertTx = 446.448  // metres
+	helmertTy = -125.157 // metres
+	helmertTz = 542.060  // metres
+	helmertS  = -20.4894 // ppm
+	helmertRx = 0.1502   // arcseconds
+	helmertRy = 0.2470   // arcseconds
+	helmertRz = 0.8421   // arcseconds
+)
+
+// OSGBToWGS84 converts an OSGB36 National Grid easting/northing in metres to
+// WGS84 latitude/longitude in decimal degrees
+func OSGBToWGS84(easting, northing float64) (lat, lng float64) {
+	phi, lambda := gridToOSGB36(easting, northing)
+
+	x, y, z := geodeticToCartesian(phi, lambda, airyA, airyB)
+	x, y, z = helmertToWGS84(x, y, z)
+	phi, lambda = cartesianToGeodetic(x, y, z, wgs84A, wgs84B)
+
+	return phi * 180 / math.Pi, lambda * 180 / math.Pi
+}
+
+// gridToOSGB36 inverts the National Grid transverse Mercator projection,
+// following the Ordnance Survey "Guide to coordinate systems in Great Britain"
+func gridToOSGB36(easting, northing float64) (phi, lambda float64) {
+	a, b, f0 := airyA, airyB, nationalGridF0
+	e2 := 1 - (b*b)/(a*a)
+	n := (a - b) / (a + b)
+
+	phi = nationalGridPhi0
+	m := 0.0
+	for i := 0; i < 100; i++ {
+		phi = (northing-nationalGridN0-m)/(a*f0) + phi
+		m = meridionalArc(phi, b, f0, n)
+		if math.Abs(northing-nationalGridN0-m) < 0.00001 {
+			break
+		}
+	}
+
+	sinPhi := math.Sin(phi)
+	nu := a * f0 / math.Sqrt(1-e2*sinPhi*sinPhi)
+	rho := a * f0 * (1 - e2) / math.Pow(1-e2*sinPhi*sinPhi, 1.5)
+	eta2 := nu/rho - 1
+
+	tanPhi := math.Tan(phi)
+	tan2, tan4, tan6 := tanPhi*tanPhi, math.Pow(tanPhi, 4), math.Pow(tanPhi, 6)
+	secPhi := 1 / math.Cos(phi)
+
+	vii := tanPhi / (2 * rho * nu)
+	viii := tanPhi / (24 * rho * math.Pow(nu, 3)) * (5 + 3*tan2 + eta2 - 9*tan2*eta2)
+	ix := tanPhi / (720 * rho * math.Pow(nu, 5)) * (61 + 90*tan2 + 45*tan4)
+	x := secPhi / nu
+	xi := secPhi / (6 * math.Pow(nu, 3)) * (nu/rho + 2*tan2)
+	xii := secPhi / (120 * math.Pow(nu, 5)) * (5 + 28*tan2 + 24*tan4)
+	xiia := secPhi / (5040 * math.Pow(nu, 7)) * (61 + 662*tan2 + 1320*tan4 + 720*tan6)
+
+	dE := easting - nationalGridE0
+	phi = phi - vii*dE*dE + viii*math.Pow(dE, 4) - ix*math.Pow(dE, 6)
+	lambda = nationalGridLambda0 + x*dE - xi*math.Pow(dE, 3) + xii*math.Pow(dE, 5) - xiia*math.Pow(dE, 7)
+
+	return phi, lambda
+}
+
+// meridionalArc returns the developed arc of the meridian from the true origin to phi
+func meridionalArc(phi, b, f0, n float64) float64 {
+	n2, n3 := n*n, n*n*n
+	dPhi, sPhi := phi-nationalGridPhi0, phi+nationalGridPhi0
+
+	ma := (1 + n + (5.0/4)*n2 + (5.0/4)*n3) * dPhi
+	mb := (3*n + 3*n2 + (21.0/8)*n3) * math.Sin(dPhi) * math.Cos(sPhi)
+	mc := ((15.0/8)*n2 + (15.0/8)*n3) * math.Sin(2*dPhi) * math.Cos(2*sPhi)
+	md := (35.0 / 24) * n3 * math.Sin(3*dPhi) * math.Cos(3*sPhi)
+
+	return b * f0 * (ma - mb + mc - md)
+}
+
+// geodeticToCartesian converts latitude/longitude (radians, height 0) to ECEF coordinates
+func geodeticToCartesian(phi, lambda, a, b float64) (x, y, z float64) {
+	e2 := 1 - (b*b)/(a*a)
+	sinPhi := math.Sin(phi)
+	nu := a / math.Sqrt(1-e2*sinPhi*sinPhi)
+
+	x = nu * math.Cos(phi) * math.Cos(lambda)
+	y = nu * math.Cos(phi) * math.Sin(lambda)
+	z = (1 - e2) * nu * sinPhi
+	return x, y, z
+}
+
+// helmertToWGS84 applies the seven-parameter OSGB36 -> WGS84 Helmert transform
+func helmertToWGS84(x, y, z float64) (float64, float64, float64) {
+	arcsec := math.Pi / (180 * 3600)
+	rx, ry, rz := helmertRx*arcsec, helmertRy*arcsec, helmertRz*arcsec
+	s := 1 + helmertS*1e-6
+
+	return helmertTx + s*x - rz*y + ry*z,
+		helmertTy + rz*x + s*y - rx*z,
+		helmertTz - ry*x + rx*y + s*z
+}
+
+// cartesianToGeodetic converts ECEF coordinates to latitude/longitude in radians
+func cartesianToGeodetic(x, y, z, a, b float64) (phi, lambda float64) {
+	e2 := 1 - (b*b)/(a*a)
+	p := math.Sqrt(x*x + y*y)
+
+	phi = math.Atan2(z, p*(1-e2))
+	for i := 0; i < 10; i++ {
+		sinPhi := math.Sin(phi)
+		nu := a / math.Sqrt(1-e2*sinPhi*sinPhi)
+		next := math.Atan2(z+e2*nu*sinPhi, p)
+		if math.Abs(next-phi) < 1e-12 {
+			phi = next
+			break
+		}
+		phi = next
+	}
+
+	return phi, math.Atan2(y, x)
+}
@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"math"
+	"testing"
+)
+
+// The Ordnance Survey worked example: Caister Water Tower
+const (
+	caisterEasting  = 651409.903
+	caisterNorthing = 313177.270
+)
+
+func TestGridToOSGB36(t *testing.T) {
+	tests := []struct {
+		name              string
+		easting, northing float64
+		wantLat, wantLng  float64
+	}{
+		// From the Ordnance Survey guide's worked example
+		{"Caister Water Tower", caisterEasting, caisterNorthing, 52.657570301, 1.717921583},
+		// The projection's true origin is defined as 49N 2W
+		{"true origin", nationalGridE0, nationalGridN0, 49, -2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			phi, lambda := gridToOSGB36(tt.easting, tt.northing)
+			lat, lng := phi*180/math.Pi, lambda*180/math.Pi
+			if math.Abs(lat-tt.wantLat) > 1e-8 || math.Abs(lng-tt.wantLng) > 1e-8 {
+				t.Errorf("gridToOSGB36(%v, %v) = %.9f, %.9f; want %.9f, %.9f", tt.easting, tt.northing, lat, lng, tt.wantLat, tt.wantLng)
+			}
+		})
+	}
+}
+
+func TestOSGBToWGS84(t *testing.T) {
+	// The Helmert transform is accurate to around 5 metres, about 5e-5 degrees
+	lat, lng := OSGBToWGS84(caisterEasting, caisterNorthing)
+	if math.Abs(lat-52.657979) > 5e-5 || math.Abs(lng-1.716052) > 5e-5 {
+		t.Errorf("OSGBToWGS84 = %.6f, %.6f; want 52.657979, 1.716052", lat, lng)
+	}
+}
+
+func TestOSGBFieldsFallback(t *testing.T) {
+	p := NewXMLParser(WithOSGBFields("Easting", "Northing"))
+
+	tests := []struct {
+		name    string
+		journey string
+	}{
+		{"in VehicleLocation", `<VehicleLocation><Easting>651409.903</Easting><Northing>313177.270</Northing></VehicleLocation>`},
+		{"on the journey", `<Easting>651409.903</Easting><Northing>313177.270</Northing>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vehicle := parseJourney(t, p, sampleJourney+tt.journey)
+			if math.Abs(vehicle.Latitude-52.657979) > 5e-5 || math.Abs(vehicle.Longitude-1.716052) > 5e-5 {
+				t.Errorf("location = %f, %f; want the converted Caister position", vehicle.Latitude, vehicle.Longitude)
+			}
+		})
+	}
+
+	// Feeds that give lat/lng directly are left alone
+	vehicle := parseJourney(t, p, sampleJourney+sampleLocation)
+	if vehicle.Latitude != 51.495853 || vehicle.Longitude != -2.480741 {
+		t.Errorf("location = %f, %f; want the reported lat/lng", vehicle.Latitude, vehicle.Longitude)
+	}
+}
@@ -0,0 +1,129 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"bods2loki/pkg/types"
+)
+
+// Feed lag at or below goodLag scores fully; it falls linearly to zero at maxLag
+const (
+	goodLag = time.Minute
+	maxLag  = 10 * time.Minute
+)
+
+// QualityWeights sets how much each signal contributes to data_quality
+type QualityWeights struct {
+	// Monitored scores real-time (or unreported) positions over schedule-based ones
+	Monitored float64
+	// Coordinates scores a plausible, non-zero latitude/longitude
+	Coordinates float64
+	// Lag scores how recently the position was recorded relative to the fetch
+	Lag float64
+	// Freshness scores whether ValidUntilTime had not passed when fetched
+	Freshness float64
+}
+
+// DefaultQualityWeights weights every signal equally
+func DefaultQualityWeights() QualityWeights {
+	return QualityWeights{Monitored: 1, Coordinates: 1, Lag: 1, Freshness: 1}
+}
+
+// ParseQualityWeights parses "monitored=2,coordinates=1,lag=1,freshness=1".
+// Signals not listed keep their default weight.
+func ParseQualityWeights(s string) (QualityWeights, error) {
+	weights := DefaultQualityWeights()
+	if strings.TrimSpace(s) == "" {
+		return weights, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return weights, fmt.Errorf("invalid quality weight %q: expected name=value", pair)
+		}
+		w, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || w < 0 {
+			return weights, fmt.Errorf("invalid quality weight %q: expected a non-negative number", pair)
+		}
+
+		switch strings.TrimSpace(name) {
+		case "monitored":
+			weights.Monitored = w
+		case "coordinates":
+			weights.Coordinates = w
+		case "lag":
+			weights.Lag = w
+		case "freshness":
+			weights.Freshness = w
+		default:
+			return weights, fmt.Errorf("unknown quality signal %q", name)
+		}
+	}
+
+	return weights, nil
+}
+
+// DataQuality combines a vehicle's quality signals into a 0-100 score, relative
+// to the time its data was fetched. Signals that can't be evaluated (e.g. a
+// missing RecordedAtTime) score zero.
+func DataQuality(vehicle *types.VehicleActivity, fetchedAt time.Time, weights QualityWeights) int {
+	total := weights.Monitored + weights.Coordinates + weights.Lag + weights.Freshness
+	if total == 0 {
+		return 0
+	}
+
+	score := weights.Monitored*monitoredSignal(vehicle) +
+		weights.Coordinates*coordinatesSignal(vehicle) +
+		weights.Lag*lagSignal(vehicle, fetchedAt) +
+		weights.Freshness*freshnessSignal(vehicle, fetchedAt)
+
+	return int(math.Round(score / total * 100))
+}
+
+// monitoredSignal is 0 only when the feed says the position is not real-time
+func monitoredSignal(vehicle *types.VehicleActivity) float64 {
+	if vehicle.Monitored != nil && !*vehicle.Monitored {
+		return 0
+	}
+	return 1
+}
+
+// coordinatesSignal is 1 for an in-range position that isn't the 0,0 placeholder
+func coordinatesSignal(vehicle *types.VehicleActivity) float64 {
+	if !validCoordinates(vehicle.Latitude, vehicle.Longitude) {
+		return 0
+	}
+	return 1
+}
+
+// lagSignal scores the gap between the position being recorded and fetched
+func lagSignal(vehicle *types.VehicleActivity, fetchedAt time.Time) float64 {
+	recorded, err := time.Parse(time.RFC3339, vehicle.RecordedAtTime)
+	if err != nil {
+		return 0
+	}
+
+	lag := fetchedAt.Sub(recorded)
+	switch {
+	case lag <= goodLag:
+		return 1
+	case lag >= maxLag:
+		return 0
+	default:
+		return 1 - float64(lag-goodLag)/float64(maxLag-goodLag)
+	}
+}
+
+// freshnessSignal is 1 when the position was still valid at fetch time
+func freshnessSignal(vehicle *types.VehicleActivity, fetchedAt time.Time) float64 {
+	validUntil, err := time.Parse(time.RFC3339, vehicle.ValidUntilTime)
+	if err != nil || validUntil.Before(fetchedAt) {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"testing"
+
+	"bods2loki/pkg/types"
+)
+
+// qualityVehicle returns a monitored vehicle recorded 6s before sampleFetchTime
+// and valid for five minutes after it
+func qualityVehicle() types.VehicleActivity {
+	return types.VehicleActivity{
+		Monitored:      ptr(true),
+		Latitude:       51.495853,
+		Longitude:      -2.480741,
+		RecordedAtTime: "2025-10-09T15:37:34Z",
+		ValidUntilTime: "2025-10-09T15:42:40Z",
+	}
+}
+
+func TestDataQuality(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(v *types.VehicleActivity)
+		weights  QualityWeights
+		min, max int
+	}{
+		{"fully valid", func(v *types.VehicleActivity) {}, DefaultQualityWeights(), 100, 100},
+		{"monitored unreported", func(v *types.VehicleActivity) { v.Monitored = nil }, DefaultQualityWeights(), 100, 100},
+		{"schedule based", func(v *types.VehicleActivity) { v.Monitored = ptr(false) }, DefaultQualityWeights(), 75, 75},
+		{"placeholder position", func(v *types.VehicleActivity) { v.Latitude, v.Longitude = 0, 0 }, DefaultQualityWeights(), 75, 75},
+		{"lagging five minutes", func(v *types.VehicleActivity) { v.RecordedAtTime = "2025-10-09T15:32:40Z" }, DefaultQualityWeights(), 80, 95},
+		{"expired", func(v *types.VehicleActivity) { v.ValidUntilTime = "2025-10-09T15:30:00Z" }, DefaultQualityWeights(), 75, 75},
+		{"degraded", func(v *types.VehicleActivity) {
+			v.Monitored = ptr(false)
+			v.RecordedAtTime = "2025-10-09T15:20:00Z"
+			v.ValidUntilTime = ""
+		}, DefaultQualityWeights(), 25, 25},
+		{"weighted towards monitored", func(v *types.VehicleActivity) { v.Monitored = ptr(false) }, QualityWeights{Monitored: 3, Coordinates: 1}, 25, 25},
+		{"no weights", func(v *types.VehicleActivity) {}, QualityWeights{}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vehicle := qualityVehicle()
+			tt.modify(&vehicle)
+
+			got := DataQuality(&vehicle, sampleFetchTime, tt.weights)
+			if got < tt.min || got > tt.max {
+				t.Errorf("DataQuality = %d, want %d-%d", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestParseQualityWeights(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    QualityWeights
+		wantErr bool
+	}{
+		{input: "", want: DefaultQualityWeights()},
+		{input: "monitored=2", want: QualityWeights{Monitored: 2, Coordinates: 1, Lag: 1, Freshness: 1}},
+		{input: "lag=0, freshness=0.5", want: QualityWeights{Monitored: 1, Coordinates: 1, Lag: 0, Freshness: 0.5}},
+		{input: "monitored", wantErr: true},
+		{input: "lag=-1", wantErr: true},
+		{input: "speed=1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseQualityWeights(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseQualityWeights(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("ParseQualityWeights(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package parser
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"bods2loki/pkg/types"
+)
+
+// processKeySize is the length of the random key used when none is configured
+const processKeySize = 32
+
+// Redactable fields, named as they appear in emitted entries
+const (
+	RedactVehicleRef = "vehicle_ref"
+	RedactBlockRef   = "block_ref"
+)
+
+// Redactor hides configured vehicle identifiers before they reach logs, spans
+// or emitted entries. Values are replaced by a truncated HMAC-SHA256 so they
+// stay joinable across entries but cannot be reversed. Without a configured
+// key a random one is generated, so hashes still tell vehicles apart (for
+// dedup, position history and Kafka keys) but change on every restart.
+type Redactor struct {
+	key        []byte
+	vehicleRef bool
+	blockRef   bool
+}
+
+// NewRedactor creates a Redactor for the given fields, hashing with key, or a
+// random per-process key when it is empty
+func NewRedactor(fields []string, key string) (*Redactor, error) {
+	r := &Redactor{key: []byte(key)}
+	if key == "" {
+		r.key = make([]byte, processKeySize)
+		if _, err := rand.Read(r.key); err != nil {
+			return nil, fmt.Errorf("failed to generate redaction key: %w", err)
+		}
+	}
+
+	for _, field := range fields {
+		switch strings.TrimSpace(field) {
+		case RedactVehicleRef:
+			r.vehicleRef = true
+		case RedactBlockRef:
+			r.blockRef = true
+		case "":
+		default:
+			return nil, fmt.Errorf("unsupported redaction field %q (supported: %s, %s)", field, RedactVehicleRef, RedactBlockRef)
+		}
+	}
+
+	return r, nil
+}
+
+// Value returns the redacted form of an identifier. Empty values stay empty.
+func (r *Redactor) Value(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// VehicleRef returns ref redacted if vehicle_ref redaction is enabled
+func (r *Redactor) VehicleRef(ref string) string {
+	if r == nil || !r.vehicleRef {
+		return ref
+	}
+	return r.Value(ref)
+}
+
+// Apply redacts the configured fields of a vehicle in place
+func (r *Redactor) Apply(vehicle *types.VehicleActivity) {
+	if r == nil {
+		return
+	}
+
+	if r.vehicleRef {
+		vehicle.VehicleRef = r.Value(vehicle.VehicleRef)
+		// DatedVehicleJourneyRef stands in for a missing VehicleRef, so it
+		// would otherwise leak the identifier under another key
+		vehicle.DatedVehicleJourneyRef = r.Value(vehicle.DatedVehicleJourneyRef)
+	}
+	if r.blockRef {
+		vehicle.BlockRef = r.Value(vehicle.BlockRef)
+	}
+}
@@ -0,0 +1,169 @@
+package parser
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"bods2loki/pkg/loki"
+	"bods2loki/pkg/types"
+)
+
+func TestRedactorValue(t *testing.T) {
+	keyed, err := NewRedactor([]string{RedactVehicleRef}, "secret")
+	if err != nil {
+		t.Fatalf("NewRedactor: %v", err)
+	}
+	otherKey, err := NewRedactor([]string{RedactVehicleRef}, "other-secret")
+	if err != nil {
+		t.Fatalf("NewRedactor: %v", err)
+	}
+
+	if a, b := keyed.Value("bus-1"), keyed.Value("bus-1"); a != b {
+		t.Errorf("same input hashed to %q and %q, want a stable hash", a, b)
+	}
+	if a, b := keyed.Value("bus-1"), keyed.Value("bus-2"); a == b {
+		t.Errorf("different inputs both hashed to %q", a)
+	}
+	if a, b := keyed.Value("bus-1"), otherKey.Value("bus-1"); a == b {
+		t.Errorf("different keys both hashed to %q", a)
+	}
+	if got := keyed.Value("bus-1"); len(got) != 16 || strings.Contains(got, "bus-1") {
+		t.Errorf("Value(bus-1) = %q, want a 16 character hash", got)
+	}
+	if got := keyed.Value(""); got != "" {
+		t.Errorf("Value(\"\") = %q, want empty", got)
+	}
+
+	unkeyed, err := NewRedactor([]string{RedactVehicleRef}, "")
+	if err != nil {
+		t.Fatalf("NewRedactor: %v", err)
+	}
+	// Without a key, values still hash distinctly so they can identify vehicles
+	if a, b := unkeyed.Value("bus-1"), unkeyed.Value("bus-1"); a != b {
+		t.Errorf("same input hashed to %q and %q without a key, want a stable hash", a, b)
+	}
+	if a, b := unkeyed.Value("bus-1"), unkeyed.Value("bus-2"); a == b {
+		t.Errorf("different inputs both hashed to %q without a key", a)
+	}
+	if got := unkeyed.Value("bus-1"); len(got) != 16 || strings.Contains(got, "bus-1") {
+		t.Errorf("Value(bus-1) without a key = %q, want a 16 character hash", got)
+	}
+
+	// Each process gets its own random key
+	restarted, err := NewRedactor([]string{RedactVehicleRef}, "")
+	if err != nil {
+		t.Fatalf("NewRedactor: %v", err)
+	}
+	if a, b := unkeyed.Value("bus-1"), restarted.Value("bus-1"); a == b {
+		t.Errorf("two unkeyed redactors both hashed to %q, want random keys", a)
+	}
+}
+
+func TestNewRedactorFields(t *testing.T) {
+	tests := []struct {
+		fields     []string
+		vehicleRef bool
+		blockRef   bool
+		wantErr    bool
+	}{
+		{fields: nil},
+		{fields: []string{"vehicle_ref"}, vehicleRef: true},
+		{fields: []string{" block_ref ", ""}, blockRef: true},
+		{fields: []string{"vehicle_ref", "block_ref"}, vehicleRef: true, blockRef: true},
+		{fields: []string{"operator_ref"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.fields, ","), func(t *testing.T) {
+			r, err := NewRedactor(tt.fields, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewRedactor error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (r.vehicleRef != tt.vehicleRef || r.blockRef != tt.blockRef) {
+				t.Errorf("vehicleRef, blockRef = %v, %v; want %v, %v", r.vehicleRef, r.blockRef, tt.vehicleRef, tt.blockRef)
+			}
+		})
+	}
+}
+
+func TestParseRedactsIdentifiers(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []string
+		key    string
+		hidden []string
+		kept   []string
+	}{
+		{"vehicle ref hashed", []string{RedactVehicleRef}, "secret", []string{"bus-1"}, []string{"block-7"}},
+		{"both replaced", []string{RedactVehicleRef, RedactBlockRef}, "", []string{"bus-1", "block-7"}, nil},
+		{"disabled", nil, "", nil, []string{"bus-1", "block-7"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redactor, err := NewRedactor(tt.fields, tt.key)
+			if err != nil {
+				t.Fatalf("NewRedactor: %v", err)
+			}
+			p := NewXMLParser(WithRedactor(redactor))
+
+			vehicle := parseJourney(t, p, sampleJourney+`<BlockRef>block-7</BlockRef>`+sampleLocation)
+			encoded, err := json.Marshal(vehicle)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+
+			for _, raw := range tt.hidden {
+				if strings.Contains(string(encoded), raw) {
+					t.Errorf("raw value %q appears in %s", raw, encoded)
+				}
+			}
+			for _, raw := range tt.kept {
+				if !strings.Contains(string(encoded), raw) {
+					t.Errorf("unredacted value %q missing from %s", raw, encoded)
+				}
+			}
+			if tt.key != "" && vehicle.VehicleRef != redactor.Value("bus-1") {
+				t.Errorf("VehicleRef = %q, want the keyed hash %q", vehicle.VehicleRef, redactor.Value("bus-1"))
+			}
+		})
+	}
+}
+
+func TestRedactDatedVehicleJourneyRef(t *testing.T) {
+	journeyRef := `<FramedVehicleJourneyRef><DataFrameRef>2025-10-09</DataFrameRef><DatedVehicleJourneyRef>journey-1523</DatedVehicleJourneyRef></FramedVehicleJourneyRef>`
+
+	tests := []struct {
+		name    string
+		journey string
+		fields  []string
+		hidden  bool
+	}{
+		{"fallback VehicleRef redacted", `<LineRef>49x</LineRef>` + journeyRef, []string{RedactVehicleRef}, true},
+		{"alongside VehicleRef redacted", sampleJourney + journeyRef, []string{RedactVehicleRef}, true},
+		{"vehicle_ref not redacted", `<LineRef>49x</LineRef>` + journeyRef, []string{RedactBlockRef}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redactor, err := NewRedactor(tt.fields, "secret")
+			if err != nil {
+				t.Fatalf("NewRedactor: %v", err)
+			}
+			vehicle := parseJourney(t, NewXMLParser(WithRedactor(redactor)), tt.journey+sampleLocation)
+
+			entry := loki.BuildVehicleEntry(&types.ParsedBusData{LineRef: "49x", Timestamp: "2025-10-09T15:37:40Z"}, vehicle, loki.EntryOptions{})
+			encoded, err := json.Marshal(entry)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if got := strings.Contains(string(encoded), "journey-1523"); got == tt.hidden {
+				t.Errorf("raw journey ref in entry = %v, want %v: %s", got, !tt.hidden, encoded)
+			}
+			if tt.hidden && vehicle.DatedVehicleJourneyRef != redactor.Value("journey-1523") {
+				t.Errorf("DatedVehicleJourneyRef = %q, want the keyed hash %q", vehicle.DatedVehicleJourneyRef, redactor.Value("journey-1523"))
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"context"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"bods2loki/pkg/bods"
+)
+
+// selfCheckSample is a minimal SIRI-VM response with a single known vehicle
+//
+//go:embed selfcheck/sample.xml
+var selfCheckSample []byte
+
+// SelfCheck parses an embedded SIRI sample with this parser's configuration
+// and verifies the vehicle and its bus image come out intact, so a broken
+// build or configuration fails fast at startup
+func (p *XMLParser) SelfCheck(ctx context.Context) error {
+	return p.checkSample(ctx, selfCheckSample)
+}
+
+// checkSample parses sample and checks it yields exactly one valid vehicle
+func (p *XMLParser) checkSample(ctx context.Context, sample []byte) error {
+	busData := &bods.BusData{
+		XMLData:     string(sample),
+		ContentType: "application/xml",
+		Timestamp:   time.Now(),
+		LineRef:     "selfcheck",
+	}
+
+	parsed, err := p.ParseBusData(ctx, busData)
+	if err != nil {
+		return fmt.Errorf("self-check: failed to parse sample: %w", err)
+	}
+
+	if len(parsed.VehicleData) != 1 {
+		return fmt.Errorf("self-check: expected 1 vehicle in sample, got %d", len(parsed.VehicleData))
+	}
+
+	vehicle := parsed.VehicleData[0]
+	if vehicle.VehicleRef == "" || vehicle.LineRef != "49x" {
+		return fmt.Errorf("self-check: vehicle fields not extracted (vehicle_ref=%q, line_ref=%q)", vehicle.VehicleRef, vehicle.LineRef)
+	}
+	if vehicle.Latitude == 0 || vehicle.Longitude == 0 {
+		return fmt.Errorf("self-check: vehicle location not extracted")
+	}
+
+	if p.imageMode == ImageModeNone {
+		if vehicle.BusImage != "" {
+			return fmt.Errorf("self-check: bus image generated with image mode none")
+		}
+		return nil
+	}
+
+	const imagePrefix = "data:image/svg+xml;base64,"
+	if !strings.HasPrefix(vehicle.BusImage, imagePrefix) {
+		return fmt.Errorf("self-check: bus image is not a base64 SVG data URI")
+	}
+	svg, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(vehicle.BusImage, imagePrefix))
+	if err != nil || !strings.Contains(string(svg), "<svg") {
+		return fmt.Errorf("self-check: bus image does not decode to an SVG")
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSelfCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"compact images", nil},
+		{"badge images", []Option{WithImageMode(ImageModeBadge)}},
+		{"no images", []Option{WithImageMode(ImageModeNone)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewXMLParser(tt.opts...).SelfCheck(context.Background()); err != nil {
+				t.Errorf("SelfCheck: %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckSampleCorrupted(t *testing.T) {
+	sample := string(selfCheckSample)
+
+	tests := []struct {
+		name    string
+		sample  string
+		wantErr string
+	}{
+		{"truncated", sample[:len(sample)/2], "failed to parse sample"},
+		{"no vehicles", strings.Replace(sample, "VehicleActivity>", "Activity>", 2), "expected 1 vehicle"},
+		{"wrong line", strings.Replace(sample, "<LineRef>49x</LineRef>", "<LineRef>72</LineRef>", 1), "vehicle fields not extracted"},
+		{"no location", strings.Replace(sample, "<Latitude>51.495853</Latitude>", "", 1), "vehicle location not extracted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewXMLParser().checkSample(context.Background(), []byte(tt.sample))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkSample error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"bods2loki/pkg/bods"
+	"bods2loki/pkg/types"
+
+	"github.com/clbanning/mxj/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// situationReasons are the SIRI-SX elements naming why a situation arose
+var situationReasons = []string{
+	"MiscellaneousReason",
+	"PersonnelReason",
+	"EquipmentReason",
+	"EnvironmentReason",
+	"UndefinedReason",
+}
+
+// ParseSituations extracts the PtSituationElements from a SIRI-SX response
+func (p *XMLParser) ParseSituations(ctx context.Context, data *bods.BusData) ([]types.Situation, error) {
+	_, span := p.tracer.Start(ctx, "xml_parser.parse_situations",
+		trace.WithAttributes(
+			attribute.Int("xml_size_bytes", len(data.XMLData)),
+			attribute.String("content_type", data.ContentType),
+		),
+	)
+	defer span.End()
+
+	var xmlMap map[string]interface{}
+	if isJSONContentType(data.ContentType) {
+		if err := json.Unmarshal([]byte(data.XMLData), &xmlMap); err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+	} else {
+		m, err := mxj.NewMapXml([]byte(data.XMLData))
+		if err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to parse XML: %w", err)
+		}
+		xmlMap = m
+	}
+
+	// Siri -> ServiceDelivery -> SituationExchangeDelivery -> Situations -> PtSituationElement
+	siri, _ := xmlMap["Siri"].(map[string]interface{})
+	serviceDelivery, _ := siri["ServiceDelivery"].(map[string]interface{})
+	sxDelivery, _ := serviceDelivery["SituationExchangeDelivery"].(map[string]interface{})
+	situations, _ := sxDelivery["Situations"].(map[string]interface{})
+
+	var parsed []types.Situation
+	for _, element := range elementList(situations["PtSituationElement"]) {
+		situation, ok := element.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		parsed = append(parsed, parseSituation(situation))
+	}
+
+	span.SetAttributes(attribute.Int("situations_count", len(parsed)))
+	return parsed, nil
+}
+
+func parseSituation(element map[string]interface{}) types.Situation {
+	situation := types.Situation{
+		SituationNumber: textValue(element["SituationNumber"]),
+		Version:         textValue(element["Version"]),
+		CreationTime:    textValue(element["CreationTime"]),
+		ParticipantRef:  textValue(element["ParticipantRef"]),
+		Progress:        textValue(element["Progress"]),
+		Summary:         textValue(element["Summary"]),
+		Description:     textValue(element["Description"]),
+	}
+
+	if planned, ok := boolValue(element["Planned"]); ok {
+		situation.Planned = &planned
+	}
+
+	for _, name := range situationReasons {
+		if reason := textValue(element[name]); reason != "" {
+			situation.Reason = reason
+			break
+		}
+	}
+
+	for _, period := range elementList(element["ValidityPeriod"]) {
+		periodMap, ok := period.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		situation.ValidityPeriods = append(situation.ValidityPeriods, types.ValidityPeriod{
+			StartTime: textValue(periodMap["StartTime"]),
+			EndTime:   textValue(periodMap["EndTime"]),
+		})
+	}
+
+	// Lines may be listed under Affects directly or under each Consequence
+	seen := make(map[string]bool)
+	collectAffectedLines(element["Affects"], seen, &situation.AffectedLines)
+	if consequences, ok := element["Consequences"].(map[string]interface{}); ok {
+		for _, consequence := range elementList(consequences["Consequence"]) {
+			if consequenceMap, ok := consequence.(map[string]interface{}); ok {
+				collectAffectedLines(consequenceMap["Affects"], seen, &situation.AffectedLines)
+			}
+		}
+	}
+
+	return situation
+}
+
+// collectAffectedLines appends the LineRef of every AffectedLine found under
+// an Affects element, skipping lines already seen
+func collectAffectedLines(affects interface{}, seen map[string]bool, lines *[]string) {
+	affectsMap, ok := affects.(map[string]interface{})
+	if !ok {
+		return
+	}
+	networks, ok := affectsMap["Networks"].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	for _, network := range elementList(networks["AffectedNetwork"]) {
+		networkMap, ok := network.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, line := range elementList(networkMap["AffectedLine"]) {
+			lineMap, ok := line.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if ref := textValue(lineMap["LineRef"]); ref != "" && !seen[ref] {
+				seen[ref] = true
+				*lines = append(*lines, ref)
+			}
+		}
+	}
+}
+
+// textValue returns an element's text, including elements that carry
+// attributes such as xml:lang and so decode to a map
+func textValue(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case map[string]interface{}:
+		if text, ok := value["#text"].(string); ok {
+			return strings.TrimSpace(text)
+		}
+	case []interface{}:
+		// Repeated text, e.g. a Summary per language; use the first
+		if len(value) > 0 {
+			return textValue(value[0])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"bods2loki/pkg/bods"
+	"bods2loki/pkg/types"
+)
+
+// sampleSX is a SIRI-SX response with a planned closure affecting two lines
+// through its consequences, and an unplanned situation listing one directly
+const sampleSX = `<?xml version="1.0" encoding="UTF-8"?>
+<Siri xmlns="http://www.siri.org.uk/siri" version="2.0"><ServiceDelivery>
+<ResponseTimestamp>2025-10-09T15:37:40+00:00</ResponseTimestamp>
+<SituationExchangeDelivery><Situations>
+<PtSituationElement>
+  <CreationTime>2025-10-01T09:00:00+00:00</CreationTime>
+  <ParticipantRef>FBRI</ParticipantRef>
+  <SituationNumber>sx-1001</SituationNumber>
+  <Version>2</Version>
+  <Progress>open</Progress>
+  <ValidityPeriod><StartTime>2025-10-09T06:00:00+00:00</StartTime><EndTime>2025-10-09T22:00:00+00:00</EndTime></ValidityPeriod>
+  <ValidityPeriod><StartTime>2025-10-10T06:00:00+00:00</StartTime></ValidityPeriod>
+  <Planned>true</Planned>
+  <MiscellaneousReason>roadworks</MiscellaneousReason>
+  <Summary xml:lang="en">Temple Way closed</Summary>
+  <Description xml:lang="en"> Services diverted via Old Market. </Description>
+  <Consequences>
+    <Consequence><Affects><Networks><AffectedNetwork>
+      <AffectedLine><LineRef>49x</LineRef></AffectedLine>
+      <AffectedLine><LineRef>72</LineRef></AffectedLine>
+    </AffectedNetwork></Networks></Affects></Consequence>
+    <Consequence><Affects><Networks><AffectedNetwork>
+      <AffectedLine><LineRef>49x</LineRef></AffectedLine>
+    </AffectedNetwork></Networks></Affects></Consequence>
+  </Consequences>
+</PtSituationElement>
+<PtSituationElement>
+  <SituationNumber>sx-1002</SituationNumber>
+  <Progress>open</Progress>
+  <Planned>false</Planned>
+  <EquipmentReason>breakDown</EquipmentReason>
+  <Summary>Broken down bus on the A4</Summary>
+  <Affects><Networks><AffectedNetwork><AffectedLine><LineRef>1</LineRef></AffectedLine></AffectedNetwork></Networks></Affects>
+</PtSituationElement>
+</Situations></SituationExchangeDelivery></ServiceDelivery></Siri>`
+
+func TestParseSituations(t *testing.T) {
+	planned, unplanned := true, false
+
+	tests := []struct {
+		name string
+		body string
+		want []types.Situation
+	}{
+		{
+			name: "situations",
+			body: sampleSX,
+			want: []types.Situation{
+				{
+					SituationNumber: "sx-1001",
+					Version:         "2",
+					CreationTime:    "2025-10-01T09:00:00+00:00",
+					ParticipantRef:  "FBRI",
+					Progress:        "open",
+					Planned:         &planned,
+					Reason:          "roadworks",
+					Summary:         "Temple Way closed",
+					Description:     "Services diverted via Old Market.",
+					ValidityPeriods: []types.ValidityPeriod{
+						{StartTime: "2025-10-09T06:00:00+00:00", EndTime: "2025-10-09T22:00:00+00:00"},
+						{StartTime: "2025-10-10T06:00:00+00:00"},
+					},
+					AffectedLines: []string{"49x", "72"},
+				},
+				{
+					SituationNumber: "sx-1002",
+					Progress:        "open",
+					Planned:         &unplanned,
+					Reason:          "breakDown",
+					Summary:         "Broken down bus on the A4",
+					AffectedLines:   []string{"1"},
+				},
+			},
+		},
+		{
+			name: "no situations",
+			body: `<Siri xmlns="http://www.siri.org.uk/siri"><ServiceDelivery><SituationExchangeDelivery/></ServiceDelivery></Siri>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			situations, err := NewXMLParser().ParseSituations(context.Background(), &bods.BusData{XMLData: tt.body, ContentType: "application/xml"})
+			if err != nil {
+				t.Fatalf("ParseSituations: %v", err)
+			}
+			if !reflect.DeepEqual(situations, tt.want) {
+				t.Errorf("ParseSituations() = %+v\nwant %+v", situations, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewXMLParser().ParseSituations(context.Background(), &bods.BusData{XMLData: "<Siri><Service", ContentType: "application/xml"}); err == nil {
+		t.Error("ParseSituations accepted truncated XML")
+	}
+}
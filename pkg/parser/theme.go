@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ImageTheme holds the background, border and text colors used by the bus
+// image generators. Line and direction colors are the same in every theme.
+type ImageTheme struct {
+	Name string
+	// Background is used by the full-size bus image, CompactBackground by the compact one
+	Background        string
+	CompactBackground string
+	Border            string
+	// Text colors the line number on the full-size image
+	Text string
+	// BadgeText colors the text on status badges
+	BadgeText string
+}
+
+// LightTheme is the default theme, suited to light dashboards
+var LightTheme = ImageTheme{
+	Name:              "light",
+	Background:        "#f8f9fa",
+	CompactBackground: "white",
+	Border:            "#dee2e6",
+	Text:              "#333",
+	BadgeText:         "white",
+}
+
+// DarkTheme matches Grafana's dark mode panel colors
+var DarkTheme = ImageTheme{
+	Name:              "dark",
+	Background:        "#22252b",
+	CompactBackground: "#181b1f",
+	Border:            "#34373d",
+	Text:              "#ccccdc",
+	BadgeText:         "#f4f5f5",
+}
+
+// ImageThemeByName returns the theme with the given name
+func ImageThemeByName(name string) (ImageTheme, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", LightTheme.Name:
+		return LightTheme, nil
+	case DarkTheme.Name:
+		return DarkTheme, nil
+	default:
+		return ImageTheme{}, fmt.Errorf("unknown image theme %q (expected light or dark)", name)
+	}
+}
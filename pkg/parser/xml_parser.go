@@ -4,9 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
+	"time"
 
 	"bods2loki/pkg/bods"
+	"bods2loki/pkg/metrics"
 	"bods2loki/pkg/types"
 
 	"github.com/clbanning/mxj/v2"
@@ -15,16 +19,189 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
+// FeedError indicates the SIRI response itself reported a failed operator feed,
+// as opposed to a successful delivery that simply contains no vehicles
+type FeedError struct {
+	Reason string
+}
+
+func (e *FeedError) Error() string {
+	return fmt.Sprintf("feed reported an error: %s", e.Reason)
+}
+
+// StaleFeedError indicates the response's ResponseTimestamp is older than the
+// configured maximum feed age, e.g. a stale cached copy served by a CDN
+type StaleFeedError struct {
+	Age    time.Duration
+	MaxAge time.Duration
+}
+
+func (e *StaleFeedError) Error() string {
+	return fmt.Sprintf("response is %v old, older than the maximum feed age of %v", e.Age.Round(time.Second), e.MaxAge)
+}
+
 type XMLParser struct {
 	tracer         trace.Tracer
 	imageGenerator *BusImageGenerator
+	imageTheme     ImageTheme
+	compactSVG     bool
+	imageMode      string
+
+	// Source fields holding OSGB36 easting/northing, converted to WGS84 when set
+	eastingField  string
+	northingField string
+
+	delayThresholds DelayThresholds
+
+	qualityWeights QualityWeights
+
+	// maxFeedAge rejects responses whose ResponseTimestamp is older than this; zero disables the check
+	maxFeedAge time.Duration
+
+	// normalizeCallTimes rewrites stop call times as RFC3339 UTC
+	normalizeCallTimes bool
+
+	// skipMonitoredCall/skipOnwardCalls leave out stop predictions to save CPU and payload size
+	skipMonitoredCall bool
+	skipOnwardCalls   bool
+
+	// includeRaw keeps the full decoded response in ParsedBusData.RawData
+	includeRaw bool
+
+	// monitoredOnly drops vehicles whose position the feed marks as not real-time
+	monitoredOnly bool
+
+	// redactor hides identifiers before vehicles leave the parser; nil disables redaction
+	redactor *Redactor
+
+	// locationBounds, when set, is the area valid positions must lie within
+	locationBounds *bods.BoundingBox
+	// dropInvalidLocations drops vehicles with invalid positions rather than flagging them
+	dropInvalidLocations bool
+}
+
+// Option configures optional XMLParser behaviour
+type Option func(*XMLParser)
+
+// WithOSGBFields converts OSGB36 easting/northing found in the named fields to
+// WGS84 latitude/longitude for vehicles that do not report lat/lng directly
+func WithOSGBFields(eastingField, northingField string) Option {
+	return func(p *XMLParser) {
+		p.eastingField = eastingField
+		p.northingField = northingField
+	}
+}
+
+// WithDelayThresholds sets how MonitoredCall delays map to is_late and delay_bucket
+func WithDelayThresholds(thresholds DelayThresholds) Option {
+	return func(p *XMLParser) {
+		p.delayThresholds = thresholds
+	}
+}
+
+// WithQualityWeights sets how much each signal contributes to data_quality
+func WithQualityWeights(weights QualityWeights) Option {
+	return func(p *XMLParser) {
+		p.qualityWeights = weights
+	}
+}
+
+// WithMaxFeedAge rejects responses whose SIRI ResponseTimestamp is more than
+// maxAge older than the fetch time with a StaleFeedError
+func WithMaxFeedAge(maxAge time.Duration) Option {
+	return func(p *XMLParser) {
+		p.maxFeedAge = maxAge
+	}
 }
 
-func NewXMLParser() *XMLParser {
-	return &XMLParser{
-		tracer:         otel.Tracer("xml-parser"),
-		imageGenerator: NewBusImageGenerator(),
+// WithCallTimeNormalization rewrites MonitoredCall times in RFC3339 UTC,
+// keeping the original strings in the *_raw fields when they differ
+func WithCallTimeNormalization(enabled bool) Option {
+	return func(p *XMLParser) {
+		p.normalizeCallTimes = enabled
+	}
+}
+
+// WithoutMonitoredCall skips parsing MonitoredCall, and so is_late and delay_bucket
+func WithoutMonitoredCall() Option {
+	return func(p *XMLParser) {
+		p.skipMonitoredCall = true
+	}
+}
+
+// WithoutOnwardCalls skips parsing OnwardCalls
+func WithoutOnwardCalls() Option {
+	return func(p *XMLParser) {
+		p.skipOnwardCalls = true
+	}
+}
+
+// WithRawData keeps the full decoded response in ParsedBusData.RawData. It is
+// discarded by default since it is rarely needed and holds the whole response
+// in memory for the rest of the cycle.
+func WithRawData(enabled bool) Option {
+	return func(p *XMLParser) {
+		p.includeRaw = enabled
+	}
+}
+
+// WithMonitoredOnly drops vehicles reporting Monitored=false, i.e. positions
+// derived from the schedule rather than real-time tracking
+func WithMonitoredOnly(enabled bool) Option {
+	return func(p *XMLParser) {
+		p.monitoredOnly = enabled
+	}
+}
+
+// WithImageTheme draws bus images using the given theme's colors
+func WithImageTheme(theme ImageTheme) Option {
+	return func(p *XMLParser) {
+		p.imageTheme = theme
+	}
+}
+
+// WithCompactSVG minifies bus image SVG markup before base64 encoding
+func WithCompactSVG(enabled bool) Option {
+	return func(p *XMLParser) {
+		p.compactSVG = enabled
+	}
+}
+
+// WithImageMode selects the bus image each vehicle gets: ImageModeCompact,
+// ImageModeBadge or ImageModeNone
+func WithImageMode(mode string) Option {
+	return func(p *XMLParser) {
+		p.imageMode = mode
+	}
+}
+
+// WithRedactor redacts the redactor's configured identifiers on every parsed vehicle
+func WithRedactor(redactor *Redactor) Option {
+	return func(p *XMLParser) {
+		p.redactor = redactor
+	}
+}
+
+func NewXMLParser(opts ...Option) *XMLParser {
+	p := &XMLParser{
+		tracer:          otel.Tracer("xml-parser"),
+		imageTheme:      LightTheme,
+		imageMode:       ImageModeCompact,
+		delayThresholds: DefaultDelayThresholds(),
+		qualityWeights:  DefaultQualityWeights(),
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if p.compactSVG {
+		p.imageGenerator = NewCompactSVGBusImageGenerator(p.imageTheme)
+	} else {
+		p.imageGenerator = NewThemedBusImageGenerator(p.imageTheme)
 	}
+
+	return p
 }
 
 func (p *XMLParser) ParseBusData(ctx context.Context, busData *bods.BusData) (*types.ParsedBusData, error) {
@@ -32,15 +209,46 @@ func (p *XMLParser) ParseBusData(ctx context.Context, busData *bods.BusData) (*t
 		trace.WithAttributes(
 			attribute.String("line_ref", busData.LineRef),
 			attribute.Int("xml_size_bytes", len(busData.XMLData)),
+			attribute.String("content_type", busData.ContentType),
 		),
 	)
 	defer span.End()
 
-	// Parse XML to map
-	xmlMap, err := mxj.NewMapXml([]byte(busData.XMLData))
-	if err != nil {
-		span.RecordError(err)
-		return nil, fmt.Errorf("failed to parse XML: %w", err)
+	// Maintenance pages are sometimes served as text/html with a 200; treat
+	// anything that isn't XML or JSON as a failed feed rather than parsing it
+	if busData.ContentType != "" && !isJSONContentType(busData.ContentType) && !isXMLContentType(busData.ContentType) {
+		feedErr := &FeedError{Reason: "unexpected content type"}
+		span.RecordError(feedErr)
+		return nil, feedErr
+	}
+
+	var xmlMap map[string]interface{}
+	if isJSONContentType(busData.ContentType) {
+		// JSON responses share the SIRI element names, so skip mxj and decode directly
+		if err := json.Unmarshal([]byte(busData.XMLData), &xmlMap); err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+	} else {
+		// Parse XML to map
+		m, err := mxj.NewMapXml([]byte(busData.XMLData))
+		if err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to parse XML: %w", err)
+		}
+		xmlMap = m
+	}
+
+	// Reject stale responses before doing any further work on them
+	responseTimestamp := responseTimestamp(xmlMap)
+	if p.maxFeedAge > 0 && responseTimestamp != "" {
+		if responded, err := time.Parse(time.RFC3339, responseTimestamp); err == nil {
+			if age := busData.Timestamp.Sub(responded); age > p.maxFeedAge {
+				staleErr := &StaleFeedError{Age: age, MaxAge: p.maxFeedAge}
+				span.RecordError(staleErr)
+				return nil, staleErr
+			}
+		}
 	}
 
 	// Extract vehicle activities
@@ -50,20 +258,30 @@ func (p *XMLParser) ParseBusData(ctx context.Context, busData *bods.BusData) (*t
 		return nil, fmt.Errorf("failed to extract vehicle activities: %w", err)
 	}
 
+	for i := range vehicles {
+		vehicles[i].DataQuality = DataQuality(&vehicles[i], busData.Timestamp, p.qualityWeights)
+	}
+
 	span.SetAttributes(
 		attribute.Int("vehicles_count", len(vehicles)),
 	)
 
-	return &types.ParsedBusData{
-		LineRef:     busData.LineRef,
-		Timestamp:   busData.Timestamp.Format("2006-01-02T15:04:05.000Z"),
-		VehicleData: vehicles,
-		RawData:     xmlMap,
-	}, nil
+	parsed := &types.ParsedBusData{
+		LineRef:           busData.LineRef,
+		Timestamp:         busData.Timestamp.Format("2006-01-02T15:04:05.000Z"),
+		ResponseTimestamp: responseTimestamp,
+		SnapshotID:        responseMessageIdentifier(xmlMap),
+		VehicleData:       vehicles,
+	}
+	if p.includeRaw {
+		parsed.RawData = xmlMap
+	}
+
+	return parsed, nil
 }
 
 func (p *XMLParser) extractVehicleActivities(ctx context.Context, xmlMap map[string]interface{}) ([]types.VehicleActivity, error) {
-	_, span := p.tracer.Start(ctx, "xml_parser.extract_vehicle_activities")
+	ctx, span := p.tracer.Start(ctx, "xml_parser.extract_vehicle_activities")
 	defer span.End()
 
 	var vehicles []types.VehicleActivity
@@ -80,42 +298,157 @@ func (p *XMLParser) extractVehicleActivities(ctx context.Context, xmlMap map[str
 		return vehicles, nil
 	}
 
-	vmDelivery, ok := serviceDelivery["VehicleMonitoringDelivery"].(map[string]interface{})
-	if !ok {
-		return vehicles, nil
+	// VehicleMonitoringDelivery can be a single block or, in aggregated
+	// feeds, several; their VehicleActivity elements are concatenated
+	var vehicleActivities []interface{}
+	var feedErr *FeedError
+	deliveries := elementList(serviceDelivery["VehicleMonitoringDelivery"])
+	failed := 0
+	for _, delivery := range deliveries {
+		vmDelivery, ok := delivery.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		// A delivery with Status=false or an ErrorCondition means the operator feed failed
+		if err := deliveryError(vmDelivery); err != nil {
+			feedErr = err
+			failed++
+			continue
+		}
+
+		// VehicleActivity can be a single item or an array
+		vehicleActivities = append(vehicleActivities, elementList(vmDelivery["VehicleActivity"])...)
 	}
 
-	// VehicleActivity can be a single item or an array
-	var vehicleActivities []interface{}
-	switch va := vmDelivery["VehicleActivity"].(type) {
-	case []interface{}:
-		vehicleActivities = va
-	case map[string]interface{}:
-		vehicleActivities = []interface{}{va}
-	default:
-		return vehicles, nil
+	// Only fail the line when no delivery succeeded
+	if feedErr != nil {
+		span.SetAttributes(attribute.String("feed_error", feedErr.Reason))
+		if failed == len(deliveries) {
+			return nil, feedErr
+		}
 	}
+	span.SetAttributes(attribute.Int("deliveries", len(deliveries)))
 
+	unmonitored := 0
 	for _, activity := range vehicleActivities {
 		activityMap, ok := activity.(map[string]interface{})
 		if !ok {
 			continue
 		}
 
-		vehicle := p.parseVehicleActivity(activityMap)
-		if vehicle != nil {
-			vehicles = append(vehicles, *vehicle)
+		vehicle := p.parseVehicleActivity(ctx, activityMap)
+		if vehicle == nil {
+			continue
+		}
+
+		// Vehicles that don't report Monitored at all are kept
+		if p.monitoredOnly && vehicle.Monitored != nil && !*vehicle.Monitored {
+			unmonitored++
+			continue
 		}
+
+		vehicles = append(vehicles, *vehicle)
 	}
 
 	span.SetAttributes(
 		attribute.Int("extracted_vehicles", len(vehicles)),
+		attribute.Int("unmonitored_vehicles_dropped", unmonitored),
 	)
 
 	return vehicles, nil
 }
 
-func (p *XMLParser) parseVehicleActivity(activity map[string]interface{}) *types.VehicleActivity {
+// responseTimestamp returns the SIRI ResponseTimestamp, preferring the
+// ServiceDelivery value over the VehicleMonitoringDelivery one
+func responseTimestamp(xmlMap map[string]interface{}) string {
+	return deliveryField(xmlMap, "ResponseTimestamp")
+}
+
+// responseMessageIdentifier returns the SIRI ResponseMessageIdentifier, which
+// uniquely tags the snapshot every vehicle in the response belongs to
+func responseMessageIdentifier(xmlMap map[string]interface{}) string {
+	return deliveryField(xmlMap, "ResponseMessageIdentifier")
+}
+
+// deliveryField returns a text element from the ServiceDelivery, falling back
+// to the first VehicleMonitoringDelivery that has it
+func deliveryField(xmlMap map[string]interface{}, name string) string {
+	siri, ok := xmlMap["Siri"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	serviceDelivery, ok := siri["ServiceDelivery"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if value, ok := serviceDelivery[name].(string); ok {
+		return strings.TrimSpace(value)
+	}
+	for _, delivery := range elementList(serviceDelivery["VehicleMonitoringDelivery"]) {
+		if vmDelivery, ok := delivery.(map[string]interface{}); ok {
+			if value, ok := vmDelivery[name].(string); ok {
+				return strings.TrimSpace(value)
+			}
+		}
+	}
+	return ""
+}
+
+// deliveryError returns a FeedError if the VehicleMonitoringDelivery reports a failure
+func deliveryError(vmDelivery map[string]interface{}) *FeedError {
+	status, hasStatus := vmDelivery["Status"].(string)
+	errorCondition, hasErrorCondition := vmDelivery["ErrorCondition"]
+
+	if !hasErrorCondition && (!hasStatus || strings.TrimSpace(strings.ToLower(status)) != "false") {
+		return nil
+	}
+
+	reason := "status false"
+	if ec, ok := errorCondition.(map[string]interface{}); ok {
+		reason = errorConditionReason(ec)
+	} else if text, ok := errorCondition.(string); ok && strings.TrimSpace(text) != "" {
+		reason = strings.TrimSpace(text)
+	}
+
+	return &FeedError{Reason: reason}
+}
+
+// errorConditionReason builds a readable reason from a SIRI ErrorCondition,
+// e.g. "ServiceNotAvailableError: upstream timeout"
+func errorConditionReason(ec map[string]interface{}) string {
+	var kind, text string
+
+	for key, value := range ec {
+		if key == "Description" {
+			if desc, ok := value.(string); ok {
+				text = strings.TrimSpace(desc)
+			}
+			continue
+		}
+
+		// The remaining child names the error type and may carry ErrorText
+		kind = key
+		if detail, ok := value.(map[string]interface{}); ok && text == "" {
+			if errText, ok := detail["ErrorText"].(string); ok {
+				text = strings.TrimSpace(errText)
+			}
+		}
+	}
+
+	switch {
+	case kind != "" && text != "":
+		return kind + ": " + text
+	case kind != "":
+		return kind
+	case text != "":
+		return text
+	default:
+		return "unspecified error condition"
+	}
+}
+
+func (p *XMLParser) parseVehicleActivity(ctx context.Context, activity map[string]interface{}) *types.VehicleActivity {
 	vehicle := &types.VehicleActivity{}
 
 	// Extract RecordedAtTime and ValidUntilTime from top level
@@ -142,15 +475,33 @@ func (p *XMLParser) parseVehicleActivity(activity map[string]interface{}) *types
 	if opRef, ok := mvj["OperatorRef"].(string); ok {
 		vehicle.OperatorRef = opRef
 	}
+	if blockRef, ok := mvj["BlockRef"].(string); ok {
+		vehicle.BlockRef = blockRef
+	}
+
+	// Extract data quality flags, leaving them nil when absent
+	if monitored, ok := boolValue(mvj["Monitored"]); ok {
+		vehicle.Monitored = &monitored
+	}
+	if inCongestion, ok := boolValue(mvj["InCongestion"]); ok {
+		vehicle.InCongestion = &inCongestion
+	}
+	if inPanic, ok := boolValue(mvj["InPanic"]); ok {
+		vehicle.InPanic = &inPanic
+	}
+	vehicle.VehicleStatus = textValue(mvj["VehicleStatus"])
 
 	// Extract VehicleRef
 	if vRef, ok := mvj["VehicleRef"].(string); ok {
 		vehicle.VehicleRef = vRef
 	}
 
-	// Extract FramedVehicleJourneyRef data
+	// Extract FramedVehicleJourneyRef data; DataFrameRef is the service date,
+	// so together they identify the same journey across days
 	if fvjr, ok := mvj["FramedVehicleJourneyRef"].(map[string]interface{}); ok {
+		vehicle.DataFrameRef = textValue(fvjr["DataFrameRef"])
 		if datedVJRef, ok := fvjr["DatedVehicleJourneyRef"].(string); ok {
+			vehicle.DatedVehicleJourneyRef = datedVJRef
 			// Use this as additional vehicle identifier if VehicleRef is empty
 			if vehicle.VehicleRef == "" {
 				vehicle.VehicleRef = datedVJRef
@@ -171,6 +522,12 @@ func (p *XMLParser) parseVehicleActivity(activity map[string]interface{}) *types
 	if destName, ok := mvj["DestinationName"].(string); ok {
 		vehicle.DestinationName = formatStopName(destName)
 	}
+	// DestinationDisplay is the on-bus display text and often differs from DestinationName
+	if destDisplay, ok := mvj["DestinationDisplay"].(string); ok {
+		vehicle.DestinationDisplay = formatStopName(destDisplay)
+	}
+	// Via complements the DestinationDisplay above rather than repeating it
+	vehicle.Via = parseVia(mvj)
 	if originAimed, ok := mvj["OriginAimedDepartureTime"].(string); ok {
 		vehicle.OriginAimedDepartureTime = originAimed
 	}
@@ -178,26 +535,187 @@ func (p *XMLParser) parseVehicleActivity(activity map[string]interface{}) *types
 		vehicle.DestinationAimedArrivalTime = destAimed
 	}
 
+	// Extract the current stop call and derive lateness from it
+	if mc, ok := mvj["MonitoredCall"].(map[string]interface{}); ok && !p.skipMonitoredCall {
+		vehicle.MonitoredCall = p.parseStopCall(mc)
+	}
+	if !p.skipOnwardCalls {
+		vehicle.OnwardCalls = p.parseOnwardCalls(mvj)
+	}
+	// delay_seconds and is_late/delay_bucket share one delay, so they can't disagree
+	if delay, ok := callDelay(vehicle.MonitoredCall); ok {
+		isLate, bucket := classifyDelay(delay, p.delayThresholds)
+		vehicle.IsLate = &isLate
+		vehicle.DelayBucket = bucket
+		vehicle.DelaySeconds = int(delay.Seconds())
+	}
+
 	// Extract location data
 	if location, ok := mvj["VehicleLocation"].(map[string]interface{}); ok {
-		if lng, ok := location["Longitude"].(string); ok {
-			if f, err := parseFloat(lng); err == nil {
-				vehicle.Longitude = f
-			}
+		if f, ok := toFloat(location["Longitude"]); ok {
+			vehicle.Longitude = f
 		}
-		if lat, ok := location["Latitude"].(string); ok {
-			if f, err := parseFloat(lat); err == nil {
-				vehicle.Latitude = f
-			}
+		if f, ok := toFloat(location["Latitude"]); ok {
+			vehicle.Latitude = f
+		}
+	}
+
+	// Fall back to OSGB36 grid coordinates when the feed provides those instead
+	if vehicle.Latitude == 0 && vehicle.Longitude == 0 && p.eastingField != "" && p.northingField != "" {
+		if lat, lng, ok := p.gridLocation(mvj); ok {
+			vehicle.Latitude = lat
+			vehicle.Longitude = lng
+		}
+	}
+
+	// Flag, or drop, bogus positions such as 0,0 so they don't pollute maps
+	vehicle.LocationValid = p.validLocation(vehicle)
+	if !vehicle.LocationValid {
+		metrics.RecordVehicleFailed(ctx, "invalid_location")
+		if p.dropInvalidLocations {
+			return nil
+		}
+	}
+
+	// Extract heading and speed
+	if f, ok := toFloat(mvj["Bearing"]); ok {
+		if bearing, ok := normalizeBearing(f); ok {
+			vehicle.Bearing = bearing
+			vehicle.HasBearing = true
+			vehicle.CompassDirection = compassDirection(bearing)
+		}
+	}
+	// Some operators report Velocity inside VehicleLocation instead
+	velocity, ok := toFloat(mvj["Velocity"])
+	if !ok {
+		if location, isMap := mvj["VehicleLocation"].(map[string]interface{}); isMap {
+			velocity, ok = toFloat(location["Velocity"])
+		}
+	}
+	if ok {
+		vehicle.Velocity = velocity
+		vehicle.HasVelocity = true
+		if velocity != 0 {
+			vehicle.SpeedMPH = roundTenth(velocity * metresPerSecondToMPH)
+			vehicle.SpeedKPH = roundTenth(velocity * metresPerSecondToKPH)
 		}
 	}
 
 	// Generate bus image with line number and direction
-	vehicle.BusImage = p.imageGenerator.GenerateCompactBusImage(vehicle.LineRef, vehicle.DirectionRef)
+	if p.imageMode != ImageModeNone {
+		imageStart := time.Now()
+		if p.imageMode == ImageModeBadge {
+			vehicle.BusImage = p.imageGenerator.GenerateStatusBadge(vehicle.LineRef, vehicle.DirectionRef, vehicle.VehicleStatus)
+		} else {
+			vehicle.BusImage = p.imageGenerator.GenerateCompactBusImage(vehicle.LineRef, vehicle.DirectionRef, vehicle.Bearing)
+		}
+		metrics.RecordImageGeneration(ctx, time.Since(imageStart), len(vehicle.BusImage))
+	}
+
+	// Redact identifiers last so nothing downstream sees the raw values
+	p.redactor.Apply(vehicle)
 
 	return vehicle
 }
 
+// parseStopCall extracts stop and timing details from a SIRI call element,
+// normalizing times to RFC3339 UTC if enabled
+func (p *XMLParser) parseStopCall(call map[string]interface{}) *types.StopCall {
+	stopCall := &types.StopCall{}
+
+	if ref, ok := call["StopPointRef"].(string); ok {
+		stopCall.StopPointRef = ref
+	}
+	if name, ok := call["StopPointName"].(string); ok {
+		stopCall.StopPointName = formatStopName(name)
+	}
+	if n, ok := intValue(call["VisitNumber"]); ok {
+		stopCall.VisitNumber = n
+	}
+	if t, ok := call["AimedArrivalTime"].(string); ok {
+		stopCall.AimedArrivalTime, stopCall.AimedArrivalTimeRaw = p.callTime(t)
+	}
+	if t, ok := call["ExpectedArrivalTime"].(string); ok {
+		stopCall.ExpectedArrivalTime, stopCall.ExpectedArrivalTimeRaw = p.callTime(t)
+	}
+	if t, ok := call["AimedDepartureTime"].(string); ok {
+		stopCall.AimedDepartureTime, stopCall.AimedDepartureTimeRaw = p.callTime(t)
+	}
+	if t, ok := call["ExpectedDepartureTime"].(string); ok {
+		stopCall.ExpectedDepartureTime, stopCall.ExpectedDepartureTimeRaw = p.callTime(t)
+	}
+
+	return stopCall
+}
+
+// parseOnwardCalls extracts the predicted calls at upcoming stops
+func (p *XMLParser) parseOnwardCalls(mvj map[string]interface{}) []types.StopCall {
+	onwardCalls, ok := mvj["OnwardCalls"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	// OnwardCall can be a single item or an array
+	var calls []interface{}
+	switch oc := onwardCalls["OnwardCall"].(type) {
+	case []interface{}:
+		calls = oc
+	case map[string]interface{}:
+		calls = []interface{}{oc}
+	default:
+		return nil
+	}
+
+	var stopCalls []types.StopCall
+	for _, call := range calls {
+		if callMap, ok := call.(map[string]interface{}); ok {
+			stopCalls = append(stopCalls, *p.parseStopCall(callMap))
+		}
+	}
+
+	return stopCalls
+}
+
+// callTime returns a stop call time, normalized to RFC3339 UTC if enabled.
+// raw holds the original value when normalization changed it.
+func (p *XMLParser) callTime(value string) (normalized, raw string) {
+	if !p.normalizeCallTimes {
+		return value, ""
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(value))
+	if err != nil {
+		// Leave unparseable times as they are rather than dropping them
+		return value, ""
+	}
+
+	normalized = t.UTC().Format(time.RFC3339Nano)
+	if normalized == value {
+		return normalized, ""
+	}
+	return normalized, value
+}
+
+// gridLocation looks for the configured easting/northing fields in VehicleLocation,
+// then at the MonitoredVehicleJourney level, and converts them to WGS84
+func (p *XMLParser) gridLocation(mvj map[string]interface{}) (lat, lng float64, ok bool) {
+	sources := []map[string]interface{}{mvj}
+	if location, isMap := mvj["VehicleLocation"].(map[string]interface{}); isMap {
+		sources = []map[string]interface{}{location, mvj}
+	}
+
+	for _, source := range sources {
+		easting, hasEasting := toFloat(source[p.eastingField])
+		northing, hasNorthing := toFloat(source[p.northingField])
+		if hasEasting && hasNorthing {
+			lat, lng = OSGBToWGS84(easting, northing)
+			return lat, lng, true
+		}
+	}
+
+	return 0, 0, false
+}
+
 func parseFloat(s string) (float64, error) {
 	s = strings.TrimSpace(s)
 	var f float64
@@ -205,6 +723,146 @@ func parseFloat(s string) (float64, error) {
 	return f, err
 }
 
+func parseInt(s string) (int, error) {
+	return strconv.Atoi(strings.TrimSpace(s))
+}
+
+// toFloat extracts a float from an XML text value or a JSON number, which
+// may be decoded as float64, int or json.Number depending on the source
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case string:
+		f, err := parseFloat(n)
+		return f, err == nil
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// intValue extracts an integer from an XML text value or a JSON number,
+// which may be decoded as float64 or int depending on the source
+func intValue(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case string:
+		i, err := parseInt(n)
+		return i, err == nil
+	case float64:
+		if n != math.Trunc(n) || math.IsInf(n, 0) {
+			return 0, false
+		}
+		return int(n), true
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case json.Number:
+		i, err := n.Int64()
+		return int(i), err == nil
+	default:
+		return 0, false
+	}
+}
+
+// boolValue extracts a boolean from an XML text value or a JSON boolean
+func boolValue(v interface{}) (bool, bool) {
+	switch b := v.(type) {
+	case string:
+		parsed, err := strconv.ParseBool(strings.TrimSpace(b))
+		return parsed, err == nil
+	case bool:
+		return b, true
+	default:
+		return false, false
+	}
+}
+
+// elementList returns a repeated element as a list, since it decodes to a
+// single map when it occurs once
+func elementList(v interface{}) []interface{} {
+	switch list := v.(type) {
+	case []interface{}:
+		return list
+	case nil:
+		return nil
+	default:
+		return []interface{}{list}
+	}
+}
+
+// parseVia returns the PlaceNames of the journey's Via elements, which can be
+// a single item or an array
+func parseVia(mvj map[string]interface{}) []string {
+	var via []string
+	for _, item := range elementList(mvj["Via"]) {
+		name := textValue(item)
+		if place, ok := item.(map[string]interface{}); ok {
+			name = textValue(place["PlaceName"])
+		}
+		if name != "" {
+			via = append(via, formatStopName(name))
+		}
+	}
+	return via
+}
+
+// compassPoints are the eight compass sectors, clockwise from north
+var compassPoints = [...]string{"N", "NE", "E", "SE", "S", "SW", "W", "NW"}
+
+// compassDirection maps a bearing in [0, 360) to the nearest of eight compass points
+func compassDirection(bearing float64) string {
+	return compassPoints[int((bearing+22.5)/45)%len(compassPoints)]
+}
+
+// Factors converting a SIRI Velocity in metres per second
+const (
+	metresPerSecondToMPH = 2.23694
+	metresPerSecondToKPH = 3.6
+)
+
+// roundTenth rounds to one decimal place
+func roundTenth(f float64) float64 {
+	return math.Round(f*10) / 10
+}
+
+// normalizeBearing wraps a bearing into [0, 360), so feed values such as 360,
+// -45 or 720 still render as the right heading. ok is false for NaN/Inf.
+func normalizeBearing(bearing float64) (float64, bool) {
+	if math.IsNaN(bearing) || math.IsInf(bearing, 0) {
+		return 0, false
+	}
+
+	bearing = math.Mod(bearing, 360)
+	if bearing < 0 {
+		bearing += 360
+	}
+	// -0 and tiny negative values can round up to exactly 360
+	if bearing >= 360 || bearing == 0 {
+		bearing = 0
+	}
+	return bearing, true
+}
+
+// isJSONContentType reports whether a response Content-Type header denotes JSON
+func isJSONContentType(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// isXMLContentType reports whether a response Content-Type header denotes XML
+func isXMLContentType(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
 // formatStopName cleans up stop names from BODS format
 // Rules:
 // - Double underscores (__) become " - "
@@ -0,0 +1,910 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"bods2loki/pkg/bods"
+	"bods2loki/pkg/types"
+)
+
+// Common MonitoredVehicleJourney elements for building test fixtures
+const (
+	sampleJourney  = `<LineRef>49x</LineRef><DirectionRef>inbound</DirectionRef><VehicleRef>bus-1</VehicleRef>`
+	sampleLocation = `<VehicleLocation><Longitude>-2.480741</Longitude><Latitude>51.495853</Latitude></VehicleLocation>`
+)
+
+// sampleFetchTime is the fetch time used for every test response
+var sampleFetchTime = time.Date(2025, 10, 9, 15, 37, 40, 0, time.UTC)
+
+// siri wraps VehicleActivity elements in a SIRI-VM response
+func siri(activities ...string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<Siri xmlns="http://www.siri.org.uk/siri" version="2.0"><ServiceDelivery><VehicleMonitoringDelivery>` +
+		strings.Join(activities, "") +
+		`</VehicleMonitoringDelivery></ServiceDelivery></Siri>`
+}
+
+// activity returns a VehicleActivity with the given MonitoredVehicleJourney content
+func activity(journey string) string {
+	return `<VehicleActivity><RecordedAtTime>2025-10-09T15:37:34+00:00</RecordedAtTime>` +
+		`<MonitoredVehicleJourney>` + journey + `</MonitoredVehicleJourney></VehicleActivity>`
+}
+
+// parse parses an XML body, failing the test on error
+func parse(t *testing.T, p *XMLParser, body string) *types.ParsedBusData {
+	t.Helper()
+	return parseContent(t, p, body, "application/xml")
+}
+
+// parseContent parses body served with contentType, failing the test on error
+func parseContent(t *testing.T, p *XMLParser, body, contentType string) *types.ParsedBusData {
+	t.Helper()
+
+	parsed, err := p.ParseBusData(context.Background(), &bods.BusData{
+		XMLData:     body,
+		ContentType: contentType,
+		Timestamp:   sampleFetchTime,
+		LineRef:     "49x",
+	})
+	if err != nil {
+		t.Fatalf("ParseBusData: %v", err)
+	}
+	return parsed
+}
+
+// parseJourney parses a response holding one vehicle with the given
+// MonitoredVehicleJourney content, and returns that vehicle
+func parseJourney(t *testing.T, p *XMLParser, journey string) types.VehicleActivity {
+	t.Helper()
+
+	parsed := parse(t, p, siri(activity(journey)))
+	if len(parsed.VehicleData) != 1 {
+		t.Fatalf("got %d vehicles, want 1", len(parsed.VehicleData))
+	}
+	return parsed.VehicleData[0]
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestDestinationDisplayAndVia(t *testing.T) {
+	tests := []struct {
+		name    string
+		journey string
+		display string
+		via     []string
+	}{
+		{
+			name:    "none",
+			journey: `<DestinationName>Bath_Bus_Station</DestinationName>`,
+		},
+		{
+			name: "single via",
+			journey: `<DestinationName>Bath_Bus_Station</DestinationName>` +
+				`<DestinationDisplay>Bath_City_Centre</DestinationDisplay>` +
+				`<Via><PlaceName>Corsham</PlaceName></Via>`,
+			display: "Bath City Centre",
+			via:     []string{"Corsham"},
+		},
+		{
+			name: "multiple vias",
+			journey: `<DestinationName>Bath_Bus_Station</DestinationName>` +
+				`<DestinationDisplay>Bath</DestinationDisplay>` +
+				`<Via><PlaceName>Corsham</PlaceName></Via>` +
+				`<Via><PlaceName>Box__Market_Place</PlaceName></Via>`,
+			display: "Bath",
+			via:     []string{"Corsham", "Box - Market Place"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vehicle := parseJourney(t, NewXMLParser(), sampleJourney+tt.journey)
+			if vehicle.DestinationName != "Bath Bus Station" {
+				t.Errorf("DestinationName = %q, want %q", vehicle.DestinationName, "Bath Bus Station")
+			}
+			if vehicle.DestinationDisplay != tt.display {
+				t.Errorf("DestinationDisplay = %q, want %q", vehicle.DestinationDisplay, tt.display)
+			}
+			if strings.Join(vehicle.Via, "|") != strings.Join(tt.via, "|") {
+				t.Errorf("Via = %q, want %q", vehicle.Via, tt.via)
+			}
+		})
+	}
+}
+
+func TestNamespacePrefixedElements(t *testing.T) {
+	body := siri(
+		activity(sampleJourney+sampleLocation),
+		activity(`<LineRef>49x</LineRef><DirectionRef>outbound</DirectionRef><VehicleRef>bus-2</VehicleRef>`+sampleLocation),
+	)
+
+	// Prefix every element, declaring the SIRI namespace for the prefix
+	// rather than as the default
+	elements := regexp.MustCompile(`<(/?)([A-Za-z])`)
+	prefixed := func(prefix string) string {
+		prefixedBody := strings.Replace(body, `xmlns=`, `xmlns:`+prefix+`=`, 1)
+		return elements.ReplaceAllString(prefixedBody, `<${1}`+prefix+`:${2}`)
+	}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"default namespace", body},
+		{"siri prefix", prefixed("siri")},
+		{"other prefix", prefixed("ns2")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := parse(t, NewXMLParser(), tt.body)
+			if len(parsed.VehicleData) != 2 {
+				t.Fatalf("got %d vehicles, want 2", len(parsed.VehicleData))
+			}
+			vehicle := parsed.VehicleData[0]
+			if vehicle.VehicleRef != "bus-1" || vehicle.Latitude != 51.495853 || vehicle.Longitude != -2.480741 {
+				t.Errorf("vehicle = %s at %f,%f; want bus-1 at 51.495853,-2.480741", vehicle.VehicleRef, vehicle.Latitude, vehicle.Longitude)
+			}
+		})
+	}
+}
+
+func TestVelocityInVehicleLocation(t *testing.T) {
+	location := func(velocity string) string {
+		return `<VehicleLocation><Longitude>-2.480741</Longitude><Latitude>51.495853</Latitude>` + velocity + `</VehicleLocation>`
+	}
+
+	tests := []struct {
+		name     string
+		journey  string
+		velocity float64
+		has      bool
+	}{
+		{"journey velocity", location(``) + `<Velocity>10</Velocity>`, 10, true},
+		{"location velocity", location(`<Velocity>5</Velocity>`), 5, true},
+		{"journey velocity preferred", location(`<Velocity>5</Velocity>`) + `<Velocity>10</Velocity>`, 10, true},
+		{"unparseable journey velocity falls back", location(`<Velocity>5</Velocity>`) + `<Velocity>fast</Velocity>`, 5, true},
+		{"no velocity", location(``), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vehicle := parseJourney(t, NewXMLParser(), sampleJourney+tt.journey)
+			if vehicle.Velocity != tt.velocity || vehicle.HasVelocity != tt.has {
+				t.Errorf("Velocity, HasVelocity = %v, %v; want %v, %v", vehicle.Velocity, vehicle.HasVelocity, tt.velocity, tt.has)
+			}
+			if want := roundTenth(tt.velocity * metresPerSecondToMPH); vehicle.SpeedMPH != want {
+				t.Errorf("SpeedMPH = %v, want %v", vehicle.SpeedMPH, want)
+			}
+			if !vehicle.LocationValid {
+				t.Error("a velocity inside VehicleLocation broke the location")
+			}
+		})
+	}
+}
+
+func TestDestinationNameAndDisplay(t *testing.T) {
+	tests := []struct {
+		name        string
+		journey     string
+		destination string
+		display     string
+	}{
+		{"both", `<DestinationName>Bath_Bus_Station</DestinationName><DestinationDisplay>City Centre</DestinationDisplay>`, "Bath Bus Station", "City Centre"},
+		{"name only", `<DestinationName>Bath_Bus_Station</DestinationName>`, "Bath Bus Station", ""},
+		{"display only", `<DestinationDisplay>City__Centre</DestinationDisplay>`, "", "City - Centre"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vehicle := parseJourney(t, NewXMLParser(), sampleJourney+tt.journey)
+			if vehicle.DestinationName != tt.destination || vehicle.DestinationDisplay != tt.display {
+				t.Errorf("destination = %q, display %q; want %q, %q", vehicle.DestinationName, vehicle.DestinationDisplay, tt.destination, tt.display)
+			}
+		})
+	}
+}
+
+func TestZeroValuePresence(t *testing.T) {
+	tests := []struct {
+		name        string
+		journey     string
+		hasVelocity bool
+		hasBearing  bool
+	}{
+		{"provided zeros", `<Bearing>0.0</Bearing><Velocity>0.0</Velocity>`, true, true},
+		{"absent", ``, false, false},
+		{"velocity only", `<Velocity>0</Velocity>`, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vehicle := parseJourney(t, NewXMLParser(), sampleJourney+sampleLocation+tt.journey)
+			if vehicle.HasVelocity != tt.hasVelocity || vehicle.HasBearing != tt.hasBearing {
+				t.Errorf("HasVelocity, HasBearing = %v, %v; want %v, %v", vehicle.HasVelocity, vehicle.HasBearing, tt.hasVelocity, tt.hasBearing)
+			}
+			if vehicle.Velocity != 0 || vehicle.Bearing != 0 {
+				t.Errorf("Velocity, Bearing = %v, %v; want zeros", vehicle.Velocity, vehicle.Bearing)
+			}
+		})
+	}
+}
+
+func TestParseJSONMatchesXML(t *testing.T) {
+	xmlBody := siri(
+		activity(sampleJourney+sampleLocation+`<Bearing>270</Bearing><Velocity>12.5</Velocity><DestinationName>Bath_Bus_Station</DestinationName>`),
+		activity(`<LineRef>49x</LineRef><DirectionRef>outbound</DirectionRef><VehicleRef>bus-2</VehicleRef>`+sampleLocation),
+	)
+	jsonBody := `{"Siri": {"ServiceDelivery": {"VehicleMonitoringDelivery": {"VehicleActivity": [
+		{"RecordedAtTime": "2025-10-09T15:37:34+00:00", "MonitoredVehicleJourney": {
+			"LineRef": "49x", "DirectionRef": "inbound", "VehicleRef": "bus-1",
+			"VehicleLocation": {"Longitude": -2.480741, "Latitude": 51.495853},
+			"Bearing": 270, "Velocity": "12.5", "DestinationName": "Bath_Bus_Station"}},
+		{"RecordedAtTime": "2025-10-09T15:37:34+00:00", "MonitoredVehicleJourney": {
+			"LineRef": "49x", "DirectionRef": "outbound", "VehicleRef": "bus-2",
+			"VehicleLocation": {"Longitude": "-2.480741", "Latitude": "51.495853"}}}
+	]}}}}`
+
+	fromXML := parse(t, NewXMLParser(), xmlBody)
+	fromJSON := parseContent(t, NewXMLParser(), jsonBody, "application/json; charset=utf-8")
+
+	if len(fromJSON.VehicleData) != 2 {
+		t.Fatalf("got %d vehicles from JSON, want 2", len(fromJSON.VehicleData))
+	}
+	if !reflect.DeepEqual(fromJSON.VehicleData, fromXML.VehicleData) {
+		t.Errorf("JSON vehicles = %+v\nwant the XML vehicles %+v", fromJSON.VehicleData, fromXML.VehicleData)
+	}
+}
+
+func TestDeliveryErrorCondition(t *testing.T) {
+	delivery := func(content string) string {
+		return `<?xml version="1.0" encoding="UTF-8"?>
+<Siri xmlns="http://www.siri.org.uk/siri" version="2.0"><ServiceDelivery><VehicleMonitoringDelivery>` +
+			content + `</VehicleMonitoringDelivery></ServiceDelivery></Siri>`
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		reason string
+	}{
+		{"status false", delivery(`<Status>false</Status>`), "status false"},
+		{"error condition", delivery(`<Status>false</Status><ErrorCondition><ServiceNotAvailableError><ErrorText>upstream timeout</ErrorText></ServiceNotAvailableError></ErrorCondition>`), "ServiceNotAvailableError: upstream timeout"},
+		{"description only", delivery(`<ErrorCondition><Description>feed offline</Description></ErrorCondition>`), "feed offline"},
+		{"success without vehicles", delivery(`<Status>true</Status>`), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewXMLParser().ParseBusData(context.Background(), &bods.BusData{
+				XMLData:     tt.body,
+				ContentType: "application/xml",
+				Timestamp:   sampleFetchTime,
+				LineRef:     "49x",
+			})
+
+			var feedErr *FeedError
+			if tt.reason == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &feedErr) || feedErr.Reason != tt.reason {
+				t.Errorf("error = %v, want a FeedError with reason %q", err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestQualityFlags(t *testing.T) {
+	tests := []struct {
+		name         string
+		journey      string
+		monitored    *bool
+		inCongestion *bool
+	}{
+		{"both true", `<Monitored>true</Monitored><InCongestion>true</InCongestion>`, ptr(true), ptr(true)},
+		{"both false", `<Monitored>false</Monitored><InCongestion>false</InCongestion>`, ptr(false), ptr(false)},
+		{"absent", ``, nil, nil},
+		{"monitored only", `<Monitored> true </Monitored>`, ptr(true), nil},
+		{"unparseable", `<Monitored>maybe</Monitored><InCongestion>1</InCongestion>`, nil, ptr(true)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vehicle := parseJourney(t, NewXMLParser(), sampleJourney+sampleLocation+tt.journey)
+			if !reflect.DeepEqual(vehicle.Monitored, tt.monitored) {
+				t.Errorf("Monitored = %v, want %v", vehicle.Monitored, tt.monitored)
+			}
+			if !reflect.DeepEqual(vehicle.InCongestion, tt.inCongestion) {
+				t.Errorf("InCongestion = %v, want %v", vehicle.InCongestion, tt.inCongestion)
+			}
+		})
+	}
+}
+
+func TestPanicAndVehicleStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		journey string
+		inPanic *bool
+		status  string
+	}{
+		{"in panic", `<InPanic>true</InPanic><VehicleStatus>inProgress</VehicleStatus>`, ptr(true), "inProgress"},
+		{"not in panic", `<InPanic>false</InPanic>`, ptr(false), ""},
+		{"absent", ``, nil, ""},
+		{"unparseable panic", `<InPanic>unknown</InPanic><VehicleStatus> completed </VehicleStatus>`, nil, "completed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vehicle := parseJourney(t, NewXMLParser(), sampleJourney+sampleLocation+`<Monitored>true</Monitored>`+tt.journey)
+			if !reflect.DeepEqual(vehicle.InPanic, tt.inPanic) {
+				t.Errorf("InPanic = %v, want %v", vehicle.InPanic, tt.inPanic)
+			}
+			if vehicle.VehicleStatus != tt.status {
+				t.Errorf("VehicleStatus = %q, want %q", vehicle.VehicleStatus, tt.status)
+			}
+
+			// Absent flags are left out of the log line rather than logged as false
+			line, err := json.Marshal(vehicle)
+			if err != nil {
+				t.Fatalf("json.Marshal: %v", err)
+			}
+			if got := strings.Contains(string(line), `"in_panic"`); got != (tt.inPanic != nil) {
+				t.Errorf("in_panic in %s = %v, want %v", line, got, tt.inPanic != nil)
+			}
+		})
+	}
+}
+
+func TestJourneyRefs(t *testing.T) {
+	journeyRefs := func(frame, dated string) string {
+		return `<FramedVehicleJourneyRef>` + frame + dated + `</FramedVehicleJourneyRef>`
+	}
+
+	tests := []struct {
+		name       string
+		journey    string
+		dated      string
+		dataFrame  string
+		vehicleRef string
+	}{
+		{"both refs", sampleJourney + journeyRefs(`<DataFrameRef>2025-10-09</DataFrameRef>`, `<DatedVehicleJourneyRef>1523</DatedVehicleJourneyRef>`), "1523", "2025-10-09", "bus-1"},
+		{"dated ref only", sampleJourney + journeyRefs(``, `<DatedVehicleJourneyRef>1523</DatedVehicleJourneyRef>`), "1523", "", "bus-1"},
+		{"no FramedVehicleJourneyRef", sampleJourney, "", "", "bus-1"},
+		{"dated ref stands in for VehicleRef", `<LineRef>49x</LineRef>` + journeyRefs(`<DataFrameRef>2025-10-09</DataFrameRef>`, `<DatedVehicleJourneyRef>1523</DatedVehicleJourneyRef>`), "1523", "2025-10-09", "1523"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vehicle := parseJourney(t, NewXMLParser(), tt.journey+sampleLocation)
+			if vehicle.DatedVehicleJourneyRef != tt.dated || vehicle.DataFrameRef != tt.dataFrame {
+				t.Errorf("DatedVehicleJourneyRef, DataFrameRef = %q, %q; want %q, %q", vehicle.DatedVehicleJourneyRef, vehicle.DataFrameRef, tt.dated, tt.dataFrame)
+			}
+			if vehicle.VehicleRef != tt.vehicleRef {
+				t.Errorf("VehicleRef = %q, want %q", vehicle.VehicleRef, tt.vehicleRef)
+			}
+		})
+	}
+}
+
+func TestMonitoredOnly(t *testing.T) {
+	body := siri(
+		activity(`<LineRef>49x</LineRef><DirectionRef>inbound</DirectionRef><VehicleRef>monitored</VehicleRef><Monitored>true</Monitored>`+sampleLocation),
+		activity(`<LineRef>49x</LineRef><DirectionRef>inbound</DirectionRef><VehicleRef>scheduled</VehicleRef><Monitored>false</Monitored>`+sampleLocation),
+		activity(`<LineRef>49x</LineRef><DirectionRef>inbound</DirectionRef><VehicleRef>unreported</VehicleRef>`+sampleLocation),
+	)
+
+	tests := []struct {
+		name          string
+		monitoredOnly bool
+		want          []string
+	}{
+		{"keeps every vehicle by default", false, []string{"monitored", "scheduled", "unreported"}},
+		{"drops only Monitored=false", true, []string{"monitored", "unreported"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := parse(t, NewXMLParser(WithMonitoredOnly(tt.monitoredOnly)), body)
+
+			var refs []string
+			for _, vehicle := range parsed.VehicleData {
+				refs = append(refs, vehicle.VehicleRef)
+			}
+			if !reflect.DeepEqual(refs, tt.want) {
+				t.Errorf("vehicles = %v, want %v", refs, tt.want)
+			}
+		})
+	}
+}
+
+func TestRawData(t *testing.T) {
+	body := siri(activity(sampleJourney + sampleLocation))
+
+	tests := []struct {
+		name string
+		opts []Option
+		want bool
+	}{
+		{"dropped by default", nil, false},
+		{"dropped when disabled", []Option{WithRawData(false)}, false},
+		{"kept when enabled", []Option{WithRawData(true)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := parse(t, NewXMLParser(tt.opts...), body)
+			if got := parsed.RawData != nil; got != tt.want {
+				t.Fatalf("RawData present = %v, want %v", got, tt.want)
+			}
+			if tt.want {
+				if _, ok := parsed.RawData["Siri"]; !ok {
+					t.Errorf("RawData = %v, want the decoded Siri document", parsed.RawData)
+				}
+			}
+			if len(parsed.VehicleData) != 1 {
+				t.Errorf("got %d vehicles, want 1", len(parsed.VehicleData))
+			}
+		})
+	}
+}
+
+func TestCallTimeNormalization(t *testing.T) {
+	tests := []struct {
+		name      string
+		normalize bool
+		value     string
+		want      string
+		wantRaw   string
+	}{
+		{"offset normalized to UTC", true, "2025-10-09T16:40:00+01:00", "2025-10-09T15:40:00Z", "2025-10-09T16:40:00+01:00"},
+		{"UTC left intact", true, "2025-10-09T15:40:00Z", "2025-10-09T15:40:00Z", ""},
+		{"fractional seconds kept", true, "2025-10-09T16:40:00.5+01:00", "2025-10-09T15:40:00.5Z", "2025-10-09T16:40:00.5+01:00"},
+		{"unparseable left as is", true, "15:40", "15:40", ""},
+		{"disabled", false, "2025-10-09T16:40:00+01:00", "2025-10-09T16:40:00+01:00", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewXMLParser(WithCallTimeNormalization(tt.normalize))
+			call := `<AimedArrivalTime>` + tt.value + `</AimedArrivalTime>`
+			vehicle := parseJourney(t, p, sampleJourney+sampleLocation+
+				`<MonitoredCall>`+call+`</MonitoredCall><OnwardCalls><OnwardCall>`+call+`</OnwardCall></OnwardCalls>`)
+
+			if vehicle.MonitoredCall == nil || len(vehicle.OnwardCalls) != 1 {
+				t.Fatalf("MonitoredCall = %v, OnwardCalls = %v; want both parsed", vehicle.MonitoredCall, vehicle.OnwardCalls)
+			}
+			for _, got := range []types.StopCall{*vehicle.MonitoredCall, vehicle.OnwardCalls[0]} {
+				if got.AimedArrivalTime != tt.want || got.AimedArrivalTimeRaw != tt.wantRaw {
+					t.Errorf("AimedArrivalTime, raw = %q, %q; want %q, %q", got.AimedArrivalTime, got.AimedArrivalTimeRaw, tt.want, tt.wantRaw)
+				}
+			}
+		})
+	}
+}
+
+func TestDisableStopCalls(t *testing.T) {
+	journey := sampleJourney + sampleLocation +
+		`<MonitoredCall><StopPointRef>0100BRP90340</StopPointRef><AimedArrivalTime>2025-10-09T15:40:00Z</AimedArrivalTime><ExpectedArrivalTime>2025-10-09T15:43:00Z</ExpectedArrivalTime></MonitoredCall>` +
+		`<OnwardCalls><OnwardCall><StopPointRef>0100BRP90341</StopPointRef></OnwardCall><OnwardCall><StopPointRef>0100BRP90342</StopPointRef></OnwardCall></OnwardCalls>`
+
+	tests := []struct {
+		name          string
+		opts          []Option
+		monitoredCall bool
+		onwardCalls   int
+	}{
+		{"both parsed by default", nil, true, 2},
+		{"monitored call disabled", []Option{WithoutMonitoredCall()}, false, 2},
+		{"onward calls disabled", []Option{WithoutOnwardCalls()}, true, 0},
+		{"both disabled", []Option{WithoutMonitoredCall(), WithoutOnwardCalls()}, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vehicle := parseJourney(t, NewXMLParser(tt.opts...), journey)
+
+			if got := vehicle.MonitoredCall != nil; got != tt.monitoredCall {
+				t.Errorf("MonitoredCall present = %v, want %v", got, tt.monitoredCall)
+			}
+			if got := len(vehicle.OnwardCalls); got != tt.onwardCalls {
+				t.Errorf("got %d onward calls, want %d", got, tt.onwardCalls)
+			}
+			// Lateness is derived from MonitoredCall, so goes with it
+			if got := vehicle.IsLate != nil; got != tt.monitoredCall {
+				t.Errorf("IsLate present = %v, want %v", got, tt.monitoredCall)
+			}
+		})
+	}
+}
+
+func TestMaxFeedAge(t *testing.T) {
+	response := func(timestamp string) string {
+		return `<?xml version="1.0" encoding="UTF-8"?>
+<Siri xmlns="http://www.siri.org.uk/siri" version="2.0"><ServiceDelivery><ResponseTimestamp>` + timestamp + `</ResponseTimestamp><VehicleMonitoringDelivery>` +
+			activity(sampleJourney+sampleLocation) +
+			`</VehicleMonitoringDelivery></ServiceDelivery></Siri>`
+	}
+
+	tests := []struct {
+		name       string
+		maxAge     time.Duration
+		timestamp  string
+		wantStale  bool
+		wantMaxAge time.Duration
+	}{
+		{"fresh", 2 * time.Minute, "2025-10-09T15:37:30Z", false, 0},
+		{"stale", 2 * time.Minute, "2025-10-09T15:30:00Z", true, 2 * time.Minute},
+		{"exactly max age", 2 * time.Minute, "2025-10-09T15:35:40Z", false, 0},
+		{"check disabled", 0, "2025-10-09T15:00:00Z", false, 0},
+		{"no timestamp", 2 * time.Minute, "", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewXMLParser(WithMaxFeedAge(tt.maxAge))
+			parsed, err := p.ParseBusData(context.Background(), &bods.BusData{
+				XMLData:     response(tt.timestamp),
+				ContentType: "application/xml",
+				Timestamp:   sampleFetchTime,
+				LineRef:     "49x",
+			})
+
+			var staleErr *StaleFeedError
+			if got := errors.As(err, &staleErr); got != tt.wantStale {
+				t.Fatalf("ParseBusData error = %v, want stale %v", err, tt.wantStale)
+			}
+			if tt.wantStale {
+				if staleErr.MaxAge != tt.wantMaxAge || staleErr.Age != 7*time.Minute+40*time.Second {
+					t.Errorf("StaleFeedError = %+v, want a 7m40s old response against %v", staleErr, tt.wantMaxAge)
+				}
+				return
+			}
+			if err != nil || len(parsed.VehicleData) != 1 {
+				t.Errorf("ParseBusData = %v, %v; want the fresh vehicle", parsed, err)
+			}
+		})
+	}
+}
+
+func TestNormalizeBearing(t *testing.T) {
+	tests := []struct {
+		name    string
+		bearing float64
+		want    float64
+		ok      bool
+	}{
+		{"in range", 270, 270, true},
+		{"full circle", 360, 0, true},
+		{"negative", -45, 315, true},
+		{"two circles", 720, 0, true},
+		{"over a circle", 405.5, 45.5, true},
+		{"negative zero", math.Copysign(0, -1), 0, true},
+		{"not a number", math.NaN(), 0, false},
+		{"infinite", math.Inf(1), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := normalizeBearing(tt.bearing)
+			if got != tt.want || ok != tt.ok || math.Signbit(got) {
+				t.Errorf("normalizeBearing(%v) = %v, %v; want %v, %v", tt.bearing, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParsedBearingIsNormalized(t *testing.T) {
+	tests := []struct {
+		bearing string
+		want    float64
+		compass string
+	}{
+		{"360", 0, "N"},
+		{"-45", 315, "NW"},
+		{"720.0", 0, "N"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.bearing, func(t *testing.T) {
+			vehicle := parseJourney(t, NewXMLParser(), sampleJourney+sampleLocation+`<Bearing>`+tt.bearing+`</Bearing>`)
+			if vehicle.Bearing != tt.want || !vehicle.HasBearing || vehicle.CompassDirection != tt.compass {
+				t.Errorf("Bearing, HasBearing, CompassDirection = %v, %v, %q; want %v, true, %q", vehicle.Bearing, vehicle.HasBearing, vehicle.CompassDirection, tt.want, tt.compass)
+			}
+		})
+	}
+}
+
+func TestUnexpectedContentType(t *testing.T) {
+	body := siri(activity(sampleJourney + sampleLocation))
+
+	tests := []struct {
+		contentType string
+		wantFeedErr bool
+	}{
+		{"application/xml", false},
+		{"text/xml; charset=utf-8", false},
+		{"application/siri+xml", false},
+		{"", false},
+		{"text/html; charset=utf-8", true},
+		{"text/plain", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			_, err := NewXMLParser().ParseBusData(context.Background(), &bods.BusData{
+				XMLData:     body,
+				ContentType: tt.contentType,
+				Timestamp:   sampleFetchTime,
+				LineRef:     "49x",
+			})
+
+			var feedErr *FeedError
+			if got := errors.As(err, &feedErr); got != tt.wantFeedErr {
+				t.Fatalf("ParseBusData error = %v, want feed error %v", err, tt.wantFeedErr)
+			}
+			if tt.wantFeedErr && feedErr.Reason != "unexpected content type" {
+				t.Errorf("Reason = %q, want unexpected content type", feedErr.Reason)
+			}
+		})
+	}
+}
+
+func TestIntValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  int
+		ok    bool
+	}{
+		{"string", "3", 3, true},
+		{"padded string", " 3 ", 3, true},
+		{"float64", float64(3), 3, true},
+		{"int", 3, 3, true},
+		{"int64", int64(3), 3, true},
+		{"json.Number", json.Number("3"), 3, true},
+		{"fractional float64", 3.5, 0, false},
+		{"text", "third", 0, false},
+		{"missing", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := intValue(tt.value)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("intValue(%#v) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestVisitNumberRepresentations(t *testing.T) {
+	jsonBody := func(visitNumber string) string {
+		return `{"Siri": {"ServiceDelivery": {"VehicleMonitoringDelivery": {"VehicleActivity": {
+			"RecordedAtTime": "2025-10-09T15:37:34+00:00", "MonitoredVehicleJourney": {
+			"LineRef": "49x", "DirectionRef": "inbound", "VehicleRef": "bus-1",
+			"VehicleLocation": {"Longitude": -2.480741, "Latitude": 51.495853},
+			"MonitoredCall": {"StopPointRef": "0100BRP90340", "VisitNumber": ` + visitNumber + `}}}}}}}`
+	}
+
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+	}{
+		{"XML text", siri(activity(sampleJourney + sampleLocation + `<MonitoredCall><StopPointRef>0100BRP90340</StopPointRef><VisitNumber>2</VisitNumber></MonitoredCall>`)), "application/xml"},
+		{"JSON number", jsonBody(`2`), "application/json"},
+		{"JSON string", jsonBody(`"2"`), "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := parseContent(t, NewXMLParser(), tt.body, tt.contentType)
+			if len(parsed.VehicleData) != 1 || parsed.VehicleData[0].MonitoredCall == nil {
+				t.Fatalf("vehicles = %+v, want one with a MonitoredCall", parsed.VehicleData)
+			}
+			if got := parsed.VehicleData[0].MonitoredCall.VisitNumber; got != 2 {
+				t.Errorf("VisitNumber = %d, want 2", got)
+			}
+		})
+	}
+}
+
+func TestToFloat(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  float64
+		ok    bool
+	}{
+		{"string", "51.495853", 51.495853, true},
+		{"padded string", " -2.480741 ", -2.480741, true},
+		{"float64", 51.495853, 51.495853, true},
+		{"int", 270, 270, true},
+		{"int64", int64(270), 270, true},
+		{"json.Number", json.Number("12.5"), 12.5, true},
+		{"text", "north", 0, false},
+		{"bool", true, 0, false},
+		{"missing", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := toFloat(tt.value)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("toFloat(%#v) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNumericFieldRepresentations(t *testing.T) {
+	journey := func(longitude, latitude, bearing, velocity string) string {
+		return `{"Siri": {"ServiceDelivery": {"VehicleMonitoringDelivery": {"VehicleActivity": {
+			"RecordedAtTime": "2025-10-09T15:37:34+00:00", "MonitoredVehicleJourney": {
+			"LineRef": "49x", "DirectionRef": "inbound", "VehicleRef": "bus-1",
+			"VehicleLocation": {"Longitude": ` + longitude + `, "Latitude": ` + latitude + `},
+			"Bearing": ` + bearing + `, "Velocity": ` + velocity + `}}}}}}`
+	}
+
+	fromNumbers := parseContent(t, NewXMLParser(), journey(`-2.480741`, `51.495853`, `270`, `12.5`), "application/json")
+	fromStrings := parseContent(t, NewXMLParser(), journey(`"-2.480741"`, `"51.495853"`, `"270.0"`, `"12.5"`), "application/json")
+
+	if len(fromNumbers.VehicleData) != 1 || len(fromStrings.VehicleData) != 1 {
+		t.Fatalf("got %d and %d vehicles, want 1 each", len(fromNumbers.VehicleData), len(fromStrings.VehicleData))
+	}
+	numbers, strs := fromNumbers.VehicleData[0], fromStrings.VehicleData[0]
+	if !reflect.DeepEqual(numbers, strs) {
+		t.Errorf("numeric fields = %+v\nstring fields = %+v\nwant identical vehicles", numbers, strs)
+	}
+	if numbers.Latitude != 51.495853 || numbers.Longitude != -2.480741 || numbers.Bearing != 270 || numbers.Velocity != 12.5 {
+		t.Errorf("Latitude, Longitude, Bearing, Velocity = %v, %v, %v, %v", numbers.Latitude, numbers.Longitude, numbers.Bearing, numbers.Velocity)
+	}
+}
+
+func TestSnapshotID(t *testing.T) {
+	vehicles := activity(sampleJourney) + activity(strings.Replace(sampleJourney, "<VehicleRef>", "<VehicleRef>2-", 1))
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"service delivery", `<?xml version="1.0" encoding="UTF-8"?>
+<Siri xmlns="http://www.siri.org.uk/siri" version="2.0"><ServiceDelivery>
+<ResponseMessageIdentifier> 5b7c2c1e-6b2f-4d3a-9a51-0c6d4f3e2a10 </ResponseMessageIdentifier>
+<VehicleMonitoringDelivery>` + vehicles + `</VehicleMonitoringDelivery></ServiceDelivery></Siri>`, "5b7c2c1e-6b2f-4d3a-9a51-0c6d4f3e2a10"},
+		{"vehicle monitoring delivery", `<?xml version="1.0" encoding="UTF-8"?>
+<Siri xmlns="http://www.siri.org.uk/siri" version="2.0"><ServiceDelivery><VehicleMonitoringDelivery>
+<ResponseMessageIdentifier>snapshot-42</ResponseMessageIdentifier>` + vehicles + `</VehicleMonitoringDelivery></ServiceDelivery></Siri>`, "snapshot-42"},
+		{"missing", siri(vehicles), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := parse(t, NewXMLParser(), tt.body)
+			if parsed.SnapshotID != tt.want {
+				t.Errorf("SnapshotID = %q, want %q", parsed.SnapshotID, tt.want)
+			}
+			if len(parsed.VehicleData) != 2 {
+				t.Errorf("got %d vehicles, want 2 sharing the snapshot", len(parsed.VehicleData))
+			}
+		})
+	}
+}
+
+func TestCompassDirection(t *testing.T) {
+	tests := []struct {
+		bearing float64
+		want    string
+	}{
+		{0, "N"},
+		{22.4, "N"},
+		{22.5, "NE"},
+		{45, "NE"},
+		{90, "E"},
+		{135, "SE"},
+		{180, "S"},
+		{225, "SW"},
+		{270, "W"},
+		{315, "NW"},
+		{337.4, "NW"},
+		{337.5, "N"},
+		{359.9, "N"},
+	}
+
+	for _, tt := range tests {
+		if got := compassDirection(tt.bearing); got != tt.want {
+			t.Errorf("compassDirection(%v) = %q, want %q", tt.bearing, got, tt.want)
+		}
+	}
+}
+
+func TestSpeedConversion(t *testing.T) {
+	tests := []struct {
+		name     string
+		velocity string
+		mph, kph float64
+	}{
+		{"sample velocity", `<Velocity>12.5</Velocity>`, 28.0, 45.0},
+		{"rounded to one decimal", `<Velocity>8.3</Velocity>`, 18.6, 29.9},
+		{"inside vehicle location", `<VehicleLocation><Longitude>-2.480741</Longitude><Latitude>51.495853</Latitude><Velocity>12.5</Velocity></VehicleLocation>`, 28.0, 45.0},
+		{"stationary", `<Velocity>0</Velocity>`, 0, 0},
+		{"absent", ``, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			journey := sampleJourney + tt.velocity
+			if !strings.Contains(tt.velocity, "VehicleLocation") {
+				journey += sampleLocation
+			}
+			vehicle := parseJourney(t, NewXMLParser(), journey)
+			if vehicle.SpeedMPH != tt.mph || vehicle.SpeedKPH != tt.kph {
+				t.Errorf("SpeedMPH, SpeedKPH = %v, %v; want %v, %v", vehicle.SpeedMPH, vehicle.SpeedKPH, tt.mph, tt.kph)
+			}
+
+			// Absent speeds are left out of the JSON
+			encoded, err := json.Marshal(vehicle)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if hasSpeed := strings.Contains(string(encoded), `"speed_mph"`); hasSpeed != (tt.mph != 0) {
+				t.Errorf("speed_mph in JSON = %v, want %v: %s", hasSpeed, tt.mph != 0, encoded)
+			}
+		})
+	}
+}
+
+func TestMultipleDeliveries(t *testing.T) {
+	vehicle := func(ref string) string {
+		return activity(strings.Replace(sampleJourney, "<VehicleRef>", "<VehicleRef>"+ref+"-", 1) + sampleLocation)
+	}
+	envelope := func(deliveries ...string) string {
+		var b strings.Builder
+		b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<Siri xmlns="http://www.siri.org.uk/siri" version="2.0"><ServiceDelivery>`)
+		for _, delivery := range deliveries {
+			b.WriteString(`<VehicleMonitoringDelivery>` + delivery + `</VehicleMonitoringDelivery>`)
+		}
+		b.WriteString(`</ServiceDelivery></Siri>`)
+		return b.String()
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"single delivery", envelope(vehicle("a") + vehicle("b")), []string{"a", "b"}},
+		{"two deliveries", envelope(vehicle("a"), vehicle("b")+vehicle("c")), []string{"a", "b", "c"}},
+		{"empty delivery", envelope("", vehicle("b")), []string{"b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := parse(t, NewXMLParser(), tt.body)
+			var got []string
+			for _, v := range parsed.VehicleData {
+				prefix, _, _ := strings.Cut(v.VehicleRef, "-")
+				got = append(got, prefix)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("vehicles from deliveries %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package pipeline
+
+import (
+	"context"
+
+	"bods2loki/pkg/bods"
+)
+
+// Fetcher retrieves the raw SIRI-VM response for a line. *bods.Client is the
+// standard implementation; embedders can supply their own, e.g. to read
+// from a cache or a recorded fixture.
+type Fetcher interface {
+	FetchBusData(ctx context.Context, lineRef string) (*bods.BusData, error)
+}
+
+// Option customizes a Pipeline beyond its Config
+type Option func(*options)
+
+type options struct {
+	fetcher   Fetcher
+	sinkNames []string
+	sinks     []Sink
+}
+
+// WithFetcher fetches line data with f instead of a BODS client built from
+// the Config, in which case Config.APIKey is not required
+func WithFetcher(f Fetcher) Option {
+	return func(o *options) {
+		o.fetcher = f
+	}
+}
+
+// WithSink sends each cycle's data to sink. When any sink is given, it
+// replaces the default Loki (or dry-run stdout) output.
+func WithSink(name string, sink Sink) Option {
+	return func(o *options) {
+		o.sinkNames = append(o.sinkNames, name)
+		o.sinks = append(o.sinks, sink)
+	}
+}
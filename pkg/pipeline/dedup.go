@@ -0,0 +1,93 @@
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"bods2loki/pkg/types"
+)
+
+// sentObservation is the last observation of a vehicle that was sent
+type sentObservation struct {
+	key    string
+	sentAt time.Time
+}
+
+// vehicleDeduper remembers, per line, the last observation sent for each
+// vehicle so an unchanged vehicle is not re-sent every cycle. Observations
+// older than window are forgotten, so a stationary vehicle is still sent once
+// per window.
+type vehicleDeduper struct {
+	mu     sync.Mutex
+	window time.Duration
+	lines  map[string]map[string]sentObservation
+	now    func() time.Time
+}
+
+func newVehicleDeduper(window time.Duration) *vehicleDeduper {
+	return &vehicleDeduper{
+		window: window,
+		lines:  make(map[string]map[string]sentObservation),
+		now:    time.Now,
+	}
+}
+
+// observationKey identifies a vehicle report. RecordedAtTime changes whenever
+// the vehicle reports; the position is used when the feed omits it.
+func observationKey(vehicle types.VehicleActivity) string {
+	if vehicle.RecordedAtTime != "" {
+		return vehicle.RecordedAtTime
+	}
+	return fmt.Sprintf("%.6f,%.6f,%.1f", vehicle.Latitude, vehicle.Longitude, vehicle.Bearing)
+}
+
+// filter returns data without the vehicles whose observation matches the last
+// one sent within the window, and the number of vehicles skipped. data itself
+// is not modified.
+func (d *vehicleDeduper) filter(data *types.ParsedBusData) (*types.ParsedBusData, int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	sent := d.lines[data.LineRef]
+
+	kept := make([]types.VehicleActivity, 0, len(data.VehicleData))
+	for _, vehicle := range data.VehicleData {
+		last, ok := sent[vehicle.VehicleRef]
+		if vehicle.VehicleRef != "" && ok && now.Sub(last.sentAt) < d.window && last.key == observationKey(vehicle) {
+			continue
+		}
+		kept = append(kept, vehicle)
+	}
+
+	filtered := *data
+	filtered.VehicleData = kept
+	return &filtered, len(data.VehicleData) - len(kept)
+}
+
+// remember records the vehicles in data as sent, and forgets expired ones
+func (d *vehicleDeduper) remember(data *types.ParsedBusData) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	sent, ok := d.lines[data.LineRef]
+	if !ok {
+		sent = make(map[string]sentObservation)
+		d.lines[data.LineRef] = sent
+	}
+
+	for ref, last := range sent {
+		if now.Sub(last.sentAt) >= d.window {
+			delete(sent, ref)
+		}
+	}
+
+	for _, vehicle := range data.VehicleData {
+		if vehicle.VehicleRef == "" {
+			continue
+		}
+		sent[vehicle.VehicleRef] = sentObservation{key: observationKey(vehicle), sentAt: now}
+	}
+}
@@ -0,0 +1,83 @@
+package pipeline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"bods2loki/pkg/types"
+)
+
+func TestVehicleDeduper(t *testing.T) {
+	observed := func(ref, recordedAt string, latitude float64) *types.ParsedBusData {
+		return &types.ParsedBusData{LineRef: "49x", VehicleData: []types.VehicleActivity{
+			{VehicleRef: ref, RecordedAtTime: recordedAt, Latitude: latitude, Longitude: -2.480741},
+		}}
+	}
+
+	tests := []struct {
+		name     string
+		first    *types.ParsedBusData
+		second   *types.ParsedBusData
+		advance  time.Duration
+		wantSkip int
+	}{
+		{"unchanged", observed("bus-1", "2025-10-09T15:37:34Z", 51.5), observed("bus-1", "2025-10-09T15:37:34Z", 51.5), 30 * time.Second, 1},
+		{"new report", observed("bus-1", "2025-10-09T15:37:34Z", 51.5), observed("bus-1", "2025-10-09T15:38:04Z", 51.5), 30 * time.Second, 0},
+		{"window expired", observed("bus-1", "2025-10-09T15:37:34Z", 51.5), observed("bus-1", "2025-10-09T15:37:34Z", 51.5), 5 * time.Minute, 0},
+		{"unmoved without RecordedAtTime", observed("bus-1", "", 51.5), observed("bus-1", "", 51.5), 30 * time.Second, 1},
+		{"moved without RecordedAtTime", observed("bus-1", "", 51.5), observed("bus-1", "", 51.6), 30 * time.Second, 0},
+		{"no vehicle ref", observed("", "2025-10-09T15:37:34Z", 51.5), observed("", "2025-10-09T15:37:34Z", 51.5), 30 * time.Second, 0},
+		{"other vehicle", observed("bus-1", "2025-10-09T15:37:34Z", 51.5), observed("bus-2", "2025-10-09T15:37:34Z", 51.5), 30 * time.Second, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Date(2025, 10, 9, 15, 37, 40, 0, time.UTC)}
+			d := newVehicleDeduper(2 * time.Minute)
+			d.now = clock.Now
+
+			filtered, skipped := d.filter(tt.first)
+			if skipped != 0 {
+				t.Fatalf("skipped %d vehicles on first sight, want 0", skipped)
+			}
+			d.remember(filtered)
+			clock.Advance(tt.advance)
+
+			filtered, skipped = d.filter(tt.second)
+			if skipped != tt.wantSkip || len(filtered.VehicleData) != len(tt.second.VehicleData)-tt.wantSkip {
+				t.Errorf("skipped %d and kept %d vehicles, want %d skipped", skipped, len(filtered.VehicleData), tt.wantSkip)
+			}
+			if len(tt.second.VehicleData) != 1 {
+				t.Error("filter modified its input")
+			}
+		})
+	}
+}
+
+func TestDedupWindowSkipsIdenticalCycles(t *testing.T) {
+	tests := []struct {
+		name   string
+		window time.Duration
+		second int
+	}{
+		{"dedup disabled", 0, 2},
+		{"dedup window", time.Hour, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, sink := newTestPipeline(t, Config{LineRefs: []string{"49x", "72"}, DedupWindow: tt.window}, &fakeFetcher{})
+
+			for cycle, want := range []int{2, tt.second} {
+				sink.Reset()
+				if err := p.RunCycle(context.Background()); err != nil {
+					t.Fatalf("RunCycle %d: %v", cycle, err)
+				}
+				if got := len(sink.Records()); got != want {
+					t.Errorf("cycle %d sent %d lines, want %d", cycle, got, want)
+				}
+			}
+		})
+	}
+}
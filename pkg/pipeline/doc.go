@@ -0,0 +1,8 @@
+// Package pipeline polls BODS for the configured lines, parses the SIRI-VM
+// responses and forwards the results to one or more sinks.
+//
+// The stable surface for embedding bods2loki in another program is New,
+// Config, Option (WithFetcher, WithSink), the Fetcher and Sink interfaces,
+// and the Run, RunOnce and Close methods. Other exported identifiers may change
+// between releases.
+package pipeline
@@ -0,0 +1,79 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"bods2loki/pkg/loki"
+	"bods2loki/pkg/types"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Dry run output formats
+const (
+	// DryRunPretty prints a summary of each line followed by its log lines
+	DryRunPretty = "pretty"
+	// DryRunJSONLines prints only the log lines, one JSON object per line
+	DryRunJSONLines = "jsonl"
+	// DryRunJSON prints the log lines of each cycle as a single JSON array
+	DryRunJSON = "json"
+)
+
+// dryRunSink prints to stdout instead of sending to Loki, taking whole
+// cycles so DryRunJSON can print one array per cycle
+type dryRunSink struct {
+	p *Pipeline
+}
+
+func (s dryRunSink) Send(ctx context.Context, data *types.ParsedBusData) error {
+	return s.SendBatch(ctx, []*types.ParsedBusData{data})
+}
+
+func (s dryRunSink) SendBatch(ctx context.Context, batch []*types.ParsedBusData) error {
+	if s.p.config.DryRunFormat == DryRunPretty {
+		for _, data := range batch {
+			if err := s.p.handleDryRun(ctx, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return s.p.printDryRunEntries(ctx, batch)
+}
+
+// printDryRunEntries prints the log lines of batch as JSON lines or a JSON array
+func (p *Pipeline) printDryRunEntries(ctx context.Context, batch []*types.ParsedBusData) error {
+	_, span := p.tracer.Start(ctx, "pipeline.dry_run")
+	defer span.End()
+
+	entries := []map[string]interface{}{}
+	for _, data := range batch {
+		for _, vehicle := range data.VehicleData {
+			entries = append(entries, loki.BuildVehicleEntry(data, vehicle, p.entryOptions()))
+		}
+	}
+	span.SetAttributes(attribute.Int("vehicles_printed", len(entries)))
+
+	if p.config.DryRunFormat == DryRunJSON {
+		return printJSON(entries)
+	}
+	for _, entry := range entries {
+		if err := printJSON(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printJSON prints v as JSON on a line of its own
+func printJSON(v interface{}) error {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON for dry run: %w", err)
+	}
+	fmt.Println(string(encoded))
+	return nil
+}
@@ -0,0 +1,101 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureStdout returns what fn prints to stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		output <- string(b)
+	}()
+
+	fn()
+	w.Close()
+	return <-output
+}
+
+func TestDryRunFormats(t *testing.T) {
+	twoVehicles := func(line string) []string { return []string{line + "-1", line + "-2"} }
+
+	tests := []struct {
+		format string
+		check  func(t *testing.T, output string)
+	}{
+		{DryRunPretty, func(t *testing.T, output string) {
+			if json.Valid([]byte(output)) {
+				t.Error("pretty output is a single JSON value, want a human summary")
+			}
+			for _, want := range []string{"49x", "72", `"vehicle_ref":"49x-2"`} {
+				if !strings.Contains(output, want) {
+					t.Errorf("pretty output lacks %q:\n%s", want, output)
+				}
+			}
+		}},
+		{DryRunJSONLines, func(t *testing.T, output string) {
+			lines := strings.Split(strings.TrimSpace(output), "\n")
+			if len(lines) != 4 {
+				t.Fatalf("got %d lines, want one per vehicle:\n%s", len(lines), output)
+			}
+			for _, line := range lines {
+				var entry map[string]interface{}
+				if err := json.Unmarshal([]byte(line), &entry); err != nil {
+					t.Fatalf("line %q is not a JSON object: %v", line, err)
+				}
+				if entry["vehicle_ref"] == nil || entry["line_ref"] == nil {
+					t.Errorf("entry %v lacks vehicle_ref or line_ref", entry)
+				}
+			}
+		}},
+		{DryRunJSON, func(t *testing.T, output string) {
+			var entries []map[string]interface{}
+			if err := json.Unmarshal([]byte(output), &entries); err != nil {
+				t.Fatalf("output is not a JSON array: %v\n%s", err, output)
+			}
+			if len(entries) != 4 {
+				t.Errorf("array holds %d entries, want one per vehicle", len(entries))
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			captureLog(t)
+			p, err := New(Config{
+				DryRun:       true,
+				DryRunFormat: tt.format,
+				LineRefs:     []string{"49x", "72"},
+				Interval:     time.Hour,
+			}, WithFetcher(&fakeFetcher{vehicles: twoVehicles}))
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer p.Close()
+
+			output := captureStdout(t, func() {
+				if err := p.RunCycle(context.Background()); err != nil {
+					t.Errorf("RunCycle: %v", err)
+				}
+			})
+			tt.check(t, output)
+		})
+	}
+}
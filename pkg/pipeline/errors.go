@@ -0,0 +1,75 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Pipeline stages a LineError can come from
+const (
+	StageFetch = "fetch"
+	StageParse = "parse"
+	StageFeed  = "feed"
+	StagePanic = "panic"
+	// StageTimeout is a line still fetching or parsing when the cycle timed out
+	StageTimeout = "timeout"
+)
+
+// LineError is a failure processing one line, keeping the line ref and stage
+// available to callers after wrapping
+type LineError struct {
+	LineRef string
+	Stage   string
+	Err     error
+}
+
+func (e *LineError) Error() string {
+	switch e.Stage {
+	case StageFetch:
+		return fmt.Sprintf("failed to fetch bus data for line %s: %v", e.LineRef, e.Err)
+	case StageParse:
+		return fmt.Sprintf("failed to parse bus data for line %s: %v", e.LineRef, e.Err)
+	case StageFeed:
+		return fmt.Sprintf("feed error for line %s: %v", e.LineRef, e.Err)
+	case StagePanic:
+		return fmt.Sprintf("panic processing line %s: %v", e.LineRef, e.Err)
+	case StageTimeout:
+		return fmt.Sprintf("cycle timed out processing line %s: %v", e.LineRef, e.Err)
+	default:
+		return fmt.Sprintf("line %s: %v", e.LineRef, e.Err)
+	}
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// LineRefFromError returns the line ref carried by the first LineError in
+// err's chain, or "" if there is none
+func LineRefFromError(err error) string {
+	var lineErr *LineError
+	if errors.As(err, &lineErr) {
+		return lineErr.LineRef
+	}
+	return ""
+}
+
+// LineRefsFromError returns the line refs of every LineError in err's tree,
+// including those joined together when all lines fail
+func LineRefsFromError(err error) []string {
+	var refs []string
+
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *LineError:
+		return []string{e.LineRef}
+	case interface{ Unwrap() []error }:
+		for _, inner := range e.Unwrap() {
+			refs = append(refs, LineRefsFromError(inner)...)
+		}
+		return refs
+	}
+
+	return LineRefsFromError(errors.Unwrap(err))
+}
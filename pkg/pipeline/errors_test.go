@@ -0,0 +1,85 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLineRefFromError(t *testing.T) {
+	errUnavailable := errors.New("BODS unavailable")
+	fetchErr := &LineError{LineRef: "49x", Stage: StageFetch, Err: errUnavailable}
+	parseErr := &LineError{LineRef: "72", Stage: StageParse, Err: errors.New("unexpected EOF")}
+
+	tests := []struct {
+		name  string
+		err   error
+		ref   string
+		refs  []string
+		cause error
+	}{
+		{"fetch error", fetchErr, "49x", []string{"49x"}, errUnavailable},
+		{"wrapped", fmt.Errorf("cycle: %w", fetchErr), "49x", []string{"49x"}, errUnavailable},
+		{"all lines failed", fmt.Errorf("all lines failed: %w", errors.Join(fetchErr, parseErr)), "49x", []string{"49x", "72"}, errUnavailable},
+		{"not a line error", errUnavailable, "", nil, errUnavailable},
+		{"nil", nil, "", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LineRefFromError(tt.err); got != tt.ref {
+				t.Errorf("LineRefFromError = %q, want %q", got, tt.ref)
+			}
+			if got := LineRefsFromError(tt.err); !reflect.DeepEqual(got, tt.refs) {
+				t.Errorf("LineRefsFromError = %v, want %v", got, tt.refs)
+			}
+			if tt.cause != nil && !errors.Is(tt.err, tt.cause) {
+				t.Errorf("errors.Is(%v, %v) = false, want the cause preserved", tt.err, tt.cause)
+			}
+		})
+	}
+}
+
+func TestLineErrorMessage(t *testing.T) {
+	tests := []struct {
+		stage string
+		want  string
+	}{
+		{StageFetch, "failed to fetch bus data for line 49x: boom"},
+		{StageParse, "failed to parse bus data for line 49x: boom"},
+		{StageFeed, "feed error for line 49x: boom"},
+		{StagePanic, "panic processing line 49x: boom"},
+		{StageTimeout, "cycle timed out processing line 49x: boom"},
+		{"other", "line 49x: boom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.stage, func(t *testing.T) {
+			err := &LineError{LineRef: "49x", Stage: tt.stage, Err: errors.New("boom")}
+			if got := err.Error(); got != tt.want {
+				t.Errorf("Error() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunOnceErrorsCarryLineRefs(t *testing.T) {
+	errUnavailable := errors.New("BODS unavailable")
+	fetcher := &fakeFetcher{errs: map[string]error{"49x": errUnavailable, "72": errUnavailable}}
+	p, _ := newTestPipeline(t, Config{LineRefs: []string{"49x", "72"}}, fetcher)
+
+	_, err := p.RunOnce(context.Background())
+	if err == nil {
+		t.Fatal("RunOnce succeeded with every line failing")
+	}
+
+	if got := strings.Join(LineRefsFromError(err), ","); got != "49x,72" {
+		t.Errorf("LineRefsFromError = %s, want 49x,72", got)
+	}
+	if !errors.Is(err, errUnavailable) {
+		t.Errorf("RunOnce error %v lost the fetch error", err)
+	}
+}
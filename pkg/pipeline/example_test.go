@@ -0,0 +1,59 @@
+package pipeline_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"bods2loki/pkg/bods"
+	"bods2loki/pkg/pipeline"
+	"bods2loki/pkg/types"
+)
+
+// staticFetcher serves the same SIRI-VM response for every line, in place of
+// the BODS API
+type staticFetcher string
+
+func (f staticFetcher) FetchBusData(ctx context.Context, lineRef string) (*bods.BusData, error) {
+	return &bods.BusData{
+		XMLData:     string(f),
+		ContentType: "application/xml",
+		Timestamp:   time.Date(2025, 10, 9, 15, 37, 40, 0, time.UTC),
+		LineRef:     lineRef,
+	}, nil
+}
+
+const siriResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<Siri xmlns="http://www.siri.org.uk/siri" version="2.0"><ServiceDelivery><VehicleMonitoringDelivery>
+<VehicleActivity><RecordedAtTime>2025-10-09T15:37:34+00:00</RecordedAtTime><MonitoredVehicleJourney>
+<LineRef>49x</LineRef><DirectionRef>inbound</DirectionRef><VehicleRef>bus-1</VehicleRef>
+<VehicleLocation><Longitude>-2.480741</Longitude><Latitude>51.495853</Latitude></VehicleLocation>
+</MonitoredVehicleJourney></VehicleActivity>
+</VehicleMonitoringDelivery></ServiceDelivery></Siri>`
+
+// This example embeds the pipeline as a library, printing vehicle positions
+// instead of sending them to Loki
+func ExampleNew() {
+	printer := pipeline.SinkFunc(func(ctx context.Context, data *types.ParsedBusData) error {
+		for _, vehicle := range data.VehicleData {
+			fmt.Printf("line %s vehicle %s at %.6f,%.6f\n", data.LineRef, vehicle.VehicleRef, vehicle.Latitude, vehicle.Longitude)
+		}
+		return nil
+	})
+
+	p, err := pipeline.New(pipeline.Config{
+		LineRefs: []string{"49x"},
+		Interval: 30 * time.Second,
+	}, pipeline.WithFetcher(staticFetcher(siriResponse)), pipeline.WithSink("printer", printer))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer p.Close()
+
+	if err := p.RunCycle(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	// Output:
+	// line 49x vehicle bus-1 at 51.495853,-2.480741
+}
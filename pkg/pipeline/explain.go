@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+
+	"bods2loki/pkg/bods"
+	"bods2loki/pkg/loki"
+	"bods2loki/pkg/types"
+)
+
+// explainf logs a message about the vehicle selected with ExplainVehicle,
+// without needing global debug logging
+func (p *Pipeline) explainf(format string, args ...interface{}) {
+	log.Printf("[explain %s] "+format, append([]interface{}{p.config.ExplainVehicle}, args...)...)
+}
+
+// explainedVehicle returns the targeted vehicle from parsed data, if present
+func (p *Pipeline) explainedVehicle(data *types.ParsedBusData) (types.VehicleActivity, bool) {
+	// Parsed refs may be redacted, so compare against the redacted form
+	ref := p.redactor.VehicleRef(p.config.ExplainVehicle)
+	for _, vehicle := range data.VehicleData {
+		if vehicle.VehicleRef == ref {
+			return vehicle, true
+		}
+	}
+	return types.VehicleActivity{}, false
+}
+
+// explainParse reports whether the targeted vehicle was fetched and how it was parsed
+func (p *Pipeline) explainParse(busData *bods.BusData, data *types.ParsedBusData) {
+	if p.config.ExplainVehicle == "" {
+		return
+	}
+
+	vehicle, found := p.explainedVehicle(data)
+	if !found {
+		// The ref appearing in the raw response means the parser dropped it
+		if strings.Contains(busData.XMLData, p.config.ExplainVehicle) {
+			p.explainf("fetch: present in raw response for line %s but not extracted by the parser", busData.LineRef)
+		}
+		return
+	}
+
+	p.explainf("fetch: found in response for line %s fetched at %s (%d bytes)",
+		busData.LineRef, busData.Timestamp.Format("2006-01-02T15:04:05.000Z"), len(busData.XMLData))
+
+	fields, err := json.Marshal(vehicle)
+	if err != nil {
+		p.explainf("parse: failed to marshal parsed fields: %v", err)
+		return
+	}
+	p.explainf("parse: %s", fields)
+	p.explainf("filter: kept")
+}
+
+// explainSend reports the entry built for the targeted vehicle and the send outcome
+func (p *Pipeline) explainSend(data *types.ParsedBusData, destination string, sendErr error) {
+	if p.config.ExplainVehicle == "" {
+		return
+	}
+
+	vehicle, found := p.explainedVehicle(data)
+	if !found {
+		return
+	}
+
+	entry, err := json.Marshal(loki.BuildVehicleEntry(data, vehicle, p.entryOptions()))
+	if err != nil {
+		p.explainf("send: failed to marshal entry: %v", err)
+		return
+	}
+
+	if sendErr != nil {
+		p.explainf("send: failed to send to %s: %v; entry: %s", destination, sendErr, entry)
+		return
+	}
+	p.explainf("send: sent to %s; entry: %s", destination, entry)
+}
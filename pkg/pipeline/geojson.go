@@ -0,0 +1,22 @@
+package pipeline
+
+import (
+	"context"
+
+	"bods2loki/pkg/geojson"
+	"bods2loki/pkg/types"
+)
+
+// geojsonSink writes each cycle's vehicles to a GeoJSON file, replacing the
+// previous cycle's
+type geojsonSink struct {
+	path string
+}
+
+func (s geojsonSink) Send(ctx context.Context, data *types.ParsedBusData) error {
+	return s.SendBatch(ctx, []*types.ParsedBusData{data})
+}
+
+func (s geojsonSink) SendBatch(ctx context.Context, batch []*types.ParsedBusData) error {
+	return geojson.WriteFile(s.path, geojson.FromBusData(batch))
+}
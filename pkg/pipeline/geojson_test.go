@@ -0,0 +1,42 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGeoJSONOut(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vehicles.geojson")
+	p, _ := newTestPipeline(t, Config{LineRefs: []string{"49x", "72"}, GeoJSONOut: path}, &fakeFetcher{})
+
+	for cycle := 0; cycle < 2; cycle++ {
+		if err := p.RunCycle(context.Background()); err != nil {
+			t.Fatalf("RunCycle %d: %v", cycle, err)
+		}
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading GeoJSON output: %v", err)
+	}
+	var collection struct {
+		Features []struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(raw, &collection); err != nil {
+		t.Fatalf("GeoJSON output is not valid JSON: %v", err)
+	}
+
+	// The file holds every line of the latest cycle only
+	lines := make(map[interface{}]int)
+	for _, feature := range collection.Features {
+		lines[feature.Properties["line_ref"]]++
+	}
+	if len(collection.Features) != 2 || lines["49x"] != 1 || lines["72"] != 1 {
+		t.Errorf("features by line = %v, want one vehicle from each line", lines)
+	}
+}
@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultAdaptiveIdleCycles is how many consecutive cycles without vehicles
+// start the idle backoff when no count is configured
+const DefaultAdaptiveIdleCycles = 3
+
+// idleBackoff lengthens the polling interval while the feed returns no
+// vehicles, e.g. overnight, to save API quota. After threshold empty cycles
+// each further one doubles the interval, up to max.
+type idleBackoff struct {
+	mu         sync.Mutex
+	threshold  int
+	max        time.Duration
+	idleCycles int
+	// reset is signalled when vehicles reappear after a backoff, so the
+	// next cycle isn't left waiting on the long interval
+	reset chan struct{}
+}
+
+func newIdleBackoff(threshold int, max time.Duration) *idleBackoff {
+	return &idleBackoff{
+		threshold: threshold,
+		max:       max,
+		reset:     make(chan struct{}, 1),
+	}
+}
+
+// observe records a cycle's vehicle count. Cycles in which every line failed
+// say nothing about the feed being idle, so they are not counted.
+func (b *idleBackoff) observe(vehicles int, allFailed bool) {
+	if allFailed {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if vehicles > 0 {
+		if b.idleCycles >= b.threshold {
+			log.Printf("Vehicles returned after %d empty cycles, resuming the normal polling interval", b.idleCycles)
+			select {
+			case b.reset <- struct{}{}:
+			default:
+			}
+		}
+		b.idleCycles = 0
+		return
+	}
+
+	b.idleCycles++
+	if b.idleCycles == b.threshold {
+		log.Printf("No vehicles for %d cycles, slowing polling down to at most every %v", b.idleCycles, b.max)
+	}
+}
+
+// interval returns base, lengthened if the feed has been idle
+func (b *idleBackoff) interval(base time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.idleCycles < b.threshold {
+		return base
+	}
+
+	interval := base
+	for i := b.threshold; i <= b.idleCycles && interval < b.max; i++ {
+		interval *= 2
+	}
+	return min(interval, b.max)
+}
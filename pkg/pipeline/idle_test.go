@@ -0,0 +1,102 @@
+package pipeline
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIdleBackoffInterval(t *testing.T) {
+	base, maxInterval := 10*time.Second, 60*time.Second
+	tests := []struct {
+		emptyCycles int
+		want        time.Duration
+	}{
+		{0, base},
+		{2, base},
+		{3, 20 * time.Second},
+		{4, 40 * time.Second},
+		{5, maxInterval},
+		{50, maxInterval},
+	}
+
+	for _, tt := range tests {
+		b := newIdleBackoff(3, maxInterval)
+		for range tt.emptyCycles {
+			b.observe(0, false)
+		}
+		if got := b.interval(base); got != tt.want {
+			t.Errorf("after %d empty cycles interval = %v, want %v", tt.emptyCycles, got, tt.want)
+		}
+	}
+}
+
+func TestIdleBackoffResetsWhenVehiclesReturn(t *testing.T) {
+	b := newIdleBackoff(2, time.Minute)
+	for range 4 {
+		b.observe(0, false)
+	}
+	if got := b.interval(time.Second); got == time.Second {
+		t.Fatalf("interval did not grow after empty cycles")
+	}
+
+	// Failed cycles say nothing about the feed being idle
+	b.observe(5, true)
+	if got := b.interval(time.Second); got == time.Second {
+		t.Fatalf("a failed cycle reset the backoff")
+	}
+
+	b.observe(5, false)
+	if got := b.interval(time.Second); got != time.Second {
+		t.Errorf("interval = %v after vehicles returned, want %v", got, time.Second)
+	}
+	select {
+	case <-b.reset:
+	default:
+		t.Errorf("reset was not signalled when vehicles returned")
+	}
+}
+
+func TestAdaptiveIdleObservesGlobalLinesWithLineIntervals(t *testing.T) {
+	fetcher := &fakeFetcher{vehicles: func(line string) []string {
+		if line == "busy" {
+			return []string{"busy-1"}
+		}
+		return nil
+	}}
+	p, _ := newTestPipeline(t, Config{
+		Interval:           time.Second,
+		LineRefs:           []string{"quiet", "busy"},
+		LineIntervals:      map[string]time.Duration{"busy": time.Minute},
+		AdaptiveIdleMax:    time.Minute,
+		AdaptiveIdleCycles: 2,
+	}, fetcher)
+
+	groups := p.lineGroups()
+	global := groups[0]
+	if !global.adaptive || global.lines[0] != "quiet" {
+		t.Fatalf("first group = %q, want the adaptive global group", global.lines)
+	}
+
+	ctx := context.Background()
+	for range 3 {
+		// A cycle of every line must not let the busy line mask the idle one
+		if err := p.processLines(ctx, p.config.LineRefs); err != nil {
+			t.Fatalf("processLines: %v", err)
+		}
+	}
+	if got := p.idle.interval(global.interval); got <= global.interval {
+		t.Errorf("global group interval = %v after empty cycles, want it lengthened", got)
+	}
+	if got := p.nextInterval(groups[1]); got != time.Minute {
+		t.Errorf("per-line group interval = %v, want its own %v", got, time.Minute)
+	}
+
+	fetcher.vehicles = nil
+	if err := p.processLines(ctx, global.lines); err != nil {
+		t.Fatalf("processLines: %v", err)
+	}
+	if got := p.nextInterval(global); got != global.interval {
+		t.Errorf("global group interval = %v after vehicles returned, want %v", got, global.interval)
+	}
+}
@@ -0,0 +1,47 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+
+	"bods2loki/pkg/types"
+)
+
+// MemorySink keeps every ParsedBusData it receives, for demos and harnesses
+// that want to inspect what the pipeline produced
+type MemorySink struct {
+	mu      sync.Mutex
+	records []*types.ParsedBusData
+}
+
+// NewMemorySink creates an empty MemorySink
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// Send records data
+func (s *MemorySink) Send(ctx context.Context, data *types.ParsedBusData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records = append(s.records, data)
+	return nil
+}
+
+// Records returns a copy of everything received so far, in arrival order
+func (s *MemorySink) Records() []*types.ParsedBusData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make([]*types.ParsedBusData, len(s.records))
+	copy(records, s.records)
+	return records
+}
+
+// Reset discards everything received so far
+func (s *MemorySink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records = nil
+}
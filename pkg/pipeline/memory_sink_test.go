@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"bods2loki/pkg/types"
+)
+
+func TestMemorySinkRecordsCycles(t *testing.T) {
+	fetcher := &fakeFetcher{}
+	p, sink := newTestPipeline(t, Config{LineRefs: []string{"49x", "72"}}, fetcher)
+
+	for cycle := 0; cycle < 3; cycle++ {
+		if err := p.RunCycle(context.Background()); err != nil {
+			t.Fatalf("RunCycle %d: %v", cycle, err)
+		}
+	}
+
+	records := sink.Records()
+	if len(records) != 6 {
+		t.Fatalf("sink holds %d records, want 2 lines × 3 cycles", len(records))
+	}
+	lines := make(map[string]int)
+	for _, record := range records {
+		lines[record.LineRef]++
+		if len(record.VehicleData) != 1 {
+			t.Errorf("line %s record has %d vehicles, want 1", record.LineRef, len(record.VehicleData))
+		}
+	}
+	if lines["49x"] != 3 || lines["72"] != 3 {
+		t.Errorf("records by line = %v, want 3 each", lines)
+	}
+
+	// Records is a copy that callers can't use to change the sink
+	records[0] = nil
+	if sink.Records()[0] == nil {
+		t.Error("changing the returned slice changed the sink")
+	}
+
+	sink.Reset()
+	if got := len(sink.Records()); got != 0 {
+		t.Errorf("sink holds %d records after Reset, want 0", got)
+	}
+}
+
+func TestMemorySinkConcurrentSends(t *testing.T) {
+	sink := NewMemorySink()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sink.Send(context.Background(), &types.ParsedBusData{LineRef: fmt.Sprint(i)})
+			sink.Records()
+		}()
+	}
+	wg.Wait()
+
+	if got := len(sink.Records()); got != 20 {
+		t.Errorf("sink holds %d records, want 20", got)
+	}
+}
@@ -3,12 +3,23 @@ package pipeline
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand/v2"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"time"
 
 	"bods2loki/pkg/bods"
+	"bods2loki/pkg/kafka"
 	"bods2loki/pkg/loki"
+	"bods2loki/pkg/metrics"
+	"bods2loki/pkg/otellogs"
 	"bods2loki/pkg/parser"
 	"bods2loki/pkg/types"
 
@@ -19,12 +30,44 @@ import (
 
 type Pipeline struct {
 	config     Config
-	bodsClient *bods.Client
+	fetcher    Fetcher
 	lokiClient *loki.Client
+	sink       *MultiSink
 	parser     *parser.XMLParser
 	tracer     trace.Tracer
+	redactor   *parser.Redactor
+	sessionID  string
+	positions  *positionStore
+	dedup      *vehicleDeduper
+	situations situationTracker
+	// fetchSlots caps the lines processed at once across all cycles
+	fetchSlots chan struct{}
+	// idle slows polling while no vehicles are returned; nil when disabled
+	idle *idleBackoff
+	// random returns a number in [0, 1) for interval jitter and the startup delay
+	random func() float64
+
+	// cycleMu is held shared by each line group's scheduled cycles, so groups
+	// run independently, and exclusively by full cycles (TriggerCycle,
+	// RunCycle, RunOnce) so those never overlap any other cycle
+	cycleMu sync.RWMutex
 }
 
+// DefaultMinInterval is the shortest polling interval accepted without
+// AllowFastPolling, since aggressive polling risks the API key being banned
+const DefaultMinInterval = 10 * time.Second
+
+// lokiRetryDelay is the initial backoff between Loki push attempts when the
+// response has no Retry-After header
+const lokiRetryDelay = time.Second
+
+// DefaultDrainTimeout is how long a cycle may keep sending after shutdown
+// begins when no drain timeout is configured
+const DefaultDrainTimeout = 5 * time.Second
+
+// DefaultMaxConcurrency bounds simultaneous line fetches when no limit is configured
+const DefaultMaxConcurrency = 8
+
 type Config struct {
 	DryRun       bool
 	APIKey       string
@@ -34,10 +77,184 @@ type Config struct {
 	LokiUser     string
 	LokiPassword string
 	Interval     time.Duration
+	// DumpSampleDir, when set, receives a copy of each line's raw XML per cycle
+	DumpSampleDir string
+	// EmitZeroValues keeps bearing/velocity in entries when the feed reports them as 0
+	EmitZeroValues bool
+	// SplitOutOfOrder sends entries older than a stream's last push to a separate stream
+	SplitOutOfOrder bool
+	// OSGBEastingField/OSGBNorthingField name feed fields holding OSGB36 grid
+	// coordinates to convert to WGS84 when lat/lng are absent
+	OSGBEastingField  string
+	OSGBNorthingField string
+	// ExplainVehicle logs each pipeline stage for the vehicle with this ref
+	ExplainVehicle string
+	// DedupEntries skips Loki entries identical to the previous push for the stream
+	DedupEntries bool
+	// ProxyURL routes BODS and Loki requests through an HTTP(S) proxy
+	ProxyURL string
+	// DelayThresholds controls is_late/delay_bucket; zero uses the parser defaults
+	DelayThresholds parser.DelayThresholds
+	// RedactFields lists identifiers (vehicle_ref, block_ref) to hide before
+	// they reach logs, spans or entries, hashed with RedactKey or a random
+	// per-process key when it is empty. IncludeRaw and DumpSampleDir keep the
+	// raw response and are not redacted.
+	RedactFields []string
+	RedactKey    string
+	// ImageTheme selects the bus image colors ("light" or "dark"); empty means light
+	ImageTheme string
+	// MaxFeedAge treats responses whose ResponseTimestamp is older than this
+	// as failed; zero disables the check
+	MaxFeedAge time.Duration
+	// QualityWeights weights the data_quality signals; zero uses equal weights
+	QualityWeights parser.QualityWeights
+	// DisableMonitoredCall/DisableOnwardCalls skip parsing and emitting those
+	// stop predictions to trim payload size
+	DisableMonitoredCall bool
+	DisableOnwardCalls   bool
+	// NormalizeCallTimes rewrites MonitoredCall times as RFC3339 UTC
+	NormalizeCallTimes bool
+	// IncludeRaw keeps each line's full decoded response in ParsedBusData.RawData
+	IncludeRaw bool
+	// CompactSVG minifies bus image SVG markup to shrink every entry
+	CompactSVG bool
+	// MonitoredOnly drops vehicles the feed reports as Monitored=false
+	MonitoredOnly bool
+	// PositionHistoryTTL enables a shared per-vehicle position history,
+	// forgetting vehicles not seen for this long; zero disables it
+	PositionHistoryTTL time.Duration
+	// PositionHistorySize bounds the number of vehicles kept in the history;
+	// zero uses DefaultPositionHistorySize
+	PositionHistorySize int
+	// RecoverPanics marks a line as failed when processing it panics, instead
+	// of crashing the process
+	RecoverPanics bool
+	// DisableLineRefLabel sends all lines to a single Loki stream, keeping
+	// line_ref only in the log line body
+	DisableLineRefLabel bool
+	// CycleSummary pushes a per-cycle summary entry to a service="summary" Loki stream
+	CycleSummary bool
+	// IntervalJitter varies each polling period by up to this fraction of
+	// Interval either way (e.g. 0.1 for ±10%)
+	IntervalJitter float64
+	// MinInterval is the shortest accepted Interval; zero uses DefaultMinInterval
+	MinInterval time.Duration
+	// AllowFastPolling accepts an Interval below MinInterval
+	AllowFastPolling bool
+	// SessionTag adds a per-process session_id to entries ("field"), and
+	// also as a stream label ("label"); empty disables it
+	SessionTag string
+	// QueueOverlappingCycle runs one extra cycle straight after a slow cycle
+	// instead of skipping the tick that overlapped it
+	QueueOverlappingCycle bool
+	// StripFields lists entry fields to remove from every log line; line_ref
+	// can only be stripped while it is still sent as a stream label
+	StripFields []string
+	// TimestampField renames the timestamp key in each log line; empty keeps "timestamp"
+	TimestampField string
+	// MaxLineBytes trims or drops Loki log lines larger than this; zero disables it
+	MaxLineBytes int
+	// MaxPushBytes splits Loki pushes larger than this into several requests;
+	// zero sends each line's entries in one request
+	MaxPushBytes int
+	// FetchAttempts retries BODS fetches failing with 429, 5xx or network
+	// errors, up to this many attempts in total, backing off exponentially
+	// from FetchRetryDelay; values <= 1 disable retries
+	FetchAttempts   int
+	FetchRetryDelay time.Duration
+	// LokiAttempts retries Loki pushes rejected with 429 (waiting for its
+	// Retry-After), 5xx or network errors, up to this many attempts in
+	// total; values <= 1 disable retries
+	LokiAttempts int
+	// CompressPushes gzips Loki push bodies
+	CompressPushes bool
+	// RecordedAtTimestamps stamps Loki entries with each vehicle's
+	// RecordedAtTime instead of the push time
+	RecordedAtTimestamps bool
+	// BoundingBox ("minLng,minLat,maxLng,maxLat") limits fetches to vehicles
+	// within an area; empty fetches every vehicle on the line
+	BoundingBox string
+	// OperatorRef limits fetches to one operator's vehicles; empty fetches
+	// every operator in the dataset
+	OperatorRef string
+	// BODSHeaders are extra headers sent with every BODS request
+	BODSHeaders map[string]string
+	// LokiTenant sets the X-Scope-OrgID header for multi-tenant Loki
+	LokiTenant string
+	// LokiToken authenticates to Loki with a bearer token instead of LokiUser/LokiPassword
+	LokiToken string
+	// LineIntervals overrides Interval for individual lines. Lines sharing
+	// an interval are polled together; the rest use Interval.
+	LineIntervals map[string]time.Duration
+	// MaxConcurrency caps how many lines are fetched and parsed at once;
+	// zero uses DefaultMaxConcurrency
+	MaxConcurrency int
+	// DedupWindow skips sending a vehicle whose observation is unchanged since
+	// it was last sent less than this long ago; zero disables it
+	DedupWindow time.Duration
+	// EnableSituations also polls the SIRI-SX disruptions feed every Interval,
+	// pushing new or updated situations to the stream="disruptions" Loki stream
+	EnableSituations bool
+	// LokiLabels are added to every Loki stream. They may not replace the
+	// reserved labels (see loki.ReservedLabels) unless AllowReservedLabels is set.
+	LokiLabels          map[string]string
+	AllowReservedLabels bool
+	// DrainTimeout is how long the running cycle may keep sending data it
+	// already fetched after ctx is cancelled; zero uses DefaultDrainTimeout
+	DrainTimeout time.Duration
+	// LocationBounds ("uk" or "minLng,minLat,maxLng,maxLat") marks positions
+	// outside the area as invalid, as well as 0,0 and out-of-range ones
+	LocationBounds string
+	// DropInvalidLocations drops vehicles with invalid positions instead of
+	// flagging them with location_valid=false
+	DropInvalidLocations bool
+	// BODSTimeout and LokiTimeout bound each request to BODS and Loki; zero
+	// uses the clients' 30s default
+	BODSTimeout time.Duration
+	LokiTimeout time.Duration
+	// DryRunFormat is how dry runs print data: DryRunPretty (the default),
+	// DryRunJSONLines or DryRunJSON
+	DryRunFormat string
+	// LokiFormat is the Loki push body format, loki.FormatJSON (the default)
+	// or loki.FormatProtobuf
+	LokiFormat string
+	// BusImageMode selects each vehicle's bus image: "compact", "badge" or
+	// "none"; empty means compact
+	BusImageMode string
+	// GeoJSONOut, when set, is a file each cycle's vehicles are written to
+	// as a GeoJSON FeatureCollection, replacing the previous cycle's
+	GeoJSONOut string
+	// AdaptiveIdleMax, when set, lengthens the polling interval up to this
+	// maximum after AdaptiveIdleCycles consecutive cycles return no vehicles,
+	// resetting as soon as vehicles reappear. It doesn't apply to lines with
+	// their own interval.
+	AdaptiveIdleMax time.Duration
+	// AdaptiveIdleCycles is the number of empty cycles before slowing down;
+	// zero means DefaultAdaptiveIdleCycles
+	AdaptiveIdleCycles int
+	// CycleTimeout bounds all the fetching, parsing and sending of a cycle;
+	// zero means twice the polling interval of the cycle's lines
+	CycleTimeout time.Duration
+	// MaxResponseBytes fails fetches whose response body is larger; zero
+	// means bods.DefaultMaxResponseBytes
+	MaxResponseBytes int64
+	// KafkaBrokers, when set, also publishes each vehicle entry to
+	// KafkaTopic, keyed by vehicle ref. Dry runs don't publish.
+	KafkaBrokers []string
+	KafkaTopic   string
+	// OTelLogs also emits each vehicle as an OpenTelemetry log record through
+	// the OTLP logs exporter, configured by the OTEL_EXPORTER_OTLP_* variables.
+	// Dry runs don't emit.
+	OTelLogs bool
 }
 
-func New(config Config) (*Pipeline, error) {
-	if config.APIKey == "" {
+func New(config Config, opts ...Option) (*Pipeline, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if config.APIKey == "" && o.fetcher == nil {
 		return nil, fmt.Errorf("API key is required")
 	}
 
@@ -45,137 +262,978 @@ func New(config Config) (*Pipeline, error) {
 		return nil, fmt.Errorf("at least one line reference is required")
 	}
 
+	minInterval := config.MinInterval
+	if minInterval == 0 {
+		minInterval = DefaultMinInterval
+	}
+	if config.Interval < minInterval && !config.AllowFastPolling {
+		return nil, fmt.Errorf("interval %v is below the minimum of %v; set allow-fast-polling to override", config.Interval, minInterval)
+	}
+	for line, interval := range config.LineIntervals {
+		if interval < minInterval && !config.AllowFastPolling {
+			return nil, fmt.Errorf("interval %v for line %s is below the minimum of %v; set allow-fast-polling to override", interval, line, minInterval)
+		}
+	}
+
+	if config.IntervalJitter < 0 || config.IntervalJitter >= 1 {
+		return nil, fmt.Errorf("interval jitter must be between 0 and 1, got %v", config.IntervalJitter)
+	}
+
+	if err := loki.ValidateLabels(config.LokiLabels, config.AllowReservedLabels); err != nil {
+		return nil, fmt.Errorf("invalid Loki labels: %w", err)
+	}
+
+	if config.DrainTimeout < 0 {
+		return nil, fmt.Errorf("drain timeout must not be negative, got %v", config.DrainTimeout)
+	}
+	if config.DrainTimeout == 0 {
+		config.DrainTimeout = DefaultDrainTimeout
+	}
+
+	switch config.DryRunFormat {
+	case "":
+		config.DryRunFormat = DryRunPretty
+	case DryRunPretty, DryRunJSONLines, DryRunJSON:
+	default:
+		return nil, fmt.Errorf("unknown dry run format %q: expected %s, %s or %s", config.DryRunFormat, DryRunPretty, DryRunJSONLines, DryRunJSON)
+	}
+
+	switch config.LokiFormat {
+	case "", loki.FormatJSON, loki.FormatProtobuf:
+	default:
+		return nil, fmt.Errorf("unknown Loki format %q: expected %s or %s", config.LokiFormat, loki.FormatJSON, loki.FormatProtobuf)
+	}
+
+	if config.CycleTimeout < 0 {
+		return nil, fmt.Errorf("cycle timeout must not be negative, got %v", config.CycleTimeout)
+	}
+
+	if config.AdaptiveIdleMax < 0 || config.AdaptiveIdleCycles < 0 {
+		return nil, fmt.Errorf("adaptive idle maximum and cycles must not be negative")
+	}
+	if config.AdaptiveIdleCycles == 0 {
+		config.AdaptiveIdleCycles = DefaultAdaptiveIdleCycles
+	}
+
+	if config.MaxConcurrency < 0 {
+		return nil, fmt.Errorf("max concurrency must not be negative, got %d", config.MaxConcurrency)
+	}
+	if config.MaxConcurrency == 0 {
+		config.MaxConcurrency = DefaultMaxConcurrency
+	}
+
+	if config.DumpSampleDir != "" {
+		if err := os.MkdirAll(config.DumpSampleDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create dump sample directory: %w", err)
+		}
+	}
+
+	var bodsOpts []bods.Option
+	var lokiOpts []loki.Option
+	if config.ProxyURL != "" {
+		proxyURL, err := url.Parse(config.ProxyURL)
+		if err != nil || proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", config.ProxyURL)
+		}
+		bodsOpts = append(bodsOpts, bods.WithProxy(proxyURL))
+		lokiOpts = append(lokiOpts, loki.WithProxy(proxyURL))
+	}
+
+	if config.BoundingBox != "" {
+		box, err := bods.ParseBoundingBox(config.BoundingBox)
+		if err != nil {
+			return nil, err
+		}
+		bodsOpts = append(bodsOpts, bods.WithBoundingBox(box))
+	}
+
+	if config.MaxResponseBytes < 0 {
+		return nil, fmt.Errorf("max response bytes must not be negative, got %d", config.MaxResponseBytes)
+	}
+	if config.MaxResponseBytes > 0 {
+		bodsOpts = append(bodsOpts, bods.WithMaxResponseBytes(config.MaxResponseBytes))
+	}
+
+	if len(config.BODSHeaders) > 0 {
+		bodsOpts = append(bodsOpts, bods.WithHeaders(config.BODSHeaders))
+	}
+
+	if config.OperatorRef != "" {
+		bodsOpts = append(bodsOpts, bods.WithOperatorRef(config.OperatorRef))
+	}
+
+	if config.BODSTimeout > 0 {
+		bodsOpts = append(bodsOpts, bods.WithTimeout(config.BODSTimeout))
+	}
+	if config.LokiTimeout > 0 {
+		lokiOpts = append(lokiOpts, loki.WithTimeout(config.LokiTimeout))
+	}
+
+	if config.FetchAttempts > 1 {
+		bodsOpts = append(bodsOpts, bods.WithRetry(config.FetchAttempts, config.FetchRetryDelay))
+	}
+
+	var parserOpts []parser.Option
+	if config.OSGBEastingField != "" && config.OSGBNorthingField != "" {
+		parserOpts = append(parserOpts, parser.WithOSGBFields(config.OSGBEastingField, config.OSGBNorthingField))
+	}
+
+	if config.DelayThresholds != (parser.DelayThresholds{}) {
+		parserOpts = append(parserOpts, parser.WithDelayThresholds(config.DelayThresholds))
+	}
+
+	if config.ImageTheme != "" {
+		theme, err := parser.ImageThemeByName(config.ImageTheme)
+		if err != nil {
+			return nil, err
+		}
+		parserOpts = append(parserOpts, parser.WithImageTheme(theme))
+	}
+
+	if config.BusImageMode != "" {
+		mode, err := parser.ImageModeByName(config.BusImageMode)
+		if err != nil {
+			return nil, err
+		}
+		parserOpts = append(parserOpts, parser.WithImageMode(mode))
+	}
+
+	if config.MaxFeedAge > 0 {
+		parserOpts = append(parserOpts, parser.WithMaxFeedAge(config.MaxFeedAge))
+	}
+
+	if config.QualityWeights != (parser.QualityWeights{}) {
+		parserOpts = append(parserOpts, parser.WithQualityWeights(config.QualityWeights))
+	}
+
+	if config.DisableMonitoredCall {
+		parserOpts = append(parserOpts, parser.WithoutMonitoredCall())
+	}
+	if config.DisableOnwardCalls {
+		parserOpts = append(parserOpts, parser.WithoutOnwardCalls())
+	}
+
+	if config.NormalizeCallTimes {
+		parserOpts = append(parserOpts, parser.WithCallTimeNormalization(true))
+	}
+
+	if config.IncludeRaw {
+		parserOpts = append(parserOpts, parser.WithRawData(true))
+	}
+
+	if config.CompactSVG {
+		parserOpts = append(parserOpts, parser.WithCompactSVG(true))
+	}
+
+	if config.MonitoredOnly {
+		parserOpts = append(parserOpts, parser.WithMonitoredOnly(true))
+	}
+
+	switch config.LocationBounds {
+	case "":
+	case "uk":
+		parserOpts = append(parserOpts, parser.WithLocationBounds(parser.UKBoundingBox))
+	default:
+		box, err := bods.ParseBoundingBox(config.LocationBounds)
+		if err != nil {
+			return nil, fmt.Errorf("invalid location bounds: %w", err)
+		}
+		parserOpts = append(parserOpts, parser.WithLocationBounds(box))
+	}
+	if config.DropInvalidLocations {
+		parserOpts = append(parserOpts, parser.WithDropInvalidLocations(true))
+	}
+
+	for _, field := range config.StripFields {
+		if field == "line_ref" && config.DisableLineRefLabel {
+			return nil, fmt.Errorf("cannot strip line_ref while line_ref is not a stream label")
+		}
+	}
+
+	var sessionID string
+	switch config.SessionTag {
+	case "":
+	case SessionTagField, SessionTagLabel:
+		id, err := newSessionID()
+		if err != nil {
+			return nil, err
+		}
+		sessionID = id
+	default:
+		return nil, fmt.Errorf("invalid session tag %q: expected %q or %q", config.SessionTag, SessionTagField, SessionTagLabel)
+	}
+
+	var redactor *parser.Redactor
+	if len(config.RedactFields) > 0 {
+		r, err := parser.NewRedactor(config.RedactFields, config.RedactKey)
+		if err != nil {
+			return nil, err
+		}
+		redactor = r
+		parserOpts = append(parserOpts, parser.WithRedactor(redactor))
+
+		// Raw responses are kept verbatim for debugging, identifiers included
+		if config.IncludeRaw {
+			log.Printf("Warning: --include-raw keeps unredacted identifiers in RawData")
+		}
+		if config.DumpSampleDir != "" {
+			log.Printf("Warning: --dump-sample writes unredacted identifiers to %s", config.DumpSampleDir)
+		}
+	}
+
 	pipeline := &Pipeline{
 		config:     config,
-		bodsClient: bods.NewClient(config.APIKey, config.DatasetID),
-		parser:     parser.NewXMLParser(),
+		fetcher:    o.fetcher,
+		parser:     parser.NewXMLParser(parserOpts...),
 		tracer:     otel.Tracer("pipeline"),
+		redactor:   redactor,
+		sessionID:  sessionID,
+		fetchSlots: make(chan struct{}, config.MaxConcurrency),
+		random:     rand.Float64,
+	}
+
+	if pipeline.fetcher == nil {
+		pipeline.fetcher = bods.NewClient(config.APIKey, config.DatasetID, bodsOpts...)
+	}
+
+	// Only create Loki client if not in dry run mode or using custom sinks
+	if !config.DryRun && len(o.sinks) == 0 {
+		lokiOpts = append(lokiOpts,
+			loki.WithEntryOptions(pipeline.entryOptions()),
+			loki.WithOutOfOrderSplit(config.SplitOutOfOrder),
+			loki.WithEntryDedup(config.DedupEntries),
+			loki.WithLineRefLabel(!config.DisableLineRefLabel),
+			loki.WithMaxLineBytes(config.MaxLineBytes),
+			loki.WithMaxPushBytes(config.MaxPushBytes),
+			loki.WithCompression(config.CompressPushes),
+			loki.WithFormat(config.LokiFormat),
+			loki.WithRecordedAtTimestamps(config.RecordedAtTimestamps),
+			loki.WithTenant(config.LokiTenant),
+			loki.WithBearerToken(config.LokiToken),
+			loki.WithLabels(config.LokiLabels),
+			loki.WithReservedLabelOverride(config.AllowReservedLabels),
+		)
+		if config.LokiAttempts > 1 {
+			lokiOpts = append(lokiOpts, loki.WithRetry(config.LokiAttempts, lokiRetryDelay))
+		}
+		if config.SessionTag == SessionTagLabel {
+			lokiOpts = append(lokiOpts, loki.WithLabel("session_id", sessionID))
+		}
+		pipeline.lokiClient = loki.NewClient(config.LokiURL, config.LokiUser, config.LokiPassword, lokiOpts...)
+	}
+
+	if config.PositionHistoryTTL > 0 {
+		pipeline.positions = newPositionStore(config.PositionHistoryTTL, config.PositionHistorySize)
 	}
 
-	// Only create Loki client if not in dry run mode
-	if !config.DryRun {
-		pipeline.lokiClient = loki.NewClient(config.LokiURL, config.LokiUser, config.LokiPassword)
+	if config.AdaptiveIdleMax > config.Interval {
+		pipeline.idle = newIdleBackoff(config.AdaptiveIdleCycles, config.AdaptiveIdleMax)
+	}
+
+	if config.DedupWindow > 0 {
+		pipeline.dedup = newVehicleDeduper(config.DedupWindow)
+	}
+
+	// Dry run prints instead of sending to Loki
+	pipeline.sink = NewMultiSink()
+	switch {
+	case len(o.sinks) > 0:
+		for i, sink := range o.sinks {
+			pipeline.sink.Add(o.sinkNames[i], sink)
+		}
+	case config.DryRun:
+		pipeline.sink.Add("stdout", dryRunSink{pipeline})
+	default:
+		pipeline.sink.Add("loki", lokiSink{pipeline})
+	}
+	if len(config.KafkaBrokers) > 0 && !config.DryRun {
+		if config.KafkaTopic == "" {
+			return nil, fmt.Errorf("a Kafka topic is required with Kafka brokers")
+		}
+		pipeline.sink.Add("kafka", kafka.NewClient(config.KafkaBrokers, config.KafkaTopic,
+			kafka.WithEntryOptions(pipeline.entryOptions()),
+		))
+	}
+	if config.OTelLogs && !config.DryRun {
+		logsClient, err := otellogs.NewClient(otellogs.WithEntryOptions(pipeline.entryOptions()))
+		if err != nil {
+			return nil, err
+		}
+		pipeline.sink.Add("otel-logs", logsClient)
+	}
+	if config.GeoJSONOut != "" {
+		pipeline.sink.Add("geojson", geojsonSink{path: config.GeoJSONOut})
 	}
 
 	return pipeline, nil
 }
 
-func (p *Pipeline) Run(ctx context.Context) error {
-	ticker := time.NewTicker(p.config.Interval)
-	defer ticker.Stop()
+// AddSink sends each cycle's data to an additional sink alongside Loki (or
+// stdout in dry run mode). It must be called before Run.
+func (p *Pipeline) AddSink(name string, sink Sink) {
+	p.sink.Add(name, sink)
+}
+
+// Close flushes and closes the sinks that hold buffers or connections, such
+// as the Kafka producer. Call it once Run or RunCycle has returned.
+func (p *Pipeline) Close() error {
+	return p.sink.Close()
+}
+
+// SelfCheck verifies the configured parser and image generator work on an
+// embedded sample before the pipeline starts polling
+func (p *Pipeline) SelfCheck(ctx context.Context) error {
+	return p.parser.SelfCheck(ctx)
+}
 
-	log.Printf("Pipeline started - polling every %v", p.config.Interval)
+// CheckDataset fetches the dataset metadata, logging a summary of its
+// coverage and warning about configured lines it doesn't list. It fails if
+// the metadata can't be fetched, e.g. because the dataset ID is wrong, and is
+// a no-op when a custom Fetcher doesn't provide metadata.
+func (p *Pipeline) CheckDataset(ctx context.Context) error {
+	infoFetcher, ok := p.fetcher.(interface {
+		FetchDatasetInfo(ctx context.Context) (*bods.DatasetInfo, error)
+	})
+	if !ok {
+		return nil
+	}
 
-	// Process immediately on start
-	if err := p.processOnce(ctx); err != nil {
-		log.Printf("Error in initial processing: %v", err)
+	info, err := infoFetcher.FetchDatasetInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("dataset %s: %w", p.config.DatasetID, err)
 	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Pipeline stopped")
-			return ctx.Err()
-		case <-ticker.C:
-			if err := p.processOnce(ctx); err != nil {
-				log.Printf("Error processing: %v", err)
+	log.Printf("Dataset %d %q (%s): status %s, last modified %s, %d lines",
+		info.ID, info.Name, info.OperatorName, info.Status, info.LastModified, len(info.Lines))
+	if len(info.BoundingBox) == 4 {
+		log.Printf("Dataset bounding box: %v", info.BoundingBox)
+	}
+
+	if len(info.Lines) > 0 {
+		covered := make(map[string]bool, len(info.Lines))
+		for _, line := range info.Lines {
+			covered[line] = true
+		}
+		for _, line := range p.config.LineRefs {
+			if !covered[line] {
+				log.Printf("Warning: line %s is not listed in dataset %s", line, p.config.DatasetID)
 			}
 		}
 	}
+
+	return nil
+}
+
+// VehicleHistory returns the recent positions of a vehicle, oldest first, or
+// nil if the position history is disabled or the vehicle hasn't been seen
+func (p *Pipeline) VehicleHistory(vehicleRef string) []VehiclePosition {
+	if p.positions == nil {
+		return nil
+	}
+	return p.positions.history(vehicleRef)
+}
+
+// entryOptions derives the log entry format from the pipeline configuration
+func (p *Pipeline) entryOptions() loki.EntryOptions {
+	return loki.EntryOptions{
+		EmitZeroValues: p.config.EmitZeroValues,
+		SessionID:      p.sessionID,
+		StripFields:    p.config.StripFields,
+		TimestampField: p.config.TimestampField,
+	}
+}
+
+// SessionID returns the ID generated for this process, or "" when session tagging is disabled
+func (p *Pipeline) SessionID() string {
+	return p.sessionID
+}
+
+func (p *Pipeline) Run(ctx context.Context) error {
+	// Spread the first cycle of replicas started together
+	if !p.waitStartupDelay(ctx) {
+		log.Println("Pipeline stopped")
+		return ctx.Err()
+	}
+
+	groups := p.lineGroups()
+	for _, group := range groups {
+		switch {
+		case len(groups) > 1:
+			log.Printf("Pipeline started - polling %v every %v", group.lines, group.interval)
+		case p.config.IntervalJitter > 0:
+			log.Printf("Pipeline started - polling every %v ±%.0f%%", group.interval, p.config.IntervalJitter*100)
+		default:
+			log.Printf("Pipeline started - polling every %v", group.interval)
+		}
+	}
+
+	// Wait for in-flight cycles before returning so shutdown doesn't cut them off
+	var cycles sync.WaitGroup
+	defer cycles.Wait()
+
+	var schedules sync.WaitGroup
+	for _, group := range groups {
+		schedules.Add(1)
+		go func() {
+			defer schedules.Done()
+			p.runLineGroup(ctx, group, &cycles)
+		}()
+	}
+
+	// The situations feed covers every line, so it has a schedule of its own
+	// rather than being fetched by each line group
+	if p.config.EnableSituations {
+		schedules.Add(1)
+		go func() {
+			defer schedules.Done()
+			p.runSituations(ctx)
+		}()
+	}
+
+	schedules.Wait()
+	log.Println("Pipeline stopped")
+	return ctx.Err()
+}
+
+// idleReset returns the channel signalled when idle polling of group ends,
+// or nil (which never receives) when the idle backoff doesn't apply to it
+func (p *Pipeline) idleReset(group *lineGroup) <-chan struct{} {
+	if p.idle == nil || !group.adaptive {
+		return nil
+	}
+	return p.idle.reset
 }
 
+// nextInterval returns group's polling interval with jitter applied, so
+// replicas started together drift apart instead of hitting BODS in lockstep
+func (p *Pipeline) nextInterval(group *lineGroup) time.Duration {
+	if p.idle != nil && group.adaptive {
+		return p.jitter(p.idle.interval(group.interval))
+	}
+	return p.jitter(group.interval)
+}
+
+// jitter varies interval by up to IntervalJitter either way
+func (p *Pipeline) jitter(interval time.Duration) time.Duration {
+	if p.config.IntervalJitter <= 0 {
+		return interval
+	}
+
+	factor := 1 + (p.random()*2-1)*p.config.IntervalJitter
+	return max(time.Duration(float64(interval)*factor), minJitteredInterval)
+}
+
+// minJitteredInterval stops jitter ever producing a zero or negative wait
+const minJitteredInterval = time.Millisecond
+
+// waitStartupDelay waits a random fraction of IntervalJitter × Interval before
+// the first cycle. It returns false if ctx is done first.
+func (p *Pipeline) waitStartupDelay(ctx context.Context) bool {
+	if p.config.IntervalJitter <= 0 {
+		return true
+	}
+
+	delay := time.Duration(p.random() * p.config.IntervalJitter * float64(p.config.Interval))
+	log.Printf("Delaying first cycle by %v", delay.Round(time.Millisecond))
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// scheduleCycle starts a cycle for group in the background unless one of
+// group's cycles, or a full cycle, is already running, so slow BODS or Loki
+// responses can't make a group's cycles pile up. Other groups keep their own
+// schedule. An overlapping tick is skipped, or queued to run next if
+// QueueOverlappingCycle is set and nothing is queued for group yet.
+func (p *Pipeline) scheduleCycle(ctx context.Context, cycles *sync.WaitGroup, group *lineGroup) {
+	if !p.tryStartGroupCycle(group) {
+		if p.config.QueueOverlappingCycle && group.queued.CompareAndSwap(false, true) {
+			log.Printf("Previous cycle of %v still running, queueing the next cycle", group.lines)
+			cycles.Add(1)
+			go func() {
+				defer cycles.Done()
+				group.running.Lock()
+				defer group.running.Unlock()
+				p.cycleMu.RLock()
+				defer p.cycleMu.RUnlock()
+
+				// A cycle started since may already have satisfied the queued tick
+				if ctx.Err() == nil && group.queued.CompareAndSwap(true, false) {
+					p.runGroupCycle(ctx, group)
+				}
+			}()
+			return
+		}
+
+		log.Printf("Previous cycle of %v still running, skipping this tick", group.lines)
+		metrics.RecordCycleSkipped(ctx)
+		return
+	}
+
+	cycles.Add(1)
+	go func() {
+		defer cycles.Done()
+		defer group.running.Unlock()
+		defer p.cycleMu.RUnlock()
+
+		// This cycle satisfies any tick queued before it started
+		group.queued.Store(false)
+		p.runGroupCycle(ctx, group)
+	}()
+}
+
+// tryStartGroupCycle takes group's guard and a shared hold on cycleMu,
+// returning false if group or a full cycle is already running. The group
+// guard is always taken first, so the queued path can't deadlock with it.
+func (p *Pipeline) tryStartGroupCycle(group *lineGroup) bool {
+	if !group.running.TryLock() {
+		return false
+	}
+	if !p.cycleMu.TryRLock() {
+		group.running.Unlock()
+		return false
+	}
+	return true
+}
+
+func (p *Pipeline) runGroupCycle(ctx context.Context, group *lineGroup) {
+	if err := p.processLines(ctx, group.lines); err != nil {
+		log.Printf("Error processing: %v", err)
+	}
+}
+
+// ErrCycleInProgress is returned by TriggerCycle when a cycle is already running
+var ErrCycleInProgress = errors.New("a processing cycle is already running")
+
+// TriggerCycle runs one cycle immediately, outside the polling schedule.
+// It returns ErrCycleInProgress rather than overlapping a running cycle.
+func (p *Pipeline) TriggerCycle(ctx context.Context) error {
+	if !p.cycleMu.TryLock() {
+		return ErrCycleInProgress
+	}
+	defer p.cycleMu.Unlock()
+
+	log.Println("Running on-demand processing cycle")
+	return p.processOnce(ctx)
+}
+
+// RunCycle runs one full fetch, parse and send cycle, waiting for any running
+// cycle to finish first, for deployments that run the pipeline on a schedule
+// of their own. Like Run's cycles, it fails only if every line failed.
+func (p *Pipeline) RunCycle(ctx context.Context) error {
+	p.cycleMu.Lock()
+	defer p.cycleMu.Unlock()
+
+	return p.processOnce(ctx)
+}
+
+// ProcessOnceResult is the structured outcome of fetching and parsing every
+// configured line in one cycle
+type ProcessOnceResult struct {
+	// Lines holds one result per configured line, in configuration order
+	Lines    []LineResult
+	Started  time.Time
+	Duration time.Duration
+}
+
+// LineResult is the outcome of fetching and parsing a single line
+type LineResult struct {
+	LineRef string
+	// Data is nil when Err is set
+	Data          *types.ParsedBusData
+	Err           error
+	FetchDuration time.Duration
+	ParseDuration time.Duration
+}
+
+// Vehicles returns the total number of vehicles parsed across all lines
+func (r *ProcessOnceResult) Vehicles() int {
+	total := 0
+	for _, line := range r.Lines {
+		if line.Data != nil {
+			total += len(line.Data.VehicleData)
+		}
+	}
+	return total
+}
+
+// Errors returns the errors of all lines that failed
+func (r *ProcessOnceResult) Errors() []error {
+	var errs []error
+	for _, line := range r.Lines {
+		if line.Err != nil {
+			errs = append(errs, line.Err)
+		}
+	}
+	return errs
+}
+
+// RunOnce fetches and parses every configured line once and returns the
+// results without sending them to Loki or printing them, for embedding the
+// pipeline as a library. It waits for any running cycle to finish first.
+func (p *Pipeline) RunOnce(ctx context.Context) (*ProcessOnceResult, error) {
+	p.cycleMu.Lock()
+	defer p.cycleMu.Unlock()
+
+	result := p.collect(ctx, p.config.LineRefs)
+	if errs := result.Errors(); len(errs) == len(result.Lines) {
+		return result, fmt.Errorf("all lines failed: %w", errors.Join(errs...))
+	}
+
+	return result, nil
+}
+
+// processOnce runs one cycle of every line, along with the situations feed
+// that Run otherwise polls on its own schedule
 func (p *Pipeline) processOnce(ctx context.Context) error {
+	err := p.processLines(ctx, p.config.LineRefs)
+	p.pollSituations(ctx)
+	return err
+}
+
+// processLines runs one cycle for the given lines
+func (p *Pipeline) processLines(ctx context.Context, lines []string) error {
 	ctx, span := p.tracer.Start(ctx, "pipeline.process_once",
 		trace.WithAttributes(
-			attribute.StringSlice("line_refs", p.config.LineRefs),
+			attribute.StringSlice("line_refs", lines),
 			attribute.Bool("dry_run", p.config.DryRun),
-			attribute.Int("lines_count", len(p.config.LineRefs)),
+			attribute.Int("lines_count", len(lines)),
 		),
 	)
 	defer span.End()
 
-	start := time.Now()
+	// Bound the whole cycle so a slow line can't hold it past the next ones
+	cycleCtx, cancelCycle := p.cycleContext(ctx, lines)
+	defer cancelCycle()
+
+	result := p.collect(cycleCtx, lines)
 
-	// Process all lines concurrently
-	type lineResult struct {
-		lineRef string
-		data    *types.ParsedBusData
-		err     error
+	// Collect results
+	var allData []*types.ParsedBusData
+	var lineErrors []error
+
+	for _, line := range result.Lines {
+		var lineErr *LineError
+		if errors.As(line.Err, &lineErr) && context.Cause(cycleCtx) == errCycleTimeout && errors.Is(lineErr, context.DeadlineExceeded) {
+			metrics.RecordFeedError(ctx, line.LineRef, "cycle_timeout")
+			lineErr.Stage = StageTimeout
+		}
+		if line.Err != nil {
+			lineErrors = append(lineErrors, line.Err)
+			log.Printf("Error processing line %s: %v", line.LineRef, line.Err)
+		} else {
+			allData = append(allData, line.Data)
+		}
 	}
 
-	results := make(chan lineResult, len(p.config.LineRefs))
+	if p.idle != nil {
+		p.observeIdle(result)
+	}
 
-	// Start concurrent fetching for each line
-	for _, lineRef := range p.config.LineRefs {
-		go func(line string) {
-			lineCtx, lineSpan := p.tracer.Start(ctx, "pipeline.process_line",
-				trace.WithAttributes(attribute.String("line_ref", line)),
-			)
-			defer lineSpan.End()
+	span.SetAttributes(
+		attribute.Int("total_vehicles_processed", result.Vehicles()),
+		attribute.Int("successful_lines", len(allData)),
+		attribute.Int("failed_lines", len(lineErrors)),
+		attribute.String("processing_duration", result.Duration.String()),
+	)
 
-			// Fetch data from BODS API
-			busData, err := p.bodsClient.FetchBusData(lineCtx, line)
-			if err != nil {
-				lineSpan.RecordError(err)
-				results <- lineResult{lineRef: line, err: fmt.Errorf("failed to fetch bus data for line %s: %w", line, err)}
-				return
-			}
+	// Deliver what was fetched even if shutdown begins during the cycle, but
+	// still within the cycle timeout
+	sendCtx, cancelDrain := p.drainContext(ctx)
+	defer cancelDrain()
+	if deadline, ok := cycleCtx.Deadline(); ok {
+		var cancelSend context.CancelFunc
+		sendCtx, cancelSend = context.WithDeadline(sendCtx, deadline)
+		defer cancelSend()
+	}
 
-			// Parse XML to JSON
-			parsedData, err := p.parser.ParseBusData(lineCtx, busData)
-			if err != nil {
-				lineSpan.RecordError(err)
-				results <- lineResult{lineRef: line, err: fmt.Errorf("failed to parse bus data for line %s: %w", line, err)}
-				return
+	sendData := allData
+	if p.dedup != nil {
+		sendData = p.dedupVehicles(sendCtx, allData)
+	}
+
+	// Send successful results to every sink, batching them where supported
+	sendErrors := 0
+	if len(sendData) > 0 {
+		sendDone := metrics.TrackLineStage(sendCtx, "send", len(sendData))
+		err := p.sink.SendBatch(sendCtx, sendData)
+		sendDone()
+		if err != nil {
+			// A failed batch can't be attributed to individual lines
+			sendErrors = len(sendData)
+			log.Printf("Error sending data for %d lines: %v", len(sendData), err)
+		} else if p.dedup != nil {
+			for _, data := range sendData {
+				p.dedup.remember(data)
 			}
+		}
+		for _, data := range sendData {
+			p.explainSend(data, p.sink.String(), err)
+		}
+	}
 
-			lineSpan.SetAttributes(
-				attribute.Int("vehicles_processed", len(parsedData.VehicleData)),
-			)
+	p.sendCycleSummary(sendCtx, result, sendErrors)
 
-			results <- lineResult{lineRef: line, data: parsedData, err: nil}
-		}(lineRef)
+	// Return error only if all lines failed
+	if len(lineErrors) == len(lines) {
+		return fmt.Errorf("all lines failed: %w", errors.Join(lineErrors...))
 	}
 
-	// Collect results
-	var allData []*types.ParsedBusData
-	var errors []error
-	totalVehicles := 0
-
-	for i := 0; i < len(p.config.LineRefs); i++ {
-		result := <-results
-		if result.err != nil {
-			errors = append(errors, result.err)
-			log.Printf("Error processing line %s: %v", result.lineRef, result.err)
-		} else {
-			allData = append(allData, result.data)
-			totalVehicles += len(result.data.VehicleData)
+	return nil
+}
+
+// observeIdle feeds the adaptive idle backoff the outcome of the lines in
+// result polled on the global Interval; lines with their own interval don't
+// count towards it
+func (p *Pipeline) observeIdle(result *ProcessOnceResult) {
+	lines, failed, vehicles := 0, 0, 0
+	for _, line := range result.Lines {
+		if p.lineInterval(line.LineRef) != p.config.Interval {
+			continue
+		}
+		lines++
+		if line.Err != nil {
+			failed++
+		} else if line.Data != nil {
+			vehicles += len(line.Data.VehicleData)
 		}
 	}
 
-	span.SetAttributes(
-		attribute.Int("total_vehicles_processed", totalVehicles),
-		attribute.Int("successful_lines", len(allData)),
-		attribute.Int("failed_lines", len(errors)),
-		attribute.String("processing_duration", time.Since(start).String()),
-	)
+	if lines > 0 {
+		p.idle.observe(vehicles, failed == lines)
+	}
+}
+
+// errCycleTimeout is the cause of a cycle context exceeding CycleTimeout
+var errCycleTimeout = errors.New("cycle timeout exceeded")
 
-	// Process successful results
+// cycleContext returns a context for one cycle of lines that expires after
+// CycleTimeout, or twice the longest of their intervals when it isn't set
+func (p *Pipeline) cycleContext(ctx context.Context, lines []string) (context.Context, context.CancelFunc) {
+	return context.WithTimeoutCause(ctx, p.cycleTimeout(lines), errCycleTimeout)
+}
+
+func (p *Pipeline) cycleTimeout(lines []string) time.Duration {
+	if p.config.CycleTimeout > 0 {
+		return p.config.CycleTimeout
+	}
+
+	var interval time.Duration
+	for _, line := range lines {
+		interval = max(interval, p.lineInterval(line))
+	}
+	return 2 * interval
+}
+
+// drainContext returns a context for sending a cycle's data that is not
+// cancelled with ctx, but expires DrainTimeout after ctx is done
+func (p *Pipeline) drainContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	drainCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		log.Printf("Shutting down, allowing up to %v to send data already fetched", p.config.DrainTimeout)
+		time.AfterFunc(p.config.DrainTimeout, cancel)
+	})
+
+	return drainCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// dedupVehicles drops vehicles unchanged since they were last sent, and lines
+// left with no vehicles to send
+func (p *Pipeline) dedupVehicles(ctx context.Context, allData []*types.ParsedBusData) []*types.ParsedBusData {
+	var sendData []*types.ParsedBusData
 	for _, data := range allData {
-		if p.config.DryRun {
-			if err := p.handleDryRun(ctx, data); err != nil {
-				log.Printf("Error in dry run for line %s: %v", data.LineRef, err)
+		filtered, skipped := p.dedup.filter(data)
+		if skipped > 0 {
+			metrics.RecordVehiclesDeduplicated(ctx, data.LineRef, skipped)
+		}
+		if len(filtered.VehicleData) > 0 || len(data.VehicleData) == 0 {
+			sendData = append(sendData, filtered)
+		}
+	}
+	return sendData
+}
+
+// collect fetches and parses all lines concurrently
+func (p *Pipeline) collect(ctx context.Context, lines []string) *ProcessOnceResult {
+	result := &ProcessOnceResult{
+		Lines:   make([]LineResult, len(lines)),
+		Started: time.Now(),
+	}
+
+	var wg sync.WaitGroup
+	for i, lineRef := range lines {
+		wg.Add(1)
+		go func(i int, line string) {
+			defer wg.Done()
+			if err := p.acquireFetchSlot(ctx); err != nil {
+				result.Lines[i] = LineResult{LineRef: line, Err: &LineError{LineRef: line, Stage: StageFetch, Err: err}}
+				return
 			}
-		} else {
-			if err := p.sendToLoki(ctx, data); err != nil {
-				log.Printf("Error sending to Loki for line %s: %v", data.LineRef, err)
+			defer p.releaseFetchSlot()
+
+			if p.config.RecoverPanics {
+				defer p.recoverLinePanic(ctx, line, &result.Lines[i])
 			}
+			result.Lines[i] = p.processLine(ctx, line)
+		}(i, lineRef)
+	}
+	wg.Wait()
+
+	result.Duration = time.Since(result.Started)
+	return result
+}
+
+// acquireFetchSlot waits until fewer than MaxConcurrency lines are being
+// processed, counting the line as queued meanwhile
+func (p *Pipeline) acquireFetchSlot(ctx context.Context) error {
+	select {
+	case p.fetchSlots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	queuedDone := metrics.TrackLineStage(ctx, "queued", 1)
+	defer queuedDone()
+	select {
+	case p.fetchSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pipeline) releaseFetchSlot() {
+	<-p.fetchSlots
+}
+
+// recoverLinePanic turns a panic while processing a line into a failure of
+// that line alone, so the other lines and the process keep running
+func (p *Pipeline) recoverLinePanic(ctx context.Context, line string, result *LineResult) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	log.Printf("Recovered from panic processing line %s: %v\n%s", line, r, debug.Stack())
+	metrics.RecordPanic(ctx, line)
+	*result = LineResult{
+		LineRef: line,
+		Err:     &LineError{LineRef: line, Stage: StagePanic, Err: fmt.Errorf("%v", r)},
+	}
+}
+
+// processLine fetches and parses a single line
+func (p *Pipeline) processLine(ctx context.Context, line string) LineResult {
+	lineCtx, lineSpan := p.tracer.Start(ctx, "pipeline.process_line",
+		trace.WithAttributes(attribute.String("line_ref", line)),
+	)
+	defer lineSpan.End()
+
+	result := LineResult{LineRef: line}
+
+	// Fetch data from BODS API
+	fetchStart := time.Now()
+	fetchDone := metrics.TrackLineStage(lineCtx, "fetch", 1)
+	busData, err := p.fetcher.FetchBusData(lineCtx, line)
+	fetchDone()
+	result.FetchDuration = time.Since(fetchStart)
+	if err != nil {
+		lineSpan.RecordError(err)
+		result.Err = &LineError{LineRef: line, Stage: StageFetch, Err: err}
+		return result
+	}
+
+	// Save raw XML for building regression fixtures
+	if p.config.DumpSampleDir != "" {
+		if err := p.dumpSample(busData); err != nil {
+			lineSpan.RecordError(err)
+			log.Printf("Error dumping sample for line %s: %v", line, err)
 		}
 	}
 
-	// Return error only if all lines failed
-	if len(errors) == len(p.config.LineRefs) {
-		return fmt.Errorf("all lines failed: %v", errors)
+	// Parse XML to JSON
+	parseStart := time.Now()
+	parsedData, err := p.parser.ParseBusData(lineCtx, busData)
+	result.ParseDuration = time.Since(parseStart)
+	if err != nil {
+		lineSpan.RecordError(err)
+
+		// Distinguish operator feed failures from malformed responses
+		var feedErr *parser.FeedError
+		if errors.As(err, &feedErr) {
+			metrics.RecordFeedError(lineCtx, line, feedErr.Reason)
+			result.Err = &LineError{LineRef: line, Stage: StageFeed, Err: err}
+			return result
+		}
+
+		var staleErr *parser.StaleFeedError
+		if errors.As(err, &staleErr) {
+			metrics.RecordFeedError(lineCtx, line, "stale response")
+			result.Err = &LineError{LineRef: line, Stage: StageFeed, Err: err}
+			return result
+		}
+
+		result.Err = &LineError{LineRef: line, Stage: StageParse, Err: err}
+		return result
+	}
+
+	p.explainParse(busData, parsedData)
+
+	lineSpan.SetAttributes(
+		attribute.Int("vehicles_processed", len(parsedData.VehicleData)),
+	)
+	metrics.RecordVehiclesPerLine(lineCtx, line, len(parsedData.VehicleData))
+
+	if maxAge, ok := recordDataAge(lineCtx, line, busData.Timestamp, parsedData); ok {
+		lineSpan.SetAttributes(attribute.Float64("max_vehicle_data_age_seconds", maxAge.Seconds()))
+	}
+
+	if p.positions != nil {
+		p.positions.record(parsedData)
+	}
+
+	result.Data = parsedData
+	return result
+}
+
+// recordDataAge records how far each vehicle's RecordedAtTime lags fetchedAt
+// and returns the largest lag, or false when no vehicle has a valid time
+func recordDataAge(ctx context.Context, line string, fetchedAt time.Time, data *types.ParsedBusData) (time.Duration, bool) {
+	var maxAge time.Duration
+	found := false
+	for _, vehicle := range data.VehicleData {
+		recorded, err := time.Parse(time.RFC3339, vehicle.RecordedAtTime)
+		if err != nil {
+			continue
+		}
+		age := fetchedAt.Sub(recorded)
+		metrics.RecordVehicleDataAge(ctx, line, age)
+		if !found || age > maxAge {
+			maxAge = age
+			found = true
+		}
+	}
+	return maxAge, found
+}
+
+// dumpSample writes the raw fetched XML to <dir>/<line>-<timestamp>.xml
+func (p *Pipeline) dumpSample(busData *bods.BusData) error {
+	// Line refs are user supplied, so keep them from escaping the directory
+	safeLine := strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(busData.LineRef)
+	filename := fmt.Sprintf("%s-%s.xml", safeLine, busData.Timestamp.UTC().Format("20060102T150405.000Z"))
+	path := filepath.Join(p.config.DumpSampleDir, filename)
+
+	if err := os.WriteFile(path, []byte(busData.XMLData), 0o644); err != nil {
+		return fmt.Errorf("failed to write sample file: %w", err)
 	}
 
 	return nil
@@ -208,24 +1266,7 @@ func (p *Pipeline) handleDryRun(ctx context.Context, data *types.ParsedBusData)
 	// Show individual log lines as they would be sent to Loki
 	for i, vehicle := range data.VehicleData {
 		// Create individual vehicle log entry (same format as Loki client)
-		vehicleLog := map[string]interface{}{
-			"timestamp":                      data.Timestamp,
-			"line_ref":                       data.LineRef,
-			"vehicle_ref":                    vehicle.VehicleRef,
-			"direction_ref":                  vehicle.DirectionRef,
-			"operator_ref":                   vehicle.OperatorRef,
-			"origin_ref":                     vehicle.OriginRef,
-			"origin_name":                    vehicle.OriginName,
-			"destination_ref":                vehicle.DestinationRef,
-			"destination_name":               vehicle.DestinationName,
-			"origin_aimed_departure_time":    vehicle.OriginAimedDepartureTime,
-			"destination_aimed_arrival_time": vehicle.DestinationAimedArrivalTime,
-			"longitude":                      vehicle.Longitude,
-			"latitude":                       vehicle.Latitude,
-			"recorded_at_time":               vehicle.RecordedAtTime,
-			"valid_until_time":               vehicle.ValidUntilTime,
-			"bus_image":                      vehicle.BusImage,
-		}
+		vehicleLog := loki.BuildVehicleEntry(data, vehicle, p.entryOptions())
 
 		// Convert vehicle to JSON
 		vehicleJSON, err := json.Marshal(vehicleLog)
@@ -237,7 +1278,7 @@ func (p *Pipeline) handleDryRun(ctx context.Context, data *types.ParsedBusData)
 		fmt.Printf("Log Line %d: %s\n", i+1, string(vehicleJSON))
 	}
 
-	fmt.Println("=== END DRY RUN ===\n")
+	fmt.Print("=== END DRY RUN ===\n\n")
 
 	span.SetAttributes(
 		attribute.Int("vehicles_printed", len(data.VehicleData)),
@@ -246,6 +1287,50 @@ func (p *Pipeline) handleDryRun(ctx context.Context, data *types.ParsedBusData)
 	return nil
 }
 
+// lokiSink sends to Loki, pushing all lines of a cycle in one request
+type lokiSink struct {
+	p *Pipeline
+}
+
+func (s lokiSink) Send(ctx context.Context, data *types.ParsedBusData) error {
+	return s.p.sendToLoki(ctx, data)
+}
+
+func (s lokiSink) SendBatch(ctx context.Context, batch []*types.ParsedBusData) error {
+	return s.p.sendBatchToLoki(ctx, batch)
+}
+
+// sendBatchToLoki pushes every line of a cycle to Loki in a single request
+func (p *Pipeline) sendBatchToLoki(ctx context.Context, batch []*types.ParsedBusData) error {
+	ctx, span := p.tracer.Start(ctx, "pipeline.send_batch_to_loki",
+		trace.WithAttributes(attribute.Int("lines_count", len(batch))),
+	)
+	defer span.End()
+
+	if p.lokiClient == nil {
+		err := fmt.Errorf("loki client not initialized")
+		span.RecordError(err)
+		return err
+	}
+
+	if err := p.lokiClient.SendBatch(ctx, batch); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to send data to Loki: %w", err)
+	}
+
+	vehicles := 0
+	for _, data := range batch {
+		vehicles += len(data.VehicleData)
+	}
+	log.Printf("Successfully sent %d individual vehicle log lines to Loki for %d lines", vehicles, len(batch))
+
+	span.SetAttributes(
+		attribute.Int("vehicles_sent", vehicles),
+	)
+
+	return nil
+}
+
 func (p *Pipeline) sendToLoki(ctx context.Context, data *types.ParsedBusData) error {
 	ctx, span := p.tracer.Start(ctx, "pipeline.send_to_loki")
 	defer span.End()
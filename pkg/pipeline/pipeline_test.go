@@ -0,0 +1,841 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"bods2loki/pkg/bods"
+	"bods2loki/pkg/loki"
+	"bods2loki/pkg/parser"
+	"bods2loki/pkg/types"
+)
+
+// sirixml returns a SIRI-VM response for line with one vehicle per ref
+func sirixml(line string, vehicleRefs ...string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<Siri xmlns="http://www.siri.org.uk/siri" version="2.0"><ServiceDelivery><VehicleMonitoringDelivery>`)
+	for _, ref := range vehicleRefs {
+		fmt.Fprintf(&b, `<VehicleActivity>
+<RecordedAtTime>2025-10-09T15:37:34+00:00</RecordedAtTime>
+<MonitoredVehicleJourney>
+<LineRef>%s</LineRef><DirectionRef>inbound</DirectionRef>
+<VehicleLocation><Longitude>-2.480741</Longitude><Latitude>51.495853</Latitude></VehicleLocation>
+<Bearing>270.0</Bearing><VehicleRef>%s</VehicleRef>
+</MonitoredVehicleJourney>
+</VehicleActivity>`, line, ref)
+	}
+	b.WriteString(`</VehicleMonitoringDelivery></ServiceDelivery></Siri>`)
+	return b.String()
+}
+
+// fakeFetcher serves sirixml responses, recording each fetch
+type fakeFetcher struct {
+	mu sync.Mutex
+	// vehicles returns the vehicle refs for a line; nil means one vehicle
+	vehicles func(line string) []string
+	// delay holds each fetch, honouring ctx
+	delay time.Duration
+	// errs fails the fetches of the lines it holds
+	errs    map[string]error
+	fetches map[string]int
+	active  int
+	peak    int
+}
+
+func (f *fakeFetcher) FetchBusData(ctx context.Context, lineRef string) (*bods.BusData, error) {
+	f.mu.Lock()
+	if f.fetches == nil {
+		f.fetches = make(map[string]int)
+	}
+	f.fetches[lineRef]++
+	f.active++
+	f.peak = max(f.peak, f.active)
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		f.active--
+		f.mu.Unlock()
+	}()
+
+	if f.delay > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(f.delay):
+		}
+	}
+	if err := f.errs[lineRef]; err != nil {
+		return nil, err
+	}
+
+	refs := []string{lineRef + "-1"}
+	if f.vehicles != nil {
+		refs = f.vehicles(lineRef)
+	}
+	return &bods.BusData{
+		XMLData:     sirixml(lineRef, refs...),
+		ContentType: "application/xml",
+		Timestamp:   time.Now(),
+		LineRef:     lineRef,
+	}, nil
+}
+
+// staticFetcher serves the same response body for every line
+type staticFetcher string
+
+func (f staticFetcher) FetchBusData(ctx context.Context, lineRef string) (*bods.BusData, error) {
+	return &bods.BusData{
+		XMLData:     string(f),
+		ContentType: "application/xml",
+		Timestamp:   time.Now(),
+		LineRef:     lineRef,
+	}, nil
+}
+
+// fetchCount returns how many times line was fetched
+func (f *fakeFetcher) fetchCount(line string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fetches[line]
+}
+
+// peakActive returns the most fetches that were ever in flight at once
+func (f *fakeFetcher) peakActive() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.peak
+}
+
+// newTestPipeline builds a pipeline reading from fetcher and sending to a
+// MemorySink, with fast polling allowed
+func newTestPipeline(t *testing.T, config Config, fetcher Fetcher, opts ...Option) (*Pipeline, *MemorySink) {
+	t.Helper()
+
+	sink := NewMemorySink()
+	config.AllowFastPolling = true
+	if config.Interval == 0 {
+		config.Interval = time.Hour
+	}
+	if len(config.LineRefs) == 0 {
+		config.LineRefs = []string{"49x"}
+	}
+
+	p, err := New(config, append([]Option{WithFetcher(fetcher), WithSink("memory", sink)}, opts...)...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return p, sink
+}
+
+// lokiRecorder is a fake Loki that keeps every stream pushed to it
+type lokiRecorder struct {
+	mu      sync.Mutex
+	pushes  int
+	streams []loki.Stream
+}
+
+func (r *lokiRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var push loki.PushRequest
+	if err := json.NewDecoder(req.Body).Decode(&push); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.mu.Lock()
+	r.pushes++
+	r.streams = append(r.streams, push.Streams...)
+	r.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// entries returns every pushed log line decoded, with the labels of its stream
+func (r *lokiRecorder) entries(t *testing.T) ([]map[string]interface{}, []map[string]string) {
+	t.Helper()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var entries []map[string]interface{}
+	var labels []map[string]string
+	for _, stream := range r.streams {
+		for _, value := range stream.Values {
+			var entry map[string]interface{}
+			if err := json.Unmarshal([]byte(value[1]), &entry); err != nil {
+				t.Fatalf("log line %q: %v", value[1], err)
+			}
+			entries = append(entries, entry)
+			labels = append(labels, stream.Stream)
+		}
+	}
+	return entries, labels
+}
+
+// logBuffer is a buffer that may be read while background goroutines still log to it
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLog redirects the standard logger to a buffer until the test ends
+func captureLog(t *testing.T) *logBuffer {
+	t.Helper()
+
+	buf := &logBuffer{}
+	log.SetOutput(buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return buf
+}
+
+// runFor runs p until d has passed
+func runFor(t *testing.T, p *Pipeline, d time.Duration) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	if err := p.Run(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Run returned %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestCycleTimeout(t *testing.T) {
+	tests := []struct {
+		name         string
+		cycleTimeout time.Duration
+		lines        []string
+		want         time.Duration
+	}{
+		{"global lines", 0, []string{"1", "2"}, 20 * time.Second},
+		{"slow line group", 0, []string{"slow"}, 10 * time.Minute},
+		{"fast line group", 0, []string{"fast"}, 10 * time.Second},
+		{"all lines", 0, []string{"1", "fast", "slow"}, 10 * time.Minute},
+		{"configured", time.Minute, []string{"slow"}, time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestPipeline(t, Config{
+				Interval:      10 * time.Second,
+				LineRefs:      []string{"1", "2", "fast", "slow"},
+				LineIntervals: map[string]time.Duration{"fast": 5 * time.Second, "slow": 5 * time.Minute},
+				CycleTimeout:  tt.cycleTimeout,
+			}, &fakeFetcher{})
+
+			if got := p.cycleTimeout(tt.lines); got != tt.want {
+				t.Errorf("cycleTimeout(%q) = %v, want %v", tt.lines, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCycleTimeoutBoundsSlowFetches(t *testing.T) {
+	p, _ := newTestPipeline(t, Config{
+		CycleTimeout: 50 * time.Millisecond,
+	}, &fakeFetcher{delay: time.Minute})
+
+	start := time.Now()
+	err := p.RunCycle(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cycle took %v, want it cut off after about 50ms", elapsed)
+	}
+
+	var lineErr *LineError
+	if !errors.As(err, &lineErr) || lineErr.Stage != StageTimeout {
+		t.Errorf("RunCycle error = %v, want a %s stage LineError", err, StageTimeout)
+	}
+}
+
+func TestDumpSample(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "samples")
+	p, _ := newTestPipeline(t, Config{LineRefs: []string{"49x", "../72"}, DumpSampleDir: dir}, &fakeFetcher{})
+
+	if err := p.RunCycle(context.Background()); err != nil {
+		t.Fatalf("RunCycle: %v", err)
+	}
+
+	for _, tt := range []struct{ line, prefix string }{{"49x", "49x-"}, {"../72", "__72-"}} {
+		files, err := filepath.Glob(filepath.Join(dir, tt.prefix+"*.xml"))
+		if err != nil || len(files) != 1 {
+			t.Fatalf("line %s: got sample files %v (%v), want one", tt.line, files, err)
+		}
+		content, err := os.ReadFile(files[0])
+		if err != nil {
+			t.Fatalf("line %s: %v", tt.line, err)
+		}
+		if want := sirixml(tt.line, tt.line+"-1"); string(content) != want {
+			t.Errorf("line %s: sample = %q, want the fetched XML %q", tt.line, content, want)
+		}
+	}
+}
+
+func TestFeedErrorIsNotAnEmptySuccess(t *testing.T) {
+	body := staticFetcher(`<?xml version="1.0" encoding="UTF-8"?>
+<Siri xmlns="http://www.siri.org.uk/siri" version="2.0"><ServiceDelivery><VehicleMonitoringDelivery>
+<Status>false</Status><ErrorCondition><ServiceNotAvailableError/></ErrorCondition>
+</VehicleMonitoringDelivery></ServiceDelivery></Siri>`)
+	p, sink := newTestPipeline(t, Config{}, body)
+
+	result, err := p.RunOnce(context.Background())
+	if err == nil {
+		t.Fatal("RunOnce succeeded, want the feed error")
+	}
+
+	var lineErr *LineError
+	var feedErr *parser.FeedError
+	if !errors.As(result.Lines[0].Err, &lineErr) || lineErr.Stage != StageFeed || !errors.As(err, &feedErr) {
+		t.Errorf("line error = %v, want a feed stage FeedError", result.Lines[0].Err)
+	}
+	if result.Lines[0].Data != nil || len(sink.Records()) != 0 {
+		t.Errorf("feed error produced data")
+	}
+}
+
+func TestTriggerCycleDoesNotOverlap(t *testing.T) {
+	fetcher := &fakeFetcher{delay: 100 * time.Millisecond}
+	p, sink := newTestPipeline(t, Config{}, fetcher)
+
+	done := make(chan error, 1)
+	go func() { done <- p.RunCycle(context.Background()) }()
+
+	// Wait for the scheduled cycle to be fetching
+	deadline := time.Now().Add(time.Second)
+	for fetcher.fetchCount("49x") == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := p.TriggerCycle(context.Background()); !errors.Is(err, ErrCycleInProgress) {
+		t.Errorf("TriggerCycle during a cycle = %v, want %v", err, ErrCycleInProgress)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("RunCycle: %v", err)
+	}
+
+	if err := p.TriggerCycle(context.Background()); err != nil {
+		t.Errorf("TriggerCycle: %v", err)
+	}
+	if got := len(sink.Records()); got != 2 {
+		t.Errorf("sink received %d lines, want 2", got)
+	}
+}
+
+func TestRunCycle(t *testing.T) {
+	errUnavailable := errors.New("BODS unavailable")
+
+	tests := []struct {
+		name    string
+		errs    map[string]error
+		records int
+		wantErr bool
+	}{
+		{"every line succeeds", nil, 2, false},
+		{"one line fails", map[string]error{"72": errUnavailable}, 1, false},
+		{"every line fails", map[string]error{"49x": errUnavailable, "72": errUnavailable}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, sink := newTestPipeline(t, Config{LineRefs: []string{"49x", "72"}}, &fakeFetcher{errs: tt.errs})
+
+			err := p.RunCycle(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RunCycle error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, errUnavailable) {
+				t.Errorf("RunCycle error = %v, want it to wrap %v", err, errUnavailable)
+			}
+			if got := len(sink.Records()); got != tt.records {
+				t.Errorf("sink received %d lines, want %d", got, tt.records)
+			}
+		})
+	}
+}
+
+func TestRunCycleWaitsForRunningCycle(t *testing.T) {
+	fetcher := &fakeFetcher{delay: 50 * time.Millisecond}
+	p, sink := newTestPipeline(t, Config{}, fetcher)
+
+	// Unlike TriggerCycle, a second RunCycle queues behind the first
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.RunCycle(context.Background()); err != nil {
+				t.Errorf("RunCycle: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := fetcher.peakActive(); got != 1 {
+		t.Errorf("%d fetches ran at once, want cycles to run one after the other", got)
+	}
+	if got := len(sink.Records()); got != 2 {
+		t.Errorf("sink received %d lines, want 2", got)
+	}
+}
+
+func TestExplainVehicle(t *testing.T) {
+	fetcher := &fakeFetcher{vehicles: func(line string) []string { return []string{"bus-1", "bus-2"} }}
+	p, _ := newTestPipeline(t, Config{ExplainVehicle: "bus-2"}, fetcher)
+	logs := captureLog(t)
+
+	if err := p.RunCycle(context.Background()); err != nil {
+		t.Fatalf("RunCycle: %v", err)
+	}
+
+	var explained []string
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(line, "[explain") {
+			explained = append(explained, line)
+		}
+	}
+
+	for _, stage := range []string{"fetch: found", "parse:", "filter: kept", "send: sent to memory"} {
+		found := false
+		for _, line := range explained {
+			found = found || strings.Contains(line, "[explain bus-2] "+stage)
+		}
+		if !found {
+			t.Errorf("no %q explain log in %q", stage, explained)
+		}
+	}
+	for _, line := range explained {
+		if strings.Contains(line, "bus-1") {
+			t.Errorf("explain log mentions another vehicle: %s", line)
+		}
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	errUnavailable := errors.New("BODS unavailable")
+
+	tests := []struct {
+		name     string
+		lines    []string
+		errs     map[string]error
+		vehicles map[string][]string
+		total    int
+		wantErr  bool
+	}{
+		{
+			name:     "every line succeeds",
+			lines:    []string{"49x", "72"},
+			vehicles: map[string][]string{"49x": {"bus-1", "bus-2"}, "72": {"bus-3"}},
+			total:    3,
+		},
+		{
+			name:     "one line fails",
+			lines:    []string{"49x", "72"},
+			errs:     map[string]error{"72": errUnavailable},
+			vehicles: map[string][]string{"49x": {"bus-1"}},
+			total:    1,
+		},
+		{
+			name:    "every line fails",
+			lines:   []string{"49x", "72"},
+			errs:    map[string]error{"49x": errUnavailable, "72": errUnavailable},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := &fakeFetcher{
+				errs:     tt.errs,
+				vehicles: func(line string) []string { return tt.vehicles[line] },
+			}
+			p, sink := newTestPipeline(t, Config{LineRefs: tt.lines}, fetcher)
+
+			result, err := p.RunOnce(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RunOnce error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if len(result.Lines) != len(tt.lines) {
+				t.Fatalf("got %d line results, want %d", len(result.Lines), len(tt.lines))
+			}
+			for i, line := range result.Lines {
+				if line.LineRef != tt.lines[i] {
+					t.Errorf("result %d is for line %s, want %s", i, line.LineRef, tt.lines[i])
+				}
+
+				if wantErr := tt.errs[line.LineRef]; wantErr != nil {
+					var lineErr *LineError
+					if !errors.As(line.Err, &lineErr) || lineErr.Stage != StageFetch || !errors.Is(line.Err, wantErr) || line.Data != nil {
+						t.Errorf("line %s: Err = %v, Data = %v; want a fetch stage error and no data", line.LineRef, line.Err, line.Data)
+					}
+					continue
+				}
+
+				if line.Err != nil || line.Data == nil {
+					t.Fatalf("line %s: Err = %v, want data", line.LineRef, line.Err)
+				}
+				var refs []string
+				for _, vehicle := range line.Data.VehicleData {
+					refs = append(refs, vehicle.VehicleRef)
+				}
+				if strings.Join(refs, ",") != strings.Join(tt.vehicles[line.LineRef], ",") {
+					t.Errorf("line %s: vehicles = %v, want %v", line.LineRef, refs, tt.vehicles[line.LineRef])
+				}
+			}
+
+			if got := result.Vehicles(); got != tt.total {
+				t.Errorf("Vehicles() = %d, want %d", got, tt.total)
+			}
+			if got := len(result.Errors()); got != len(tt.errs) {
+				t.Errorf("Errors() has %d errors, want %d", got, len(tt.errs))
+			}
+			if result.Started.IsZero() {
+				t.Error("Started is not set")
+			}
+			if records := sink.Records(); len(records) != 0 {
+				t.Errorf("RunOnce sent %d records to the sink, want none", len(records))
+			}
+		})
+	}
+}
+
+func TestMinInterval(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"default floor", Config{Interval: 10 * time.Second}, false},
+		{"below default floor", Config{Interval: 5 * time.Second}, true},
+		{"fast polling allowed", Config{Interval: time.Second, AllowFastPolling: true}, false},
+		{"lowered floor", Config{Interval: 5 * time.Second, MinInterval: 5 * time.Second}, false},
+		{"raised floor", Config{Interval: 20 * time.Second, MinInterval: 30 * time.Second}, true},
+		{"line interval below floor", Config{Interval: 30 * time.Second, LineIntervals: map[string]time.Duration{"49x": 2 * time.Second}}, true},
+		{"line interval with fast polling", Config{Interval: 30 * time.Second, LineIntervals: map[string]time.Duration{"49x": 2 * time.Second}, AllowFastPolling: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.LineRefs = []string{"49x"}
+			p, err := New(tt.config, WithFetcher(&fakeFetcher{}), WithSink("memory", NewMemorySink()))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "allow-fast-polling") {
+				t.Errorf("error %q doesn't mention the allow-fast-polling override", err)
+			}
+			if p != nil {
+				p.Close()
+			}
+		})
+	}
+}
+
+// panickingFetcher panics fetching line, and otherwise fetches from Fetcher
+type panickingFetcher struct {
+	Fetcher
+	line string
+}
+
+func (f panickingFetcher) FetchBusData(ctx context.Context, lineRef string) (*bods.BusData, error) {
+	if lineRef == f.line {
+		var data map[string]interface{}
+		_ = data["VehicleActivity"].([]interface{})
+	}
+	return f.Fetcher.FetchBusData(ctx, lineRef)
+}
+
+func TestRecoverPanics(t *testing.T) {
+	logs := captureLog(t)
+	fetcher := panickingFetcher{Fetcher: &fakeFetcher{}, line: "72"}
+	p, sink := newTestPipeline(t, Config{LineRefs: []string{"49x", "72"}, RecoverPanics: true}, fetcher)
+
+	result, err := p.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+
+	var lineErr *LineError
+	if !errors.As(result.Lines[1].Err, &lineErr) || lineErr.Stage != StagePanic || lineErr.LineRef != "72" {
+		t.Errorf("line 72 error = %v, want a panic stage LineError", result.Lines[1].Err)
+	}
+	if result.Lines[0].Err != nil || result.Lines[0].Data == nil {
+		t.Errorf("line 49x = %+v, want it processed despite the other line panicking", result.Lines[0])
+	}
+	if !strings.Contains(logs.String(), "Recovered from panic processing line 72") || !strings.Contains(logs.String(), "goroutine") {
+		t.Errorf("log = %q, want the panic and its stack trace", logs.String())
+	}
+
+	// Full cycles carry on sending the lines that didn't panic
+	if err := p.RunCycle(context.Background()); err != nil {
+		t.Fatalf("RunCycle: %v", err)
+	}
+	if records := sink.Records(); len(records) != 1 || records[0].LineRef != "49x" {
+		t.Errorf("sink received %v, want only line 49x", records)
+	}
+}
+
+func TestStripFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"image and line_ref", Config{StripFields: []string{"bus_image", "line_ref"}}, false},
+		{"image without line label", Config{StripFields: []string{"bus_image"}, DisableLineRefLabel: true}, false},
+		{"line_ref without line label", Config{StripFields: []string{"line_ref"}, DisableLineRefLabel: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &lokiRecorder{}
+			server := httptest.NewServer(recorder)
+			defer server.Close()
+
+			tt.config.LineRefs = []string{"49x"}
+			tt.config.Interval = time.Hour
+			tt.config.LokiURL = server.URL
+			p, err := New(tt.config, WithFetcher(&fakeFetcher{}))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer p.Close()
+
+			if err := p.RunCycle(context.Background()); err != nil {
+				t.Fatalf("RunCycle: %v", err)
+			}
+
+			entries, labels := recorder.entries(t)
+			if len(entries) != 1 {
+				t.Fatalf("Loki received %d entries, want 1", len(entries))
+			}
+			for _, field := range tt.config.StripFields {
+				if got, ok := entries[0][field]; ok {
+					t.Errorf("%s = %v, want it stripped", field, got)
+				}
+			}
+			if entries[0]["vehicle_ref"] == nil || entries[0]["latitude"] == nil {
+				t.Errorf("entry %v lost fields that weren't stripped", entries[0])
+			}
+			// A stripped line_ref is still found through the stream label
+			if got := labels[0]["line_ref"]; !tt.config.DisableLineRefLabel && got != "49x" {
+				t.Errorf("line_ref label = %q, want 49x", got)
+			}
+		})
+	}
+}
+
+func TestCycleBatchesLokiPush(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		errs    map[string]error
+		pushes  int
+		streams []string
+	}{
+		{"one line", []string{"49x"}, nil, 1, []string{"49x"}},
+		{"every line in one push", []string{"49x", "72", "1"}, nil, 1, []string{"49x", "72", "1"}},
+		{"failed lines left out", []string{"49x", "72", "1"}, map[string]error{"72": errors.New("connection reset")}, 1, []string{"49x", "1"}},
+		{"nothing to send", []string{"49x"}, map[string]error{"49x": errors.New("connection reset")}, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &lokiRecorder{}
+			server := httptest.NewServer(recorder)
+			defer server.Close()
+
+			p, err := New(Config{LineRefs: tt.lines, Interval: time.Hour, LokiURL: server.URL}, WithFetcher(&fakeFetcher{errs: tt.errs}))
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer p.Close()
+			p.RunCycle(context.Background())
+
+			recorder.mu.Lock()
+			pushes, streams := recorder.pushes, recorder.streams
+			recorder.mu.Unlock()
+			if pushes != tt.pushes {
+				t.Errorf("Loki received %d pushes, want %d", pushes, tt.pushes)
+			}
+			// Each line keeps its own stream with its line_ref label
+			var lines []string
+			for _, stream := range streams {
+				lines = append(lines, stream.Stream["line_ref"])
+			}
+			sort.Strings(lines)
+			want := append([]string(nil), tt.streams...)
+			sort.Strings(want)
+			if !reflect.DeepEqual(lines, want) {
+				t.Errorf("streams for lines %q, want %q", lines, want)
+			}
+		})
+	}
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		lines int
+		want  int
+	}{
+		{"small limit", 3, 20, 3},
+		{"serial", 1, 5, 1},
+		{"default", 0, 20, DefaultMaxConcurrency},
+		{"fewer lines than the limit", 8, 4, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lines []string
+			for i := 0; i < tt.lines; i++ {
+				lines = append(lines, fmt.Sprintf("line-%d", i))
+			}
+			fetcher := &fakeFetcher{delay: 20 * time.Millisecond}
+			p, sink := newTestPipeline(t, Config{LineRefs: lines, MaxConcurrency: tt.limit, CycleTimeout: 10 * time.Second}, fetcher)
+
+			if err := p.RunCycle(context.Background()); err != nil {
+				t.Fatalf("RunCycle: %v", err)
+			}
+			if peak := fetcher.peakActive(); peak != tt.want {
+				t.Errorf("peak concurrent fetches = %d, want %d", peak, tt.want)
+			}
+			if got := len(sink.Records()); got != tt.lines {
+				t.Errorf("sent %d lines, want all %d", got, tt.lines)
+			}
+		})
+	}
+
+	_, err := New(Config{LineRefs: []string{"49x"}, Interval: time.Minute, MaxConcurrency: -1}, WithFetcher(&fakeFetcher{}), WithSink("memory", NewMemorySink()))
+	if err == nil {
+		t.Error("New accepted a negative max concurrency")
+	}
+}
+
+func TestShutdownDrainsRunningCycle(t *testing.T) {
+	tests := []struct {
+		name      string
+		drain     time.Duration
+		sendTime  time.Duration
+		delivered bool
+	}{
+		{"send finishes within the drain timeout", time.Second, 100 * time.Millisecond, true},
+		{"drain timeout cuts the send off", 50 * time.Millisecond, 10 * time.Second, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLog(t)
+			sending := make(chan struct{})
+			var once sync.Once
+			var mu sync.Mutex
+			var delivered bool
+			sink := SinkFunc(func(ctx context.Context, data *types.ParsedBusData) error {
+				once.Do(func() { close(sending) })
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(tt.sendTime):
+				}
+				mu.Lock()
+				delivered = true
+				mu.Unlock()
+				return nil
+			})
+
+			p, err := New(Config{LineRefs: []string{"49x"}, Interval: time.Hour, DrainTimeout: tt.drain}, WithFetcher(&fakeFetcher{}), WithSink("slow", sink))
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer p.Close()
+
+			// Shut down once the first cycle has fetched and started sending
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				<-sending
+				cancel()
+			}()
+
+			start := time.Now()
+			if err := p.Run(ctx); err != context.Canceled {
+				t.Fatalf("Run returned %v, want %v", err, context.Canceled)
+			}
+			elapsed := time.Since(start)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if delivered != tt.delivered {
+				t.Errorf("batch delivered = %v, want %v", delivered, tt.delivered)
+			}
+			// Run only returns once the drain completes or times out
+			if tt.delivered && elapsed < tt.sendTime {
+				t.Errorf("Run returned after %v, before the %v send finished", elapsed, tt.sendTime)
+			}
+			if !tt.delivered && elapsed > 2*time.Second {
+				t.Errorf("Run returned after %v, want it bounded by the %v drain timeout", elapsed, tt.drain)
+			}
+			if !strings.Contains(logs.String(), "allowing up to "+tt.drain.String()) {
+				t.Errorf("log doesn't announce the drain:\n%s", logs)
+			}
+		})
+	}
+}
+
+func TestRecordDataAge(t *testing.T) {
+	fetchedAt := time.Date(2025, 10, 9, 15, 37, 40, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		recordedAt  []string
+		wantMaxAge  time.Duration
+		wantHasTime bool
+	}{
+		{"single vehicle", []string{"2025-10-09T15:37:34Z"}, 6 * time.Second, true},
+		{"largest lag wins", []string{"2025-10-09T15:37:34Z", "2025-10-09T15:35:40Z", "2025-10-09T16:37:39+01:00"}, 2 * time.Minute, true},
+		{"invalid times skipped", []string{"", "soon", "2025-10-09T15:37:10Z"}, 30 * time.Second, true},
+		{"no valid times", []string{"", "soon"}, 0, false},
+		{"no vehicles", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &types.ParsedBusData{LineRef: "49x"}
+			for _, recordedAt := range tt.recordedAt {
+				data.VehicleData = append(data.VehicleData, types.VehicleActivity{RecordedAtTime: recordedAt})
+			}
+
+			maxAge, ok := recordDataAge(context.Background(), "49x", fetchedAt, data)
+			if ok != tt.wantHasTime || maxAge != tt.wantMaxAge {
+				t.Errorf("recordDataAge = %v, %v; want %v, %v", maxAge, ok, tt.wantMaxAge, tt.wantHasTime)
+			}
+		})
+	}
+}
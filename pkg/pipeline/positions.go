@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"sync"
+	"time"
+
+	"bods2loki/pkg/types"
+)
+
+// positionHistoryDepth is how many recent positions are kept per vehicle
+const positionHistoryDepth = 10
+
+// DefaultPositionHistorySize bounds the number of vehicles tracked when no size is configured
+const DefaultPositionHistorySize = 10000
+
+// VehiclePosition is one observed position of a vehicle
+type VehiclePosition struct {
+	LineRef        string
+	Latitude       float64
+	Longitude      float64
+	Bearing        float64
+	Velocity       float64
+	RecordedAtTime string
+	// SeenAt is when the pipeline observed the position
+	SeenAt time.Time
+}
+
+// vehicleHistory holds a vehicle's recent positions, oldest first
+type vehicleHistory struct {
+	positions []VehiclePosition
+	lastSeen  time.Time
+}
+
+// positionStore is a concurrency-safe per-vehicle position history shared by
+// features that need to compare a vehicle against its past positions.
+// Vehicles not seen for ttl are evicted, and once more than maxVehicles are
+// tracked the least recently seen are evicted first.
+type positionStore struct {
+	mu          sync.Mutex
+	ttl         time.Duration
+	maxVehicles int
+	vehicles    map[string]*vehicleHistory
+	now         func() time.Time
+}
+
+func newPositionStore(ttl time.Duration, maxVehicles int) *positionStore {
+	if maxVehicles <= 0 {
+		maxVehicles = DefaultPositionHistorySize
+	}
+
+	return &positionStore{
+		ttl:         ttl,
+		maxVehicles: maxVehicles,
+		vehicles:    make(map[string]*vehicleHistory),
+		now:         time.Now,
+	}
+}
+
+// record adds the positions of all vehicles in a parsed line
+func (s *positionStore) record(data *types.ParsedBusData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for _, vehicle := range data.VehicleData {
+		if vehicle.VehicleRef == "" {
+			continue
+		}
+
+		history, ok := s.vehicles[vehicle.VehicleRef]
+		if !ok {
+			history = &vehicleHistory{}
+			s.vehicles[vehicle.VehicleRef] = history
+		}
+
+		history.positions = append(history.positions, VehiclePosition{
+			LineRef:        data.LineRef,
+			Latitude:       vehicle.Latitude,
+			Longitude:      vehicle.Longitude,
+			Bearing:        vehicle.Bearing,
+			Velocity:       vehicle.Velocity,
+			RecordedAtTime: vehicle.RecordedAtTime,
+			SeenAt:         now,
+		})
+		if len(history.positions) > positionHistoryDepth {
+			history.positions = history.positions[len(history.positions)-positionHistoryDepth:]
+		}
+		history.lastSeen = now
+	}
+
+	s.evictLocked(now)
+}
+
+// history returns a copy of a vehicle's recent positions, oldest first
+func (s *positionStore) history(vehicleRef string) []VehiclePosition {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history, ok := s.vehicles[vehicleRef]
+	if !ok || s.expired(history, s.now()) {
+		return nil
+	}
+
+	return append([]VehiclePosition(nil), history.positions...)
+}
+
+// len returns the number of vehicles currently tracked
+func (s *positionStore) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.vehicles)
+}
+
+func (s *positionStore) expired(history *vehicleHistory, now time.Time) bool {
+	return s.ttl > 0 && now.Sub(history.lastSeen) > s.ttl
+}
+
+// evictLocked drops expired vehicles, then the least recently seen ones
+// until the store is within its size bound. s.mu must be held.
+func (s *positionStore) evictLocked(now time.Time) {
+	for ref, history := range s.vehicles {
+		if s.expired(history, now) {
+			delete(s.vehicles, ref)
+		}
+	}
+
+	for len(s.vehicles) > s.maxVehicles {
+		var oldestRef string
+		var oldest time.Time
+		for ref, history := range s.vehicles {
+			if oldestRef == "" || history.lastSeen.Before(oldest) {
+				oldestRef, oldest = ref, history.lastSeen
+			}
+		}
+		delete(s.vehicles, oldestRef)
+	}
+}
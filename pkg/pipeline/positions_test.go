@@ -0,0 +1,155 @@
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"bods2loki/pkg/types"
+)
+
+// fakeClock is a settable time source for the position store
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newTestPositionStore returns a store reading time from the returned clock
+func newTestPositionStore(ttl time.Duration, maxVehicles int) (*positionStore, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 10, 9, 15, 37, 40, 0, time.UTC)}
+	store := newPositionStore(ttl, maxVehicles)
+	store.now = clock.Now
+	return store, clock
+}
+
+// lineData returns parsed data for line with a vehicle per ref at latitude
+func lineData(line string, latitude float64, vehicleRefs ...string) *types.ParsedBusData {
+	data := &types.ParsedBusData{LineRef: line}
+	for _, ref := range vehicleRefs {
+		data.VehicleData = append(data.VehicleData, types.VehicleActivity{VehicleRef: ref, Latitude: latitude, Longitude: -2.480741})
+	}
+	return data
+}
+
+func TestPositionStoreHistory(t *testing.T) {
+	store, clock := newTestPositionStore(time.Hour, 0)
+
+	for i := 0; i < positionHistoryDepth+3; i++ {
+		store.record(lineData("49x", float64(i), "bus-1", ""))
+		clock.Advance(time.Second)
+	}
+
+	history := store.history("bus-1")
+	if len(history) != positionHistoryDepth {
+		t.Fatalf("got %d positions, want the last %d", len(history), positionHistoryDepth)
+	}
+	if first, last := history[0].Latitude, history[len(history)-1].Latitude; first != 3 || last != positionHistoryDepth+2 {
+		t.Errorf("history runs from %v to %v, want oldest first from 3 to %d", first, last, positionHistoryDepth+2)
+	}
+	if store.len() != 1 {
+		t.Errorf("tracking %d vehicles, want 1 as vehicles without a ref are skipped", store.len())
+	}
+
+	// Callers get a copy they can't use to change the store
+	history[0].Latitude = -1
+	if store.history("bus-1")[0].Latitude != 3 {
+		t.Error("changing a returned history changed the store")
+	}
+	if got := store.history("unknown"); got != nil {
+		t.Errorf("history of an unseen vehicle = %v, want nil", got)
+	}
+}
+
+func TestPositionStoreTTLEviction(t *testing.T) {
+	tests := []struct {
+		name     string
+		ttl      time.Duration
+		advance  time.Duration
+		stale    bool
+		tracking int
+	}{
+		{"within ttl", time.Minute, 30 * time.Second, false, 2},
+		{"expired", time.Minute, 2 * time.Minute, true, 1},
+		{"ttl disabled", 0, 24 * time.Hour, false, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, clock := newTestPositionStore(tt.ttl, 0)
+
+			store.record(lineData("49x", 51.5, "stale"))
+			clock.Advance(tt.advance)
+			if got := store.history("stale") == nil; got != tt.stale {
+				t.Errorf("history hidden = %v, want %v", got, tt.stale)
+			}
+
+			// Expired vehicles are dropped on the next record
+			store.record(lineData("49x", 51.5, "fresh"))
+			if got := store.len(); got != tt.tracking {
+				t.Errorf("tracking %d vehicles, want %d", got, tt.tracking)
+			}
+		})
+	}
+}
+
+func TestPositionStoreSizeEviction(t *testing.T) {
+	store, clock := newTestPositionStore(0, 2)
+
+	store.record(lineData("49x", 51.5, "bus-1"))
+	clock.Advance(time.Second)
+	store.record(lineData("49x", 51.5, "bus-2"))
+	clock.Advance(time.Second)
+	store.record(lineData("49x", 51.5, "bus-1"))
+	clock.Advance(time.Second)
+	store.record(lineData("49x", 51.5, "bus-3"))
+
+	if got := store.len(); got != 2 {
+		t.Fatalf("tracking %d vehicles, want 2", got)
+	}
+	// bus-2 is the least recently seen, since bus-1 was seen again
+	for ref, want := range map[string]bool{"bus-1": true, "bus-2": false, "bus-3": true} {
+		if got := store.history(ref) != nil; got != want {
+			t.Errorf("%s tracked = %v, want %v", ref, got, want)
+		}
+	}
+
+	if store := newPositionStore(0, 0); store.maxVehicles != DefaultPositionHistorySize {
+		t.Errorf("maxVehicles = %d, want the default %d", store.maxVehicles, DefaultPositionHistorySize)
+	}
+}
+
+func TestPositionStoreConcurrentAccess(t *testing.T) {
+	store, _ := newTestPositionStore(time.Hour, 50)
+
+	var wg sync.WaitGroup
+	for line := 0; line < 8; line++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				ref := fmt.Sprintf("bus-%d-%d", line, i%10)
+				store.record(lineData(fmt.Sprint(line), float64(i), ref))
+				store.history(ref)
+				store.len()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := store.len(); got > 50 {
+		t.Errorf("tracking %d vehicles, want at most 50", got)
+	}
+}
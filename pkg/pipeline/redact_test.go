@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactWithoutKeyKeepsVehiclesApart(t *testing.T) {
+	threeVehicles := func(line string) []string { return []string{"bus-1", "bus-2", "bus-3"} }
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"keyed", "secret"},
+		{"random process key", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, sink := newTestPipeline(t, Config{
+				RedactFields:       []string{"vehicle_ref"},
+				RedactKey:          tt.key,
+				DedupWindow:        2 * time.Minute,
+				PositionHistoryTTL: time.Hour,
+			}, &fakeFetcher{vehicles: threeVehicles})
+
+			if err := p.RunCycle(context.Background()); err != nil {
+				t.Fatalf("RunCycle: %v", err)
+			}
+
+			// Every vehicle reports the same time and place, so only distinct
+			// redacted refs keep dedup from treating them as one
+			refs := make(map[string]bool)
+			for _, record := range sink.Records() {
+				for _, vehicle := range record.VehicleData {
+					if strings.HasPrefix(vehicle.VehicleRef, "bus-") {
+						t.Errorf("raw VehicleRef %q reached the sink", vehicle.VehicleRef)
+					}
+					refs[vehicle.VehicleRef] = true
+				}
+			}
+			if len(refs) != 3 {
+				t.Errorf("sink received %d distinct vehicle refs, want 3", len(refs))
+			}
+			if got := p.positions.len(); got != 3 {
+				t.Errorf("position history tracks %d vehicles, want 3", got)
+			}
+		})
+	}
+}
+
+func TestRedactExcludesRawPaths(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name   string
+		config Config
+		warn   string
+		raw    func(t *testing.T, sink *MemorySink) string
+	}{
+		{
+			name:   "include raw",
+			config: Config{IncludeRaw: true},
+			warn:   "--include-raw keeps unredacted identifiers",
+			raw: func(t *testing.T, sink *MemorySink) string {
+				encoded, err := json.Marshal(sink.Records()[0].RawData)
+				if err != nil {
+					t.Fatalf("Marshal: %v", err)
+				}
+				return string(encoded)
+			},
+		},
+		{
+			name:   "dump sample",
+			config: Config{DumpSampleDir: dir},
+			warn:   "--dump-sample writes unredacted identifiers",
+			raw: func(t *testing.T, sink *MemorySink) string {
+				files, err := filepath.Glob(filepath.Join(dir, "49x-*.xml"))
+				if err != nil || len(files) != 1 {
+					t.Fatalf("found samples %v (%v), want one", files, err)
+				}
+				dumped, err := os.ReadFile(files[0])
+				if err != nil {
+					t.Fatal(err)
+				}
+				return string(dumped)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLog(t)
+			config := tt.config
+			config.RedactFields = []string{"vehicle_ref"}
+			p, sink := newTestPipeline(t, config, &fakeFetcher{})
+
+			if !strings.Contains(logs.String(), tt.warn) {
+				t.Errorf("log lacks the warning %q: %s", tt.warn, logs.String())
+			}
+			if err := p.RunCycle(context.Background()); err != nil {
+				t.Fatalf("RunCycle: %v", err)
+			}
+
+			// Parsed vehicles are redacted; the documented raw copies are not
+			if ref := sink.Records()[0].VehicleData[0].VehicleRef; ref == "49x-1" {
+				t.Errorf("parsed VehicleRef %q was not redacted", ref)
+			}
+			if raw := tt.raw(t, sink); !strings.Contains(raw, "49x-1") {
+				t.Errorf("raw copy lacks the unredacted VehicleRef: %s", raw)
+			}
+		})
+	}
+}
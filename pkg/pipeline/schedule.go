@@ -0,0 +1,71 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// lineGroup is a set of lines polled together on the same interval
+type lineGroup struct {
+	interval time.Duration
+	lines    []string
+	// adaptive is set for the group polled on the global Interval, the
+	// only one the adaptive idle backoff applies to
+	adaptive bool
+	// running is held while a cycle of this group runs, so a group's cycles
+	// never overlap each other
+	running sync.Mutex
+	// queued records a tick of this group waiting on the running cycle
+	queued atomic.Bool
+}
+
+// lineInterval returns the polling interval of line
+func (p *Pipeline) lineInterval(line string) time.Duration {
+	if interval, ok := p.config.LineIntervals[line]; ok && interval > 0 {
+		return interval
+	}
+	return p.config.Interval
+}
+
+// lineGroups groups the configured lines by their polling interval, in
+// configuration order
+func (p *Pipeline) lineGroups() []*lineGroup {
+	var groups []*lineGroup
+	index := make(map[time.Duration]*lineGroup)
+	for _, line := range p.config.LineRefs {
+		interval := p.lineInterval(line)
+
+		group, ok := index[interval]
+		if !ok {
+			group = &lineGroup{interval: interval, adaptive: interval == p.config.Interval}
+			index[interval] = group
+			groups = append(groups, group)
+		}
+		group.lines = append(group.lines, line)
+	}
+	return groups
+}
+
+// runLineGroup schedules cycles for one group of lines, starting
+// immediately, until ctx is done
+func (p *Pipeline) runLineGroup(ctx context.Context, group *lineGroup, cycles *sync.WaitGroup) {
+	timer := time.NewTimer(p.nextInterval(group))
+	defer timer.Stop()
+
+	p.scheduleCycle(ctx, cycles, group)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			p.scheduleCycle(ctx, cycles, group)
+			timer.Reset(p.nextInterval(group))
+		case <-p.idleReset(group):
+			// Vehicles are back, so don't wait out the idle interval
+			timer.Reset(p.nextInterval(group))
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"bods2loki/pkg/bods"
+)
+
+func TestLineGroups(t *testing.T) {
+	p, _ := newTestPipeline(t, Config{
+		Interval:      time.Minute,
+		LineRefs:      []string{"1", "2", "3", "4"},
+		LineIntervals: map[string]time.Duration{"2": 5 * time.Minute, "4": 5 * time.Minute, "3": time.Minute},
+	}, &fakeFetcher{})
+
+	groups := p.lineGroups()
+	want := []struct {
+		interval time.Duration
+		lines    []string
+		adaptive bool
+	}{
+		{time.Minute, []string{"1", "3"}, true},
+		{5 * time.Minute, []string{"2", "4"}, false},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("got %d groups, want %d", len(groups), len(want))
+	}
+	for i, w := range want {
+		g := groups[i]
+		if g.interval != w.interval || !reflect.DeepEqual(g.lines, w.lines) || g.adaptive != w.adaptive {
+			t.Errorf("group %d = {%v %q %v}, want {%v %q %v}", i, g.interval, g.lines, g.adaptive, w.interval, w.lines, w.adaptive)
+		}
+	}
+}
+
+func TestRunPollsEachLineOnItsOwnInterval(t *testing.T) {
+	fetcher := &fakeFetcher{}
+	p, _ := newTestPipeline(t, Config{
+		Interval:      20 * time.Millisecond,
+		LineRefs:      []string{"fast", "slow"},
+		LineIntervals: map[string]time.Duration{"slow": 200 * time.Millisecond},
+	}, fetcher)
+
+	runFor(t, p, 450*time.Millisecond)
+
+	fast, slow := fetcher.fetchCount("fast"), fetcher.fetchCount("slow")
+	if slow < 2 || slow > 3 {
+		t.Errorf("slow line fetched %d times in 450ms at 200ms, want 2-3", slow)
+	}
+	if fast < 4*slow {
+		t.Errorf("fast line fetched %d times, want far more than the slow line's %d", fast, slow)
+	}
+}
+
+// lineFetcher is a fakeFetcher that holds fetches of its slow line and
+// tracks the peak concurrent fetches of each line
+type lineFetcher struct {
+	fakeFetcher
+	slow      string
+	slowDelay time.Duration
+
+	lineMu sync.Mutex
+	active map[string]int
+	peaks  map[string]int
+}
+
+func (f *lineFetcher) FetchBusData(ctx context.Context, lineRef string) (*bods.BusData, error) {
+	f.lineMu.Lock()
+	if f.active == nil {
+		f.active, f.peaks = make(map[string]int), make(map[string]int)
+	}
+	f.active[lineRef]++
+	f.peaks[lineRef] = max(f.peaks[lineRef], f.active[lineRef])
+	f.lineMu.Unlock()
+
+	defer func() {
+		f.lineMu.Lock()
+		f.active[lineRef]--
+		f.lineMu.Unlock()
+	}()
+
+	if lineRef == f.slow {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(f.slowDelay):
+		}
+	}
+	return f.fakeFetcher.FetchBusData(ctx, lineRef)
+}
+
+func (f *lineFetcher) peak(line string) int {
+	f.lineMu.Lock()
+	defer f.lineMu.Unlock()
+	return f.peaks[line]
+}
+
+func TestRunLineGroupsRunIndependently(t *testing.T) {
+	tests := []struct {
+		name  string
+		queue bool
+	}{
+		{"skipping overlapping ticks", false},
+		{"queueing overlapping ticks", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := &lineFetcher{slow: "slow", slowDelay: 150 * time.Millisecond}
+			p, _ := newTestPipeline(t, Config{
+				Interval:              10 * time.Millisecond,
+				LineRefs:              []string{"fast", "slow"},
+				LineIntervals:         map[string]time.Duration{"slow": 20 * time.Millisecond},
+				QueueOverlappingCycle: tt.queue,
+				CycleTimeout:          time.Second,
+			}, fetcher)
+
+			runFor(t, p, 200*time.Millisecond)
+
+			// The slow group's long cycle doesn't hold up the fast group
+			if got := fetcher.fetchCount("fast"); got < 8 {
+				t.Errorf("fast line fetched %d times in 200ms at 10ms, want at least 8 despite the slow group", got)
+			}
+			if got := fetcher.fetchCount("slow"); got > 2 {
+				t.Errorf("slow line fetched %d times in 200ms of 150ms cycles, want at most 2", got)
+			}
+			// ...but neither group's cycles overlap themselves
+			for _, line := range []string{"fast", "slow"} {
+				if peak := fetcher.peak(line); peak != 1 {
+					t.Errorf("line %s peak concurrent fetches = %d, want 1", line, peak)
+				}
+			}
+		})
+	}
+}
+
+func TestFullCycleExcludesLineGroups(t *testing.T) {
+	fetcher := &lineFetcher{slow: "slow", slowDelay: 100 * time.Millisecond}
+	p, _ := newTestPipeline(t, Config{
+		Interval:      time.Hour,
+		LineRefs:      []string{"fast", "slow"},
+		LineIntervals: map[string]time.Duration{"fast": 10 * time.Millisecond},
+		CycleTimeout:  time.Second,
+	}, fetcher)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Wait for the hourly group's slow cycle to be fetching
+	deadline := time.Now().Add(time.Second)
+	for fetcher.peak("slow") == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := p.TriggerCycle(context.Background()); !errors.Is(err, ErrCycleInProgress) {
+		t.Errorf("TriggerCycle during a line group cycle = %v, want %v", err, ErrCycleInProgress)
+	}
+
+	// RunCycle waits instead, and no group cycle starts while it runs
+	if err := p.RunCycle(context.Background()); err != nil {
+		t.Fatalf("RunCycle: %v", err)
+	}
+	if peak := fetcher.peak("slow"); peak != 1 {
+		t.Errorf("slow line peak concurrent fetches = %d, want 1", peak)
+	}
+	if peak := fetcher.peak("fast"); peak != 1 {
+		t.Errorf("fast line peak concurrent fetches = %d, want 1", peak)
+	}
+}
+
+func TestRunQueuesOverlappingLineGroupCycle(t *testing.T) {
+	logs := captureLog(t)
+	fetcher := &fakeFetcher{delay: 60 * time.Millisecond}
+	p, _ := newTestPipeline(t, Config{
+		Interval:              10 * time.Millisecond,
+		QueueOverlappingCycle: true,
+		CycleTimeout:          time.Second,
+	}, fetcher)
+
+	runFor(t, p, 100*time.Millisecond)
+
+	// Ticks during the first cycle queue one follow-up rather than overlapping it
+	if peak := fetcher.peakActive(); peak != 1 {
+		t.Errorf("peak concurrent fetches = %d, want 1", peak)
+	}
+	if got := fetcher.fetchCount("49x"); got != 2 {
+		t.Errorf("line fetched %d times, want the first cycle and one queued cycle", got)
+	}
+	if !strings.Contains(logs.String(), "queueing the next cycle") {
+		t.Error("no overlapping tick was queued")
+	}
+}
+
+func TestRunSkipsOverlappingTicks(t *testing.T) {
+	logs := captureLog(t)
+	fetcher := &fakeFetcher{delay: 50 * time.Millisecond}
+	p, _ := newTestPipeline(t, Config{Interval: 10 * time.Millisecond, CycleTimeout: time.Second}, fetcher)
+
+	runFor(t, p, 200*time.Millisecond)
+
+	if peak := fetcher.peakActive(); peak != 1 {
+		t.Errorf("peak concurrent fetches = %d, want 1", peak)
+	}
+	// Each slow cycle swallows the ticks that fire while it runs
+	if got := fetcher.fetchCount("49x"); got > 5 {
+		t.Errorf("line fetched %d times in 200ms of 50ms cycles, want at most 5", got)
+	}
+	if skipped := strings.Count(logs.String(), "skipping this tick"); skipped == 0 {
+		t.Error("no overlapping ticks were skipped")
+	}
+	if strings.Contains(logs.String(), "queueing the next cycle") {
+		t.Error("overlapping ticks were queued without QueueOverlappingCycle")
+	}
+}
+
+func TestIntervalJitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		jitter   float64
+	}{
+		{"no jitter", 30 * time.Second, 0},
+		{"ten percent", 30 * time.Second, 0.1},
+		{"fifty percent", 30 * time.Second, 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestPipeline(t, Config{Interval: tt.interval, IntervalJitter: tt.jitter}, &fakeFetcher{})
+			group := &lineGroup{lines: []string{"49x"}, interval: tt.interval}
+
+			lower := time.Duration(float64(tt.interval) * (1 - tt.jitter))
+			upper := time.Duration(float64(tt.interval) * (1 + tt.jitter))
+			periods := make(map[time.Duration]bool)
+			for i := 0; i < 100; i++ {
+				period := p.nextInterval(group)
+				if period < lower || period > upper {
+					t.Fatalf("period %v outside %v-%v", period, lower, upper)
+				}
+				periods[period] = true
+			}
+
+			if varies := len(periods) > 1; varies != (tt.jitter > 0) {
+				t.Errorf("got %d distinct periods from 100 cycles, want them to vary only with jitter", len(periods))
+			}
+		})
+	}
+}
+
+func TestJitterBounds(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		jitter   float64
+		random   float64
+		want     time.Duration
+	}{
+		{"lowest draw", 30 * time.Second, 0.1, 0, 27 * time.Second},
+		{"middle draw", 30 * time.Second, 0.1, 0.5, 30 * time.Second},
+		{"high draw", 30 * time.Second, 0.1, 0.75, 31500 * time.Millisecond},
+		{"no jitter", 30 * time.Second, 0, 0, 30 * time.Second},
+		{"never zero", time.Millisecond, 0.99, 0, minJitteredInterval},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestPipeline(t, Config{IntervalJitter: tt.jitter}, &fakeFetcher{})
+			p.random = func() float64 { return tt.random }
+
+			if got := p.jitter(tt.interval); got != tt.want {
+				t.Errorf("jitter(%v) = %v, want %v", tt.interval, got, tt.want)
+			}
+		})
+	}
+
+	// A seeded source keeps every period within ±10% and repeats exactly
+	periods := func() []time.Duration {
+		p, _ := newTestPipeline(t, Config{IntervalJitter: 0.1}, &fakeFetcher{})
+		p.random = rand.New(rand.NewPCG(1, 2)).Float64
+		var periods []time.Duration
+		for i := 0; i < 1000; i++ {
+			period := p.jitter(30 * time.Second)
+			if period < 27*time.Second || period > 33*time.Second {
+				t.Fatalf("period %v outside 27s-33s", period)
+			}
+			periods = append(periods, period)
+		}
+		return periods
+	}
+	if first, second := periods(), periods(); !reflect.DeepEqual(first, second) {
+		t.Error("the same seed gave different periods")
+	}
+}
+
+func TestStartupDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		jitter float64
+		random float64
+		cancel bool
+		want   bool
+	}{
+		{"no jitter", 0, 0.99, false, true},
+		{"short delay", 0.5, 0.001, false, true},
+		{"cancelled during delay", 0.5, 0.99, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// With a 1m interval, the short delay lasts 30ms and the long one ~30s
+			p, _ := newTestPipeline(t, Config{Interval: time.Minute, IntervalJitter: tt.jitter}, &fakeFetcher{})
+			p.random = func() float64 { return tt.random }
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				time.AfterFunc(20*time.Millisecond, cancel)
+			}
+
+			start := time.Now()
+			if got := p.waitStartupDelay(ctx); got != tt.want {
+				t.Errorf("waitStartupDelay = %v, want %v", got, tt.want)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("waitStartupDelay took %v, want it to return promptly", elapsed)
+			}
+		})
+	}
+}
+
+func TestIntervalJitterValidation(t *testing.T) {
+	for _, jitter := range []float64{-0.1, 1, 1.5} {
+		_, err := New(Config{LineRefs: []string{"49x"}, Interval: time.Minute, IntervalJitter: jitter}, WithFetcher(&fakeFetcher{}), WithSink("memory", NewMemorySink()))
+		if err == nil {
+			t.Errorf("New accepted an interval jitter of %v", jitter)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package pipeline
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// Session tagging modes for Config.SessionTag
+const (
+	SessionTagField = "field"
+	SessionTagLabel = "label"
+)
+
+// newSessionID generates a random (version 4) UUID identifying this process
+func newSessionID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,94 @@
+package pipeline
+
+import (
+	"context"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var uuidV4 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewSessionID(t *testing.T) {
+	first, err := newSessionID()
+	if err != nil {
+		t.Fatalf("newSessionID: %v", err)
+	}
+	second, err := newSessionID()
+	if err != nil {
+		t.Fatalf("newSessionID: %v", err)
+	}
+
+	for _, id := range []string{first, second} {
+		if !uuidV4.MatchString(id) {
+			t.Errorf("session ID %q is not a version 4 UUID", id)
+		}
+	}
+	if first == second {
+		t.Errorf("two session IDs were both %q", first)
+	}
+}
+
+func TestSessionTag(t *testing.T) {
+	tests := []struct {
+		tag   string
+		field bool
+		label bool
+	}{
+		{tag: ""},
+		{tag: SessionTagField, field: true},
+		{tag: SessionTagLabel, field: true, label: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			recorder := &lokiRecorder{}
+			server := httptest.NewServer(recorder)
+			defer server.Close()
+
+			p, err := New(Config{
+				LineRefs:   []string{"49x"},
+				Interval:   time.Hour,
+				LokiURL:    server.URL,
+				SessionTag: tt.tag,
+			}, WithFetcher(&fakeFetcher{}))
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer p.Close()
+
+			// Every cycle of the process carries the same ID
+			for i := 0; i < 2; i++ {
+				if err := p.RunCycle(context.Background()); err != nil {
+					t.Fatalf("RunCycle: %v", err)
+				}
+			}
+
+			id := p.SessionID()
+			if tt.field != (id != "") || (id != "" && !uuidV4.MatchString(id)) {
+				t.Fatalf("SessionID() = %q", id)
+			}
+
+			entries, labels := recorder.entries(t)
+			if len(entries) != 2 {
+				t.Fatalf("Loki received %d entries, want 2", len(entries))
+			}
+			for i, entry := range entries {
+				if got, ok := entry["session_id"]; ok != tt.field || (ok && got != id) {
+					t.Errorf("entry %d session_id = %v (present %v), want %q", i, got, ok, id)
+				}
+				if got, ok := labels[i]["session_id"]; ok != tt.label || (ok && got != id) {
+					t.Errorf("entry %d session_id label = %q (present %v), want %q", i, got, ok, id)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionTagInvalid(t *testing.T) {
+	_, err := New(Config{LineRefs: []string{"49x"}, Interval: time.Hour, SessionTag: "stream"}, WithFetcher(&fakeFetcher{}), WithSink("memory", NewMemorySink()))
+	if err == nil {
+		t.Error("New accepted an unknown session tag mode")
+	}
+}
@@ -0,0 +1,132 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"bods2loki/pkg/metrics"
+	"bods2loki/pkg/types"
+)
+
+// Sink receives each successfully parsed line at the end of a cycle. Sinks
+// that buffer data or hold connections may also implement io.Closer, to be
+// flushed and closed by Pipeline.Close.
+type Sink interface {
+	Send(ctx context.Context, data *types.ParsedBusData) error
+}
+
+// BatchSink is a Sink that can receive every line of a cycle at once, e.g.
+// to send them in a single request
+type BatchSink interface {
+	Sink
+	SendBatch(ctx context.Context, batch []*types.ParsedBusData) error
+}
+
+// SinkFunc adapts a function to the Sink interface
+type SinkFunc func(ctx context.Context, data *types.ParsedBusData) error
+
+// Send calls f(ctx, data)
+func (f SinkFunc) Send(ctx context.Context, data *types.ParsedBusData) error {
+	return f(ctx, data)
+}
+
+// MultiSink fans data out to several sinks concurrently. A failing or slow
+// sink doesn't stop the others receiving the data; all failures are returned
+// together.
+type MultiSink struct {
+	names []string
+	sinks []Sink
+}
+
+// NewMultiSink creates an empty MultiSink
+func NewMultiSink() *MultiSink {
+	return &MultiSink{}
+}
+
+// Add registers a sink under a name used in errors and metrics
+func (m *MultiSink) Add(name string, sink Sink) *MultiSink {
+	m.names = append(m.names, name)
+	m.sinks = append(m.sinks, sink)
+	return m
+}
+
+// Names returns the registered sink names, in the order they were added
+func (m *MultiSink) Names() []string {
+	return append([]string(nil), m.names...)
+}
+
+// Send delivers data to every sink and waits for them all to finish
+func (m *MultiSink) Send(ctx context.Context, data *types.ParsedBusData) error {
+	errs := make([]error, len(m.sinks))
+
+	var wg sync.WaitGroup
+	for i, sink := range m.sinks {
+		wg.Add(1)
+		go func(i int, sink Sink) {
+			defer wg.Done()
+
+			err := sink.Send(ctx, data)
+			metrics.RecordSinkSend(ctx, m.names[i], err == nil)
+			if err != nil {
+				errs[i] = fmt.Errorf("sink %s: %w", m.names[i], err)
+			}
+		}(i, sink)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// SendBatch delivers a cycle's data to every sink and waits for them all to
+// finish. BatchSinks receive it in one call; other sinks get one Send per line.
+func (m *MultiSink) SendBatch(ctx context.Context, batch []*types.ParsedBusData) error {
+	errs := make([]error, len(m.sinks))
+
+	var wg sync.WaitGroup
+	for i, sink := range m.sinks {
+		wg.Add(1)
+		go func(i int, sink Sink) {
+			defer wg.Done()
+
+			var err error
+			if batchSink, ok := sink.(BatchSink); ok {
+				err = batchSink.SendBatch(ctx, batch)
+			} else {
+				var sendErrs []error
+				for _, data := range batch {
+					sendErrs = append(sendErrs, sink.Send(ctx, data))
+				}
+				err = errors.Join(sendErrs...)
+			}
+			metrics.RecordSinkSend(ctx, m.names[i], err == nil)
+			if err != nil {
+				errs[i] = fmt.Errorf("sink %s: %w", m.names[i], err)
+			}
+		}(i, sink)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// Close closes every sink implementing io.Closer, returning all failures together
+func (m *MultiSink) Close() error {
+	var errs []error
+	for i, sink := range m.sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("sink %s: %w", m.names[i], err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// String describes the sinks, e.g. for log messages
+func (m *MultiSink) String() string {
+	return strings.Join(m.names, ", ")
+}
@@ -0,0 +1,151 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"bods2loki/pkg/types"
+)
+
+// fakeSink records what it receives and can fail every send or its Close
+type fakeSink struct {
+	mu       sync.Mutex
+	received []*types.ParsedBusData
+	batches  int
+	err      error
+	closeErr error
+	closed   bool
+}
+
+func (s *fakeSink) Send(ctx context.Context, data *types.ParsedBusData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.received = append(s.received, data)
+	return s.err
+}
+
+func (s *fakeSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	return s.closeErr
+}
+
+// fakeBatchSink is a fakeSink that also accepts whole batches
+type fakeBatchSink struct {
+	fakeSink
+}
+
+func (s *fakeBatchSink) SendBatch(ctx context.Context, batch []*types.ParsedBusData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batches++
+	s.received = append(s.received, batch...)
+	return s.err
+}
+
+func TestPipelineCloseClosesSinks(t *testing.T) {
+	closer := &fakeSink{}
+	failing := &fakeSink{closeErr: errors.New("flush failed")}
+	plain := SinkFunc(func(ctx context.Context, data *types.ParsedBusData) error { return nil })
+
+	p, _ := newTestPipeline(t, Config{}, &fakeFetcher{},
+		WithSink("closer", closer), WithSink("plain", plain), WithSink("failing", failing))
+
+	err := p.Close()
+	if !closer.closed || !failing.closed {
+		t.Errorf("closers were not all closed")
+	}
+	if !errors.Is(err, failing.closeErr) || !strings.Contains(err.Error(), "sink failing") {
+		t.Errorf("Close error = %v, want the failing sink's error", err)
+	}
+}
+
+func TestMultiSinkFanOut(t *testing.T) {
+	sendErr := errors.New("unavailable")
+	tests := []struct {
+		name    string
+		batch   bool
+		failing bool
+	}{
+		{"send", false, false},
+		{"send with failing sink", false, true},
+		{"send batch", true, false},
+		{"send batch with failing sink", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := &fakeSink{}
+			batcher := &fakeBatchSink{}
+			failing := &fakeSink{}
+			if tt.failing {
+				failing.err = sendErr
+			}
+			sink := NewMultiSink().Add("plain", plain).Add("batcher", batcher).Add("failing", failing)
+
+			data := []*types.ParsedBusData{{LineRef: "49x"}, {LineRef: "72"}}
+			var err error
+			if tt.batch {
+				err = sink.SendBatch(context.Background(), data)
+			} else {
+				err = errors.Join(sink.Send(context.Background(), data[0]), sink.Send(context.Background(), data[1]))
+			}
+
+			for name, s := range map[string]*fakeSink{"plain": plain, "batcher": &batcher.fakeSink, "failing": failing} {
+				if len(s.received) != len(data) {
+					t.Errorf("sink %s received %d lines, want %d", name, len(s.received), len(data))
+				}
+			}
+			if want := map[bool]int{true: 1}[tt.batch]; batcher.batches != want {
+				t.Errorf("batch sink got %d batches, want %d", batcher.batches, want)
+			}
+
+			if !tt.failing {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, sendErr) || !strings.Contains(err.Error(), "sink failing") {
+				t.Errorf("error = %v, want the failing sink's error", err)
+			}
+			if strings.Contains(err.Error(), "sink plain") || strings.Contains(err.Error(), "sink batcher") {
+				t.Errorf("error = %v, blames a sink that succeeded", err)
+			}
+		})
+	}
+}
+
+func TestMultiSinkAggregatesErrors(t *testing.T) {
+	first := &fakeSink{err: errors.New("first down")}
+	second := &fakeSink{err: errors.New("second down")}
+	sink := NewMultiSink().Add("first", first).Add("second", second)
+
+	err := sink.Send(context.Background(), &types.ParsedBusData{LineRef: "49x"})
+	if !errors.Is(err, first.err) || !errors.Is(err, second.err) {
+		t.Errorf("error = %v, want both sinks' errors", err)
+	}
+}
+
+func TestRunCycleFansOutToSinks(t *testing.T) {
+	failing := &fakeSink{err: errors.New("unavailable")}
+	p, memory := newTestPipeline(t, Config{LineRefs: []string{"49x", "72"}}, &fakeFetcher{}, WithSink("failing", failing))
+
+	// Send failures are logged; the cycle only fails when every line does
+	if err := p.RunCycle(context.Background()); err != nil {
+		t.Fatalf("RunCycle: %v", err)
+	}
+	if got := len(memory.Records()); got != 2 {
+		t.Errorf("memory sink received %d lines, want 2", got)
+	}
+	if len(failing.received) != 2 {
+		t.Errorf("failing sink received %d lines, want 2", len(failing.received))
+	}
+}
@@ -0,0 +1,150 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"bods2loki/pkg/bods"
+	"bods2loki/pkg/types"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// situationsFetcher is implemented by fetchers that can retrieve the SIRI-SX feed
+type situationsFetcher interface {
+	FetchSituations(ctx context.Context) (*bods.BusData, error)
+}
+
+// situationTracker remembers the version of each situation last sent, so
+// only new or updated situations are pushed each cycle
+type situationTracker struct {
+	mu       sync.Mutex
+	versions map[string]string
+}
+
+// runSituations polls the SIRI-SX feed every Interval, starting immediately,
+// until ctx is done
+func (p *Pipeline) runSituations(ctx context.Context) {
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		p.pollSituations(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollSituations processes the situations feed, bounded like a cycle of the
+// lines polled on Interval
+func (p *Pipeline) pollSituations(ctx context.Context) {
+	timeout := p.config.CycleTimeout
+	if timeout <= 0 {
+		timeout = 2 * p.config.Interval
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	p.processSituations(ctx)
+}
+
+// processSituations fetches the SIRI-SX feed and sends new or updated situations
+func (p *Pipeline) processSituations(ctx context.Context) {
+	// Nothing new is fetched once shutdown has begun
+	if !p.config.EnableSituations || ctx.Err() != nil {
+		return
+	}
+
+	fetcher, ok := p.fetcher.(situationsFetcher)
+	if !ok {
+		return
+	}
+
+	p.situations.mu.Lock()
+	defer p.situations.mu.Unlock()
+
+	ctx, span := p.tracer.Start(ctx, "pipeline.process_situations")
+	defer span.End()
+
+	data, err := fetcher.FetchSituations(ctx)
+	if err != nil {
+		span.RecordError(err)
+		log.Printf("Error fetching situations: %v", err)
+		return
+	}
+
+	situations, err := p.parser.ParseSituations(ctx, data)
+	if err != nil {
+		span.RecordError(err)
+		log.Printf("Error parsing situations: %v", err)
+		return
+	}
+
+	var changed []types.Situation
+	for _, situation := range situations {
+		if p.situations.versions[situation.SituationNumber] != situation.Version || situation.SituationNumber == "" {
+			changed = append(changed, situation)
+		}
+	}
+	span.SetAttributes(
+		attribute.Int("situations_count", len(situations)),
+		attribute.Int("situations_changed", len(changed)),
+	)
+
+	if err := p.sendSituations(ctx, changed); err != nil {
+		span.RecordError(err)
+		log.Printf("Error sending %d situations: %v", len(changed), err)
+		return
+	}
+
+	// Situations that left the feed are forgotten
+	versions := make(map[string]string, len(situations))
+	for _, situation := range situations {
+		versions[situation.SituationNumber] = situation.Version
+	}
+	p.situations.versions = versions
+}
+
+// sendSituations pushes situations to Loki, or prints them in dry run mode
+func (p *Pipeline) sendSituations(ctx context.Context, situations []types.Situation) error {
+	if len(situations) == 0 {
+		return nil
+	}
+
+	if p.config.DryRun && p.config.DryRunFormat == DryRunJSON {
+		return printJSON(situations)
+	}
+	if p.config.DryRun && p.config.DryRunFormat == DryRunJSONLines {
+		for _, situation := range situations {
+			if err := printJSON(situation); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if p.config.DryRun {
+		fmt.Printf("\n=== DRY RUN - %d Disruptions ===\n", len(situations))
+		for _, situation := range situations {
+			situationJSON, err := json.Marshal(situation)
+			if err != nil {
+				return fmt.Errorf("failed to marshal situation JSON for dry run: %w", err)
+			}
+			fmt.Println(string(situationJSON))
+		}
+		fmt.Print("=== END DRY RUN ===\n\n")
+		return nil
+	}
+
+	if p.lokiClient == nil {
+		return nil
+	}
+	return p.lokiClient.SendSituations(ctx, situations)
+}
@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"bods2loki/pkg/bods"
+)
+
+// situationsFakeFetcher is a fakeFetcher that also serves an empty SIRI-SX feed
+type situationsFakeFetcher struct {
+	fakeFetcher
+
+	mu                sync.Mutex
+	situationsFetches int
+}
+
+func (f *situationsFakeFetcher) FetchSituations(ctx context.Context) (*bods.BusData, error) {
+	f.mu.Lock()
+	f.situationsFetches++
+	f.mu.Unlock()
+
+	return &bods.BusData{
+		XMLData:   `<Siri xmlns="http://www.siri.org.uk/siri" version="2.0"><ServiceDelivery><SituationExchangeDelivery/></ServiceDelivery></Siri>`,
+		Timestamp: time.Now(),
+	}, nil
+}
+
+func (f *situationsFakeFetcher) situationsCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.situationsFetches
+}
+
+func TestSituationsPolledOncePerInterval(t *testing.T) {
+	tests := []struct {
+		name          string
+		lineIntervals map[string]time.Duration
+	}{
+		{"one line group", nil},
+		{"several line groups", map[string]time.Duration{"2": 10 * time.Millisecond, "3": 15 * time.Millisecond, "4": time.Hour}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := &situationsFakeFetcher{}
+			p, _ := newTestPipeline(t, Config{
+				Interval:         50 * time.Millisecond,
+				LineRefs:         []string{"1", "2", "3", "4"},
+				LineIntervals:    tt.lineIntervals,
+				EnableSituations: true,
+			}, fetcher)
+
+			runFor(t, p, 220*time.Millisecond)
+
+			// Immediately and then every 50ms, however many groups tick
+			if got := fetcher.situationsCount(); got < 4 || got > 6 {
+				t.Errorf("situations fetched %d times in 220ms at 50ms, want 4-6", got)
+			}
+		})
+	}
+}
+
+func TestSituationsPolledWithFullCycle(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		want    int
+	}{
+		{"enabled", true, 1},
+		{"disabled", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := &situationsFakeFetcher{}
+			p, _ := newTestPipeline(t, Config{EnableSituations: tt.enabled}, fetcher)
+
+			if err := p.RunCycle(context.Background()); err != nil {
+				t.Fatalf("RunCycle: %v", err)
+			}
+			if got := fetcher.situationsCount(); got != tt.want {
+				t.Errorf("situations fetched %d times, want %d", got, tt.want)
+			}
+		})
+	}
+}
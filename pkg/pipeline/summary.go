@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Cycle summary statuses
+const (
+	CycleStatusOK      = "ok"
+	CycleStatusPartial = "partial"
+	CycleStatusFailed  = "failed"
+)
+
+// CycleSummary is the compact per-cycle entry pushed to the service="summary"
+// stream when Config.CycleSummary is set
+type CycleSummary struct {
+	Timestamp      string   `json:"timestamp"`
+	Status         string   `json:"status"`
+	LinesTotal     int      `json:"lines_total"`
+	LinesSucceeded int      `json:"lines_succeeded"`
+	LinesFailed    int      `json:"lines_failed"`
+	FailedLineRefs []string `json:"failed_line_refs,omitempty"`
+	Vehicles       int      `json:"vehicles"`
+	DurationMs     int64    `json:"duration_ms"`
+	MaxFetchMs     int64    `json:"max_fetch_ms"`
+	MaxParseMs     int64    `json:"max_parse_ms"`
+	SendErrors     int      `json:"send_errors"`
+	SessionID      string   `json:"session_id,omitempty"`
+}
+
+// newCycleSummary summarizes a cycle's results and the number of failed sends
+func (p *Pipeline) newCycleSummary(result *ProcessOnceResult, sendErrors int) CycleSummary {
+	summary := CycleSummary{
+		Timestamp:  result.Started.UTC().Format("2006-01-02T15:04:05.000Z"),
+		LinesTotal: len(result.Lines),
+		Vehicles:   result.Vehicles(),
+		DurationMs: time.Since(result.Started).Milliseconds(),
+		SendErrors: sendErrors,
+		SessionID:  p.sessionID,
+	}
+
+	for _, line := range result.Lines {
+		if line.Err != nil {
+			summary.LinesFailed++
+			summary.FailedLineRefs = append(summary.FailedLineRefs, line.LineRef)
+		} else {
+			summary.LinesSucceeded++
+		}
+		summary.MaxFetchMs = max(summary.MaxFetchMs, line.FetchDuration.Milliseconds())
+		summary.MaxParseMs = max(summary.MaxParseMs, line.ParseDuration.Milliseconds())
+	}
+
+	switch {
+	case summary.LinesFailed == 0 && sendErrors == 0:
+		summary.Status = CycleStatusOK
+	case summary.LinesSucceeded == 0:
+		summary.Status = CycleStatusFailed
+	default:
+		summary.Status = CycleStatusPartial
+	}
+
+	return summary
+}
+
+// sendCycleSummary pushes the cycle summary to Loki if enabled
+func (p *Pipeline) sendCycleSummary(ctx context.Context, result *ProcessOnceResult, sendErrors int) {
+	if !p.config.CycleSummary || p.lokiClient == nil {
+		return
+	}
+
+	if err := p.lokiClient.SendSummary(ctx, p.newCycleSummary(result, sendErrors)); err != nil {
+		log.Printf("Error sending cycle summary to Loki: %v", err)
+	}
+}
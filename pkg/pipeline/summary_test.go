@@ -0,0 +1,118 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCycleSummary(t *testing.T) {
+	errUnavailable := errors.New("BODS unavailable")
+
+	tests := []struct {
+		name     string
+		enabled  bool
+		errs     map[string]error
+		status   string
+		failed   []string
+		vehicles float64
+	}{
+		{"disabled", false, nil, "", nil, 0},
+		{"every line succeeds", true, nil, CycleStatusOK, nil, 2},
+		{"one line fails", true, map[string]error{"72": errUnavailable}, CycleStatusPartial, []string{"72"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &lokiRecorder{}
+			server := httptest.NewServer(recorder)
+			defer server.Close()
+
+			p, err := New(Config{
+				LineRefs:     []string{"49x", "72"},
+				Interval:     time.Hour,
+				LokiURL:      server.URL,
+				CycleSummary: tt.enabled,
+			}, WithFetcher(&fakeFetcher{errs: tt.errs}))
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			defer p.Close()
+
+			if err := p.RunCycle(context.Background()); err != nil {
+				t.Fatalf("RunCycle: %v", err)
+			}
+
+			var summaries []map[string]interface{}
+			entries, labels := recorder.entries(t)
+			for i, entry := range entries {
+				if labels[i]["service"] != "summary" {
+					continue
+				}
+				if labels[i]["job"] != "bods2loki" {
+					t.Errorf("summary stream labels = %v, want job=bods2loki", labels[i])
+				}
+				summaries = append(summaries, entry)
+			}
+
+			if !tt.enabled {
+				if len(summaries) != 0 {
+					t.Errorf("pushed %d summaries with the summary disabled", len(summaries))
+				}
+				return
+			}
+			if len(summaries) != 1 {
+				t.Fatalf("pushed %d summaries, want 1", len(summaries))
+			}
+
+			summary := summaries[0]
+			if summary["status"] != tt.status || summary["lines_total"] != float64(2) || summary["vehicles"] != tt.vehicles {
+				t.Errorf("summary = %v, want status %s, 2 lines and %v vehicles", summary, tt.status, tt.vehicles)
+			}
+			var failed []string
+			if refs, ok := summary["failed_line_refs"].([]interface{}); ok {
+				for _, ref := range refs {
+					failed = append(failed, ref.(string))
+				}
+			}
+			if !reflect.DeepEqual(failed, tt.failed) {
+				t.Errorf("failed_line_refs = %v, want %v", failed, tt.failed)
+			}
+			for _, field := range []string{"timestamp", "duration_ms", "max_fetch_ms", "max_parse_ms", "send_errors"} {
+				if _, ok := summary[field]; !ok {
+					t.Errorf("summary is missing %s", field)
+				}
+			}
+		})
+	}
+}
+
+func TestNewCycleSummaryStatus(t *testing.T) {
+	failed := LineResult{LineRef: "72", Err: errors.New("boom")}
+	ok := LineResult{LineRef: "49x"}
+
+	tests := []struct {
+		name       string
+		lines      []LineResult
+		sendErrors int
+		want       string
+	}{
+		{"ok", []LineResult{ok}, 0, CycleStatusOK},
+		{"send errors", []LineResult{ok}, 1, CycleStatusPartial},
+		{"some lines failed", []LineResult{ok, failed}, 0, CycleStatusPartial},
+		{"every line failed", []LineResult{failed}, 0, CycleStatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Pipeline{}
+			summary := p.newCycleSummary(&ProcessOnceResult{Lines: tt.lines, Started: time.Now()}, tt.sendErrors)
+			if summary.Status != tt.want {
+				t.Errorf("Status = %s, want %s", summary.Status, tt.want)
+			}
+		})
+	}
+}
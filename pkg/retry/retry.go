@@ -0,0 +1,136 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy configures how an operation is retried
+type Policy struct {
+	// MaxAttempts is the total number of attempts including the first; values <= 1 disable retries
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry, doubled for each further attempt
+	BaseDelay time.Duration
+	// MaxDelay caps a single backoff delay; zero means no cap
+	MaxDelay time.Duration
+	// Jitter randomises each delay by up to this fraction (0-1) to avoid synchronized retries
+	Jitter float64
+	// Retryable classifies errors; nil retries every error
+	Retryable func(error) bool
+	// OnRetry is called before waiting for each retry, e.g. to record metrics or span events
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+// NoRetry is a policy that makes a single attempt
+var NoRetry = Policy{MaxAttempts: 1}
+
+// RetryAfterError wraps an error with the wait the server asked for,
+// e.g. from a Retry-After header. It overrides the computed backoff.
+type RetryAfterError struct {
+	Err   error
+	After time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// Do calls fn until it succeeds, returns a non-retryable error, the attempts
+// are exhausted, or ctx is done. The last error from fn is returned.
+func Do(ctx context.Context, policy Policy, fn func(ctx context.Context) error) error {
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= maxAttempts || (policy.Retryable != nil && !policy.Retryable(err)) {
+			return err
+		}
+
+		delay := policy.Backoff(attempt)
+		var retryAfter *RetryAfterError
+		if errors.As(err, &retryAfter) && retryAfter.After > 0 {
+			delay = retryAfter.After
+		}
+
+		// Don't start a wait that cannot finish before the deadline
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return fmt.Errorf("retry wait of %v exceeds context deadline: %w", delay, err)
+		}
+
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, err, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+// Backoff returns the delay before retry number attempt (1-based), applying
+// exponential growth, the MaxDelay cap and jitter
+func (p Policy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		delay += delay * jitter * (rand.Float64()*2 - 1)
+	}
+
+	return time.Duration(delay)
+}
+
+// ParseRetryAfter parses a Retry-After header in either delay-seconds or
+// HTTP-date form, returning the wait relative to now
+func ParseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if at, err := http.ParseTime(header); err == nil {
+		wait := at.Sub(now)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,183 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errTransient = errors.New("transient")
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		attempt int
+		want    time.Duration
+	}{
+		{"first retry", Policy{BaseDelay: time.Second}, 1, time.Second},
+		{"doubles", Policy{BaseDelay: time.Second}, 3, 4 * time.Second},
+		{"attempt below one", Policy{BaseDelay: time.Second}, 0, time.Second},
+		{"capped", Policy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}, 4, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Backoff(tt.attempt); got != tt.want {
+				t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoffJitterBounds(t *testing.T) {
+	policy := Policy{BaseDelay: time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if got := policy.Backoff(2); got < time.Second || got > 3*time.Second {
+			t.Fatalf("Backoff(2) = %v, want within 2s ± 50%%", got)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   Policy
+		failures int
+		err      error
+		attempts int
+		wantErr  bool
+	}{
+		{"succeeds first time", Policy{MaxAttempts: 3}, 0, errTransient, 1, false},
+		{"succeeds after retries", Policy{MaxAttempts: 3}, 2, errTransient, 3, false},
+		{"attempts exhausted", Policy{MaxAttempts: 3}, 5, errTransient, 3, true},
+		{"no retry", NoRetry, 5, errTransient, 1, true},
+		{"not retryable", Policy{MaxAttempts: 3, Retryable: func(err error) bool { return !errors.Is(err, errTransient) }}, 5, errTransient, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var retries []int
+			tt.policy.BaseDelay = time.Millisecond
+			tt.policy.OnRetry = func(attempt int, err error, delay time.Duration) {
+				retries = append(retries, attempt)
+			}
+
+			attempts := 0
+			err := Do(context.Background(), tt.policy, func(ctx context.Context) error {
+				attempts++
+				if attempts <= tt.failures {
+					return tt.err
+				}
+				return nil
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Do error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Do error = %v, want the last error from fn", err)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("got %d attempts, want %d", attempts, tt.attempts)
+			}
+			if len(retries) != tt.attempts-1 {
+				t.Errorf("OnRetry called for %v, want %d retries", retries, tt.attempts-1)
+			}
+		})
+	}
+}
+
+func TestDoContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := Policy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Hour,
+		OnRetry:     func(int, error, time.Duration) { cancel() },
+	}
+
+	attempts := 0
+	start := time.Now()
+	err := Do(ctx, policy, func(ctx context.Context) error {
+		attempts++
+		return errTransient
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Do error = %v, want context.Canceled", err)
+	}
+	if attempts != 1 {
+		t.Errorf("got %d attempts, want 1", attempts)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Do returned after %v, want it to stop waiting on cancel", elapsed)
+	}
+}
+
+func TestDoDeadlineShorterThanDelay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	attempts := 0
+	err := Do(ctx, Policy{MaxAttempts: 3, BaseDelay: time.Minute}, func(ctx context.Context) error {
+		attempts++
+		return errTransient
+	})
+
+	if !errors.Is(err, errTransient) || attempts != 1 {
+		t.Errorf("Do = %v after %d attempts, want errTransient after 1", err, attempts)
+	}
+}
+
+func TestDoHonoursRetryAfter(t *testing.T) {
+	var delays []time.Duration
+	policy := Policy{
+		MaxAttempts: 2,
+		BaseDelay:   time.Hour,
+		OnRetry:     func(attempt int, err error, delay time.Duration) { delays = append(delays, delay) },
+	}
+
+	attempts := 0
+	err := Do(context.Background(), policy, func(ctx context.Context) error {
+		attempts++
+		if attempts == 1 {
+			return &RetryAfterError{Err: errTransient, After: 5 * time.Millisecond}
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if len(delays) != 1 || delays[0] != 5*time.Millisecond {
+		t.Errorf("retry delays = %v, want [5ms] from Retry-After", delays)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 10, 9, 15, 37, 40, 0, time.UTC)
+
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{" 0 ", 0, true},
+		{"Thu, 09 Oct 2025 15:38:10 GMT", 30 * time.Second, true},
+		{"Thu, 09 Oct 2025 15:37:00 GMT", 0, true},
+		{"", 0, false},
+		{"-5", 0, false},
+		{"soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, ok := ParseRetryAfter(tt.header, now)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("ParseRetryAfter(%q) = %v, %v; want %v, %v", tt.header, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
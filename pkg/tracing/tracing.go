@@ -2,6 +2,7 @@ package tracing
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/url"
 	"os"
@@ -9,13 +10,25 @@ import (
 	"strings"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
+// tracerProvider is kept so spans can be flushed on demand
+var tracerProvider *trace.TracerProvider
+
+// StrictEndpointScheme makes InitTracing fail on a scheme-less OTLP endpoint,
+// or an insecure setting contradicting its scheme, instead of warning
+var StrictEndpointScheme bool
+
+// protocolHTTPProtobuf is the only OTLP protocol the trace exporter speaks
+const protocolHTTPProtobuf = "http/protobuf"
+
 func InitTracing() (func(), error) {
 	// Check if tracing is enabled
 	if enabled := getEnv("OTEL_TRACING_ENABLED", "false"); !isTrue(enabled) {
@@ -24,7 +37,12 @@ func InitTracing() (func(), error) {
 	}
 
 	// Get parsed OTLP endpoint configuration
-	endpointConfig := parseOTLPEndpoint()
+	endpointConfig, err := parseOTLPEndpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	protocol := exporterProtocol()
 
 	// Parse headers if provided
 	headers := parseHeaders(getEnv("OTEL_EXPORTER_OTLP_TRACES_HEADERS", ""))
@@ -42,6 +60,12 @@ func InitTracing() (func(), error) {
 	// Determine insecure mode: explicit env var takes precedence, else use parsed scheme
 	insecureEnv := getEnv("OTEL_EXPORTER_OTLP_TRACES_INSECURE", "")
 	if insecureEnv != "" {
+		if isTrue(insecureEnv) != endpointConfig.Insecure {
+			if StrictEndpointScheme {
+				return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_TRACES_INSECURE=%s conflicts with the OTLP endpoint scheme", insecureEnv)
+			}
+			log.Printf("Warning: OTEL_EXPORTER_OTLP_TRACES_INSECURE=%s overrides the OTLP endpoint scheme", insecureEnv)
+		}
 		if isTrue(insecureEnv) {
 			opts = append(opts, otlptracehttp.WithInsecure())
 		}
@@ -77,7 +101,10 @@ func InitTracing() (func(), error) {
 			// Telemetry SDK information
 			semconv.TelemetrySDKName("opentelemetry"),
 			semconv.TelemetrySDKLanguageGo,
-			semconv.TelemetrySDKVersion("1.21.0"),
+			semconv.TelemetrySDKVersion(sdk.Version()),
+
+			// Effective export protocol, which may differ from the one requested
+			attribute.String("otel.exporter.otlp.protocol", protocol),
 		),
 	)
 	if err != nil {
@@ -92,6 +119,7 @@ func InitTracing() (func(), error) {
 
 	// Set global trace provider
 	otel.SetTracerProvider(tp)
+	tracerProvider = tp
 	otel.SetTextMapPropagator(propagation.TraceContext{})
 
 	return func() {
@@ -101,6 +129,14 @@ func InitTracing() (func(), error) {
 	}, nil
 }
 
+// ForceFlush exports all buffered spans immediately. It is a no-op when tracing is disabled.
+func ForceFlush(ctx context.Context) error {
+	if tracerProvider == nil {
+		return nil
+	}
+	return tracerProvider.ForceFlush(ctx)
+}
+
 // getEnv returns the value of an environment variable or a default value if not set
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -115,6 +151,18 @@ func isTrue(s string) bool {
 	return s == "true" || s == "1" || s == "yes" || s == "on"
 }
 
+// exporterProtocol returns the OTLP protocol traces are exported with. The
+// otlptracehttp exporter only encodes protobuf, so a requested http/json or
+// grpc protocol falls back to http/protobuf with a warning rather than silently.
+func exporterProtocol() string {
+	requested := getEnv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", getEnv("OTEL_EXPORTER_OTLP_PROTOCOL", protocolHTTPProtobuf))
+	requested = strings.ToLower(strings.TrimSpace(requested))
+	if requested != protocolHTTPProtobuf {
+		log.Printf("Warning: OTLP protocol %q is not supported for traces, exporting with %s", requested, protocolHTTPProtobuf)
+	}
+	return protocolHTTPProtobuf
+}
+
 // otlpEndpointConfig holds parsed OTLP endpoint configuration
 type otlpEndpointConfig struct {
 	Host     string // host:port for WithEndpoint()
@@ -124,7 +172,7 @@ type otlpEndpointConfig struct {
 
 // parseOTLPEndpoint parses the OTLP endpoint from environment variables
 // and extracts host, path, and scheme information for proper configuration.
-func parseOTLPEndpoint() otlpEndpointConfig {
+func parseOTLPEndpoint() (otlpEndpointConfig, error) {
 	endpoint := getEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
 	appendTracesPath := false
 
@@ -138,11 +186,15 @@ func parseOTLPEndpoint() otlpEndpointConfig {
 			Host:     "localhost:4318",
 			Path:     "",
 			Insecure: true,
-		}
+		}, nil
 	}
 
 	// Add default scheme if missing (default to https for security)
 	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		if StrictEndpointScheme {
+			return otlpEndpointConfig{}, fmt.Errorf("OTLP endpoint %q has no http:// or https:// scheme", endpoint)
+		}
+		log.Printf("Warning: OTLP endpoint %q has no scheme, assuming https://", endpoint)
 		endpoint = "https://" + endpoint
 	}
 
@@ -150,7 +202,7 @@ func parseOTLPEndpoint() otlpEndpointConfig {
 	if err != nil {
 		// Fallback to treating as host:port
 		log.Printf("Failed to parse OTLP endpoint URL, using as-is: %v", err)
-		return otlpEndpointConfig{Host: endpoint, Insecure: true}
+		return otlpEndpointConfig{Host: endpoint, Insecure: true}, nil
 	}
 
 	path := u.Path
@@ -166,7 +218,7 @@ func parseOTLPEndpoint() otlpEndpointConfig {
 		Host:     u.Host,
 		Path:     path,
 		Insecure: u.Scheme == "http",
-	}
+	}, nil
 }
 
 // parseHeaders parses header string in format "key1=value1,key2=value2"
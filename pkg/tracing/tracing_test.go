@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureLog redirects the standard logger into the returned buffer for the
+// rest of the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestParseOTLPEndpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		traces   string
+		strict   bool
+		want     otlpEndpointConfig
+		wantWarn bool
+		wantErr  bool
+	}{
+		{name: "default", want: otlpEndpointConfig{Host: "localhost:4318", Insecure: true}},
+		{name: "http endpoint", endpoint: "http://collector:4318", want: otlpEndpointConfig{Host: "collector:4318", Path: "/v1/traces", Insecure: true}},
+		{name: "https endpoint with path", endpoint: "https://otlp.example.com/otlp", want: otlpEndpointConfig{Host: "otlp.example.com", Path: "/otlp/v1/traces"}},
+		{name: "traces endpoint used as-is", traces: "http://collector:4318/custom", want: otlpEndpointConfig{Host: "collector:4318", Path: "/custom", Insecure: true}},
+		{name: "scheme-less endpoint warns", endpoint: "collector:4318", want: otlpEndpointConfig{Host: "collector:4318", Path: "/v1/traces"}, wantWarn: true},
+		{name: "scheme-less traces endpoint warns", traces: "collector:4318/v1/traces", want: otlpEndpointConfig{Host: "collector:4318", Path: "/v1/traces"}, wantWarn: true},
+		{name: "strict scheme-less endpoint", endpoint: "collector:4318", strict: true, wantErr: true},
+		{name: "strict with scheme", endpoint: "http://collector:4318", strict: true, want: otlpEndpointConfig{Host: "collector:4318", Path: "/v1/traces", Insecure: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", tt.endpoint)
+			t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", tt.traces)
+			StrictEndpointScheme = tt.strict
+			t.Cleanup(func() { StrictEndpointScheme = false })
+			logs := captureLog(t)
+
+			got, err := parseOTLPEndpoint()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseOTLPEndpoint error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseOTLPEndpoint() = %+v, want %+v", got, tt.want)
+			}
+			if warned := strings.Contains(logs.String(), "has no scheme"); warned != tt.wantWarn {
+				t.Errorf("scheme warning logged = %v, want %v; log: %q", warned, tt.wantWarn, logs.String())
+			}
+		})
+	}
+}
+
+func TestExporterProtocol(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+		traces   string
+		wantWarn bool
+	}{
+		{name: "default"},
+		{name: "http/protobuf", protocol: "http/protobuf"},
+		{name: "grpc falls back", protocol: "grpc", wantWarn: true},
+		{name: "http/json falls back", protocol: "http/json", wantWarn: true},
+		{name: "traces protocol overrides general", protocol: "grpc", traces: "http/protobuf"},
+		{name: "unsupported traces protocol", protocol: "http/protobuf", traces: "grpc", wantWarn: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", tt.protocol)
+			t.Setenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", tt.traces)
+			logs := captureLog(t)
+
+			if got := exporterProtocol(); got != protocolHTTPProtobuf {
+				t.Errorf("exporterProtocol() = %q, want %q", got, protocolHTTPProtobuf)
+			}
+			if warned := strings.Contains(logs.String(), "is not supported for traces"); warned != tt.wantWarn {
+				t.Errorf("protocol warning logged = %v, want %v; log: %q", warned, tt.wantWarn, logs.String())
+			}
+		})
+	}
+}
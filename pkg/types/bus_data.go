@@ -1,10 +1,12 @@
 package types
 
 type ParsedBusData struct {
-	LineRef     string                 `json:"line_ref"`
-	Timestamp   string                 `json:"timestamp"`
-	VehicleData []VehicleActivity      `json:"vehicle_activities"`
-	RawData     map[string]interface{} `json:"raw_data,omitempty"`
+	LineRef           string                 `json:"line_ref"`
+	Timestamp         string                 `json:"timestamp"`
+	ResponseTimestamp string                 `json:"response_timestamp,omitempty"`
+	SnapshotID        string                 `json:"snapshot_id,omitempty"`
+	VehicleData       []VehicleActivity      `json:"vehicle_activities"`
+	RawData           map[string]interface{} `json:"raw_data,omitempty"`
 }
 
 type VehicleActivity struct {
@@ -12,15 +14,103 @@ type VehicleActivity struct {
 	LineRef                     string  `json:"line_ref"`
 	DirectionRef                string  `json:"direction_ref"`
 	OperatorRef                 string  `json:"operator_ref"`
+	BlockRef                    string  `json:"block_ref,omitempty"`
+	DatedVehicleJourneyRef      string  `json:"dated_vehicle_journey_ref,omitempty"`
+	DataFrameRef                string  `json:"data_frame_ref,omitempty"`
 	OriginRef                   string  `json:"origin_ref"`
 	OriginName                  string  `json:"origin_name"`
 	DestinationRef              string  `json:"destination_ref"`
 	DestinationName             string  `json:"destination_name"`
+	DestinationDisplay          string  `json:"destination_display,omitempty"`
 	OriginAimedDepartureTime    string  `json:"origin_aimed_departure_time"`
 	DestinationAimedArrivalTime string  `json:"destination_aimed_arrival_time"`
 	Longitude                   float64 `json:"longitude"`
 	Latitude                    float64 `json:"latitude"`
+	Bearing                     float64 `json:"bearing,omitempty"`
+	Velocity                    float64 `json:"velocity,omitempty"`
 	RecordedAtTime              string  `json:"recorded_at_time"`
 	ValidUntilTime              string  `json:"valid_until_time"`
-	BusImage                    string  `json:"bus_image"`
+	BusImage                    string  `json:"bus_image,omitempty"`
+
+	// Via lists the places shown on the bus as it goes via, e.g. "Town Centre"
+	Via []string `json:"via,omitempty"`
+
+	// CompassDirection is the bearing as one of eight compass points (N, NE, ...)
+	CompassDirection string `json:"compass_direction,omitempty"`
+	// LocationValid is false for out-of-range, 0,0 or out-of-bounds positions
+	LocationValid bool `json:"location_valid"`
+	// SpeedMPH and SpeedKPH are Velocity (m/s) converted and rounded to one decimal place
+	SpeedMPH float64 `json:"speed_mph,omitempty"`
+	SpeedKPH float64 `json:"speed_kph,omitempty"`
+
+	// MonitoredCall is the stop the vehicle is currently at or approaching
+	MonitoredCall *StopCall `json:"monitored_call,omitempty"`
+	// OnwardCalls are the predicted calls at the stops after MonitoredCall
+	OnwardCalls []StopCall `json:"onward_calls,omitempty"`
+	// IsLate and DelayBucket are derived from the MonitoredCall delay and
+	// are nil/empty when the delay is unknown
+	IsLate      *bool  `json:"is_late,omitempty"`
+	DelayBucket string `json:"delay_bucket,omitempty"`
+	// DelaySeconds is the MonitoredCall expected minus aimed arrival time,
+	// or departure time when arrival times are missing: positive when late,
+	// negative when early, zero when unknown
+	DelaySeconds int `json:"delay_seconds,omitempty"`
+
+	// Monitored is false when the position comes from the schedule rather than
+	// real-time tracking; Monitored, InCongestion and InPanic are nil when not
+	// reported
+	Monitored    *bool `json:"monitored,omitempty"`
+	InCongestion *bool `json:"in_congestion,omitempty"`
+	InPanic      *bool `json:"in_panic,omitempty"`
+	// VehicleStatus is the operator's status for the vehicle, e.g. "inProgress"
+	VehicleStatus string `json:"vehicle_status,omitempty"`
+
+	// DataQuality is a 0-100 score combining the monitored flag, coordinate
+	// validity, feed lag and timestamp freshness
+	DataQuality int `json:"data_quality"`
+
+	// HasBearing and HasVelocity record whether the feed actually provided
+	// the value, so a genuine 0 can be told apart from a missing field
+	HasBearing  bool `json:"-"`
+	HasVelocity bool `json:"-"`
+}
+
+// StopCall holds the timing information for a call at a stop, as found in
+// SIRI MonitoredCall and OnwardCall elements
+type StopCall struct {
+	StopPointRef          string `json:"stop_point_ref,omitempty"`
+	StopPointName         string `json:"stop_point_name,omitempty"`
+	VisitNumber           int    `json:"visit_number,omitempty"`
+	AimedArrivalTime      string `json:"aimed_arrival_time,omitempty"`
+	ExpectedArrivalTime   string `json:"expected_arrival_time,omitempty"`
+	AimedDepartureTime    string `json:"aimed_departure_time,omitempty"`
+	ExpectedDepartureTime string `json:"expected_departure_time,omitempty"`
+
+	// Original times, set only when normalization to RFC3339 UTC changed them
+	AimedArrivalTimeRaw      string `json:"aimed_arrival_time_raw,omitempty"`
+	ExpectedArrivalTimeRaw   string `json:"expected_arrival_time_raw,omitempty"`
+	AimedDepartureTimeRaw    string `json:"aimed_departure_time_raw,omitempty"`
+	ExpectedDepartureTimeRaw string `json:"expected_departure_time_raw,omitempty"`
+}
+
+// Situation is a service disruption from a SIRI-SX PtSituationElement
+type Situation struct {
+	SituationNumber string           `json:"situation_number"`
+	Version         string           `json:"version,omitempty"`
+	CreationTime    string           `json:"creation_time,omitempty"`
+	ParticipantRef  string           `json:"participant_ref,omitempty"`
+	Progress        string           `json:"progress,omitempty"`
+	Planned         *bool            `json:"planned,omitempty"`
+	Reason          string           `json:"reason,omitempty"`
+	Summary         string           `json:"summary,omitempty"`
+	Description     string           `json:"description,omitempty"`
+	ValidityPeriods []ValidityPeriod `json:"validity_periods,omitempty"`
+	// AffectedLines are the LineRefs of every line the situation affects
+	AffectedLines []string `json:"affected_lines,omitempty"`
+}
+
+// ValidityPeriod is when a situation applies; EndTime is empty when open-ended
+type ValidityPeriod struct {
+	StartTime string `json:"start_time,omitempty"`
+	EndTime   string `json:"end_time,omitempty"`
 }
@@ -0,0 +1,10 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+)
+
+// notifyDiagnostics is a no-op on Windows, which has no SIGUSR1
+func notifyDiagnostics(c chan<- os.Signal) {}